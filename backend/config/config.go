@@ -0,0 +1,186 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+)
+
+// DefaultReservationSweepInterval is how often expired reservations are released when no interval is configured.
+const DefaultReservationSweepInterval = time.Minute
+
+// DefaultDeletedCarPurgeInterval is how often deleted cars past their retention period are purged when no interval is configured.
+const DefaultDeletedCarPurgeInterval = time.Hour
+
+// Constants for the stores car images can be kept in
+const (
+	ImageStoreGridFS = "gridfs" // GridFS in the car database
+	ImageStoreDisk   = "disk"   // A directory of the local filesystem
+	ImageStoreS3     = "s3"     // A bucket of an S3-compatible object store
+)
+
+// DefaultImageDir is the directory the disk image store keeps images in when no directory is configured.
+const DefaultImageDir = "images"
+
+// MinJWTSecretLength is the shortest accepted key for signing tokens, in bytes, matching the output of HMAC-SHA256.
+const MinJWTSecretLength = 32
+
+// Config holds the settings of the backend that are read from environment variables.
+type Config struct {
+	ReservationHoldPeriod    time.Duration // RESERVATION_HOLD_PERIOD: how long a new reservation holds a car
+	ReservationSweepInterval time.Duration // RESERVATION_SWEEP_INTERVAL: how often expired reservations are released
+	MaxImageSize             int64         // MAX_IMAGE_SIZE: largest accepted image upload, in bytes
+	ImageStore               string        // IMAGE_STORE: where car images are kept, one of gridfs, disk and s3
+	ImageDir                 string        // IMAGE_DIR: directory the disk image store keeps images in
+	S3Endpoint               string        // S3_ENDPOINT: host and port of the S3-compatible object store
+	S3Bucket                 string        // S3_BUCKET: bucket the S3 image store keeps images in
+	S3Region                 string        // S3_REGION: region of the bucket
+	S3AccessKeyID            string        // S3_ACCESS_KEY_ID: access key of the object store
+	S3SecretAccessKey        string        // S3_SECRET_ACCESS_KEY: secret key of the object store
+	S3UseSSL                 bool          // S3_USE_SSL: whether the object store is reached through HTTPS
+	ImageCheckInterval       time.Duration // IMAGE_CHECK_INTERVAL: how often the consistency of car images is checked
+	ImageCheckRepair         bool          // IMAGE_CHECK_REPAIR: whether the periodic image check repairs the problems it finds
+	DeletedCarRetention      time.Duration // DELETED_CAR_RETENTION: how long a deleted car can be restored before it is purged
+	DeletedCarPurgeInterval  time.Duration // DELETED_CAR_PURGE_INTERVAL: how often deleted cars past their retention are purged
+	JWTSecret                string        // JWT_SECRET: key access and refresh tokens are signed with
+	AccessTokenLifetime      time.Duration // ACCESS_TOKEN_LIFETIME: how long an access token is valid
+	RefreshTokenLifetime     time.Duration // REFRESH_TOKEN_LIFETIME: how long a refresh token is valid
+	AdminUsername            string        // ADMIN_USERNAME: name of the account created when no account exists
+	AdminPassword            string        // ADMIN_PASSWORD: password of the account created when no account exists
+}
+
+// Load reads the configuration from environment variables, falling back to the defaults for unset variables.
+// Returns the configuration and an error if a variable is set to an invalid value.
+func Load() (Config, error) {
+	var cfg Config
+	var err error
+
+	if cfg.ReservationHoldPeriod, err = durationFromEnv("RESERVATION_HOLD_PERIOD", models.DefaultReservationHoldPeriod); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReservationSweepInterval, err = durationFromEnv("RESERVATION_SWEEP_INTERVAL", DefaultReservationSweepInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxImageSize, err = sizeFromEnv("MAX_IMAGE_SIZE", models.DefaultMaxImageSize); err != nil {
+		return Config{}, err
+	}
+	if err := loadImageStore(&cfg); err != nil {
+		return Config{}, err
+	}
+	if cfg.ImageCheckInterval, err = durationFromEnv("IMAGE_CHECK_INTERVAL", models.DefaultImageCheckInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.ImageCheckRepair, err = boolFromEnv("IMAGE_CHECK_REPAIR", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.DeletedCarRetention, err = durationFromEnv("DELETED_CAR_RETENTION", models.DefaultDeletedCarRetention); err != nil {
+		return Config{}, err
+	}
+	if cfg.DeletedCarPurgeInterval, err = durationFromEnv("DELETED_CAR_PURGE_INTERVAL", DefaultDeletedCarPurgeInterval); err != nil {
+		return Config{}, err
+	}
+	if err := loadAuth(&cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// loadAuth reads the settings of user accounts and their tokens, checking that a key for signing tokens is set.
+func loadAuth(cfg *Config) error {
+	cfg.JWTSecret = os.Getenv("JWT_SECRET")
+	if len(cfg.JWTSecret) < MinJWTSecretLength {
+		return fmt.Errorf("JWT_SECRET must be set to a random key of at least %d bytes", MinJWTSecretLength)
+	}
+
+	var err error
+	if cfg.AccessTokenLifetime, err = durationFromEnv("ACCESS_TOKEN_LIFETIME", models.DefaultAccessTokenLifetime); err != nil {
+		return err
+	}
+	if cfg.RefreshTokenLifetime, err = durationFromEnv("REFRESH_TOKEN_LIFETIME", models.DefaultRefreshTokenLifetime); err != nil {
+		return err
+	}
+
+	cfg.AdminUsername = os.Getenv("ADMIN_USERNAME")
+	cfg.AdminPassword = os.Getenv("ADMIN_PASSWORD")
+	if (cfg.AdminUsername == "") != (cfg.AdminPassword == "") {
+		return fmt.Errorf("ADMIN_USERNAME and ADMIN_PASSWORD must be set together")
+	}
+	return nil
+}
+
+// loadImageStore reads the settings of the store car images are kept in, checking that the settings the store needs are set.
+func loadImageStore(cfg *Config) error {
+	cfg.ImageStore = stringFromEnv("IMAGE_STORE", ImageStoreGridFS)
+	cfg.ImageDir = stringFromEnv("IMAGE_DIR", DefaultImageDir)
+	cfg.S3Endpoint = os.Getenv("S3_ENDPOINT")
+	cfg.S3Bucket = os.Getenv("S3_BUCKET")
+	cfg.S3Region = os.Getenv("S3_REGION")
+	cfg.S3AccessKeyID = os.Getenv("S3_ACCESS_KEY_ID")
+	cfg.S3SecretAccessKey = os.Getenv("S3_SECRET_ACCESS_KEY")
+
+	var err error
+	if cfg.S3UseSSL, err = boolFromEnv("S3_USE_SSL", true); err != nil {
+		return err
+	}
+
+	switch cfg.ImageStore {
+	case ImageStoreGridFS, ImageStoreDisk:
+		return nil
+	case ImageStoreS3:
+		if cfg.S3Endpoint == "" || cfg.S3Bucket == "" {
+			return fmt.Errorf("S3_ENDPOINT and S3_BUCKET must be set when IMAGE_STORE is %s", ImageStoreS3)
+		}
+		return nil
+	}
+	return fmt.Errorf("IMAGE_STORE must be one of %s, %s and %s, got '%s'", ImageStoreGridFS, ImageStoreDisk, ImageStoreS3, cfg.ImageStore)
+}
+
+// stringFromEnv returns the value of the environment variable with the given name, or the fallback when it is not set.
+func stringFromEnv(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// boolFromEnv parses a boolean such as "true" or "false" from the environment variable with the given name.
+func boolFromEnv(name string, fallback bool) (bool, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false, got '%s'", name, value)
+	}
+	return parsed, nil
+}
+
+// sizeFromEnv parses a positive number of bytes such as "10485760" from the environment variable with the given name.
+func sizeFromEnv(name string, fallback int64) (int64, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("%s must be a positive number of bytes such as 10485760, got '%s'", name, value)
+	}
+	return size, nil
+}
+
+// durationFromEnv parses a positive duration such as "72h" from the environment variable with the given name.
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration such as 72h, got '%s'", name, value)
+	}
+	return duration, nil
+}
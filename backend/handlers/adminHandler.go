@@ -0,0 +1,25 @@
+package handlers
+
+import "net/http"
+
+// CheckImages reports the stored images no car refers to and the images cars refer to that are not stored,
+// without changing anything, and returns the report in JSON format.
+func CheckImages(w http.ResponseWriter, r *http.Request) {
+	report, err := carService.CheckImages(false)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, report)
+}
+
+// RepairImages deletes the stored images no car refers to and removes the images that are not stored from the galleries
+// of their cars, and returns the report of what was found and repaired in JSON format.
+func RepairImages(w http.ResponseWriter, r *http.Request) {
+	report, err := carServiceFor(r).CheckImages(true)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, report)
+}
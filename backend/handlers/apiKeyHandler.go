@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// GetAPIKeys retrieves every API key, including revoked ones, newest first, and returns them in JSON format.
+// The keys themselves are left out.
+func GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := authService.GetAPIKeys()
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, keys)
+}
+
+// CreateAPIKey handles the creation of a new API key on behalf of the calling user. The response is the only time
+// the key itself is returned.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var request models.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid API key data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the API key request struct
+	if err := validate.Struct(request); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	var createdBy string
+	if principal, ok := principalFromRequest(r); ok {
+		createdBy = principal.Username
+	}
+	key, err := authService.CreateAPIKey(request, createdBy)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, key)
+}
+
+// RevokeAPIKey revokes an API key, so that requests made with it are rejected from now on.
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := authService.RevokeAPIKey(id); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var auditService services.IauditService
+
+// SetAuditService sets the auditService variable for testing purposes
+func SetAuditService(service services.IauditService) {
+	auditService = service
+}
+
+// InitAuditHandler initializes the audit handler with the given audit service
+func InitAuditHandler(service services.IauditService) {
+	auditService = service
+}
+
+// RequestIDHeader is the header carrying the ID of a request, which the changes made in the request are recorded with.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the length of the longest request ID accepted from a client.
+const maxRequestIDLength = 100
+
+// requestIDContextKey is the key of the request ID in the context of a request.
+type requestIDContextKey struct{}
+
+// AssignRequestID is middleware that gives every request an ID, which is returned in the X-Request-ID header and
+// recorded with the changes made in the request. An X-Request-ID sent by the client is kept when it is at most
+// 100 printable characters, so that requests can be traced across services; otherwise a random ID is generated.
+func AssignRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, requestID)))
+	})
+}
+
+// isValidRequestID reports whether a request ID sent by a client can be kept.
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range requestID {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Printf("Error generating request ID: %v", err)
+		return primitive.NewObjectID().Hex()
+	}
+	return hex.EncodeToString(id)
+}
+
+// actorFromRequest returns who is making a request, as recorded in the audit log: the user or API key Authenticate
+// found for it, or an anonymous caller, together with the ID AssignRequestID gave the request.
+func actorFromRequest(r *http.Request) models.Actor {
+	actor := models.Actor{Kind: models.ActorKindAnonymous}
+	if principal, ok := principalFromRequest(r); ok {
+		actor.Name, actor.Kind = principal.Username, models.ActorKindUser
+		if principal.IsAPIKey() {
+			actor.Kind = models.ActorKindAPIKey
+		}
+	}
+	actor.RequestID, _ = r.Context().Value(requestIDContextKey{}).(string)
+	return actor
+}
+
+// carServiceFor returns the car service recording the changes made in a request as made by its caller.
+func carServiceFor(r *http.Request) services.IcarService {
+	return carService.WithActor(actorFromRequest(r))
+}
+
+// customerServiceFor returns the customer service recording the changes made in a request as made by its caller.
+func customerServiceFor(r *http.Request) services.IcustomerService {
+	return customerService.WithActor(actorFromRequest(r))
+}
+
+// paymentServiceFor returns the payment service recording the payments taken in a request as taken by its caller.
+func paymentServiceFor(r *http.Request) services.IpaymentService {
+	return paymentService.WithActor(actorFromRequest(r))
+}
+
+// GetAuditEntries retrieves a page of the audit log, newest first, and returns it in JSON format.
+// Supported parameters are carId or customerId, actor, from and to (RFC 3339 times, to being exclusive),
+// plus limit, cursor and includeTotal.
+func GetAuditEntries(w http.ResponseWriter, r *http.Request) {
+	query, parseErrors := parseAuditQuery(r.URL.Query())
+	page := parsePageRequest(r.URL.Query(), parseErrors)
+	if len(parseErrors) > 0 {
+		writeJSONResponse(w, http.StatusBadRequest, parseErrors)
+		return
+	}
+
+	// Validate the page request struct
+	if err := validate.Struct(page); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	entries, err := auditService.GetAuditEntries(query, page)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, entries)
+}
+
+// parseAuditQuery converts the query parameters of an audit log listing into an audit query.
+// Returns the query and the errors of parameters that could not be parsed, keyed by parameter name.
+func parseAuditQuery(values url.Values) (models.AuditQuery, map[string]string) {
+	var query models.AuditQuery
+	parseErrors := make(map[string]string)
+
+	for key, vals := range values {
+		if isPageParameter(key) {
+			continue
+		}
+		if len(vals) > 1 {
+			parseErrors[key] = key + " must be provided at most once"
+			continue
+		}
+		value := strings.TrimSpace(vals[0])
+
+		switch key {
+		case "carId":
+			carID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				parseErrors[key] = key + " must be a valid car ID"
+				continue
+			}
+			query.CarID = &carID
+		case "customerId":
+			customerID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				parseErrors[key] = key + " must be a valid customer ID"
+				continue
+			}
+			query.CustomerID = &customerID
+		case "actor":
+			query.Actor = value
+		case "from", "to":
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				parseErrors[key] = key + " must be an RFC 3339 time"
+				continue
+			}
+			t = t.UTC()
+			if key == "from" {
+				query.From = &t
+			} else {
+				query.To = &t
+			}
+		default:
+			parseErrors[key] = key + " is not a supported parameter"
+		}
+	}
+
+	if query.CarID != nil && query.CustomerID != nil {
+		parseErrors["customerId"] = "customerId cannot be combined with carId"
+	}
+	if query.From != nil && query.To != nil && !query.To.After(*query.From) {
+		parseErrors["to"] = "to must be after from"
+	}
+	return query, parseErrors
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var authService services.IauthService
+
+// SetAuthService sets the authService variable for testing purposes
+func SetAuthService(service services.IauthService) {
+	authService = service
+}
+
+// InitAuthHandler initializes the auth handler with the given auth service
+func InitAuthHandler(service services.IauthService) {
+	authService = service
+}
+
+// principalContextKey is the key of the authenticated caller in the context of a request.
+type principalContextKey struct{}
+
+// Authenticate is middleware that checks the bearer token in the Authorization header of a request and adds the caller
+// it was issued to to the context of the request. The token is an access token of a user, or an API key of an integration.
+// Requests without an Authorization header pass through anonymously, so that routes decide whether they need a caller;
+// requests with a malformed, invalid, expired or revoked token are rejected.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, models.TokenTypeBearer) || strings.TrimSpace(token) == "" {
+			writeUnauthorized(w, r, fmt.Errorf("%w: Authorization header must be of the form 'Bearer <token>'", services.ErrUnauthorized))
+			return
+		}
+		token = strings.TrimSpace(token)
+		authenticate := authService.Authenticate
+		if strings.HasPrefix(token, models.APIKeyPrefix) {
+			authenticate = authService.AuthenticateAPIKey
+		}
+		principal, err := authenticate(token)
+		if err != nil {
+			writeUnauthorized(w, r, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ContextWithPrincipal(r.Context(), principal)))
+	})
+}
+
+// RequireRole wraps a handler so that it rejects requests that Authenticate found no caller for, requests of users
+// whose role is not granted what the required role is granted, see models.HasRole, and requests with API keys.
+func RequireRole(role string, handler http.HandlerFunc) http.HandlerFunc {
+	return RequireRoleOrScope(role, "", handler)
+}
+
+// RequireRoleOrScope wraps a handler like RequireRole, but accepts API keys that have the required scope.
+func RequireRoleOrScope(role, scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := principalFromRequest(r)
+		if !ok {
+			writeUnauthorized(w, r, fmt.Errorf("%w: an access token is required", services.ErrUnauthorized))
+			return
+		}
+		if !principal.Allows(role, scope) {
+			writeServiceError(w, r, forbidden(principal, role, scope))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// ContextWithPrincipal returns a copy of the context carrying the authenticated caller, as Authenticate adds it to requests.
+func ContextWithPrincipal(ctx context.Context, principal *models.Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// principalFromRequest returns the caller Authenticate added to the context of a request, if any.
+func principalFromRequest(r *http.Request) (*models.Principal, bool) {
+	principal, ok := r.Context().Value(principalContextKey{}).(*models.Principal)
+	return principal, ok
+}
+
+// callerAllows reports whether the caller of a request is granted what the given role, or for API keys the given scope,
+// is granted.
+func callerAllows(r *http.Request, role, scope string) bool {
+	principal, ok := principalFromRequest(r)
+	return ok && principal.Allows(role, scope)
+}
+
+// forbidden returns the error for a caller that is not granted the given role, or for API keys the given scope.
+func forbidden(principal *models.Principal, role, scope string) error {
+	switch {
+	case !principal.IsAPIKey():
+		return fmt.Errorf("%w: the %s role is required", services.ErrForbidden, role)
+	case scope == "":
+		return fmt.Errorf("%w: API keys cannot be used for this request", services.ErrForbidden)
+	default:
+		return fmt.Errorf("%w: the %s scope is required", services.ErrForbidden, scope)
+	}
+}
+
+// writeUnauthorized reports an error of authenticating a caller, telling the client to authenticate with a bearer token
+// when the caller was rejected.
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, services.ErrUnauthorized) {
+		w.Header().Set("WWW-Authenticate", models.TokenTypeBearer)
+	}
+	writeServiceError(w, r, err)
+}
+
+// Login checks the username and password of a user and returns a new access and refresh token in JSON format.
+func Login(w http.ResponseWriter, r *http.Request) {
+	var request models.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid login data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the login request struct
+	if err := validate.Struct(request); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	tokens, err := authService.Login(request.Username, request.Password)
+	if err != nil {
+		writeUnauthorized(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, tokens)
+}
+
+// RefreshTokens exchanges a refresh token for a new access and refresh token and returns them in JSON format.
+// The refresh token cannot be used again.
+func RefreshTokens(w http.ResponseWriter, r *http.Request) {
+	var request models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid refresh data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the refresh request struct
+	if err := validate.Struct(request); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	tokens, err := authService.Refresh(request.RefreshToken)
+	if err != nil {
+		writeUnauthorized(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, tokens)
+}
+
+// Logout revokes a refresh token. Access tokens issued with it stay valid until they expire.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	var request models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid logout data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the logout request struct
+	if err := validate.Struct(request); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	if err := authService.Logout(request.RefreshToken); err != nil {
+		writeUnauthorized(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetUsers retrieves every user account, ordered by username, and returns them in JSON format.
+func GetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := authService.GetUsers()
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, users)
+}
+
+// CreateUser handles the creation of a new user account. Usernames are unique regardless of case.
+func CreateUser(w http.ResponseWriter, r *http.Request) {
+	var request models.UserRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid user data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the user request struct
+	if err := validate.Struct(request); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	user, err := authService.CreateUser(request)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, user)
+}
+
+// SetUserRole changes the role of a user and returns the updated user in JSON format.
+// The last admin cannot be given another role.
+func SetUserRole(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var request models.RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid role data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the role request struct
+	if err := validate.Struct(request); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	user, err := authService.SetUserRole(id, request.Role)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, user)
+}
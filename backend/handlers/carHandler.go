@@ -1,18 +1,24 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator"
 	"github.com/gorilla/mux"
 	"github.com/lazarpetrovicc/Car-Dealership/models"
 	"github.com/lazarpetrovicc/Car-Dealership/services"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 var (
@@ -30,10 +36,10 @@ func SetValidator(v *validator.Validate) {
 	validate = v
 }
 
-// InitCarHandler initializes the car handler with the given MongoDB client and database name
-func InitCarHandler(client *mongo.Client, dbName string) {
+// InitCarHandler initializes the car handler with the given car service
+func InitCarHandler(service services.IcarService) {
 	validate = validator.New()
-	carService = services.NewCarServiceInterface(client, dbName)
+	carService = service
 }
 
 // HealthCheck returns a simple readiness response.
@@ -43,97 +49,309 @@ func HealthCheck(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
-// GetCarsByStatus retrieves cars by their status and returns them in JSON format
+// GetCarsByStatus retrieves a page of cars by their status and returns it in JSON format.
+// Supported parameters are limit, cursor and includeTotal. API keys without the customers:read scope see the cars
+// without their customers.
 func GetCarsByStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	status := vars["status"]
 
 	// Check if the status is one of the valid constants
-	switch status {
-	case models.CarStatusAvailable, models.CarStatusReserved, models.CarStatusSold:
-		cars, err := carService.GetCarsByStatus(status)
+	if !models.IsValidCarStatus(status) {
+		http.Error(w, "Invalid status provided", http.StatusBadRequest)
+		return
+	}
+
+	parseErrors := make(map[string]string)
+	page := parsePageRequest(r.URL.Query(), parseErrors)
+	if len(parseErrors) > 0 {
+		writeJSONResponse(w, http.StatusBadRequest, parseErrors)
+		return
+	}
+
+	// Validate the page request struct
+	if err := validate.Struct(page); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	cars, err := carService.GetCarsByStatus(status, page)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	for i := range cars.Items {
+		hideCustomer(r, &cars.Items[i])
+	}
+	writeJSONResponse(w, http.StatusOK, models.NewCarListResponse(*cars))
+}
+
+// SearchCars retrieves a page of cars matching the query parameters and returns it in JSON format.
+// Supported parameters are make, model, minYear, maxYear, minPrice, maxPrice, q (free text), status, customerId, sort
+// and deleted (exclude, the default, include or only), along with the limit, cursor and includeTotal page parameters.
+// The sort parameter is a comma separated list of price, year and created, each optionally prefixed with "-" for descending order.
+// API keys without the customers:read scope see the cars without their customers and cannot search by customerId.
+func SearchCars(w http.ResponseWriter, r *http.Request) {
+	query, parseErrors := parseCarQuery(r.URL.Query())
+	page := parsePageRequest(r.URL.Query(), parseErrors)
+	if len(parseErrors) > 0 {
+		writeJSONResponse(w, http.StatusBadRequest, parseErrors)
+		return
+	}
+
+	// Validate the query and page request structs
+	if err := validate.Struct(query); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+	if err := validate.Struct(page); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	// Callers who may not read customers may not find out whose cars they are either
+	if query.CustomerID != nil && !callerReadsCustomers(r) {
+		writeServiceError(w, r, fmt.Errorf("%w: the %s scope is required to search cars by customer", services.ErrForbidden, models.ScopeCustomersRead))
+		return
+	}
+
+	cars, err := carService.SearchCars(query, page)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	for i := range cars.Items {
+		hideCustomer(r, &cars.Items[i])
+	}
+	writeJSONResponse(w, http.StatusOK, models.NewCarListResponse(*cars))
+}
+
+// parsePageRequest converts the limit, cursor and includeTotal URL query parameters into a page request.
+// Parameters that could not be parsed are added to parseErrors.
+func parsePageRequest(values url.Values, parseErrors map[string]string) models.PageRequest {
+	page := models.PageRequest{Limit: models.DefaultPageLimit}
+	for _, key := range pageParameters {
+		vals, ok := values[key]
+		if !ok {
+			continue
+		}
+		if len(vals) > 1 {
+			parseErrors[key] = key + " must be provided at most once"
+			continue
+		}
+
+		var err error
+		switch key {
+		case "limit":
+			page.Limit, err = strconv.Atoi(vals[0])
+			if err != nil {
+				parseErrors[key] = key + " must be a number"
+			}
+		case "cursor":
+			page.Cursor = vals[0]
+		case "includeTotal":
+			page.IncludeTotal, err = strconv.ParseBool(vals[0])
+			if err != nil {
+				parseErrors[key] = key + " must be true or false"
+			}
+		}
+	}
+	return page
+}
+
+// pageParameters lists the URL query parameters accepted by every car listing.
+var pageParameters = []string{"limit", "cursor", "includeTotal"}
+
+// isPageParameter reports whether the URL query parameter is one of the page parameters.
+func isPageParameter(key string) bool {
+	for _, param := range pageParameters {
+		if key == param {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCarQuery converts the URL query parameters of a car search into a car query.
+// Returns the query and a map of parameter names to error messages for parameters that could not be parsed.
+func parseCarQuery(values url.Values) (models.CarQuery, map[string]string) {
+	var query models.CarQuery
+	parseErrors := make(map[string]string)
+
+	for key, vals := range values {
+		if isPageParameter(key) {
+			continue
+		}
+		if len(vals) > 1 {
+			parseErrors[key] = key + " must be provided at most once"
+			continue
+		}
+		value := strings.TrimSpace(vals[0])
+
+		var err error
+		switch key {
+		case "make":
+			query.Make = value
+		case "model":
+			query.Model = value
+		case "q":
+			query.Text = value
+		case "status":
+			query.Status = value
+		case "deleted":
+			query.Deleted = value
+		case "customerId":
+			customerID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				parseErrors[key] = key + " must be a valid customer ID"
+				continue
+			}
+			query.CustomerID = &customerID
+		case "minYear":
+			query.MinYear, err = strconv.Atoi(value)
+		case "maxYear":
+			query.MaxYear, err = strconv.Atoi(value)
+		case "minPrice":
+			query.MinPrice, err = strconv.ParseFloat(value, 64)
+		case "maxPrice":
+			query.MaxPrice, err = strconv.ParseFloat(value, 64)
+		case "sort":
+			query.Sort, err = parseCarSort(value)
+			if err != nil {
+				parseErrors[key] = err.Error()
+				continue
+			}
+		default:
+			parseErrors[key] = key + " is not a supported parameter"
+			continue
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			parseErrors[key] = key + " must be a number"
 		}
-		writeJSONResponse(w, http.StatusOK, cars)
-	default:
-		http.Error(w, "Invalid status provided", http.StatusBadRequest)
 	}
+	return query, parseErrors
+}
+
+// parseCarSort converts a comma separated list of sort keys into car sort fields.
+func parseCarSort(value string) ([]models.CarSortField, error) {
+	var fields []models.CarSortField
+	seen := make(map[string]bool)
+	for _, key := range strings.Split(value, ",") {
+		direction := models.SortAscending
+		if strings.HasPrefix(key, "-") {
+			direction = models.SortDescending
+			key = key[1:]
+		}
+		field, ok := models.CarSortFields[key]
+		if !ok {
+			return nil, errors.New("sort must be a comma separated list of price, year and created")
+		}
+		if seen[field] {
+			return nil, errors.New("sort must not repeat " + key)
+		}
+		seen[field] = true
+		fields = append(fields, models.CarSortField{Field: field, Direction: direction})
+	}
+	return fields, nil
 }
 
-// GetCarImage retrieves a car's image by its ID and returns it in JPEG format
+// GetCarByID retrieves a single car by its ID and returns it in JSON format.
+// The customer of the car is left out for API keys without the customers:read scope.
+func GetCarByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	car, err := carService.GetCarByID(id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusOK, car)
+}
+
+// imageCacheControl lets clients and proxies cache images for a year without revalidating them, as a stored image never changes.
+const imageCacheControl = "public, max-age=31536000, immutable"
+
+// GetCarImage streams a car's image by its ID with the content type it was stored with.
+// The size parameter selects a resized variant (thumb, medium or large) instead of the original image.
+// The ETag is the ID of the stored file, and conditional and Range requests are answered by http.ServeContent.
 func GetCarImage(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	pictureID := vars["id"]
 
+	size := r.URL.Query().Get("size")
+	if size != "" && !models.IsValidImageSize(size) {
+		http.Error(w, "Invalid image size", http.StatusBadRequest)
+		return
+	}
+
 	// Retrieve the car image data from the service
-	fileData, err := carService.GetCarImage(pictureID)
+	image, err := carService.GetCarImage(pictureID, size)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, err)
 		return
 	}
 
-	// Set headers and write the image data to the response
-	w.Header().Set("Content-Type", "image/jpeg")
-	w.Header().Set("Content-Length", strconv.Itoa(len(fileData)))
-	w.Write(fileData)
+	defer image.Content.Close()
+
+	// Set headers and stream the image data, or the requested range of it, to the response
+	w.Header().Set("Content-Type", image.ContentType)
+	w.Header().Set("ETag", `"`+image.ID+`"`)
+	w.Header().Set("Cache-Control", imageCacheControl)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", image.UploadedAt, image.Content)
 }
 
 // CreateCar handles the creation of a new available car and saves its details in the database
 func CreateCar(w http.ResponseWriter, r *http.Request) {
 	var car models.Car
 
-	// Parse the multipart form data
-	err := r.ParseMultipartForm(10 << 20)
-	if err != nil {
-		http.Error(w, "Error parsing form data", http.StatusInternalServerError)
+	// Read the form values up to the picture, which is streamed to the service
+	form, file, ok := readMultipartUpload(w, r, "picture")
+	if !ok {
 		return
 	}
 
 	// Extract form values
-	car.Make = r.FormValue("make")
-	car.Model = r.FormValue("model")
-	year, _ := strconv.Atoi(r.FormValue("year"))
+	car.Make = form.Get("make")
+	car.Model = form.Get("model")
+	year, _ := strconv.Atoi(form.Get("year"))
 	car.Year = year
-	price, _ := strconv.ParseFloat(r.FormValue("price"), 64)
+	price, _ := strconv.ParseFloat(form.Get("price"), 64)
 	car.Price = price
 	car.Status = models.CarStatusAvailable // Ensure the status remains available
 
-	// Retrieve the file from the form
-	file, handler, err := r.FormFile("picture")
-	if err != nil {
+	if file == nil {
 		http.Error(w, "picture is required", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
-
-	// Read the file into a byte slice
-	fileData, err := io.ReadAll(file)
-	if err != nil {
-		http.Error(w, "failed to read uploaded picture", http.StatusBadRequest)
-		return
-	}
-
-	car.Picture = string(fileData)
 
-	// Validate the car struct
-	if err := validate.Struct(car); err != nil {
+	// Validate the car struct; the picture is checked by the service when it is uploaded
+	if err := validate.StructExcept(car, "Picture"); err != nil {
 		log.Println("Validation errors: ", err)
 		handleValidationErrors(w, err)
 		return
 	}
 
 	// Save the car in the database
-	result, err := carService.CreateCar(&car, fileData, handler.Filename)
+	createdCar, err := carServiceFor(r).CreateCar(&car, file, file.FileName())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, err)
 		return
 	}
-	writeJSONResponse(w, http.StatusOK, result)
+	w.Header().Set("Location", "/cars/"+createdCar.ID.Hex())
+	writeCarResponse(w, r, http.StatusCreated, createdCar)
 }
 
-// UpdateCar handles updating the details of an existing available car in the database. Only available cars can be updated, and their status cannot be changed through updating.
+// UpdateCar handles updating the details of an existing car in the database, optionally with a new picture.
+// Only available cars and cars in preparation can be updated, and their status cannot be changed through updating.
 func UpdateCar(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	carID := vars["id"]
@@ -143,56 +361,154 @@ func UpdateCar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
 	var car models.Car
 
-	// Parse the multipart form data
-	err = r.ParseMultipartForm(10 << 20)
-	if err != nil {
-		http.Error(w, "Error parsing form data", http.StatusInternalServerError)
+	// Read the form values up to the picture, if present, which is streamed to the service
+	form, file, ok := readMultipartUpload(w, r, "picture")
+	if !ok {
 		return
 	}
 
 	// Extract form values
-	car.Make = r.FormValue("make")
-	car.Model = r.FormValue("model")
-	year, _ := strconv.Atoi(r.FormValue("year"))
+	car.Make = form.Get("make")
+	car.Model = form.Get("model")
+	year, _ := strconv.Atoi(form.Get("year"))
 	car.Year = year
-	price, _ := strconv.ParseFloat(r.FormValue("price"), 64)
+	price, _ := strconv.ParseFloat(form.Get("price"), 64)
 	car.Price = price
-	car.Status = models.CarStatusAvailable // Ensure the status remains available
 
-	// Retrieve the file from the form, if present
-	var fileData []byte
+	// Only pass a picture on when one was uploaded, a nil content reader keeps the current one
+	var content io.Reader
 	var fileName string
-	file, handler, err := r.FormFile("picture")
-	if err == nil {
-		defer file.Close()
-		fileData, err = io.ReadAll(file)
-		if err != nil {
-			http.Error(w, "Error reading file", http.StatusInternalServerError)
-			return
-		}
-		fileName = handler.Filename
-		car.Picture = string(fileData)
+	if file != nil {
+		content, fileName = file, file.FileName()
 	}
 
-	// Validate the car struct
-	if err := validate.Struct(car); err != nil {
+	// Validate the car struct; the status is kept and the picture is only replaced when a new one is uploaded
+	if err := validate.StructExcept(car, "Status", "Picture"); err != nil {
 		log.Println("Validation errors: ", err)
 		handleValidationErrors(w, err)
 		return
 	}
 
+	// Only managers may change the price
+	version, ok = authorizePriceChange(w, r, id, car.Price, version, "change the price of a car")
+	if !ok {
+		return
+	}
+
 	// Update the car in the database
-	result, err := carService.UpdateCar(id, &car, fileData, fileName)
+	updatedCar, err := carServiceFor(r).UpdateCar(id, &car, content, fileName, version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, err)
 		return
 	}
-	writeJSONResponse(w, http.StatusOK, result)
+	writeCarResponse(w, r, http.StatusOK, updatedCar)
 }
 
-// DeleteCar handles deleting a car from the database by its ID. Only available cars can be deleted.
+// PatchCar handles changing some of the details of a car with a JSON Merge Patch (RFC 7396).
+// Only the fields present in the patch are validated and changed. Only available cars and cars in preparation can be patched.
+func PatchCar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != models.MergePatchContentType {
+		http.Error(w, "Content-Type must be "+models.MergePatchContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	patch, parseErrors, err := parseCarPatch(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid car patch", http.StatusBadRequest)
+		return
+	}
+	if len(parseErrors) > 0 {
+		writeJSONResponse(w, http.StatusBadRequest, parseErrors)
+		return
+	}
+
+	// Validate the fields present in the patch
+	if err := validate.Struct(patch); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	// Only managers may change the price
+	if patch.Price != nil {
+		var ok bool
+		version, ok = authorizePriceChange(w, r, id, *patch.Price, version, "change the price of a car")
+		if !ok {
+			return
+		}
+	}
+
+	// Apply the patch to the car
+	patchedCar, err := carServiceFor(r).PatchCar(id, patch, version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusOK, patchedCar)
+}
+
+// parseCarPatch decodes a JSON Merge Patch of a car, which has to be a JSON object.
+// Returns the patch, the errors of fields that cannot be patched keyed by field name, and an error if the body is not a JSON object.
+func parseCarPatch(body io.Reader) (models.CarPatch, map[string]string, error) {
+	var patch models.CarPatch
+	var fields map[string]json.RawMessage
+	if err := json.NewDecoder(body).Decode(&fields); err != nil {
+		return patch, nil, err
+	}
+	if fields == nil {
+		return patch, nil, errors.New("car patch must be a JSON object")
+	}
+
+	parseErrors := make(map[string]string)
+	for key, value := range fields {
+		// A null member removes the field in a merge patch, but every field of a car is required
+		if string(bytes.TrimSpace(value)) == "null" {
+			parseErrors[key] = key + " cannot be removed"
+			continue
+		}
+
+		var target interface{}
+		switch key {
+		case "make":
+			target = &patch.Make
+		case "model":
+			target = &patch.Model
+		case "year":
+			target = &patch.Year
+		case "price":
+			target = &patch.Price
+		default:
+			parseErrors[key] = key + " cannot be patched"
+			continue
+		}
+		if err := json.Unmarshal(value, target); err != nil {
+			parseErrors[key] = key + " has an invalid value"
+		}
+	}
+	return patch, parseErrors, nil
+}
+
+// DeleteCar handles deleting a car by its ID, which archives it until it is restored or purged. Only available cars can be deleted.
 func DeleteCar(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := primitive.ObjectIDFromHex(vars["id"])
@@ -201,16 +517,23 @@ func DeleteCar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
 	// Delete the car from the database
-	result, err := carService.DeleteCar(id)
+	err = carServiceFor(r).DeleteCar(id, version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, err)
 		return
 	}
-	writeJSONResponse(w, http.StatusOK, result)
+	w.Header().Set("API-Version", models.APIVersion)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// ReserveCar handles reserving a car by a customer. Only available cars can be reserved.
+// ReserveCar handles reserving a car by a customer, optionally with a deposit. Only available cars can be reserved.
+// The customer is either an existing customer given by customerId or inline customer details.
 func ReserveCar(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := primitive.ObjectIDFromHex(vars["id"])
@@ -219,26 +542,88 @@ func ReserveCar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var customer models.Customer
-	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var reservation models.ReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&reservation); err != nil {
 		http.Error(w, "Invalid customer data", http.StatusBadRequest)
 		return
 	}
 
-	// Validate the customer struct
-	if err := validate.Struct(customer); err != nil {
+	// Validate the reservation request struct
+	if !validateCustomerRequest(w, reservation, reservation.CustomerID, reservation.Customer) {
+		return
+	}
+
+	// Reserve the car for the customer
+	reservedCar, err := carServiceFor(r).ReserveCar(id, reservation, version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusOK, reservedCar)
+}
+
+// ExtendReservation handles moving the expiry of a car reservation
+func ExtendReservation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.ExtendReservationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid reservation data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the extend reservation request struct
+	if err := validate.Struct(request); err != nil {
 		log.Println("Validation errors: ", err)
 		handleValidationErrors(w, err)
 		return
 	}
 
-	// Reserve the car for the customer
-	result, err := carService.ReserveCar(id, customer)
+	// Extend the car reservation
+	car, err := carServiceFor(r).ExtendReservation(id, request.ExpiresAt, version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, err)
 		return
 	}
-	writeJSONResponse(w, http.StatusOK, result)
+	writeCarResponse(w, r, http.StatusOK, car)
+}
+
+// RestoreCar handles restoring a deleted car by its ID, which puts it back on the market as available.
+func RestoreCar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	// Restore the deleted car
+	car, err := carServiceFor(r).RestoreCar(id, version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusOK, car)
 }
 
 // CancelReservation handles canceling a car reservation
@@ -250,16 +635,22 @@ func CancelReservation(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
 	// Cancel the car reservation
-	result, err := carService.CancelReservation(id)
+	car, err := carServiceFor(r).CancelReservation(id, version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, err)
 		return
 	}
-	writeJSONResponse(w, http.StatusOK, result)
+	writeCarResponse(w, r, http.StatusOK, car)
 }
 
-// SellCar handles selling a car to a customer. Only available cars can be sold.
+// SellCar handles selling a car to a customer, optionally with the payments received.
+// Available cars can be sold to anyone, reserved cars only to the customer who reserved them.
 func SellCar(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := primitive.ObjectIDFromHex(vars["id"])
@@ -268,26 +659,119 @@ func SellCar(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var customer models.Customer
-	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var sale models.SaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&sale); err != nil {
 		http.Error(w, "Invalid customer data", http.StatusBadRequest)
 		return
 	}
 
-	// Validate the customer struct
-	if err := validate.Struct(customer); err != nil {
+	// Validate the sale request struct
+	if !validateCustomerRequest(w, sale, sale.CustomerID, sale.Customer) {
+		return
+	}
+
+	// Only managers may agree on a price other than the list price
+	if sale.Price != nil {
+		var ok bool
+		version, ok = authorizePriceChange(w, r, id, *sale.Price, version, "sell a car at a price other than its list price")
+		if !ok {
+			return
+		}
+	}
+
+	// Sell the car to the customer
+	soldCar, err := carServiceFor(r).SellCar(id, sale, version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusOK, soldCar)
+}
+
+// ReturnCar handles taking back a sold car, which is moved to "in-preparation"
+func ReturnCar(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	// Return the car
+	car, err := carServiceFor(r).ReturnCar(id, version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusOK, car)
+}
+
+// ChangeCarStatus handles moving a car to "in-preparation", "available" or "archived"
+func ChangeCarStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.StatusChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid status change data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the status change request struct
+	if err := validate.Struct(request); err != nil {
 		log.Println("Validation errors: ", err)
 		handleValidationErrors(w, err)
 		return
 	}
 
-	// Sell the car to the customer
-	result, err := carService.SellCar(id, customer)
+	// Change the status of the car
+	car, err := carServiceFor(r).ChangeCarStatus(id, request.Status, version)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeServiceError(w, r, err)
 		return
 	}
-	writeJSONResponse(w, http.StatusOK, result)
+	writeCarResponse(w, r, http.StatusOK, car)
+}
+
+// validateCustomerRequest validates a request that names its customer either by customerId or by inline customer details.
+// It writes the error response and returns false when the request is invalid.
+func validateCustomerRequest(w http.ResponseWriter, request interface{}, customerID *primitive.ObjectID, customer models.Customer) bool {
+	var err error
+	if customerID != nil {
+		if customer != (models.Customer{}) {
+			http.Error(w, "Provide either customerId or customer details", http.StatusBadRequest)
+			return false
+		}
+		// The customer details are not needed for an existing customer
+		err = validate.StructExcept(request, "Customer")
+	} else {
+		err = validate.Struct(request)
+	}
+	if err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return false
+	}
+	return true
 }
 
 // handleValidationErrors formats and returns validation errors in JSON format
@@ -305,8 +789,12 @@ func handleValidationErrors(w http.ResponseWriter, err error) {
 				validationErrors[field] = field + " is not a valid email address"
 			case "min":
 				validationErrors[field] = field + " must be at least " + err.Param()
+			case "max":
+				validationErrors[field] = field + " must be at most " + err.Param()
 			case "gt":
 				validationErrors[field] = field + " must be greater than " + err.Param()
+			case "gtefield":
+				validationErrors[field] = field + " must be greater than or equal to " + err.Param()
 			case "oneof":
 				validationErrors[field] = field + " must be one of " + err.Param()
 			default:
@@ -318,8 +806,136 @@ func handleValidationErrors(w http.ResponseWriter, err error) {
 	writeJSONResponse(w, http.StatusBadRequest, validationErrors)
 }
 
+// authorizePriceChange checks that a caller below the manager role, or an API key without the prices:write scope, leaves
+// the price of a car as it is. The car is read to compare the prices, and the change is tied to the version that was read,
+// so that it fails with 412 rather than being applied to a car whose price was changed in the meantime.
+// Returns the version to apply the change to and whether the change may go ahead; otherwise the error response was written.
+func authorizePriceChange(w http.ResponseWriter, r *http.Request, id primitive.ObjectID, price float64, version *int64, action string) (*int64, bool) {
+	if callerAllows(r, models.RoleManager, models.ScopePricesWrite) {
+		return version, true
+	}
+	car, err := carService.GetCarByID(id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return nil, false
+	}
+	if car.Price != price {
+		requirement := fmt.Sprintf("the %s role", models.RoleManager)
+		if principal, ok := principalFromRequest(r); ok && principal.IsAPIKey() {
+			requirement = fmt.Sprintf("the %s scope", models.ScopePricesWrite)
+		}
+		writeServiceError(w, r, fmt.Errorf("%w: %s is required to %s", services.ErrForbidden, requirement, action))
+		return nil, false
+	}
+	if version == nil {
+		version = &car.Version
+	}
+	return version, true
+}
+
+// callerReadsCustomers reports whether the caller of a request may read customers, which API keys need the
+// customers:read scope for.
+func callerReadsCustomers(r *http.Request) bool {
+	return callerAllows(r, models.RoleViewer, models.ScopeCustomersRead)
+}
+
+// hideCustomer removes the customer of a car read by a caller who may not read customers.
+func hideCustomer(r *http.Request, car *models.Car) {
+	if !callerReadsCustomers(r) {
+		car.Customer = nil
+	}
+}
+
+// writeCarResponse writes a car as a JSON response with its version as the ETag, for use in If-Match headers.
+// The customer of the car is left out for callers who may not read customers, whichever endpoint returns the car.
+func writeCarResponse(w http.ResponseWriter, r *http.Request, statusCode int, car *models.Car) {
+	hideCustomer(r, car)
+	w.Header().Set("ETag", carETag(car.Version))
+	writeJSONResponse(w, statusCode, models.NewCarResponse(*car))
+}
+
+// carETag returns the entity tag of a car at the given version
+func carETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// requireIfMatch returns the car version required by the If-Match header of a request, so that the change is only
+// applied if nobody changed the car since the client fetched it. "*" explicitly allows any version and returns nil.
+// A missing header is answered with 428 Precondition Required and an invalid one with 400 Bad Request, and false is returned.
+func requireIfMatch(w http.ResponseWriter, r *http.Request) (*int64, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" {
+		writeProblem(w, Problem{
+			Type:     "/problems/precondition-required",
+			Title:    "Precondition required",
+			Status:   http.StatusPreconditionRequired,
+			Detail:   `If-Match header with the ETag of the car is required, or "*" to change any version`,
+			Instance: r.URL.Path,
+		})
+		return nil, false
+	}
+	if value == "*" {
+		return nil, true
+	}
+	if len(value) < 2 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+		return nil, false
+	}
+	version, err := strconv.ParseInt(value[1:len(value)-1], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
+		return nil, false
+	}
+	return &version, true
+}
+
+// maxFormValuesSize is the largest total size, in bytes, of the text fields sent with an uploaded file.
+const maxFormValuesSize = 64 << 10
+
+// readMultipartUpload reads the text fields of a multipart request up to the part holding the file of the given field,
+// which is returned unread so that it can be streamed instead of being buffered. Fields sent after the file are not read,
+// so clients have to send the file as the last part. The file part is nil when the request has none.
+// Writes an error response and returns false when the request is not a valid multipart request or its fields are too large.
+func readMultipartUpload(w http.ResponseWriter, r *http.Request, fileField string) (url.Values, *multipart.Part, bool) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Error parsing form data", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	form := url.Values{}
+	remaining := int64(maxFormValuesSize)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return form, nil, true
+		}
+		if err != nil {
+			http.Error(w, "Error parsing form data", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		// A file input left empty is sent without a file name, like a text field
+		if part.FormName() == fileField && part.FileName() != "" {
+			return form, part, true
+		}
+
+		value, err := io.ReadAll(io.LimitReader(part, remaining+1))
+		if err != nil {
+			http.Error(w, "Error parsing form data", http.StatusBadRequest)
+			return nil, nil, false
+		}
+		if remaining -= int64(len(value)); remaining < 0 {
+			http.Error(w, "Form data too large", http.StatusRequestEntityTooLarge)
+			return nil, nil, false
+		}
+		form.Add(part.FormName(), string(value))
+	}
+}
+
+// writeJSONResponse writes the payload as a JSON response tagged with the API version of the response shapes
 func writeJSONResponse(w http.ResponseWriter, statusCode int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("API-Version", models.APIVersion)
 	w.WriteHeader(statusCode)
 	json.NewEncoder(w).Encode(payload)
 }
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AddCarImage handles uploading an image to the gallery of a car, with an optional caption and primary flag.
+// Only available cars and cars in preparation can have their images changed.
+func AddCarImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	// Read the form values up to the image, which is streamed to the service
+	form, file, ok := readMultipartUpload(w, r, "image")
+	if !ok {
+		return
+	}
+
+	// Extract form values
+	request := models.CarImageRequest{Caption: form.Get("caption")}
+	if value := form.Get("primary"); value != "" {
+		primary, err := strconv.ParseBool(value)
+		if err != nil {
+			writeJSONResponse(w, http.StatusBadRequest, map[string]string{"primary": "primary must be true or false"})
+			return
+		}
+		request.Primary = primary
+	}
+
+	if file == nil {
+		http.Error(w, "image is required", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the image request struct
+	if err := validate.Struct(request); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	// Add the image to the gallery of the car
+	car, err := carServiceFor(r).AddCarImage(id, request, file, file.FileName(), version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusCreated, car)
+}
+
+// UpdateCarImage handles changing the caption of an image of a car or making it the car's primary image.
+func UpdateCarImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var update models.CarImageUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Invalid image data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the image update struct
+	if err := validate.Struct(update); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	// Change the image of the car
+	car, err := carServiceFor(r).UpdateCarImage(id, vars["imageId"], update, version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusOK, car)
+}
+
+// RemoveCarImage handles removing an image from the gallery of a car. The last image of a car cannot be removed.
+func RemoveCarImage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	// Remove the image from the gallery of the car
+	car, err := carServiceFor(r).RemoveCarImage(id, vars["imageId"], version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusOK, car)
+}
+
+// ReorderCarImages handles putting the images of a car in a new order, listing every image of the car exactly once.
+func ReorderCarImages(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	version, ok := requireIfMatch(w, r)
+	if !ok {
+		return
+	}
+
+	var request models.CarImageOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid image order data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the image order request struct
+	if err := validate.Struct(request); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	// Put the images of the car in the new order
+	car, err := carServiceFor(r).ReorderCarImages(id, request.ImageIDs, version)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeCarResponse(w, r, http.StatusOK, car)
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var customerService services.IcustomerService
+
+// SetCustomerService sets the customerService variable for testing purposes
+func SetCustomerService(service services.IcustomerService) {
+	customerService = service
+}
+
+// InitCustomerHandler initializes the customer handler with the given customer service
+func InitCustomerHandler(service services.IcustomerService) {
+	customerService = service
+}
+
+// GetCustomers retrieves a page of customers, newest first, and returns it in JSON format.
+// Supported parameters are q (free text matched against name, email and phone number), plus limit, cursor and includeTotal.
+func GetCustomers(w http.ResponseWriter, r *http.Request) {
+	query, parseErrors := parseCustomerQuery(r.URL.Query())
+	page := parsePageRequest(r.URL.Query(), parseErrors)
+	if len(parseErrors) > 0 {
+		writeJSONResponse(w, http.StatusBadRequest, parseErrors)
+		return
+	}
+
+	// Validate the customer query struct
+	if err := validate.Struct(query); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	// Validate the page request struct
+	if err := validate.Struct(page); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	customers, err := customerService.GetCustomers(query, page)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, models.NewCustomerListResponse(*customers))
+}
+
+// parseCustomerQuery converts the query parameters of a customer listing into a customer query.
+// Returns the query and the errors of parameters that could not be parsed, keyed by parameter name.
+func parseCustomerQuery(values url.Values) (models.CustomerQuery, map[string]string) {
+	var query models.CustomerQuery
+	parseErrors := make(map[string]string)
+
+	for key, vals := range values {
+		if isPageParameter(key) {
+			continue
+		}
+		if len(vals) > 1 {
+			parseErrors[key] = key + " must be provided at most once"
+			continue
+		}
+		value := strings.TrimSpace(vals[0])
+
+		switch key {
+		case "q":
+			query.Text = value
+		default:
+			parseErrors[key] = key + " is not a supported parameter"
+		}
+	}
+	return query, parseErrors
+}
+
+// GetCustomerByID retrieves a single customer by its ID and returns it in JSON format.
+func GetCustomerByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+
+	customer, err := customerService.GetCustomerByID(id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, models.NewCustomerResponse(*customer))
+}
+
+// CreateCustomer handles the creation of a new customer. Email addresses and phone numbers must not belong to another customer.
+func CreateCustomer(w http.ResponseWriter, r *http.Request) {
+	var customer models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+		http.Error(w, "Invalid customer data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the customer struct
+	if err := validate.Struct(customer); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	createdCustomer, err := customerServiceFor(r).CreateCustomer(customer)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/customers/"+createdCustomer.ID.Hex())
+	writeJSONResponse(w, http.StatusCreated, models.NewCustomerResponse(*createdCustomer))
+}
+
+// UpdateCustomer handles updating the details of an existing customer.
+// Cars and sales keep the customer details they were recorded with.
+func UpdateCustomer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+
+	var customer models.Customer
+	if err := json.NewDecoder(r.Body).Decode(&customer); err != nil {
+		http.Error(w, "Invalid customer data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the customer struct
+	if err := validate.Struct(customer); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	updatedCustomer, err := customerServiceFor(r).UpdateCustomer(id, customer)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, models.NewCustomerResponse(*updatedCustomer))
+}
+
+// DeleteCustomer handles deleting a customer who has no reserved cars.
+func DeleteCustomer(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid customer ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := customerServiceFor(r).DeleteCustomer(id); err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+)
+
+// Problem represents an RFC 7807 problem details response body.
+type Problem struct {
+	Type     string `json:"type"`               // URI reference identifying the problem type
+	Title    string `json:"title"`              // Short summary of the problem type
+	Status   int    `json:"status"`             // HTTP status code of the response
+	Detail   string `json:"detail,omitempty"`   // Explanation specific to this occurrence of the problem
+	Instance string `json:"instance,omitempty"` // URI reference of the request that caused the problem
+}
+
+// problemType describes how a class of service errors is reported to clients.
+type problemType struct {
+	err    error
+	status int
+	uri    string
+	title  string
+}
+
+// problemTypes maps the domain errors of the services to their HTTP status codes and problem types.
+var problemTypes = []problemType{
+	{services.ErrNotFound, http.StatusNotFound, "/problems/not-found", "Resource not found"},
+	{services.ErrInvalidTransition, http.StatusConflict, "/problems/invalid-state-transition", "Invalid state transition"},
+	{services.ErrConflict, http.StatusConflict, "/problems/conflict", "Conflict"},
+	{services.ErrValidation, http.StatusUnprocessableEntity, "/problems/validation", "Validation failed"},
+	{services.ErrPrecondition, http.StatusPreconditionFailed, "/problems/precondition-failed", "Precondition failed"},
+	{services.ErrTooLarge, http.StatusRequestEntityTooLarge, "/problems/too-large", "Payload too large"},
+	{services.ErrUnauthorized, http.StatusUnauthorized, "/problems/unauthorized", "Unauthorized"},
+	{services.ErrForbidden, http.StatusForbidden, "/problems/forbidden", "Forbidden"},
+}
+
+// writeServiceError maps an error returned by a service to an application/problem+json response.
+// Errors that are not domain errors are logged and reported as 500 without exposing their message.
+func writeServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	for _, pt := range problemTypes {
+		if errors.Is(err, pt.err) {
+			writeProblem(w, Problem{
+				Type:     pt.uri,
+				Title:    pt.title,
+				Status:   pt.status,
+				Detail:   err.Error(),
+				Instance: r.URL.Path,
+			})
+			return
+		}
+	}
+
+	log.Printf("Unexpected error handling %s %s: %v", r.Method, r.URL.Path, err)
+	writeProblem(w, Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(http.StatusInternalServerError),
+		Status:   http.StatusInternalServerError,
+		Detail:   "An unexpected error occurred",
+		Instance: r.URL.Path,
+	})
+}
+
+// writeProblem writes a problem details response with the status code of the problem
+func writeProblem(w http.ResponseWriter, problem Problem) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("API-Version", models.APIVersion)
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var paymentService services.IpaymentService
+
+// SetPaymentService sets the paymentService variable for testing purposes
+func SetPaymentService(service services.IpaymentService) {
+	paymentService = service
+}
+
+// InitPaymentHandler initializes the payment handler with the given payment service
+func InitPaymentHandler(service services.IpaymentService) {
+	paymentService = service
+}
+
+// GetPayments retrieves the payments and refunds of a car and returns them in JSON format.
+func GetPayments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	payments, err := paymentService.GetPaymentsByCar(id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, models.NewPaymentListResponse(payments))
+}
+
+// RecordPayment handles recording a payment for a reserved or sold car.
+func RecordPayment(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	var request models.PaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid payment data", http.StatusBadRequest)
+		return
+	}
+
+	// Validate the payment request struct
+	if err := validate.Struct(request); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	// Record the payment
+	payment, err := paymentServiceFor(r).RecordPayment(id, request)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusCreated, models.NewPaymentResponse(*payment))
+}
+
+// GetBalance retrieves how much of the price of a car has been paid and returns it in JSON format.
+func GetBalance(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid car ID", http.StatusBadRequest)
+		return
+	}
+
+	balance, err := paymentService.GetBalance(id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	writeJSONResponse(w, http.StatusOK, models.NewCarBalanceResponse(*balance))
+}
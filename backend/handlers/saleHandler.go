@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var saleService services.IsaleService
+
+// SetSaleService sets the saleService variable for testing purposes
+func SetSaleService(service services.IsaleService) {
+	saleService = service
+}
+
+// InitSaleHandler initializes the sale handler with the given sale service
+func InitSaleHandler(service services.IsaleService) {
+	saleService = service
+}
+
+// GetSales retrieves a page of sales, newest first, and returns it in JSON format.
+// Supported parameters are carId, customerId and salesperson, plus limit, cursor and includeTotal.
+// API keys without the customers:read scope see the sales without their customers and cannot filter by customerId.
+func GetSales(w http.ResponseWriter, r *http.Request) {
+	query, parseErrors := parseSaleQuery(r.URL.Query())
+	page := parsePageRequest(r.URL.Query(), parseErrors)
+	if len(parseErrors) > 0 {
+		writeJSONResponse(w, http.StatusBadRequest, parseErrors)
+		return
+	}
+
+	// Validate the page request struct
+	if err := validate.Struct(page); err != nil {
+		log.Println("Validation errors: ", err)
+		handleValidationErrors(w, err)
+		return
+	}
+
+	// Callers who may not read customers may not find out what a customer bought either
+	if query.CustomerID != nil && !callerReadsCustomers(r) {
+		writeServiceError(w, r, fmt.Errorf("%w: the %s scope is required to list sales by customer", services.ErrForbidden, models.ScopeCustomersRead))
+		return
+	}
+
+	sales, err := saleService.GetSales(query, page)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	response := models.NewSaleListResponse(*sales)
+	for i := range response.Items {
+		hideSaleCustomer(r, &response.Items[i])
+	}
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// parseSaleQuery converts the query parameters of a sales listing into a sale query.
+// Returns the query and the errors of parameters that could not be parsed, keyed by parameter name.
+func parseSaleQuery(values url.Values) (models.SaleQuery, map[string]string) {
+	var query models.SaleQuery
+	parseErrors := make(map[string]string)
+
+	for key, vals := range values {
+		if isPageParameter(key) {
+			continue
+		}
+		if len(vals) > 1 {
+			parseErrors[key] = key + " must be provided at most once"
+			continue
+		}
+		value := strings.TrimSpace(vals[0])
+
+		switch key {
+		case "carId":
+			carID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				parseErrors[key] = key + " must be a valid car ID"
+				continue
+			}
+			query.CarID = &carID
+		case "customerId":
+			customerID, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				parseErrors[key] = key + " must be a valid customer ID"
+				continue
+			}
+			query.CustomerID = &customerID
+		case "salesperson":
+			query.Salesperson = value
+		default:
+			parseErrors[key] = key + " is not a supported parameter"
+		}
+	}
+	return query, parseErrors
+}
+
+// GetSaleByID retrieves a single sale by its ID and returns it in JSON format.
+// The customer of the sale is left out for API keys without the customers:read scope.
+func GetSaleByID(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := primitive.ObjectIDFromHex(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid sale ID", http.StatusBadRequest)
+		return
+	}
+
+	sale, err := saleService.GetSaleByID(id)
+	if err != nil {
+		writeServiceError(w, r, err)
+		return
+	}
+	response := models.NewSaleResponse(*sale)
+	hideSaleCustomer(r, &response)
+	writeJSONResponse(w, http.StatusOK, response)
+}
+
+// hideSaleCustomer removes the customer of a sale read by a caller who may not read customers.
+func hideSaleCustomer(r *http.Request, sale *models.SaleResponse) {
+	if !callerReadsCustomers(r) {
+		sale.Customer = nil
+	}
+}
@@ -9,8 +9,11 @@ import (
 	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/lazarpetrovicc/Car-Dealership/config"
 	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
 	"github.com/lazarpetrovicc/Car-Dealership/routers"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -20,14 +23,33 @@ func setupResponse(w *http.ResponseWriter, req *http.Request) {
 	// If the request method is OPTIONS, return early without further processing
 	if req.Method == "OPTIONS" {
 		(*w).Header().Set("Access-Control-Allow-Origin", "*")
-		(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Authorization")
+		(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+		(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Authorization, If-Match, If-None-Match, If-Modified-Since, Range, X-Request-ID")
 		return
 	}
 	// Set CORS headers
 	(*w).Header().Set("Access-Control-Allow-Origin", "*")
-	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Authorization")
+	(*w).Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+	(*w).Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Authorization, If-Match, If-None-Match, If-Modified-Since, Range, X-Request-ID")
+	(*w).Header().Set("Access-Control-Expose-Headers", "ETag, Last-Modified, Accept-Ranges, Content-Range, X-Request-ID")
+}
+
+// newImageStore opens the image store selected by the configuration.
+func newImageStore(cfg config.Config, db *mongo.Database) (services.ImageStore, error) {
+	switch cfg.ImageStore {
+	case config.ImageStoreDisk:
+		return services.NewDiskImageStore(cfg.ImageDir)
+	case config.ImageStoreS3:
+		return services.NewS3ImageStore(services.S3Options{
+			Endpoint:        cfg.S3Endpoint,
+			Bucket:          cfg.S3Bucket,
+			Region:          cfg.S3Region,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			UseSSL:          cfg.S3UseSSL,
+		})
+	}
+	return services.NewGridFSImageStore(db)
 }
 
 func main() {
@@ -37,6 +59,12 @@ func main() {
 		log.Println("No .env file found") // Log a message if .env file is not found
 	}
 
+	// Load the remaining settings from environment variables
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err) // Exit if a setting is invalid
+	}
+
 	// Get MongoDB URI from environment variable
 	mongoURI := os.Getenv("MONGO_URI")
 	if mongoURI == "" {
@@ -59,8 +87,48 @@ func main() {
 		log.Fatal(err) // Exit if ping fails
 	}
 
-	// Initialize the car handler with the MongoDB client and database name
-	handlers.InitCarHandler(client, "carDealershipDB")
+	// Open the store car images are kept in
+	imageStore, err := newImageStore(cfg, client.Database("carDealershipDB"))
+	if err != nil {
+		log.Fatalf("Error opening %s image store: %v", cfg.ImageStore, err) // Exit if images cannot be stored
+	}
+
+	// Initialize the car service and the car handler using it
+	carService := services.NewCarServiceInterface(client, "carDealershipDB")
+	carService.SetImageStore(imageStore)
+	carService.SetReservationHoldPeriod(cfg.ReservationHoldPeriod)
+	carService.SetMaxImageSize(cfg.MaxImageSize)
+	handlers.InitCarHandler(carService)
+	handlers.InitPaymentHandler(services.NewPaymentServiceInterface(client, "carDealershipDB"))
+	handlers.InitSaleHandler(services.NewSaleServiceInterface(client, "carDealershipDB"))
+	handlers.InitCustomerHandler(services.NewCustomerServiceInterface(client, "carDealershipDB"))
+	handlers.InitAuditHandler(services.NewAuditServiceInterface(client, "carDealershipDB"))
+
+	// Initialize the service for user accounts and tokens, creating the admin account of a new installation
+	authService := services.NewAuthServiceInterface(client, "carDealershipDB", []byte(cfg.JWTSecret))
+	authService.SetTokenLifetimes(cfg.AccessTokenLifetime, cfg.RefreshTokenLifetime)
+	if cfg.AdminUsername != "" {
+		user, err := authService.CreateInitialUser(models.UserRequest{Username: cfg.AdminUsername, Password: cfg.AdminPassword, Role: models.RoleAdmin})
+		if err != nil {
+			log.Fatalf("Error creating initial user: %v", err) // Exit if nobody could log in
+		}
+		if user != nil {
+			log.Printf("Created initial user '%s'", user.Username)
+		}
+	}
+	handlers.InitAuthHandler(authService)
+
+	// Start releasing expired reservations in the background
+	reservationSweeper := services.NewReservationSweeper(carService, cfg.ReservationSweepInterval)
+	reservationSweeper.Start()
+
+	// Start checking the consistency of car images in the background
+	imageChecker := services.NewImageChecker(carService, cfg.ImageCheckInterval, cfg.ImageCheckRepair)
+	imageChecker.Start()
+
+	// Start purging deleted cars past their retention period in the background
+	deletedCarPurger := services.NewDeletedCarPurger(carService, cfg.DeletedCarRetention, cfg.DeletedCarPurgeInterval)
+	deletedCarPurger.Start()
 
 	// Initialize the router with the routes
 	router := routers.InitRoutes()
@@ -107,6 +175,11 @@ func main() {
 	}
 	log.Println("Server exited properly")
 
+	// Stop the background jobs before the database connection is closed
+	reservationSweeper.Stop()
+	imageChecker.Stop()
+	deletedCarPurger.Stop()
+
 	// Disconnect the MongoDB client
 	if err := client.Disconnect(ctxShutDown); err != nil {
 		log.Fatalf("Error disconnecting from MongoDB: %v", err)
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyPrefix starts every API key, so that keys can be told apart from access tokens and recognized when leaked.
+const APIKeyPrefix = "cdk_"
+
+// APIKeyLastUsedResolution is how precisely the last use of an API key is tracked. The time is only written again once
+// it is this old, so that a busy integration does not cause a write for every request.
+const APIKeyLastUsedResolution = time.Minute
+
+// Scopes of API keys. An API key is granted only what its scopes grant, whatever the role of the user who created it.
+const (
+	ScopeInventoryRead     = "inventory:read"     // Reads cars, along with their customers when combined with customers:read
+	ScopeInventoryWrite    = "inventory:write"    // Creates, edits and deletes cars and their images at their current price
+	ScopePricesWrite       = "prices:write"       // Changes prices and sells cars at a price other than their list price
+	ScopeReservationsWrite = "reservations:write" // Reserves cars and cancels and extends reservations
+	ScopeSalesRead         = "sales:read"         // Reads sales, payments and balances
+	ScopeSalesWrite        = "sales:write"        // Sells and returns cars and records payments
+	ScopeCustomersRead     = "customers:read"     // Reads customers
+	ScopeCustomersWrite    = "customers:write"    // Creates, edits and deletes customers
+)
+
+// HasScope reports whether the scopes include the required scope.
+func HasScope(scopes []string, required string) bool {
+	for _, scope := range scopes {
+		if scope == required {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKey represents a key an integration authenticates with instead of a user. Only a SHA-256 hash of the key is stored.
+type APIKey struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`                          // Unique identifier for the key, set by the service
+	Name       string             `bson:"name" json:"name"`                                 // Name of the integration using the key
+	Prefix     string             `bson:"prefix" json:"prefix"`                             // Start of the key, to recognize it by
+	KeyHash    string             `bson:"keyHash" json:"-"`                                 // Hex-encoded SHA-256 hash of the key
+	Scopes     []string           `bson:"scopes" json:"scopes"`                             // What the key is granted, Scope constants
+	CreatedBy  string             `bson:"createdBy" json:"createdBy"`                       // Username of the admin who created the key
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`                       // Time the key was created
+	LastUsedAt *time.Time         `bson:"lastUsedAt,omitempty" json:"lastUsedAt,omitempty"` // Time the key last authenticated a request, see APIKeyLastUsedResolution
+	RevokedAt  *time.Time         `bson:"revokedAt,omitempty" json:"revokedAt,omitempty"`   // Time the key was revoked, after which it is rejected
+}
+
+// APIKeyRequest represents the details of a new API key.
+type APIKeyRequest struct {
+	Name   string   `json:"name" validate:"required,max=100"`                                                                                                                                 // Name of the integration using the key
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=inventory:read inventory:write prices:write reservations:write sales:read sales:write customers:read customers:write"` // What the key is granted
+}
+
+// CreatedAPIKey represents a new API key together with the key itself, which is only ever returned when it is created.
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"` // The key, to be sent as "Authorization: Bearer <key>"
+}
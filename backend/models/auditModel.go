@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kinds of actors whose changes are recorded in the audit log
+const (
+	ActorKindUser      = "user"      // A user with an access token
+	ActorKindAPIKey    = "apiKey"    // An integration with an API key
+	ActorKindSystem    = "system"    // A background job of the server
+	ActorKindAnonymous = "anonymous" // A caller without credentials
+)
+
+// Entities whose changes are recorded in the audit log
+const (
+	AuditEntityCar      = "car"
+	AuditEntityCustomer = "customer"
+)
+
+// Actions recorded in the audit log in addition to the car actions of models.CarTransitions
+const (
+	AuditActionCreate       = "create"        // The entity was created
+	AuditActionUpdate       = "update"        // The details of the entity were changed
+	AuditActionDelete       = "delete"        // The entity was deleted
+	AuditActionChangeImages = "change-images" // The gallery of a car was changed
+	AuditActionRepairImages = "repair-images" // Missing images were removed from the gallery of a car
+	AuditActionPurge        = "purge"         // A deleted car was removed for good after the retention period
+	AuditActionPayment      = "payment"       // A payment was taken for a car outside of a reservation or sale
+)
+
+// Actor identifies who makes a change, so that it can be recorded in the audit log.
+type Actor struct {
+	Name      string // Username, name of the API key or name of the background job
+	Kind      string // One of the ActorKind constants
+	RequestID string // ID of the request the change is made in, empty for background jobs
+}
+
+// AuditEntry represents a change to a car or a customer. Entries are only ever added, never changed or removed.
+// Before and After hold only the fields that changed, so a created entity has no Before and a deleted one no After.
+type AuditEntry struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`                        // Unique identifier for the entry
+	Entity    string             `bson:"entity" json:"entity"`                           // Kind of entity that changed, one of the AuditEntity constants
+	EntityID  primitive.ObjectID `bson:"entityId" json:"entityId"`                       // ID of the entity that changed
+	Action    string             `bson:"action" json:"action"`                           // What was done to the entity
+	Actor     string             `bson:"actor" json:"actor"`                             // Name of the actor who made the change
+	ActorKind string             `bson:"actorKind" json:"actorKind"`                     // Kind of actor, one of the ActorKind constants
+	RequestID string             `bson:"requestId,omitempty" json:"requestId,omitempty"` // ID of the request the change was made in
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`                     // Time the change was made
+	Before    primitive.M        `bson:"before,omitempty" json:"before,omitempty"`       // Changed fields as they were before the change
+	After     primitive.M        `bson:"after,omitempty" json:"after,omitempty"`         // Changed fields as they are after the change
+}
+
+// AuditQuery represents the filters of an audit log listing. Empty fields do not filter.
+type AuditQuery struct {
+	CarID      *primitive.ObjectID // Only changes to this car
+	CustomerID *primitive.ObjectID // Only changes to this customer
+	Actor      string              // Only changes made by the actor with this name
+	From       *time.Time          // Only changes made at or after this time
+	To         *time.Time          // Only changes made before this time
+}
+
+// AuditPage represents a single page of audit entries returned by a listing.
+type AuditPage struct {
+	Items      []AuditEntry `json:"items"`                // Entries on this page
+	NextCursor string       `json:"nextCursor,omitempty"` // Cursor of the next page, empty when there are no more entries
+	Total      *int64       `json:"total,omitempty"`      // Total number of matching entries, only set when requested
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"io"
+	"time"
+)
+
+// MaxCarImages is the largest number of images a car's gallery can hold.
+const MaxCarImages = 30
+
+// Limits on uploaded car images
+const (
+	DefaultMaxImageSize = 10 << 20 // Largest accepted image file, in bytes, when no limit is configured
+	MaxImageDimension   = 8000     // Largest accepted width and height of an image, in pixels
+)
+
+// ImageContentTypes lists the content types of the images that can be uploaded.
+var ImageContentTypes = []string{"image/jpeg", "image/png", "image/webp"}
+
+// ImageFile represents a stored image that is streamed to a client. Stored images are never changed, so an ID always
+// refers to the same content.
+type ImageFile struct {
+	ID          string            // Identifier of the stored file, which is the original image or one of its variants
+	Content     io.ReadSeekCloser // Image data, read from storage as it is consumed
+	ContentType string            // MIME type of the image data
+	Size        int64             // Length of the image data in bytes
+	UploadedAt  time.Time         // Time the image was stored
+}
+
+// Constants for the sizes car images are served in
+const (
+	ImageSizeOriginal = "original" // The image as it was uploaded
+	ImageSizeThumb    = "thumb"
+	ImageSizeMedium   = "medium"
+	ImageSizeLarge    = "large"
+)
+
+// ImageVariantSizes maps each resized variant of a car image to the length, in pixels, its longer side is scaled down to.
+// Images that are already smaller are not scaled up; they are served in their original size instead.
+var ImageVariantSizes = map[string]int{
+	ImageSizeThumb:  320,
+	ImageSizeMedium: 800,
+	ImageSizeLarge:  1600,
+}
+
+// IsValidImageSize reports whether the size is the original size or one of ImageVariantSizes.
+func IsValidImageSize(size string) bool {
+	_, ok := ImageVariantSizes[size]
+	return ok || size == ImageSizeOriginal
+}
+
+// CarImage represents one image in the gallery of a car. The gallery is ordered by the position of its images.
+type CarImage struct {
+	ID      string `bson:"id" json:"id"`                               // Image store ID of the image
+	Caption string `bson:"caption,omitempty" json:"caption,omitempty"` // Caption shown with the image
+	Primary bool   `bson:"primary" json:"primary"`                     // Whether the image is the car's main photo
+}
+
+// Gallery returns the images of the car in their order. Cars stored before cars had galleries only have a picture,
+// which is returned as a gallery holding that picture as the primary image.
+func (car Car) Gallery() []CarImage {
+	if len(car.Images) > 0 || car.Picture == "" {
+		return car.Images
+	}
+	return []CarImage{{ID: car.Picture, Primary: true}}
+}
+
+// CarImageRequest represents the details uploaded together with a new image of a car.
+type CarImageRequest struct {
+	Caption string `json:"caption" validate:"max=200"` // Caption shown with the image
+	Primary bool   `json:"primary"`                    // Whether the image becomes the car's main photo
+}
+
+// CarImageUpdate represents a change to the caption of an image or to which image is the car's main photo.
+type CarImageUpdate struct {
+	Caption *string `json:"caption" validate:"omitempty,max=200"` // New caption, an empty caption removes it
+	Primary *bool   `json:"primary"`                              // Makes the image the car's main photo when true
+}
+
+// CarImageOrderRequest represents a new order of every image in the gallery of a car.
+type CarImageOrderRequest struct {
+	ImageIDs []string `json:"imageIds" validate:"required,min=1,dive,required"` // IDs of the car's images in their new order
+}
@@ -0,0 +1,79 @@
+package models
+
+import "time"
+
+// DefaultDeletedCarRetention is how long a deleted car can be restored before it is purged when no retention is configured.
+const DefaultDeletedCarRetention = 30 * 24 * time.Hour
+
+// Constants for the actions that move a car between statuses
+const (
+	CarActionReserve           = "reserve"            // Reserve an available car for a customer
+	CarActionCancelReservation = "cancel-reservation" // Release a reserved car
+	CarActionExpireReservation = "expire-reservation" // Release a reserved car whose reservation has expired
+	CarActionExtendReservation = "extend-reservation" // Move the expiry of a reservation, the car stays reserved
+	CarActionSell              = "sell"               // Sell an available car, or a reserved car to the customer who reserved it
+	CarActionReturn            = "return"             // Take back a sold car, which has to be prepared before it is sold again
+	CarActionPrepare           = "prepare"            // Take a car off the market to prepare it for sale
+	CarActionMarkAvailable     = "mark-available"     // Put a prepared car on the market
+	CarActionArchive           = "archive"            // Retire a car that is no longer for sale
+	CarActionDelete            = "delete"             // Archive an available car as deleted, from where it can be restored until it is purged
+	CarActionRestore           = "restore"            // Put a deleted car back on the market
+)
+
+// CarTransition represents an allowed status change of a car.
+type CarTransition struct {
+	From []string // Statuses the car can be in for the action to apply
+	To   string   // Status of the car after the action
+}
+
+// CarTransitions declares every allowed status change of a car, keyed by the action that performs it.
+// Actions that do not change the status, such as extending a reservation, are not listed.
+// Deleted cars are archived, but only CarActionRestore applies to them.
+var CarTransitions = map[string]CarTransition{
+	CarActionReserve:           {From: []string{CarStatusAvailable}, To: CarStatusReserved},
+	CarActionCancelReservation: {From: []string{CarStatusReserved}, To: CarStatusAvailable},
+	CarActionExpireReservation: {From: []string{CarStatusReserved}, To: CarStatusAvailable},
+	CarActionSell:              {From: []string{CarStatusAvailable, CarStatusReserved}, To: CarStatusSold},
+	CarActionReturn:            {From: []string{CarStatusSold}, To: CarStatusInPreparation},
+	CarActionPrepare:           {From: []string{CarStatusAvailable, CarStatusArchived}, To: CarStatusInPreparation},
+	CarActionMarkAvailable:     {From: []string{CarStatusInPreparation}, To: CarStatusAvailable},
+	CarActionArchive:           {From: []string{CarStatusAvailable, CarStatusInPreparation}, To: CarStatusArchived},
+	CarActionDelete:            {From: []string{CarStatusAvailable}, To: CarStatusArchived},
+	CarActionRestore:           {From: []string{CarStatusArchived}, To: CarStatusAvailable},
+}
+
+// CarStatusActions maps the statuses that can be set directly, without a customer, to the action that sets them.
+var CarStatusActions = map[string]string{
+	CarStatusInPreparation: CarActionPrepare,
+	CarStatusAvailable:     CarActionMarkAvailable,
+	CarStatusArchived:      CarActionArchive,
+}
+
+// CarEditableStatuses lists the statuses in which the details of a car can be edited.
+// Reserved and sold cars keep the details they were reserved or sold with, and archived cars have to be prepared first.
+var CarEditableStatuses = []string{CarStatusAvailable, CarStatusInPreparation}
+
+// IsEditableCarStatus reports whether the details of a car in the given status can be edited.
+func IsEditableCarStatus(status string) bool {
+	for _, s := range CarEditableStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the transition can be applied to a car in the given status.
+func (t CarTransition) Allows(status string) bool {
+	for _, from := range t.From {
+		if from == status {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusChangeRequest represents a request to move a car to a status that does not involve a customer.
+type StatusChangeRequest struct {
+	Status string `json:"status" validate:"required,oneof=in-preparation available archived"` // Status to move the car to
+}
@@ -1,22 +1,46 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // Constants for car statuses
 const (
-	CarStatusAvailable = "available"
-	CarStatusReserved  = "reserved"
-	CarStatusSold      = "sold"
+	CarStatusAvailable     = "available"
+	CarStatusReserved      = "reserved"
+	CarStatusSold          = "sold"
+	CarStatusInPreparation = "in-preparation"
+	CarStatusArchived      = "archived"
 )
 
+// CarStatuses lists every status a car can be in.
+var CarStatuses = []string{CarStatusAvailable, CarStatusReserved, CarStatusSold, CarStatusInPreparation, CarStatusArchived}
+
+// IsValidCarStatus reports whether the status is one of the car status constants.
+func IsValidCarStatus(status string) bool {
+	for _, s := range CarStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
 // Car represents a car in the dealership.
 type Car struct {
-	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`                                      // Unique identifier for the car
-	Make     string             `bson:"make" json:"make" validate:"required"`                                   // Manufacturer of the car
-	Model    string             `bson:"model" json:"model" validate:"required"`                                 // Model of the car
-	Year     int                `bson:"year" json:"year" validate:"required,min=1900"`                          // Year of manufacture
-	Price    float64            `bson:"price" json:"price" validate:"required,min=1"`                           // Price of the car
-	Status   string             `bson:"status" json:"status" validate:"required,oneof=available reserved sold"` // Current status of the car
-	Customer *Customer          `bson:"customer,omitempty" json:"customer,omitempty"`                           // Customer associated with the car (if any)
-	Picture  string             `bson:"picture" json:"picture" validate:"required"`                             // GridFS file ID for the car's image
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`                                                              // Unique identifier for the car
+	Make         string             `bson:"make" json:"make" validate:"required"`                                                           // Manufacturer of the car
+	Model        string             `bson:"model" json:"model" validate:"required"`                                                         // Model of the car
+	Year         int                `bson:"year" json:"year" validate:"required,min=1900"`                                                  // Year of manufacture
+	Price        float64            `bson:"price" json:"price" validate:"required,min=1"`                                                   // Price of the car
+	Status       string             `bson:"status" json:"status" validate:"required,oneof=available reserved sold in-preparation archived"` // Current status of the car
+	Customer     *Customer          `bson:"customer,omitempty" json:"customer,omitempty"`                                                   // Customer associated with the car (if any)
+	Reservation  *Reservation       `bson:"reservation,omitempty" json:"reservation,omitempty"`                                             // Hold on a reserved car (if any)
+	StatusReason string             `bson:"statusReason,omitempty" json:"statusReason,omitempty"`                                           // Why the car was moved to its status, set when the system changed it
+	Picture      string             `bson:"picture" json:"picture" validate:"required"`                                                     // Image store ID of the car's primary image
+	Images       []CarImage         `bson:"images,omitempty" json:"images,omitempty"`                                                       // Ordered gallery of the car's images, see Gallery
+	Version      int64              `bson:"version" json:"version"`                                                                         // Incremented on every change, used to detect concurrent updates
+	DeletedAt    *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`                                                 // Time the car was deleted, after which it is archived until it is restored or purged
 }
@@ -0,0 +1,13 @@
+package models
+
+// MergePatchContentType is the media type of JSON Merge Patch documents (RFC 7396).
+const MergePatchContentType = "application/merge-patch+json"
+
+// CarPatch represents a JSON Merge Patch of the details of a car. Only the fields present in the patch are changed.
+// The fields of a car are required, so a patch can change them but not remove them.
+type CarPatch struct {
+	Make  *string  `json:"make" validate:"omitempty,min=1"`    // New manufacturer of the car
+	Model *string  `json:"model" validate:"omitempty,min=1"`   // New model of the car
+	Year  *int     `json:"year" validate:"omitempty,min=1900"` // New year of manufacture
+	Price *float64 `json:"price" validate:"omitempty,min=1"`   // New price of the car
+}
@@ -0,0 +1,46 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Constants for sort directions
+const (
+	SortAscending  = 1
+	SortDescending = -1
+)
+
+// CarSortFields maps the sort keys accepted by the API to the car document fields they order by.
+// ObjectIDs grow with their creation time, so sorting by "_id" orders cars by the date they were created.
+var CarSortFields = map[string]string{
+	"price":   "price",
+	"year":    "year",
+	"created": "_id",
+}
+
+// Constants for how a car query treats deleted cars
+const (
+	DeletedCarsExclude = "exclude" // Leave deleted cars out, the default
+	DeletedCarsInclude = "include" // List deleted cars along with the others
+	DeletedCarsOnly    = "only"    // List only deleted cars
+)
+
+// CarSortField represents a single field used to order car search results.
+type CarSortField struct {
+	Field     string // Car document field to sort on
+	Direction int    // SortAscending or SortDescending
+}
+
+// CarQuery represents the filters and ordering used to search the car inventory.
+// Zero values mean that the corresponding filter is not applied.
+type CarQuery struct {
+	Make       string              `validate:"omitempty,max=100"`                                               // Exact make, matched case-insensitively
+	Model      string              `validate:"omitempty,max=100"`                                               // Exact model, matched case-insensitively
+	MinYear    int                 `validate:"omitempty,min=1900"`                                              // Lowest year of manufacture
+	MaxYear    int                 `validate:"omitempty,min=1900,gtefield=MinYear"`                             // Highest year of manufacture
+	MinPrice   float64             `validate:"omitempty,min=0"`                                                 // Lowest price
+	MaxPrice   float64             `validate:"omitempty,min=0,gtefield=MinPrice"`                               // Highest price
+	Text       string              `validate:"omitempty,max=100"`                                               // Free text matched against make and model
+	Status     string              `validate:"omitempty,oneof=available reserved sold in-preparation archived"` // Current status of the car
+	CustomerID *primitive.ObjectID // Customer who reserved or bought the car
+	Sort       []CarSortField      // Ordering of the results, applied in the given order
+	Deleted    string              `validate:"omitempty,oneof=exclude include only"` // Whether deleted cars are left out (the default), included or the only ones listed
+}
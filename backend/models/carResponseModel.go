@@ -0,0 +1,96 @@
+package models
+
+import "time"
+
+// APIVersion is the version of the response shapes defined in the models package.
+// It is sent in the API-Version header of every JSON response and changes whenever a response shape changes incompatibly.
+const APIVersion = "1"
+
+// CarResponse represents a car as it is returned by the API.
+type CarResponse struct {
+	ID           string               `json:"id"`                     // Unique identifier for the car
+	Make         string               `json:"make"`                   // Manufacturer of the car
+	Model        string               `json:"model"`                  // Model of the car
+	Year         int                  `json:"year"`                   // Year of manufacture
+	Price        float64              `json:"price"`                  // Price of the car
+	Status       string               `json:"status"`                 // Current status of the car
+	Customer     *CustomerResponse    `json:"customer,omitempty"`     // Customer who reserved or bought the car (if any)
+	Reservation  *ReservationResponse `json:"reservation,omitempty"`  // Hold on the car while it is reserved
+	StatusReason string               `json:"statusReason,omitempty"` // Why the system moved the car to its status (if it did)
+	Picture      string               `json:"picture"`                // Identifier of the car's primary image, used with GET /cars/image/{id}
+	Images       []CarImageResponse   `json:"images"`                 // Images of the car in their order
+	Version      int64                `json:"version"`                // Version of the car, sent as its ETag
+	DeletedAt    *time.Time           `json:"deletedAt,omitempty"`    // Time the car was deleted, until it is restored or purged
+}
+
+// ReservationResponse represents the hold on a reserved car as it is returned by the API.
+type ReservationResponse struct {
+	ReservedAt time.Time `json:"reservedAt"` // Time the car was reserved
+	ExpiresAt  time.Time `json:"expiresAt"`  // Time the car is made available again unless the reservation is extended
+}
+
+// CarImageResponse represents an image in the gallery of a car as it is returned by the API.
+type CarImageResponse struct {
+	ID      string `json:"id"`                // Identifier of the image
+	Caption string `json:"caption,omitempty"` // Caption shown with the image
+	Primary bool   `json:"primary"`           // Whether the image is the car's main photo
+	URL     string `json:"url"`               // Path the image data is served from
+}
+
+// CarListResponse represents a page of cars as it is returned by the API.
+type CarListResponse struct {
+	Items      []CarResponse `json:"items"`                // Cars on this page
+	NextCursor string        `json:"nextCursor,omitempty"` // Cursor of the next page, empty when there are no more cars
+	Total      *int64        `json:"total,omitempty"`      // Total number of matching cars, only set when requested
+}
+
+// NewCarResponse converts a car into its API response shape.
+func NewCarResponse(car Car) CarResponse {
+	response := CarResponse{
+		ID:           car.ID.Hex(),
+		Make:         car.Make,
+		Model:        car.Model,
+		Year:         car.Year,
+		Price:        car.Price,
+		Status:       car.Status,
+		StatusReason: car.StatusReason,
+		Picture:      car.Picture,
+		Images:       NewCarImageResponses(car.Gallery()),
+		Version:      car.Version,
+		DeletedAt:    car.DeletedAt,
+	}
+	if car.Customer != nil {
+		customer := NewCustomerResponse(*car.Customer)
+		response.Customer = &customer
+	}
+	if car.Reservation != nil {
+		response.Reservation = &ReservationResponse{
+			ReservedAt: car.Reservation.ReservedAt,
+			ExpiresAt:  car.Reservation.ExpiresAt,
+		}
+	}
+	return response
+}
+
+// NewCarImageResponses converts the gallery of a car into its API response shape.
+func NewCarImageResponses(images []CarImage) []CarImageResponse {
+	responses := make([]CarImageResponse, len(images))
+	for i, image := range images {
+		responses[i] = CarImageResponse{
+			ID:      image.ID,
+			Caption: image.Caption,
+			Primary: image.Primary,
+			URL:     "/cars/image/" + image.ID,
+		}
+	}
+	return responses
+}
+
+// NewCarListResponse converts a page of cars into its API response shape.
+func NewCarListResponse(page CarPage) CarListResponse {
+	items := make([]CarResponse, len(page.Items))
+	for i, car := range page.Items {
+		items[i] = NewCarResponse(car)
+	}
+	return CarListResponse{Items: items, NextCursor: page.NextCursor, Total: page.Total}
+}
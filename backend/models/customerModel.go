@@ -1,8 +1,24 @@
 package models
 
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
 // Customer represents a customer in the dealership system.
+// Cars and sales keep a copy of the customer as it was when the car was reserved or sold, including its ID.
 type Customer struct {
-	FullName    string `bson:"fullName" json:"fullName" validate:"required"`              // Full name of the customer
-	Email       string `bson:"email" json:"email" validate:"required,email"`              // Email address of the customer
-	PhoneNumber string `bson:"phoneNumber" json:"phoneNumber" validate:"required,number"` // Phone number of the customer
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"-"`                                    // Unique identifier for the customer, set by the service
+	FullName    string             `bson:"fullName" json:"fullName" validate:"required"`              // Full name of the customer
+	Email       string             `bson:"email" json:"email" validate:"required,email"`              // Email address of the customer
+	PhoneNumber string             `bson:"phoneNumber" json:"phoneNumber" validate:"required,number"` // Phone number of the customer
+}
+
+// CustomerQuery represents the filters of a customer listing. Empty fields do not filter.
+type CustomerQuery struct {
+	Text string `validate:"omitempty,max=100"` // Case-insensitive text matched against the name, email and phone number
+}
+
+// CustomerPage represents a single page of customers returned by a listing.
+type CustomerPage struct {
+	Items      []Customer `json:"items"`                // Customers on this page
+	NextCursor string     `json:"nextCursor,omitempty"` // Cursor of the next page, empty when there are no more customers
+	Total      *int64     `json:"total,omitempty"`      // Total number of matching customers, only set when requested
 }
@@ -0,0 +1,38 @@
+package models
+
+// CustomerResponse represents a customer as it is returned by the API.
+type CustomerResponse struct {
+	ID          string `json:"id,omitempty"` // Unique identifier for the customer, empty for customers recorded before customers had their own collection
+	FullName    string `json:"fullName"`     // Full name of the customer
+	Email       string `json:"email"`        // Email address of the customer
+	PhoneNumber string `json:"phoneNumber"`  // Phone number of the customer
+}
+
+// CustomerListResponse represents a page of customers as it is returned by the API.
+type CustomerListResponse struct {
+	Items      []CustomerResponse `json:"items"`                // Customers on this page
+	NextCursor string             `json:"nextCursor,omitempty"` // Cursor of the next page, empty when there are no more customers
+	Total      *int64             `json:"total,omitempty"`      // Total number of matching customers, only set when requested
+}
+
+// NewCustomerResponse converts a customer into its API response shape.
+func NewCustomerResponse(customer Customer) CustomerResponse {
+	response := CustomerResponse{
+		FullName:    customer.FullName,
+		Email:       customer.Email,
+		PhoneNumber: customer.PhoneNumber,
+	}
+	if !customer.ID.IsZero() {
+		response.ID = customer.ID.Hex()
+	}
+	return response
+}
+
+// NewCustomerListResponse converts a page of customers into its API response shape.
+func NewCustomerListResponse(page CustomerPage) CustomerListResponse {
+	items := make([]CustomerResponse, len(page.Items))
+	for i, customer := range page.Items {
+		items[i] = NewCustomerResponse(customer)
+	}
+	return CustomerListResponse{Items: items, NextCursor: page.NextCursor, Total: page.Total}
+}
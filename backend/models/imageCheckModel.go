@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// OrphanedImageGracePeriod is how old a stored image has to be before it counts as orphaned. Images are stored before the
+// car referring to them is saved, so younger images may belong to a request that is still in progress.
+const OrphanedImageGracePeriod = time.Hour
+
+// DefaultImageCheckInterval is how often the consistency of car images is checked when no interval is configured.
+const DefaultImageCheckInterval = 24 * time.Hour
+
+// ImageCheckReport represents the result of checking that the images cars refer to and the stored images match.
+type ImageCheckReport struct {
+	CheckedAt      time.Time         `json:"checkedAt"`      // Time the check started
+	Repaired       bool              `json:"repaired"`       // Whether the problems found were repaired
+	StoredImages   int               `json:"storedImages"`   // Number of files in the image store, including variants
+	CheckedCars    int               `json:"checkedCars"`    // Number of cars whose images were checked
+	OrphanedImages []OrphanedImage   `json:"orphanedImages"` // Stored files that no car refers to
+	MissingImages  []MissingCarImage `json:"missingImages"`  // Images cars refer to that are not stored
+}
+
+// OrphanedImage represents a stored file that no car refers to. Variants are orphaned when their original image is.
+type OrphanedImage struct {
+	ID         string    `json:"id"`                   // Image store ID of the file
+	OriginalID string    `json:"originalId,omitempty"` // ID of the original image when the file is a variant
+	UploadedAt time.Time `json:"uploadedAt"`           // Time the file was stored
+	Deleted    bool      `json:"deleted"`              // Whether the file was deleted by the repair
+}
+
+// MissingCarImage represents an image in the gallery of a car that is not in the image store.
+type MissingCarImage struct {
+	CarID   string `json:"carId"`   // ID of the car referring to the image
+	ImageID string `json:"imageId"` // Image store ID of the missing image
+	Primary bool   `json:"primary"` // Whether the image is the car's main photo
+	Removed bool   `json:"removed"` // Whether the repair removed the image from the gallery of the car
+}
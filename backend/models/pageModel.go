@@ -0,0 +1,21 @@
+package models
+
+// Constants for page sizes
+const (
+	DefaultPageLimit = 20  // Number of items returned when no limit is requested
+	MaxPageLimit     = 100 // Largest number of items that can be requested at once
+)
+
+// PageRequest represents the page of a listing requested by a client.
+type PageRequest struct {
+	Limit        int    `validate:"min=1,max=100"` // Maximum number of items to return
+	Cursor       string // Opaque cursor returned as NextCursor with the previous page, empty for the first page
+	IncludeTotal bool   // Whether the total number of matching items should be counted
+}
+
+// CarPage represents a single page of cars returned by a listing.
+type CarPage struct {
+	Items      []Car  `json:"items"`                // Cars on this page
+	NextCursor string `json:"nextCursor,omitempty"` // Cursor of the next page, empty when there are no more cars
+	Total      *int64 `json:"total,omitempty"`      // Total number of matching cars, only set when requested
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Constants for payment types
+const (
+	PaymentTypeDeposit = "deposit" // Paid while the car is reserved
+	PaymentTypeSale    = "sale"    // Paid when or after the car is sold
+	PaymentTypeRefund  = "refund"  // Returned to the customer when a reservation or sale is undone
+)
+
+// Constants for payment methods
+const (
+	PaymentMethodCash         = "cash"
+	PaymentMethodCard         = "card"
+	PaymentMethodBankTransfer = "bank-transfer"
+	PaymentMethodFinancing    = "financing"
+)
+
+// Payment represents money received for a car or returned to a customer.
+type Payment struct {
+	ID        primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`            // Unique identifier for the payment
+	CarID     primitive.ObjectID  `bson:"carId" json:"carId"`                           // Car the payment belongs to
+	Type      string              `bson:"type" json:"type"`                             // Type of the payment
+	Method    string              `bson:"method" json:"method"`                         // How the money was paid
+	Amount    float64             `bson:"amount" json:"amount"`                         // Amount of money, always positive
+	RefundOf  *primitive.ObjectID `bson:"refundOf,omitempty" json:"refundOf,omitempty"` // Payment that is returned by a refund
+	CreatedAt time.Time           `bson:"createdAt" json:"createdAt"`                   // Time the payment was recorded
+}
+
+// PaymentRequest represents a payment received from a customer.
+type PaymentRequest struct {
+	Amount float64 `json:"amount" validate:"required,gt=0"`                                    // Amount of money paid
+	Method string  `json:"method" validate:"required,oneof=cash card bank-transfer financing"` // How the money was paid
+}
+
+// CarBalance represents how much of the price of a car has been paid.
+type CarBalance struct {
+	CarID      primitive.ObjectID // Car the balance belongs to
+	Price      float64            // Price of the car
+	Paid       float64            // Payments received, less refunds
+	BalanceDue float64            // Amount still to be paid
+}
+
+// ReservationRequest represents a request to reserve a car for a customer, optionally with a deposit.
+// The customer is either an existing customer identified by CustomerID or inline customer details.
+type ReservationRequest struct {
+	CustomerID *primitive.ObjectID `json:"customerId,omitempty"` // Existing customer reserving the car
+	Customer
+	Deposit *PaymentRequest `json:"deposit,omitempty"` // Deposit paid with the reservation (if any)
+}
+
+// SaleRequest represents a request to sell a car to a customer, optionally with the payments received.
+// The customer is either an existing customer identified by CustomerID or inline customer details.
+type SaleRequest struct {
+	CustomerID *primitive.ObjectID `json:"customerId,omitempty"` // Existing customer buying the car
+	Customer
+	Price    *float64         `json:"price,omitempty" validate:"omitempty,gt=0"` // Agreed price, the list price of the car when omitted
+	Payments []PaymentRequest `json:"payments,omitempty" validate:"dive"`        // Payments received with the sale (if any)
+}
@@ -0,0 +1,62 @@
+package models
+
+import "time"
+
+// PaymentResponse represents a payment as it is returned by the API.
+type PaymentResponse struct {
+	ID        string    `json:"id"`                 // Unique identifier for the payment
+	CarID     string    `json:"carId"`              // Car the payment belongs to
+	Type      string    `json:"type"`               // Type of the payment: deposit, sale or refund
+	Method    string    `json:"method"`             // How the money was paid
+	Amount    float64   `json:"amount"`             // Amount of money, always positive
+	RefundOf  string    `json:"refundOf,omitempty"` // Payment that is returned by a refund
+	CreatedAt time.Time `json:"createdAt"`          // Time the payment was recorded
+}
+
+// PaymentListResponse represents the payments of a car as they are returned by the API.
+type PaymentListResponse struct {
+	Items []PaymentResponse `json:"items"` // Payments and refunds, from oldest to newest
+}
+
+// CarBalanceResponse represents the balance of a car as it is returned by the API.
+type CarBalanceResponse struct {
+	CarID      string  `json:"carId"`      // Car the balance belongs to
+	Price      float64 `json:"price"`      // Price of the car
+	Paid       float64 `json:"paid"`       // Payments received, less refunds
+	BalanceDue float64 `json:"balanceDue"` // Amount still to be paid
+}
+
+// NewPaymentResponse converts a payment into its API response shape.
+func NewPaymentResponse(payment Payment) PaymentResponse {
+	response := PaymentResponse{
+		ID:        payment.ID.Hex(),
+		CarID:     payment.CarID.Hex(),
+		Type:      payment.Type,
+		Method:    payment.Method,
+		Amount:    payment.Amount,
+		CreatedAt: payment.CreatedAt,
+	}
+	if payment.RefundOf != nil {
+		response.RefundOf = payment.RefundOf.Hex()
+	}
+	return response
+}
+
+// NewPaymentListResponse converts the payments of a car into their API response shape.
+func NewPaymentListResponse(payments []Payment) PaymentListResponse {
+	items := make([]PaymentResponse, len(payments))
+	for i, payment := range payments {
+		items[i] = NewPaymentResponse(payment)
+	}
+	return PaymentListResponse{Items: items}
+}
+
+// NewCarBalanceResponse converts the balance of a car into its API response shape.
+func NewCarBalanceResponse(balance CarBalance) CarBalanceResponse {
+	return CarBalanceResponse{
+		CarID:      balance.CarID.Hex(),
+		Price:      balance.Price,
+		Paid:       balance.Paid,
+		BalanceDue: balance.BalanceDue,
+	}
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// DefaultReservationHoldPeriod is how long a reservation holds a car when no hold period is configured.
+const DefaultReservationHoldPeriod = 72 * time.Hour
+
+// StatusReasonReservationExpired is recorded on a car that was made available again because its reservation expired.
+const StatusReasonReservationExpired = "reservation expired"
+
+// Reservation represents the hold a customer has on a reserved car.
+type Reservation struct {
+	ReservedAt time.Time `bson:"reservedAt" json:"reservedAt"` // Time the car was reserved
+	ExpiresAt  time.Time `bson:"expiresAt" json:"expiresAt"`   // Time the car is made available again unless the reservation is extended
+}
+
+// ExtendReservationRequest represents a request to move the expiry of a reservation.
+type ExtendReservationRequest struct {
+	ExpiresAt time.Time `json:"expiresAt" validate:"required"` // New expiry of the reservation
+}
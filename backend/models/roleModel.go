@@ -0,0 +1,28 @@
+package models
+
+// Roles of users, from the most to the least privileged
+const (
+	RoleAdmin       = "admin"       // Manages user accounts and the system, and can do anything a manager can
+	RoleManager     = "manager"     // Manages the inventory: adds and deletes cars, sets prices and takes back sold cars
+	RoleSalesperson = "salesperson" // Serves customers: reserves and sells cars at their price, edits listings and records payments
+	RoleViewer      = "viewer"      // Reads sales, payments and customers
+)
+
+// roleRanks orders the roles; a role is granted everything the roles ranked below it are granted.
+var roleRanks = map[string]int{
+	RoleViewer:      1,
+	RoleSalesperson: 2,
+	RoleManager:     3,
+	RoleAdmin:       4,
+}
+
+// HasRole reports whether a user with the given role may do what the required role may do. Unknown roles are granted nothing.
+func HasRole(role, required string) bool {
+	rank, ok := roleRanks[role]
+	return ok && rank >= roleRanks[required]
+}
+
+// RoleRequest represents a request to change the role of a user.
+type RoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=admin manager salesperson viewer"` // New role of the user
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Sale represents the record of a car being sold. Sales are never changed once they are recorded.
+type Sale struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`                  // Unique identifier for the sale
+	CarID       primitive.ObjectID `bson:"carId" json:"carId"`                                 // Car that was sold
+	Car         CarSnapshot        `bson:"car" json:"car"`                                     // Car as it was when it was sold
+	Customer    Customer           `bson:"customer" json:"customer"`                           // Customer who bought the car
+	Price       float64            `bson:"price" json:"price"`                                 // Price the car was sold for
+	Paid        float64            `bson:"paid" json:"paid"`                                   // Amount paid, less refunds, when the car was sold
+	Salesperson string             `bson:"salesperson,omitempty" json:"salesperson,omitempty"` // Salesperson who made the sale (if recorded)
+	SoldAt      time.Time          `bson:"soldAt" json:"soldAt"`                               // Time the car was sold
+}
+
+// CarSnapshot holds the details of a car at the time it was sold.
+type CarSnapshot struct {
+	Make      string  `bson:"make" json:"make"`           // Manufacturer of the car
+	Model     string  `bson:"model" json:"model"`         // Model of the car
+	Year      int     `bson:"year" json:"year"`           // Year of manufacture
+	ListPrice float64 `bson:"listPrice" json:"listPrice"` // Price the car was listed for
+	Picture   string  `bson:"picture" json:"picture"`     // Identifier of the car's image
+}
+
+// SaleQuery represents the filters of a sales listing. Empty fields do not filter.
+type SaleQuery struct {
+	CarID       *primitive.ObjectID // Only sales of this car
+	CustomerID  *primitive.ObjectID // Only sales to this customer
+	Salesperson string              // Only sales made by this salesperson
+}
+
+// SalePage represents a single page of sales returned by a listing.
+type SalePage struct {
+	Items      []Sale `json:"items"`                // Sales on this page
+	NextCursor string `json:"nextCursor,omitempty"` // Cursor of the next page, empty when there are no more sales
+	Total      *int64 `json:"total,omitempty"`      // Total number of matching sales, only set when requested
+}
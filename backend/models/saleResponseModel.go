@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// SaleResponse represents a sale as it is returned by the API.
+type SaleResponse struct {
+	ID          string              `json:"id"`                    // Unique identifier for the sale
+	CarID       string              `json:"carId"`                 // Car that was sold
+	Car         CarSnapshotResponse `json:"car"`                   // Car as it was when it was sold
+	Customer    *CustomerResponse   `json:"customer,omitempty"`    // Customer who bought the car, left out for callers who may not read customers
+	Price       float64             `json:"price"`                 // Price the car was sold for
+	Paid        float64             `json:"paid"`                  // Amount paid, less refunds, when the car was sold
+	Salesperson string              `json:"salesperson,omitempty"` // Salesperson who made the sale (if recorded)
+	SoldAt      time.Time           `json:"soldAt"`                // Time the car was sold
+}
+
+// CarSnapshotResponse represents the details of a car at the time it was sold as they are returned by the API.
+type CarSnapshotResponse struct {
+	Make      string  `json:"make"`      // Manufacturer of the car
+	Model     string  `json:"model"`     // Model of the car
+	Year      int     `json:"year"`      // Year of manufacture
+	ListPrice float64 `json:"listPrice"` // Price the car was listed for
+	Picture   string  `json:"picture"`   // Identifier of the car's image
+}
+
+// SaleListResponse represents a page of sales as it is returned by the API.
+type SaleListResponse struct {
+	Items      []SaleResponse `json:"items"`                // Sales on this page
+	NextCursor string         `json:"nextCursor,omitempty"` // Cursor of the next page, empty when there are no more sales
+	Total      *int64         `json:"total,omitempty"`      // Total number of matching sales, only set when requested
+}
+
+// NewSaleResponse converts a sale into its API response shape.
+func NewSaleResponse(sale Sale) SaleResponse {
+	customer := NewCustomerResponse(sale.Customer)
+	return SaleResponse{
+		ID:    sale.ID.Hex(),
+		CarID: sale.CarID.Hex(),
+		Car: CarSnapshotResponse{
+			Make:      sale.Car.Make,
+			Model:     sale.Car.Model,
+			Year:      sale.Car.Year,
+			ListPrice: sale.Car.ListPrice,
+			Picture:   sale.Car.Picture,
+		},
+		Customer:    &customer,
+		Price:       sale.Price,
+		Paid:        sale.Paid,
+		Salesperson: sale.Salesperson,
+		SoldAt:      sale.SoldAt,
+	}
+}
+
+// NewSaleListResponse converts a page of sales into its API response shape.
+func NewSaleListResponse(page SalePage) SaleListResponse {
+	items := make([]SaleResponse, len(page.Items))
+	for i, sale := range page.Items {
+		items[i] = NewSaleResponse(sale)
+	}
+	return SaleListResponse{Items: items, NextCursor: page.NextCursor, Total: page.Total}
+}
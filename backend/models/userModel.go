@@ -0,0 +1,75 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultAccessTokenLifetime is how long an access token is valid when no lifetime is configured.
+const DefaultAccessTokenLifetime = 15 * time.Minute
+
+// DefaultRefreshTokenLifetime is how long a refresh token is valid when no lifetime is configured.
+const DefaultRefreshTokenLifetime = 7 * 24 * time.Hour
+
+// TokenTypeBearer is the type of the access tokens issued by the API, to be sent as "Authorization: Bearer <token>".
+const TokenTypeBearer = "Bearer"
+
+// User represents an account of a member of the dealership staff.
+type User struct {
+	ID           primitive.ObjectID `bson:"_id,omitempty" json:"id"`    // Unique identifier for the user, set by the service
+	Username     string             `bson:"username" json:"username"`   // Name the user logs in with, in lower case
+	PasswordHash string             `bson:"passwordHash" json:"-"`      // bcrypt hash of the password of the user
+	Role         string             `bson:"role" json:"role"`           // Role of the user, one of the Role constants
+	CreatedAt    time.Time          `bson:"createdAt" json:"createdAt"` // Time the account was created
+}
+
+// UserRequest represents the details of a new user account.
+// Passwords are limited to 72 bytes, the most bcrypt takes into account.
+type UserRequest struct {
+	Username string `json:"username" validate:"required,alphanum,min=3,max=50"`              // Name the user logs in with, compared case-insensitively
+	Password string `json:"password" validate:"required,min=8,max=72"`                       // Password of the user
+	Role     string `json:"role" validate:"required,oneof=admin manager salesperson viewer"` // Role of the user
+}
+
+// LoginRequest represents the credentials a user logs in with.
+type LoginRequest struct {
+	Username string `json:"username" validate:"required"` // Name of the user
+	Password string `json:"password" validate:"required"` // Password of the user
+}
+
+// RefreshRequest represents a request to exchange a refresh token for new tokens, or to revoke it when logging out.
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken" validate:"required"` // Refresh token issued by a login or an earlier refresh
+}
+
+// TokenPair represents the tokens issued to a user that logged in or refreshed their tokens.
+type TokenPair struct {
+	AccessToken  string `json:"accessToken"`  // Signed JWT authenticating requests of the user
+	TokenType    string `json:"tokenType"`    // Type of the access token, always Bearer
+	ExpiresIn    int64  `json:"expiresIn"`    // Number of seconds the access token is valid for
+	RefreshToken string `json:"refreshToken"` // Signed JWT that can be exchanged once for new tokens
+}
+
+// Principal represents the authenticated caller of a request, a user or an integration with an API key.
+type Principal struct {
+	UserID   primitive.ObjectID // ID of the user, zero for API keys
+	Username string             // Name of the user, or of the API key
+	Role     string             // Role of the user when the access token was issued, empty for API keys
+	APIKeyID primitive.ObjectID // ID of the API key, zero for users
+	Scopes   []string           // Scopes of the API key
+}
+
+// IsAPIKey reports whether the caller authenticated with an API key rather than as a user.
+func (p Principal) IsAPIKey() bool {
+	return !p.APIKeyID.IsZero()
+}
+
+// Allows reports whether the caller may do what the given role, or for API keys the given scope, is granted.
+// API keys are refused when no scope is given.
+func (p Principal) Allows(role, scope string) bool {
+	if p.IsAPIKey() {
+		return scope != "" && HasScope(p.Scopes, scope)
+	}
+	return HasRole(p.Role, role)
+}
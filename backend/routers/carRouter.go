@@ -3,46 +3,203 @@ package routers
 import (
 	"github.com/gorilla/mux"
 	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
 )
 
 // InitRoutes initializes the routes for car-related operations.
+// Every request is given an ID, returned in the X-Request-ID header and recorded with the changes made in it.
+// Bearer tokens, access tokens of users or API keys of integrations, are checked for every route. Routes wrapped in
+// RequireRole reject anonymous requests, users below the given role, where admin > manager > salesperson > viewer,
+// and API keys; routes wrapped in RequireRoleOrScope accept API keys with the given scope instead. The other routes
+// are open to anyone.
 func InitRoutes() *mux.Router {
 	carRouter := mux.NewRouter()
+	carRouter.Use(handlers.AssignRequestID, handlers.Authenticate)
 
 	// Health endpoint
 	carRouter.HandleFunc("/health", handlers.HealthCheck).Methods("GET")
 
+	// Authentication
+
+	// POST /auth/login
+	// Log in with a username and password, receiving an access and a refresh token.
+	carRouter.HandleFunc("/auth/login", handlers.Login).Methods("POST")
+
+	// POST /auth/refresh
+	// Exchange a refresh token for a new access and refresh token.
+	carRouter.HandleFunc("/auth/refresh", handlers.RefreshTokens).Methods("POST")
+
+	// POST /auth/logout
+	// Revoke a refresh token.
+	carRouter.HandleFunc("/auth/logout", handlers.Logout).Methods("POST")
+
+	// User accounts
+
+	// GET /users
+	// Fetch every user account, ordered by username.
+	carRouter.HandleFunc("/users", handlers.RequireRole(models.RoleAdmin, handlers.GetUsers)).Methods("GET")
+
+	// POST /users
+	// Create a new user account with a role.
+	carRouter.HandleFunc("/users", handlers.RequireRole(models.RoleAdmin, handlers.CreateUser)).Methods("POST")
+
+	// PUT /users/{id}/role
+	// Change the role of a user by its ID.
+	carRouter.HandleFunc("/users/{id}/role", handlers.RequireRole(models.RoleAdmin, handlers.SetUserRole)).Methods("PUT")
+
+	// API keys
+
+	// GET /api-keys
+	// Fetch every API key, including revoked ones, newest first.
+	carRouter.HandleFunc("/api-keys", handlers.RequireRole(models.RoleAdmin, handlers.GetAPIKeys)).Methods("GET")
+
+	// POST /api-keys
+	// Create a new API key with scopes; the key is only returned by this request.
+	carRouter.HandleFunc("/api-keys", handlers.RequireRole(models.RoleAdmin, handlers.CreateAPIKey)).Methods("POST")
+
+	// DELETE /api-keys/{id}
+	// Revoke an API key by its ID.
+	carRouter.HandleFunc("/api-keys/{id}", handlers.RequireRole(models.RoleAdmin, handlers.RevokeAPIKey)).Methods("DELETE")
+
 	// CRUD operations on cars
 
-	// GET /cars/{status}
-	// Fetch cars by their status (e.g., available, reserved, sold).
-	carRouter.HandleFunc("/cars/{status}", handlers.GetCarsByStatus).Methods("GET")
+	// GET /cars
+	// Search cars by make, model, year range, price range and free text, with sorting.
+	carRouter.HandleFunc("/cars", handlers.RequireRoleOrScope(models.RoleViewer, models.ScopeInventoryRead, handlers.SearchCars)).Methods("GET")
+
+	// GET /cars/status/{status}
+	// Fetch cars by their status (e.g., available, reserved, sold, in-preparation, archived).
+	carRouter.HandleFunc("/cars/status/{status}", handlers.RequireRoleOrScope(models.RoleViewer, models.ScopeInventoryRead, handlers.GetCarsByStatus)).Methods("GET")
+
+	// GET /cars/{id}
+	// Fetch a single car, including its customer, by its ID.
+	carRouter.HandleFunc("/cars/{id}", handlers.RequireRoleOrScope(models.RoleViewer, models.ScopeInventoryRead, handlers.GetCarByID)).Methods("GET")
 
 	// POST /cars
 	// Create a new car.
-	carRouter.HandleFunc("/cars", handlers.CreateCar).Methods("POST")
+	carRouter.HandleFunc("/cars", handlers.RequireRoleOrScope(models.RoleManager, models.ScopeInventoryWrite, handlers.CreateCar)).Methods("POST")
 
 	// PUT /cars/{id}
-	// Update an existing car by its ID.
-	carRouter.HandleFunc("/cars/{id}", handlers.UpdateCar).Methods("PUT")
+	// Update an existing car by its ID; changing its price needs the manager role.
+	carRouter.HandleFunc("/cars/{id}", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeInventoryWrite, handlers.UpdateCar)).Methods("PUT")
+
+	// PATCH /cars/{id}
+	// Change some details of an existing car by its ID with a JSON Merge Patch; changing its price needs the manager role.
+	carRouter.HandleFunc("/cars/{id}", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeInventoryWrite, handlers.PatchCar)).Methods("PATCH")
 
 	// DELETE /cars/{id}
-	// Delete a car by its ID.
-	carRouter.HandleFunc("/cars/{id}", handlers.DeleteCar).Methods("DELETE")
+	// Delete a car by its ID, archiving it until it is restored or purged.
+	carRouter.HandleFunc("/cars/{id}", handlers.RequireRoleOrScope(models.RoleManager, models.ScopeInventoryWrite, handlers.DeleteCar)).Methods("DELETE")
+
+	// POST /cars/{id}/restore
+	// Restore a deleted car by its ID, putting it back on the market.
+	carRouter.HandleFunc("/cars/{id}/restore", handlers.RequireRoleOrScope(models.RoleManager, models.ScopeInventoryWrite, handlers.RestoreCar)).Methods("POST")
+
+	// Gallery of cars
+
+	// POST /cars/{id}/images
+	// Add an image to the gallery of a car by its ID.
+	carRouter.HandleFunc("/cars/{id}/images", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeInventoryWrite, handlers.AddCarImage)).Methods("POST")
+
+	// PUT /cars/{id}/images/order
+	// Put the images of a car in a new order by its ID.
+	carRouter.HandleFunc("/cars/{id}/images/order", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeInventoryWrite, handlers.ReorderCarImages)).Methods("PUT")
+
+	// PATCH /cars/{id}/images/{imageId}
+	// Change the caption of an image of a car or make it the primary image.
+	carRouter.HandleFunc("/cars/{id}/images/{imageId}", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeInventoryWrite, handlers.UpdateCarImage)).Methods("PATCH")
+
+	// DELETE /cars/{id}/images/{imageId}
+	// Remove an image from the gallery of a car.
+	carRouter.HandleFunc("/cars/{id}/images/{imageId}", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeInventoryWrite, handlers.RemoveCarImage)).Methods("DELETE")
 
 	// Actions on cars
 
 	// POST /cars/{id}/reserve
 	// Reserve a car by its ID.
-	carRouter.HandleFunc("/cars/{id}/reserve", handlers.ReserveCar).Methods("POST")
+	carRouter.HandleFunc("/cars/{id}/reserve", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeReservationsWrite, handlers.ReserveCar)).Methods("POST")
 
 	// POST /cars/{id}/sell
-	// Sell a car to a customer by its ID.
-	carRouter.HandleFunc("/cars/{id}/sell", handlers.SellCar).Methods("POST")
+	// Sell a car to a customer by its ID; selling at a price other than the list price needs the manager role.
+	carRouter.HandleFunc("/cars/{id}/sell", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeSalesWrite, handlers.SellCar)).Methods("POST")
 
 	// POST /cars/{id}/cancel-reservation
 	// Cancel a reservation of a car by its ID.
-	carRouter.HandleFunc("/cars/{id}/cancel-reservation", handlers.CancelReservation).Methods("POST")
+	carRouter.HandleFunc("/cars/{id}/cancel-reservation", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeReservationsWrite, handlers.CancelReservation)).Methods("POST")
+
+	// POST /cars/{id}/extend-reservation
+	// Move the expiry of a reservation of a car by its ID.
+	carRouter.HandleFunc("/cars/{id}/extend-reservation", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeReservationsWrite, handlers.ExtendReservation)).Methods("POST")
+
+	// POST /cars/{id}/return
+	// Take back a sold car by its ID, moving it to in-preparation.
+	carRouter.HandleFunc("/cars/{id}/return", handlers.RequireRoleOrScope(models.RoleManager, models.ScopeSalesWrite, handlers.ReturnCar)).Methods("POST")
+
+	// POST /cars/{id}/status
+	// Move a car to in-preparation, available or archived by its ID.
+	carRouter.HandleFunc("/cars/{id}/status", handlers.RequireRoleOrScope(models.RoleManager, models.ScopeInventoryWrite, handlers.ChangeCarStatus)).Methods("POST")
+
+	// Payments of cars
+
+	// GET /cars/{id}/payments
+	// Fetch the payments and refunds of a car by its ID.
+	carRouter.HandleFunc("/cars/{id}/payments", handlers.RequireRoleOrScope(models.RoleViewer, models.ScopeSalesRead, handlers.GetPayments)).Methods("GET")
+
+	// POST /cars/{id}/payments
+	// Record a payment for a reserved or sold car by its ID.
+	carRouter.HandleFunc("/cars/{id}/payments", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeSalesWrite, handlers.RecordPayment)).Methods("POST")
+
+	// GET /cars/{id}/balance
+	// Fetch how much of the price of a car has been paid by its ID.
+	carRouter.HandleFunc("/cars/{id}/balance", handlers.RequireRoleOrScope(models.RoleViewer, models.ScopeSalesRead, handlers.GetBalance)).Methods("GET")
+
+	// Sales ledger
+
+	// GET /sales
+	// Fetch the recorded sales, newest first, optionally for a single car, customer or salesperson.
+	carRouter.HandleFunc("/sales", handlers.RequireRoleOrScope(models.RoleViewer, models.ScopeSalesRead, handlers.GetSales)).Methods("GET")
+
+	// GET /sales/{id}
+	// Fetch a single sale by its ID.
+	carRouter.HandleFunc("/sales/{id}", handlers.RequireRoleOrScope(models.RoleViewer, models.ScopeSalesRead, handlers.GetSaleByID)).Methods("GET")
+
+	// Customers
+
+	// GET /customers
+	// Search customers by name, email or phone number, newest first.
+	carRouter.HandleFunc("/customers", handlers.RequireRoleOrScope(models.RoleViewer, models.ScopeCustomersRead, handlers.GetCustomers)).Methods("GET")
+
+	// POST /customers
+	// Create a new customer.
+	carRouter.HandleFunc("/customers", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeCustomersWrite, handlers.CreateCustomer)).Methods("POST")
+
+	// GET /customers/{id}
+	// Fetch a single customer by its ID.
+	carRouter.HandleFunc("/customers/{id}", handlers.RequireRoleOrScope(models.RoleViewer, models.ScopeCustomersRead, handlers.GetCustomerByID)).Methods("GET")
+
+	// PUT /customers/{id}
+	// Update an existing customer by its ID.
+	carRouter.HandleFunc("/customers/{id}", handlers.RequireRoleOrScope(models.RoleSalesperson, models.ScopeCustomersWrite, handlers.UpdateCustomer)).Methods("PUT")
+
+	// DELETE /customers/{id}
+	// Delete a customer without reserved cars by its ID.
+	carRouter.HandleFunc("/customers/{id}", handlers.RequireRoleOrScope(models.RoleManager, models.ScopeCustomersWrite, handlers.DeleteCustomer)).Methods("DELETE")
+
+	// Administration
+
+	// GET /admin/images/check
+	// Report stored images no car refers to and images of cars that are not stored.
+	carRouter.HandleFunc("/admin/images/check", handlers.RequireRole(models.RoleAdmin, handlers.CheckImages)).Methods("GET")
+
+	// POST /admin/images/repair
+	// Delete stored images no car refers to and remove images that are not stored from the galleries of cars.
+	carRouter.HandleFunc("/admin/images/repair", handlers.RequireRole(models.RoleAdmin, handlers.RepairImages)).Methods("POST")
+
+	// Audit log
+
+	// GET /audit
+	// Fetch the recorded changes to cars and customers, newest first, optionally for a single car, customer, actor or time range.
+	carRouter.HandleFunc("/audit", handlers.RequireRole(models.RoleManager, handlers.GetAuditEntries)).Methods("GET")
 
 	// Endpoint to fetch car image
 
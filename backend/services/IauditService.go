@@ -0,0 +1,19 @@
+package services
+
+import (
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NewAuditServiceInterface initializes and returns a new instance of the auditService that satisfies the IauditService interface.
+func NewAuditServiceInterface(client *mongo.Client, dbName string) IauditService {
+	return NewAuditService(client, dbName)
+}
+
+// IauditService defines the interface for querying the audit log, which the car and customer services add an entry to
+// for every change they make, see IcarService.WithActor.
+type IauditService interface {
+	// GetAuditEntries retrieves a page of audit entries matching the query, ordered from newest to oldest.
+	// Returns the page of entries and any error encountered, including ErrInvalidCursor for a malformed page cursor.
+	GetAuditEntries(query models.AuditQuery, page models.PageRequest) (*models.AuditPage, error)
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NewAuthServiceInterface initializes and returns a new instance of the authService that satisfies the IauthService interface.
+// Tokens are signed with the given key using HMAC-SHA256.
+func NewAuthServiceInterface(client *mongo.Client, dbName string, signingKey []byte) IauthService {
+	return NewAuthService(client, dbName, signingKey)
+}
+
+// IauthService defines the interface for user accounts, the tokens that authenticate their requests and the API keys
+// that authenticate integrations.
+// Access tokens are short-lived and not stored, so they stay valid until they expire; refresh tokens are stored
+// as sessions, so they can be used only once and are revoked by logging out.
+type IauthService interface {
+	// SetTokenLifetimes sets how long the access and refresh tokens issued from now on are valid.
+	SetTokenLifetimes(access, refresh time.Duration)
+
+	// GetUsers retrieves every user account, ordered by username.
+	// Returns the users and any error encountered.
+	GetUsers() ([]models.User, error)
+
+	// CreateUser creates a user account with a bcrypt hash of the password.
+	// Returns the created user and any error encountered, including ErrConflict for a username that is taken.
+	CreateUser(request models.UserRequest) (*models.User, error)
+
+	// CreateInitialUser creates an admin account when no account exists yet, so that a new installation can be logged into.
+	// Returns the created user, or nil if accounts already exist, and any error encountered.
+	CreateInitialUser(request models.UserRequest) (*models.User, error)
+
+	// SetUserRole changes the role of a user. Access tokens carry the role they were issued with, so the new role
+	// applies once the user logs in again or refreshes their tokens.
+	// Returns the updated user and any error encountered, including ErrNotFound and ErrConflict for demoting the last admin.
+	SetUserRole(id primitive.ObjectID, role string) (*models.User, error)
+
+	// Login checks the credentials of a user and starts a session.
+	// Returns the tokens of the session and any error encountered, including ErrUnauthorized for wrong credentials.
+	Login(username, password string) (*models.TokenPair, error)
+
+	// Refresh exchanges a refresh token for new tokens, which replace it.
+	// Returns the new tokens and any error encountered, including ErrUnauthorized for a refresh token that is invalid,
+	// expired, revoked or already used.
+	Refresh(refreshToken string) (*models.TokenPair, error)
+
+	// Logout revokes the session of a refresh token. Revoking an expired or revoked session succeeds.
+	// Returns any error encountered, including ErrUnauthorized for a refresh token that was not issued by the service.
+	Logout(refreshToken string) error
+
+	// Authenticate checks the signature and expiry of an access token.
+	// Returns the caller the token was issued to and any error encountered, including ErrUnauthorized.
+	Authenticate(accessToken string) (*models.Principal, error)
+
+	// GetAPIKeys retrieves every API key, including revoked ones, newest first. The keys themselves are not stored.
+	// Returns the keys and any error encountered.
+	GetAPIKeys() ([]models.APIKey, error)
+
+	// CreateAPIKey creates an API key with the requested scopes on behalf of the named user.
+	// Returns the created key, including the key itself, which cannot be retrieved again, and any error encountered.
+	CreateAPIKey(request models.APIKeyRequest, createdBy string) (*models.CreatedAPIKey, error)
+
+	// RevokeAPIKey revokes an API key. Revoking a revoked key succeeds.
+	// Returns any error encountered, including ErrNotFound.
+	RevokeAPIKey(id primitive.ObjectID) error
+
+	// AuthenticateAPIKey checks that an API key exists and is not revoked, and records when it was last used.
+	// Returns the integration the key was issued to and any error encountered, including ErrUnauthorized.
+	AuthenticateAPIKey(key string) (*models.Principal, error)
+}
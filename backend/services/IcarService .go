@@ -1,10 +1,12 @@
 package services
 
 import (
+	"io"
+	"time"
+
 	"github.com/lazarpetrovicc/Car-Dealership/models"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/gridfs"
 )
 
 // NewCarServiceInterface initializes and returns a new instance of the carService that satisfies the IcarService interface.
@@ -13,39 +15,126 @@ func NewCarServiceInterface(client *mongo.Client, dbName string) IcarService {
 }
 
 // IcarService defines the interface for car-related operations.
+// Every change to a car increments its version. Methods changing a car take the version the caller expects the car
+// to be at; when it is not nil and the car is at another version, they return ErrPrecondition without changing it.
 type IcarService interface {
-	// GetCarsByStatus retrieves cars from the database based on their status.
-	// Returns a slice of cars and any error encountered.
-	GetCarsByStatus(status string) ([]models.Car, error)
+	// GetCarsByStatus retrieves a page of cars from the database based on their status.
+	// Returns the page of cars and any error encountered, including ErrInvalidCursor for a malformed page cursor.
+	GetCarsByStatus(status string, page models.PageRequest) (*models.CarPage, error)
+
+	// SearchCars retrieves a page of cars matching the filters of the given query, ordered by its sort fields.
+	// Returns the page of cars and any error encountered, including ErrInvalidCursor for a malformed page cursor.
+	SearchCars(query models.CarQuery, page models.PageRequest) (*models.CarPage, error)
+
+	// GetCarByID retrieves a single car, including its customer, by its ID.
+	// Returns ErrNotFound if no car with the given ID exists.
+	GetCarByID(id primitive.ObjectID) (*models.Car, error)
+
+	// GetCarImage retrieves the image data associated with a car by its picture ID, resized to one of models.ImageVariantSizes
+	// or in its original size when the size is empty or models.ImageSizeOriginal.
+	// Returns the image data with its content type and any error encountered, including ErrNotFound if the image does not exist.
+	GetCarImage(pictureID string, size string) (*models.ImageFile, error)
+
+	// CreateCar adds a new available car to the database and streams its image from the content reader to the image store.
+	// Images have to be JPEG, PNG or WebP files within the maximum image size and models.MaxImageDimension.
+	// Returns the created car and any error encountered, including ErrValidation if the image is not acceptable
+	// and ErrTooLarge if it is larger than the maximum image size.
+	CreateCar(car *models.Car, content io.Reader, fileName string) (*models.Car, error)
+
+	// UpdateCar modifies an existing car's details and, when the content reader is not nil, replaces its primary image in the image store.
+	// Only cars in one of models.CarEditableStatuses can be updated, and their status cannot be changed through updating.
+	// Returns the updated car and any error encountered, including ErrNotFound, ErrPrecondition, ErrCarNotEditable,
+	// ErrValidation and ErrTooLarge.
+	UpdateCar(id primitive.ObjectID, car *models.Car, content io.Reader, fileName string, version *int64) (*models.Car, error)
+
+	// PatchCar changes only the fields of a car that are set in the patch. Like UpdateCar, it only changes cars in one of
+	// models.CarEditableStatuses. A patch that does not change anything leaves the car and its version as they are.
+	// Returns the patched car and any error encountered, including ErrNotFound, ErrPrecondition and ErrCarNotEditable.
+	PatchCar(id primitive.ObjectID, patch models.CarPatch, version *int64) (*models.Car, error)
+
+	// AddCarImage streams an image to the image store and appends it to the gallery of a car, optionally as its primary image.
+	// A car holds at most models.MaxCarImages images. Like UpdateCar, it only changes cars in one of models.CarEditableStatuses.
+	// Returns the changed car and any error encountered, including ErrNotFound, ErrPrecondition, ErrCarNotEditable,
+	// ErrValidation and ErrTooLarge.
+	AddCarImage(id primitive.ObjectID, image models.CarImageRequest, content io.Reader, fileName string, version *int64) (*models.Car, error)
+
+	// UpdateCarImage changes the caption of an image of a car or makes it the primary image.
+	// Returns the changed car and any error encountered, including ErrNotFound, ErrPrecondition, ErrCarNotEditable and ErrValidation.
+	UpdateCarImage(id primitive.ObjectID, imageID string, update models.CarImageUpdate, version *int64) (*models.Car, error)
 
-	// GetCarImage retrieves the image data associated with a car by its picture ID.
-	// Returns the image data as a byte slice and any error encountered.
-	GetCarImage(pictureID string) ([]byte, error)
+	// RemoveCarImage removes an image from the gallery of a car and deletes it from the image store. The last image cannot be removed.
+	// Returns the changed car and any error encountered, including ErrNotFound, ErrPrecondition, ErrCarNotEditable and ErrValidation.
+	RemoveCarImage(id primitive.ObjectID, imageID string, version *int64) (*models.Car, error)
 
-	// CreateCar adds a new available car to the database and uploads its image to GridFS.
-	// Returns the result of the insertion operation and any error encountered.
-	CreateCar(car *models.Car, fileData []byte, fileName string) (interface{}, error)
+	// ReorderCarImages puts the images of a car in the given order, which has to list every image of the car exactly once.
+	// Returns the changed car and any error encountered, including ErrNotFound, ErrPrecondition, ErrCarNotEditable and ErrValidation.
+	ReorderCarImages(id primitive.ObjectID, imageIDs []string, version *int64) (*models.Car, error)
 
-	// UpdateCar modifies an existing car's details and updates its image in GridFS. Only available cars can be updated, and their status cannot be changed through updating.
-	// Returns the result of the update operation and any error encountered.
-	UpdateCar(id primitive.ObjectID, car *models.Car, fileData []byte, fileName string) (interface{}, error)
+	// DeleteCar archives an available car as deleted. Deleted cars keep their images and are left out of listings
+	// unless asked for; they can be restored until they are purged, and no other action applies to them.
+	// Returns any error encountered, including ErrNotFound, ErrPrecondition and ErrInvalidTransition.
+	DeleteCar(id primitive.ObjectID, version *int64) error
 
-	// DeleteCar removes a car from the database and deletes its associated image from GridFS. Only available cars can be deleted.
-	// Returns the result of the deletion operation and any error encountered.
-	DeleteCar(id primitive.ObjectID) (interface{}, error)
+	// RestoreCar puts a deleted car back on the market as available.
+	// Returns the restored car and any error encountered, including ErrNotFound, ErrPrecondition and ErrInvalidTransition.
+	RestoreCar(id primitive.ObjectID, version *int64) (*models.Car, error)
+
+	// PurgeDeletedCars removes every car deleted at or before the given time from the database and deletes every image
+	// of its gallery from the image store.
+	// Returns the purged cars and any error encountered.
+	PurgeDeletedCars(deletedBefore time.Time) ([]models.Car, error)
 
 	// ReserveCar changes the status of a car to "reserved" and associates a customer with it. Only available cars can be reserved.
-	// Returns the result of the update operation and any error encountered.
-	ReserveCar(id primitive.ObjectID, customer models.Customer) (interface{}, error)
+	// A deposit paid with the reservation is recorded as a payment and must not exceed the price of the car.
+	// Returns the reserved car and any error encountered, including ErrNotFound, ErrInvalidTransition and ErrValidation.
+	ReserveCar(id primitive.ObjectID, reservation models.ReservationRequest, version *int64) (*models.Car, error)
+
+	// CancelReservation updates the status of a reserved car back to "available", clears customer information
+	// and refunds the deposits paid with the reservation.
+	// Returns the car that is available again and any error encountered, including ErrNotFound and ErrInvalidTransition.
+	CancelReservation(id primitive.ObjectID, version *int64) (*models.Car, error)
+
+	// SellCar updates the status of a car to "sold" and associates a customer with it.
+	// Available cars can be sold to anyone, reserved cars only to the customer who reserved them.
+	// Payments received with the sale are recorded and must not exceed the balance due.
+	// The user the service records changes for is recorded as the salesperson.
+	// Returns the sold car and any error encountered, including ErrNotFound, ErrInvalidTransition and ErrValidation.
+	SellCar(id primitive.ObjectID, sale models.SaleRequest, version *int64) (*models.Car, error)
+
+	// ExtendReservation moves the expiry of the reservation of a reserved car.
+	// The new expiry has to be later than the current one and at most one reservation hold period from now.
+	// Returns the reserved car and any error encountered, including ErrNotFound, ErrInvalidTransition and ErrValidation.
+	ExtendReservation(id primitive.ObjectID, expiresAt time.Time, version *int64) (*models.Car, error)
+
+	// ExpireReservations makes every reserved car whose reservation expired at or before the given time available again
+	// and refunds the deposits paid with the reservations.
+	// Returns the released cars and any error encountered.
+	ExpireReservations(now time.Time) ([]models.Car, error)
+
+	// ReturnCar takes back a sold car, clears its customer information, refunds its payments and moves it to "in-preparation".
+	// Returns the returned car and any error encountered, including ErrNotFound and ErrInvalidTransition.
+	ReturnCar(id primitive.ObjectID, version *int64) (*models.Car, error)
+
+	// ChangeCarStatus moves a car to "in-preparation", "available" or "archived" following models.CarTransitions.
+	// Returns the updated car and any error encountered, including ErrNotFound, ErrInvalidTransition and ErrValidation.
+	ChangeCarStatus(id primitive.ObjectID, status string, version *int64) (*models.Car, error)
+
+	// CheckImages compares the images cars refer to with the files in the image store, reporting stored files no car
+	// refers to and images cars refer to that are not stored. When repair is true, the orphaned files are deleted and the
+	// missing images are removed from the galleries of their cars.
+	// Returns the report of the check and any error encountered.
+	CheckImages(repair bool) (*models.ImageCheckReport, error)
+
+	// WithActor returns a service that records the changes it makes to cars and customers in the audit log
+	// as made by the given actor. Every change is recorded with the fields it changed, as they were before and after it.
+	WithActor(actor models.Actor) IcarService
 
-	// CancelReservation updates the status of a reserved car back to "available" and clears customer information.
-	// Returns the result of the update operation and any error encountered.
-	CancelReservation(id primitive.ObjectID) (interface{}, error)
+	// SetImageStore sets the store car images are kept in, which is GridFS in the car database unless another store is set.
+	SetImageStore(store ImageStore)
 
-	// SellCar updates the status of a car to "sold" and associates a customer with it. Only available cars can be sold.
-	// Returns the result of the update operation and any error encountered.
-	SellCar(id primitive.ObjectID, customer models.Customer) (interface{}, error)
+	// SetReservationHoldPeriod sets how long new reservations hold a car.
+	SetReservationHoldPeriod(period time.Duration)
 
-	// SetGridFSBucket sets the GridFS bucket used for storing car images.
-	SetGridFSBucket(bucket *gridfs.Bucket)
+	// SetMaxImageSize sets the largest accepted image upload, in bytes.
+	SetMaxImageSize(size int64)
 }
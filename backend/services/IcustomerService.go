@@ -0,0 +1,40 @@
+package services
+
+import (
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NewCustomerServiceInterface initializes and returns a new instance of the customerService that satisfies the IcustomerService interface.
+func NewCustomerServiceInterface(client *mongo.Client, dbName string) IcustomerService {
+	return NewCustomerService(client, dbName)
+}
+
+// IcustomerService defines the interface for customer-related operations.
+// Customers are identified by their email address and by their phone number, compared after normalization,
+// so two customers can never share either of them.
+type IcustomerService interface {
+	// GetCustomers retrieves a page of customers matching the query, ordered from newest to oldest.
+	// Returns the page of customers and any error encountered, including ErrInvalidCursor for a malformed page cursor.
+	GetCustomers(query models.CustomerQuery, page models.PageRequest) (*models.CustomerPage, error)
+
+	// GetCustomerByID retrieves a single customer by its ID.
+	// Returns the customer and any error encountered, including ErrNotFound.
+	GetCustomerByID(id primitive.ObjectID) (*models.Customer, error)
+
+	// CreateCustomer inserts a new customer into the database.
+	// Returns the created customer and any error encountered, including ErrConflict for a duplicate email or phone number.
+	CreateCustomer(customer models.Customer) (*models.Customer, error)
+
+	// UpdateCustomer updates the details of an existing customer. Cars and sales keep the details they were recorded with.
+	// Returns the updated customer and any error encountered, including ErrNotFound and ErrConflict.
+	UpdateCustomer(id primitive.ObjectID, customer models.Customer) (*models.Customer, error)
+
+	// DeleteCustomer removes a customer that has no reserved cars.
+	// Returns any error encountered, including ErrNotFound and ErrConflict.
+	DeleteCustomer(id primitive.ObjectID) error
+
+	// WithActor returns a service that records the changes it makes in the audit log as made by the given actor.
+	WithActor(actor models.Actor) IcustomerService
+}
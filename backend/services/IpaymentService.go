@@ -0,0 +1,35 @@
+package services
+
+import (
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NewPaymentServiceInterface initializes and returns a new instance of the paymentService that satisfies the IpaymentService interface.
+func NewPaymentServiceInterface(client *mongo.Client, dbName string) IpaymentService {
+	return NewPaymentService(client, dbName)
+}
+
+// IpaymentService defines the interface for payment-related operations.
+// Deposits, sale payments and refunds that belong to a status change are recorded by the IcarService methods performing it.
+type IpaymentService interface {
+	// GetPaymentsByCar retrieves the payments and refunds of a car, from oldest to newest.
+	// Returns the payments and any error encountered, including ErrNotFound.
+	GetPaymentsByCar(carID primitive.ObjectID) ([]models.Payment, error)
+
+	// RecordPayment records a payment for a car, as a deposit while it is reserved or as a sale payment once it is sold.
+	// The payment must not exceed the balance due and increments the version of the car, so concurrent payments cannot
+	// together exceed it. The payment is recorded in the audit log of the car.
+	// Returns the recorded payment and any error encountered, including ErrNotFound, ErrInvalidTransition, ErrValidation
+	// and ErrConflict.
+	RecordPayment(carID primitive.ObjectID, payment models.PaymentRequest) (*models.Payment, error)
+
+	// GetBalance calculates how much of the price of a car has been paid and how much is still due.
+	// Sold cars are balanced against the price recorded with their sale, other cars against their list price.
+	// Returns the balance and any error encountered, including ErrNotFound.
+	GetBalance(carID primitive.ObjectID) (*models.CarBalance, error)
+
+	// WithActor returns a service that records the payments it takes in the audit log as made by the given actor.
+	WithActor(actor models.Actor) IpaymentService
+}
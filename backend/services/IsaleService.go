@@ -0,0 +1,24 @@
+package services
+
+import (
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// NewSaleServiceInterface initializes and returns a new instance of the saleService that satisfies the IsaleService interface.
+func NewSaleServiceInterface(client *mongo.Client, dbName string) IsaleService {
+	return NewSaleService(client, dbName)
+}
+
+// IsaleService defines the interface for querying the sales ledger.
+// Sales are recorded by IcarService.SellCar and are never changed afterwards.
+type IsaleService interface {
+	// GetSales retrieves a page of sales matching the query, ordered from newest to oldest.
+	// Returns the page of sales and any error encountered, including ErrInvalidCursor for a malformed page cursor.
+	GetSales(query models.SaleQuery, page models.PageRequest) (*models.SalePage, error)
+
+	// GetSaleByID retrieves a single sale by its ID.
+	// Returns the sale and any error encountered, including ErrNotFound.
+	GetSaleByID(id primitive.ObjectID) (*models.Sale, error)
+}
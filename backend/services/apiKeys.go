@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// apiKeyBytes is the number of random bytes in an API key.
+const apiKeyBytes = 32
+
+// apiKeyPrefixLength is how many characters of an API key are stored in the clear to recognize it by.
+const apiKeyPrefixLength = len(models.APIKeyPrefix) + 8
+
+// GetAPIKeys retrieves every API key, including revoked ones, newest first.
+// Returns the keys and any error encountered.
+func (s *authService) GetAPIKeys() ([]models.APIKey, error) {
+	cursor, err := s.apiKeyCollection.Find(context.Background(), bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		log.Printf("Error finding API keys: %v", err)
+		return nil, err
+	}
+	keys := []models.APIKey{}
+	if err := cursor.All(context.Background(), &keys); err != nil {
+		log.Printf("Error decoding API keys: %v", err)
+		return nil, err
+	}
+	return keys, nil
+}
+
+// CreateAPIKey creates a random API key with the requested scopes. The key is random enough that a SHA-256 hash
+// protects it, and a fast hash keeps authenticating every request of an integration cheap.
+// Returns the created key, including the key itself, and any error encountered.
+func (s *authService) CreateAPIKey(request models.APIKeyRequest, createdBy string) (*models.CreatedAPIKey, error) {
+	secret := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(secret); err != nil {
+		log.Printf("Error generating API key: %v", err)
+		return nil, err
+	}
+	key := models.APIKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := models.APIKey{
+		ID:        primitive.NewObjectID(),
+		Name:      request.Name,
+		Prefix:    key[:apiKeyPrefixLength],
+		KeyHash:   hashAPIKey(key),
+		Scopes:    request.Scopes,
+		CreatedBy: createdBy,
+		CreatedAt: time.Now().UTC(),
+	}
+	if _, err := s.apiKeyCollection.InsertOne(context.Background(), apiKey); err != nil {
+		log.Printf("Error inserting API key '%s': %v", apiKey.Name, err)
+		return nil, err
+	}
+	return &models.CreatedAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+// RevokeAPIKey marks an API key as revoked, so that it is rejected from now on. Revoking a revoked key keeps the time
+// it was first revoked.
+// Returns any error encountered.
+func (s *authService) RevokeAPIKey(id primitive.ObjectID) error {
+	result, err := s.apiKeyCollection.UpdateOne(context.Background(),
+		bson.M{"_id": id, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": time.Now().UTC()}})
+	if err != nil {
+		log.Printf("Error revoking API key with ID '%s': %v", id.Hex(), err)
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	count, err := s.apiKeyCollection.CountDocuments(context.Background(), bson.M{"_id": id}, options.Count().SetLimit(1))
+	if err != nil {
+		log.Printf("Error counting API keys: %v", err)
+		return err
+	}
+	if count == 0 {
+		return fmt.Errorf("%w: API key %s does not exist", ErrNotFound, id.Hex())
+	}
+	return nil
+}
+
+// AuthenticateAPIKey looks up an API key by its hash and records that it was used.
+// Returns the integration the key was issued to and any error encountered.
+func (s *authService) AuthenticateAPIKey(key string) (*models.Principal, error) {
+	var apiKey models.APIKey
+	err := s.apiKeyCollection.FindOne(context.Background(), bson.M{"keyHash": hashAPIKey(key), "revokedAt": bson.M{"$exists": false}}).Decode(&apiKey)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: API key is invalid or revoked", ErrUnauthorized)
+		}
+		log.Printf("Error finding API key: %v", err)
+		return nil, err
+	}
+
+	// A failure to record the use of the key does not fail the request
+	now := time.Now().UTC()
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= models.APIKeyLastUsedResolution {
+		_, err := s.apiKeyCollection.UpdateOne(context.Background(), bson.M{"_id": apiKey.ID}, bson.M{"$set": bson.M{"lastUsedAt": now}})
+		if err != nil {
+			log.Printf("Error recording use of API key with ID '%s': %v", apiKey.ID.Hex(), err)
+		}
+	}
+	return &models.Principal{APIKeyID: apiKey.ID, Username: apiKey.Name, Scopes: apiKey.Scopes}, nil
+}
+
+// hashAPIKey returns the hex-encoded SHA-256 hash an API key is stored and looked up by.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// unauditedFields are left out of the changes recorded in the audit log: the ID identifies the entity already,
+// and the version changes with every change.
+var unauditedFields = map[string]bool{"_id": true, "version": true}
+
+// auditLog records the changes an actor makes to cars and customers in the audit collection.
+type auditLog struct {
+	auditCollection *mongo.Collection // MongoDB collection for storing audit entries
+	actor           models.Actor      // Actor the changes are recorded for
+}
+
+// newAuditLog initializes an auditLog using the audit collection of the given database
+// and makes sure the indexes for listing the entries of an entity or an actor exist.
+func newAuditLog(db *mongo.Database) *auditLog {
+	a := &auditLog{auditCollection: db.Collection("audit")}
+	_, err := a.auditCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "entity", Value: 1}, {Key: "entityId", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "timestamp", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Error creating audit indexes: %v", err)
+	}
+	return a
+}
+
+// withActor returns a copy of the audit log that records changes for the given actor.
+func (a *auditLog) withActor(actor models.Actor) *auditLog {
+	copied := *a
+	copied.actor = actor
+	return &copied
+}
+
+// record adds an entry for a change to an entity, given as it was before and after the change; before is nil for
+// a created entity and after for a deleted one. Every change is recorded with the context of the transaction it is made
+// in, so that the entry is only stored with the change; failures are logged and returned, aborting the transaction.
+func (a *auditLog) record(ctx context.Context, entity string, id primitive.ObjectID, action string, before, after interface{}) error {
+	entry := models.AuditEntry{
+		Entity:    entity,
+		EntityID:  id,
+		Action:    action,
+		Actor:     a.actor.Name,
+		ActorKind: a.actor.Kind,
+		RequestID: a.actor.RequestID,
+		Timestamp: time.Now().UTC(),
+	}
+	if entry.ActorKind == "" {
+		entry.ActorKind = models.ActorKindSystem
+	}
+	var err error
+	if entry.Before, entry.After, err = auditChanges(before, after); err != nil {
+		log.Printf("Error comparing %s with ID '%s' for the audit log: %v", entity, id.Hex(), err)
+		return err
+	}
+	if _, err := a.auditCollection.InsertOne(ctx, entry); err != nil {
+		log.Printf("Error recording action '%s' on %s with ID '%s' in the audit log: %v", action, entity, id.Hex(), err)
+		return err
+	}
+	return nil
+}
+
+// auditChanges compares an entity before and after a change field by field, as the fields are stored.
+// Returns the fields that differ as they were before and as they are after the change, and any error encountered.
+func auditChanges(before, after interface{}) (primitive.M, primitive.M, error) {
+	beforeFields, err := auditFields(before)
+	if err != nil {
+		return nil, nil, err
+	}
+	afterFields, err := auditFields(after)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, 0, len(beforeFields)+len(afterFields))
+	for name := range beforeFields {
+		names = append(names, name)
+	}
+	for name := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changedBefore, changedAfter := primitive.M{}, primitive.M{}
+	for _, name := range names {
+		if unauditedFields[name] {
+			continue
+		}
+		oldValue, hadValue := beforeFields[name]
+		newValue, hasValue := afterFields[name]
+		if hadValue && hasValue && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if hadValue {
+			changedBefore[name] = oldValue
+		}
+		if hasValue {
+			changedAfter[name] = newValue
+		}
+	}
+	return changedBefore, changedAfter, nil
+}
+
+// auditFields returns the fields of an entity as they are stored, or no fields for nil.
+func auditFields(entity interface{}) (primitive.M, error) {
+	if entity == nil || reflect.ValueOf(entity).IsNil() {
+		return primitive.M{}, nil
+	}
+	data, err := bson.Marshal(entity)
+	if err != nil {
+		return nil, err
+	}
+	var fields primitive.M
+	if err := bson.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// auditService provides methods to query the audit log.
+type auditService struct {
+	auditCollection *mongo.Collection // MongoDB collection for storing audit entries
+}
+
+// NewAuditService initializes a new instance of auditService.
+func NewAuditService(client *mongo.Client, dbName string) *auditService {
+	return &auditService{
+		auditCollection: newAuditLog(client.Database(dbName)).auditCollection,
+	}
+}
+
+// GetAuditEntries retrieves a page of audit entries matching the query, ordered from newest to oldest.
+// Returns the page of entries and any error encountered.
+func (s *auditService) GetAuditEntries(query models.AuditQuery, page models.PageRequest) (*models.AuditPage, error) {
+	filter := bson.M{}
+	if query.CarID != nil {
+		filter["entity"] = models.AuditEntityCar
+		filter["entityId"] = *query.CarID
+	}
+	if query.CustomerID != nil {
+		filter["entity"] = models.AuditEntityCustomer
+		filter["entityId"] = *query.CustomerID
+	}
+	if query.Actor != "" {
+		filter["actor"] = query.Actor
+	}
+	timestamp := bson.M{}
+	if query.From != nil {
+		timestamp["$gte"] = *query.From
+	}
+	if query.To != nil {
+		timestamp["$lt"] = *query.To
+	}
+	if len(timestamp) > 0 {
+		filter["timestamp"] = timestamp
+	}
+
+	entries, next, total, err := listNewestFirst(s.auditCollection, filter, page, func(entry models.AuditEntry) primitive.ObjectID { return entry.ID })
+	if err != nil {
+		if !errors.Is(err, ErrInvalidCursor) {
+			log.Printf("Error listing audit entries: %v", err)
+		}
+		return nil, err
+	}
+	return &models.AuditPage{Items: entries, NextCursor: next, Total: total}, nil
+}
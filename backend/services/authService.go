@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// tokenIssuer is the issuer of the tokens signed by the authService.
+const tokenIssuer = "car-dealership"
+
+// Types of the tokens issued by the authService, kept in their claims so that one can never be used as the other
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+)
+
+// dummyPasswordHash is compared with the password of a login for an unknown username,
+// so that a login takes as long whether or not the username exists.
+const dummyPasswordHash = "$2a$10$DvfMHr7nkR/.1V3etZr6ruGmOT.cwiS7TCpZoLx0ao/XVwenoH0tm"
+
+// tokenClaims are the claims of the tokens issued by the authService. The subject is the ID of the user;
+// the ID of a refresh token is the ID of its session.
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	TokenType string `json:"tokenType"`          // Type of the token, access or refresh
+	Username  string `json:"username,omitempty"` // Name of the user, only in access tokens
+	Role      string `json:"role,omitempty"`     // Role of the user, only in access tokens
+}
+
+// session is a refresh token as it is stored in the sessions collection. Expired sessions are removed by a TTL index.
+type session struct {
+	ID        primitive.ObjectID `bson:"_id"`       // ID of the refresh token
+	UserID    primitive.ObjectID `bson:"userId"`    // ID of the user the token was issued to
+	ExpiresAt time.Time          `bson:"expiresAt"` // Time the refresh token expires
+}
+
+// authService provides methods to manage user accounts and their tokens.
+type authService struct {
+	userCollection    *mongo.Collection // MongoDB collection for storing users
+	sessionCollection *mongo.Collection // MongoDB collection for storing refresh tokens
+	apiKeyCollection  *mongo.Collection // MongoDB collection for storing API keys
+	signingKey        []byte            // Key the tokens are signed with
+	accessLifetime    time.Duration     // How long access tokens are valid
+	refreshLifetime   time.Duration     // How long refresh tokens are valid
+}
+
+// NewAuthService initializes a new instance of authService signing tokens with the given key.
+func NewAuthService(client *mongo.Client, dbName string, signingKey []byte) *authService {
+	return newAuthService(client.Database(dbName), signingKey)
+}
+
+// newAuthService initializes an authService using the collections of the given database
+// and makes sure the indexes for unique usernames, for removing expired sessions and for looking up API keys exist.
+// Users created before roles were introduced could do anything, so they are made admins.
+func newAuthService(db *mongo.Database, signingKey []byte) *authService {
+	s := &authService{
+		userCollection:    db.Collection("users"),
+		sessionCollection: db.Collection("sessions"),
+		apiKeyCollection:  db.Collection("apiKeys"),
+		signingKey:        signingKey,
+		accessLifetime:    models.DefaultAccessTokenLifetime,
+		refreshLifetime:   models.DefaultRefreshTokenLifetime,
+	}
+	_, err := s.userCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "username", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Error creating user indexes: %v", err)
+	}
+	_, err = s.sessionCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating session indexes: %v", err)
+	}
+	_, err = s.apiKeyCollection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "keyHash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Error creating API key indexes: %v", err)
+	}
+	result, err := s.userCollection.UpdateMany(context.Background(), bson.M{"role": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"role": models.RoleAdmin}})
+	if err != nil {
+		log.Printf("Error giving users without a role the admin role: %v", err)
+	} else if result.ModifiedCount > 0 {
+		log.Printf("Gave %d users without a role the admin role", result.ModifiedCount)
+	}
+	return s
+}
+
+// SetTokenLifetimes sets how long the access and refresh tokens issued from now on are valid.
+func (s *authService) SetTokenLifetimes(access, refresh time.Duration) {
+	s.accessLifetime = access
+	s.refreshLifetime = refresh
+}
+
+// GetUsers retrieves every user account, ordered by username.
+// Returns the users and any error encountered.
+func (s *authService) GetUsers() ([]models.User, error) {
+	cursor, err := s.userCollection.Find(context.Background(), bson.M{}, options.Find().SetSort(bson.D{{Key: "username", Value: 1}}))
+	if err != nil {
+		log.Printf("Error finding users: %v", err)
+		return nil, err
+	}
+	users := []models.User{}
+	if err := cursor.All(context.Background(), &users); err != nil {
+		log.Printf("Error decoding users: %v", err)
+		return nil, err
+	}
+	return users, nil
+}
+
+// CreateUser creates a user account with a bcrypt hash of the password. Usernames are stored in lower case.
+// Returns the created user and any error encountered.
+func (s *authService) CreateUser(request models.UserRequest) (*models.User, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(request.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrValidation, err)
+	}
+	user := models.User{
+		ID:           primitive.NewObjectID(),
+		Username:     normalizeUsername(request.Username),
+		PasswordHash: string(hash),
+		Role:         request.Role,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if _, err := s.userCollection.InsertOne(context.Background(), user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("%w: username '%s' is taken", ErrConflict, user.Username)
+		}
+		log.Printf("Error inserting user: %v", err)
+		return nil, err
+	}
+	return &user, nil
+}
+
+// CreateInitialUser creates an admin account when the users collection is empty, whatever role is requested.
+// Returns the created user, or nil if accounts already exist, and any error encountered.
+func (s *authService) CreateInitialUser(request models.UserRequest) (*models.User, error) {
+	count, err := s.userCollection.CountDocuments(context.Background(), bson.M{}, options.Count().SetLimit(1))
+	if err != nil {
+		log.Printf("Error counting users: %v", err)
+		return nil, err
+	}
+	if count > 0 {
+		return nil, nil
+	}
+	request.Role = models.RoleAdmin
+	return s.CreateUser(request)
+}
+
+// SetUserRole changes the role of a user. An admin is only demoted while another admin exists, so that user accounts
+// can always be managed.
+// Returns the updated user and any error encountered.
+func (s *authService) SetUserRole(id primitive.ObjectID, role string) (*models.User, error) {
+	if role != models.RoleAdmin {
+		admins, err := s.userCollection.CountDocuments(context.Background(), bson.M{"role": models.RoleAdmin, "_id": bson.M{"$ne": id}}, options.Count().SetLimit(1))
+		if err != nil {
+			log.Printf("Error counting admins: %v", err)
+			return nil, err
+		}
+		if admins == 0 {
+			return nil, fmt.Errorf("%w: user %s is the last admin", ErrConflict, id.Hex())
+		}
+	}
+
+	var user models.User
+	err := s.userCollection.FindOneAndUpdate(context.Background(), bson.M{"_id": id}, bson.M{"$set": bson.M{"role": role}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: user %s does not exist", ErrNotFound, id.Hex())
+		}
+		log.Printf("Error updating role of user with ID '%s': %v", id.Hex(), err)
+		return nil, err
+	}
+	return &user, nil
+}
+
+// Login checks the password of a user against its bcrypt hash and starts a session.
+// Returns the tokens of the session and any error encountered.
+func (s *authService) Login(username, password string) (*models.TokenPair, error) {
+	var user models.User
+	err := s.userCollection.FindOne(context.Background(), bson.M{"username": normalizeUsername(username)}).Decode(&user)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error finding user '%s': %v", username, err)
+		return nil, err
+	}
+
+	hash := user.PasswordHash
+	if hash == "" {
+		hash = dummyPasswordHash
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil || user.PasswordHash == "" {
+		return nil, fmt.Errorf("%w: wrong username or password", ErrUnauthorized)
+	}
+	return s.startSession(user)
+}
+
+// Refresh exchanges a refresh token for new tokens. The session of the refresh token is removed, so it cannot be used again.
+// Returns the new tokens and any error encountered.
+func (s *authService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	claims, err := s.parseToken(refreshToken, refreshTokenType)
+	if err != nil {
+		return nil, err
+	}
+	sessionID, err := primitive.ObjectIDFromHex(claims.ID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: refresh token is invalid", ErrUnauthorized)
+	}
+
+	var revoked session
+	err = s.sessionCollection.FindOneAndDelete(context.Background(), bson.M{"_id": sessionID}).Decode(&revoked)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: refresh token was revoked or already used", ErrUnauthorized)
+		}
+		log.Printf("Error removing session with ID '%s': %v", sessionID.Hex(), err)
+		return nil, err
+	}
+
+	var user models.User
+	if err := s.userCollection.FindOne(context.Background(), bson.M{"_id": revoked.UserID}).Decode(&user); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: user no longer exists", ErrUnauthorized)
+		}
+		log.Printf("Error finding user with ID '%s': %v", revoked.UserID.Hex(), err)
+		return nil, err
+	}
+	return s.startSession(user)
+}
+
+// Logout removes the session of a refresh token. Expired tokens are accepted, as their sessions may still be stored.
+// Returns any error encountered.
+func (s *authService) Logout(refreshToken string) error {
+	claims, err := s.parseToken(refreshToken, refreshTokenType, jwt.WithoutClaimsValidation())
+	if err != nil {
+		return err
+	}
+	sessionID, err := primitive.ObjectIDFromHex(claims.ID)
+	if err != nil {
+		return fmt.Errorf("%w: refresh token is invalid", ErrUnauthorized)
+	}
+	if _, err := s.sessionCollection.DeleteOne(context.Background(), bson.M{"_id": sessionID}); err != nil {
+		log.Printf("Error removing session with ID '%s': %v", sessionID.Hex(), err)
+		return err
+	}
+	return nil
+}
+
+// Authenticate checks the signature and expiry of an access token.
+// Returns the caller the token was issued to and any error encountered.
+func (s *authService) Authenticate(accessToken string) (*models.Principal, error) {
+	claims, err := s.parseToken(accessToken, accessTokenType)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: access token is invalid", ErrUnauthorized)
+	}
+	return &models.Principal{UserID: userID, Username: claims.Username, Role: claims.Role}, nil
+}
+
+// startSession stores a new session for the user and issues an access token and the refresh token of the session.
+// Returns the tokens and any error encountered.
+func (s *authService) startSession(user models.User) (*models.TokenPair, error) {
+	now := time.Now().UTC()
+	accessToken, err := s.signToken(tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.accessLifetime)),
+		},
+		TokenType: accessTokenType,
+		Username:  user.Username,
+		Role:      user.Role,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	newSession := session{ID: primitive.NewObjectID(), UserID: user.ID, ExpiresAt: now.Add(s.refreshLifetime)}
+	refreshToken, err := s.signToken(tokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        newSession.ID.Hex(),
+			Subject:   user.ID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(newSession.ExpiresAt),
+		},
+		TokenType: refreshTokenType,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.sessionCollection.InsertOne(context.Background(), newSession); err != nil {
+		log.Printf("Error inserting session of user '%s': %v", user.Username, err)
+		return nil, err
+	}
+
+	return &models.TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    models.TokenTypeBearer,
+		ExpiresIn:    int64(s.accessLifetime / time.Second),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// signToken signs the claims with HMAC-SHA256.
+func (s *authService) signToken(claims tokenClaims) (string, error) {
+	claims.Issuer = tokenIssuer
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.signingKey)
+	if err != nil {
+		log.Printf("Error signing %s token: %v", claims.TokenType, err)
+		return "", err
+	}
+	return token, nil
+}
+
+// parseToken checks the signature, issuer and expiry of a token and that it is of the expected type.
+// Returns the claims of the token and any error encountered, including ErrUnauthorized.
+func (s *authService) parseToken(token string, tokenType string, opts ...jwt.ParserOption) (*tokenClaims, error) {
+	opts = append(opts, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(tokenIssuer))
+	var claims tokenClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(*jwt.Token) (interface{}, error) {
+		return s.signingKey, nil
+	}, opts...)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, fmt.Errorf("%w: %s token has expired", ErrUnauthorized, tokenType)
+		}
+		return nil, fmt.Errorf("%w: %s token is invalid", ErrUnauthorized, tokenType)
+	}
+	if claims.TokenType != tokenType {
+		return nil, fmt.Errorf("%w: %s token is invalid", ErrUnauthorized, tokenType)
+	}
+	return &claims, nil
+}
+
+// normalizeUsername returns a username in the form it is stored and looked up in.
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
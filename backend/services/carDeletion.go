@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeleteCar archives an available car as deleted, recording the time it was deleted. The car and its images are kept,
+// so that it can be restored until PurgeDeletedCars removes it for good.
+// When an expected version is given, the car is only deleted if it is still at that version.
+// Returns any error encountered.
+func (s *carService) DeleteCar(id primitive.ObjectID, version *int64) error {
+	change := carUpdate{version: version, set: bson.M{"deletedAt": time.Now().UTC()}}
+	_, err := s.transitionCar(id, models.CarActionDelete, change, nil)
+	return err
+}
+
+// RestoreCar puts a deleted car back on the market as available, clearing the time it was deleted.
+// When an expected version is given, the car is only restored if it is still at that version.
+// Returns the restored car and any error encountered.
+func (s *carService) RestoreCar(id primitive.ObjectID, version *int64) (*models.Car, error) {
+	change := carUpdate{version: version, match: bson.M{"deletedAt": bson.M{"$exists": true}}, unset: []string{"deletedAt"}}
+	return s.transitionCar(id, models.CarActionRestore, change, deletedGuard)
+}
+
+// deletedGuard only allows restoring a car that was deleted, not one that was archived.
+func deletedGuard(car models.Car) error {
+	if car.DeletedAt == nil {
+		return fmt.Errorf("%w: car %s is archived but not deleted", ErrInvalidTransition, car.ID.Hex())
+	}
+	return nil
+}
+
+// PurgeDeletedCars removes every car that was deleted at or before the given time from the database and deletes every
+// image of its gallery from the image store. Cars that are restored in the meantime are skipped.
+// Returns the purged cars and any error encountered.
+func (s *carService) PurgeDeletedCars(deletedBefore time.Time) ([]models.Car, error) {
+	cursor, err := s.carCollection.Find(
+		context.Background(),
+		bson.M{"deletedAt": bson.M{"$lte": deletedBefore}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		log.Printf("Error finding deleted cars: %v", err)
+		return nil, err
+	}
+	var deleted []models.Car
+	if err := cursor.All(context.Background(), &deleted); err != nil {
+		log.Printf("Error decoding deleted cars: %v", err)
+		return nil, err
+	}
+
+	purged := []models.Car{}
+	for _, car := range deleted {
+		var purgedCar models.Car
+		err := withTransaction(s.client, func(ctx mongo.SessionContext) error {
+			err := s.carCollection.FindOneAndDelete(ctx, bson.M{"_id": car.ID, "deletedAt": bson.M{"$lte": deletedBefore}}).Decode(&purgedCar)
+			if err != nil {
+				return err
+			}
+			return s.audit.record(ctx, models.AuditEntityCar, purgedCar.ID, models.AuditActionPurge, &purgedCar, nil)
+		})
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			log.Printf("Error purging car with ID '%s': %v", car.ID.Hex(), err)
+			return purged, err
+		}
+
+		// Delete the images of the gallery from the image store
+		for _, image := range purgedCar.Gallery() {
+			s.deletePicture(image.ID)
+		}
+		purged = append(purged, purgedCar)
+	}
+	return purged, nil
+}
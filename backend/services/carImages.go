@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// AddCarImage uploads an image to the image store and appends it to the gallery of a car. The first image of a gallery is always its primary image.
+// Like UpdateCar, it only changes cars in one of models.CarEditableStatuses, and the image is deleted again when the car cannot be changed.
+// Returns the changed car and any error encountered.
+func (s *carService) AddCarImage(id primitive.ObjectID, image models.CarImageRequest, content io.Reader, fileName string, version *int64) (*models.Car, error) {
+	car, err := s.editableCar(id, version)
+	if err != nil {
+		return nil, err
+	}
+	gallery := car.Gallery()
+	if len(gallery) >= models.MaxCarImages {
+		return nil, fmt.Errorf("%w: car %s already has the maximum of %d images", ErrValidation, id.Hex(), models.MaxCarImages)
+	}
+
+	pictureID, err := s.uploadPicture(content, fileName)
+	if err != nil {
+		return nil, err
+	}
+	images := append(append([]models.CarImage{}, gallery...), models.CarImage{ID: pictureID, Caption: image.Caption})
+	if image.Primary || len(gallery) == 0 {
+		images = setPrimaryImage(images, pictureID)
+	}
+
+	updatedCar, err := s.saveGallery(car, images, version)
+	if err != nil {
+		s.deletePicture(pictureID)
+		return nil, err
+	}
+	return updatedCar, nil
+}
+
+// UpdateCarImage changes the caption of an image of a car or makes it the primary image.
+// An update that does not change anything returns the car as it is, without incrementing its version.
+// Returns the changed car and any error encountered, including ErrNotFound if the car has no image with the given ID.
+func (s *carService) UpdateCarImage(id primitive.ObjectID, imageID string, update models.CarImageUpdate, version *int64) (*models.Car, error) {
+	car, err := s.editableCar(id, version)
+	if err != nil {
+		return nil, err
+	}
+	images := append([]models.CarImage{}, car.Gallery()...)
+	index := findCarImage(images, imageID)
+	if index < 0 {
+		return nil, errCarImageNotFound(id, imageID)
+	}
+
+	changed := false
+	if update.Caption != nil && *update.Caption != images[index].Caption {
+		images[index].Caption = *update.Caption
+		changed = true
+	}
+	if update.Primary != nil && *update.Primary != images[index].Primary {
+		if !*update.Primary {
+			return nil, fmt.Errorf("%w: the primary image is changed by making another image primary", ErrValidation)
+		}
+		images = setPrimaryImage(images, imageID)
+		changed = true
+	}
+	if !changed {
+		return car, nil
+	}
+	return s.saveGallery(car, images, version)
+}
+
+// RemoveCarImage removes an image from the gallery of a car and deletes it from the image store. When the primary image is removed,
+// the first remaining image becomes the primary image. The last image of a car cannot be removed.
+// Returns the changed car and any error encountered, including ErrNotFound if the car has no image with the given ID.
+func (s *carService) RemoveCarImage(id primitive.ObjectID, imageID string, version *int64) (*models.Car, error) {
+	car, err := s.editableCar(id, version)
+	if err != nil {
+		return nil, err
+	}
+	gallery := car.Gallery()
+	index := findCarImage(gallery, imageID)
+	if index < 0 {
+		return nil, errCarImageNotFound(id, imageID)
+	}
+	if len(gallery) == 1 {
+		return nil, fmt.Errorf("%w: the last image of a car cannot be removed", ErrValidation)
+	}
+
+	images := append(append([]models.CarImage{}, gallery[:index]...), gallery[index+1:]...)
+	if gallery[index].Primary {
+		images = setPrimaryImage(images, images[0].ID)
+	}
+	updatedCar, err := s.saveGallery(car, images, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Delete the image from the image store once the car no longer refers to it
+	s.deletePicture(imageID)
+	return updatedCar, nil
+}
+
+// ReorderCarImages puts the images of a car in the given order, which has to list every image of the car exactly once.
+// An order that matches the current one returns the car as it is, without incrementing its version.
+// Returns the changed car and any error encountered.
+func (s *carService) ReorderCarImages(id primitive.ObjectID, imageIDs []string, version *int64) (*models.Car, error) {
+	car, err := s.editableCar(id, version)
+	if err != nil {
+		return nil, err
+	}
+	gallery := car.Gallery()
+	if len(imageIDs) != len(gallery) {
+		return nil, fmt.Errorf("%w: the order must list each of the %d images of car %s exactly once", ErrValidation, len(gallery), id.Hex())
+	}
+
+	images := make([]models.CarImage, 0, len(gallery))
+	listed := make(map[string]bool, len(imageIDs))
+	changed := false
+	for i, imageID := range imageIDs {
+		index := findCarImage(gallery, imageID)
+		if index < 0 || listed[imageID] {
+			return nil, fmt.Errorf("%w: the order must list each of the %d images of car %s exactly once", ErrValidation, len(gallery), id.Hex())
+		}
+		listed[imageID] = true
+		images = append(images, gallery[index])
+		changed = changed || index != i
+	}
+	if !changed {
+		return car, nil
+	}
+	return s.saveGallery(car, images, version)
+}
+
+// saveGallery replaces the gallery of a car that was checked with editableCar and points its picture at the primary image.
+// The status and the version are checked in the same operation that changes the car.
+// Returns the changed car and any error encountered.
+func (s *carService) saveGallery(car *models.Car, images []models.CarImage, version *int64) (*models.Car, error) {
+	set := bson.M{"images": images}
+	for _, image := range images {
+		if image.Primary {
+			set["picture"] = image.ID
+		}
+	}
+
+	filter := bson.M{
+		"_id":     car.ID,
+		"status":  bson.M{"$in": models.CarEditableStatuses},
+		"version": carVersionFilter(car.Version),
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	updatedCar, err := s.updateCarAudited(car, models.AuditActionChangeImages, filter, update)
+	if err != nil {
+		log.Printf("Error changing images of car with ID '%s': %v", car.ID.Hex(), err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, s.updateFailure(car.ID, version)
+		}
+		return nil, classifyWriteError(err)
+	}
+	return updatedCar, nil
+}
+
+// findCarImage returns the index of the image with the given ID in the gallery, or -1 if the gallery does not contain it.
+func findCarImage(images []models.CarImage, imageID string) int {
+	for i, image := range images {
+		if image.ID == imageID {
+			return i
+		}
+	}
+	return -1
+}
+
+// setPrimaryImage marks the image with the given ID as the only primary image of the gallery.
+func setPrimaryImage(images []models.CarImage, imageID string) []models.CarImage {
+	for i := range images {
+		images[i].Primary = images[i].ID == imageID
+	}
+	return images
+}
+
+// replacePrimaryImage returns a copy of the gallery in which the primary image is replaced by the image with the given ID,
+// keeping its caption and position. A gallery without images gets the image as its only, primary image.
+func replacePrimaryImage(gallery []models.CarImage, imageID string) []models.CarImage {
+	images := append([]models.CarImage{}, gallery...)
+	for i := range images {
+		if images[i].Primary {
+			images[i].ID = imageID
+			return images
+		}
+	}
+	return append(images, models.CarImage{ID: imageID, Primary: true})
+}
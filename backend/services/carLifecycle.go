@@ -0,0 +1,244 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// transitionGuard checks a car in one of the statuses allowed by a transition before the transition is applied.
+// It returns an error wrapping a domain error when the transition must not happen.
+type transitionGuard func(car models.Car) error
+
+// customerStep resolves the customer a car is reserved or sold to, creating or updating the stored customer.
+// It runs in the transaction of the transition before the car is updated, and the customer is set on the car.
+type customerStep func(ctx context.Context, car models.Car) (models.Customer, error)
+
+// paymentStep records the payments or refunds belonging to a transition before the car is updated.
+// It runs in the transaction of the transition and returns the recorded payments.
+type paymentStep func(ctx context.Context, car models.Car) ([]models.Payment, error)
+
+// recordStep writes the records belonging to a transition, such as a sale, after the car is updated.
+// It runs in the transaction of the transition and receives the updated car and the payments recorded with it.
+type recordStep func(ctx context.Context, car models.Car, payments []models.Payment) error
+
+// carUpdate holds the fields changed alongside the status when a transition is applied.
+type carUpdate struct {
+	version  *int64       // Version the caller expects the car to be at (if any)
+	match    bson.M       // Conditions the car has to meet when it is updated, in addition to its status and version
+	set      bson.M       // Fields to set
+	unset    []string     // Fields to remove
+	customer customerStep // Customer the car is reserved or sold to (if any)
+	payments paymentStep  // Payments recorded with the transition (if any)
+	record   recordStep   // Records written with the transition (if any)
+}
+
+// transitionCar applies a lifecycle action declared in models.CarTransitions to a car.
+// The customer, payments and records belonging to the action, and its entry in the audit log, are written in the same
+// transaction as the car, so either all of them are stored or none. The car is only updated if it is still at the version it was checked at, so concurrent
+// changes cannot both succeed.
+// Returns the updated car and any error encountered, including ErrNotFound, ErrPrecondition, ErrInvalidTransition and ErrConflict.
+func (s *carService) transitionCar(id primitive.ObjectID, action string, change carUpdate, guard transitionGuard) (*models.Car, error) {
+	transition, ok := models.CarTransitions[action]
+	if !ok {
+		return nil, fmt.Errorf("unknown car action '%s'", action)
+	}
+
+	car, err := s.GetCarByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCarVersion(*car, change.version); err != nil {
+		return nil, err
+	}
+	if car.DeletedAt != nil && action != models.CarActionRestore {
+		return nil, fmt.Errorf("%w: car %s is deleted and has to be restored first", ErrInvalidTransition, id.Hex())
+	}
+	if !transition.Allows(car.Status) {
+		return nil, errInvalidTransition(action, car.Status)
+	}
+	if guard != nil {
+		if err := guard(*car); err != nil {
+			return nil, err
+		}
+	}
+
+	set := bson.M{"status": transition.To}
+	for field, value := range change.set {
+		set[field] = value
+	}
+	unset := bson.M{}
+	for _, field := range change.unset {
+		unset[field] = ""
+	}
+	// The reservation and the status reason only describe the status they were set with
+	for _, field := range []string{"reservation", "statusReason"} {
+		if _, ok := set[field]; !ok {
+			unset[field] = ""
+		}
+	}
+	update := bson.M{"$set": set, "$unset": unset, "$inc": bson.M{"version": 1}}
+
+	filter := bson.M{"_id": id, "status": car.Status, "version": carVersionFilter(car.Version)}
+	for field, condition := range change.match {
+		filter[field] = condition
+	}
+
+	var updatedCar models.Car
+	err = withTransaction(s.client, func(ctx mongo.SessionContext) error {
+		if change.customer != nil {
+			customer, err := change.customer(ctx, *car)
+			if err != nil {
+				return err
+			}
+			set["customer"] = customer
+		}
+
+		var payments []models.Payment
+		if change.payments != nil {
+			if payments, err = change.payments(ctx, *car); err != nil {
+				return err
+			}
+		}
+
+		err := s.carCollection.FindOneAndUpdate(ctx, filter, update, returnUpdatedCar).Decode(&updatedCar)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return fmt.Errorf("%w: car %s was changed by another request", ErrConflict, id.Hex())
+			}
+			return err
+		}
+
+		if change.record != nil {
+			if err := change.record(ctx, updatedCar, payments); err != nil {
+				return err
+			}
+		}
+		return s.audit.record(ctx, models.AuditEntityCar, id, action, car, &updatedCar)
+	})
+	if err != nil {
+		log.Printf("Error applying action '%s' to car with ID '%s': %v", action, id.Hex(), err)
+		return nil, err
+	}
+	return &updatedCar, nil
+}
+
+// sameCustomerGuard only allows a reserved car to be sold to the customer who reserved it.
+// Customers are compared by ID, or by email address for reservations made before customers had their own collection.
+func sameCustomerGuard(customer models.Customer) transitionGuard {
+	return func(car models.Car) error {
+		if car.Status != models.CarStatusReserved || car.Customer == nil {
+			return nil
+		}
+		same := strings.EqualFold(car.Customer.Email, customer.Email)
+		if !car.Customer.ID.IsZero() && !customer.ID.IsZero() {
+			same = car.Customer.ID == customer.ID
+		}
+		if !same {
+			return fmt.Errorf("%w: car is reserved for another customer", ErrInvalidTransition)
+		}
+		return nil
+	}
+}
+
+// customerStep resolves the customer of a reservation or a sale from its ID or inline details, see
+// customerService.resolveCustomer, and checks the car against the customer with the guard (if any).
+func (s *carService) customerStep(id *primitive.ObjectID, details models.Customer, guard func(customer models.Customer) transitionGuard) customerStep {
+	return func(ctx context.Context, car models.Car) (models.Customer, error) {
+		customer, err := s.customers.resolveCustomer(ctx, id, details)
+		if err != nil {
+			return models.Customer{}, err
+		}
+		if guard != nil {
+			if err := guard(customer)(car); err != nil {
+				return models.Customer{}, err
+			}
+		}
+		return customer, nil
+	}
+}
+
+// reservationExpiredGuard only allows releasing a reservation that expired at or before the given time.
+func reservationExpiredGuard(now time.Time) transitionGuard {
+	return func(car models.Car) error {
+		if car.Reservation == nil || car.Reservation.ExpiresAt.After(now) {
+			return fmt.Errorf("%w: reservation of car %s has not expired", ErrConflict, car.ID.Hex())
+		}
+		return nil
+	}
+}
+
+// depositStep records the deposit paid with a reservation (if any).
+func (s *carService) depositStep(deposit *models.PaymentRequest) paymentStep {
+	if deposit == nil {
+		return nil
+	}
+	return func(ctx context.Context, car models.Car) ([]models.Payment, error) {
+		return s.payments.recordPayments(ctx, car, models.PaymentTypeDeposit, []models.PaymentRequest{*deposit})
+	}
+}
+
+// salePaymentStep records the payments received with a sale, which must not exceed the price the car is sold for.
+func (s *carService) salePaymentStep(agreedPrice *float64, payments []models.PaymentRequest) paymentStep {
+	return func(ctx context.Context, car models.Car) ([]models.Payment, error) {
+		car.Price = salePrice(car, agreedPrice)
+		return s.payments.recordPayments(ctx, car, models.PaymentTypeSale, payments)
+	}
+}
+
+// salePrice returns the price a car is sold for: the agreed price when one is given, the list price of the car otherwise.
+// The steps of a sale are given the car checked by the transition, so the list price cannot change before the sale is stored.
+func salePrice(car models.Car, agreedPrice *float64) float64 {
+	if agreedPrice != nil {
+		return roundAmount(*agreedPrice)
+	}
+	return car.Price
+}
+
+// refundStep refunds every payment of the car that has not been refunded yet.
+func (s *carService) refundStep(ctx context.Context, car models.Car) ([]models.Payment, error) {
+	return s.payments.refundOutstanding(ctx, car.ID)
+}
+
+// saleRecordStep writes the sale record of a car that has just been sold. The salesperson is the user the service
+// records changes for, so sales made with an API key or by a background job have none.
+func (s *carService) saleRecordStep(agreedPrice *float64) recordStep {
+	var salesperson string
+	if s.audit.actor.Kind == models.ActorKindUser {
+		salesperson = s.audit.actor.Name
+	}
+	return func(ctx context.Context, car models.Car, _ []models.Payment) error {
+		price := salePrice(car, agreedPrice)
+		balance, err := s.payments.balanceOf(ctx, models.Car{ID: car.ID, Price: price})
+		if err != nil {
+			return err
+		}
+		record := models.Sale{
+			CarID: car.ID,
+			Car: models.CarSnapshot{
+				Make:      car.Make,
+				Model:     car.Model,
+				Year:      car.Year,
+				ListPrice: car.Price,
+				Picture:   car.Picture,
+			},
+			Customer:    *car.Customer,
+			Price:       price,
+			Paid:        balance.Paid,
+			Salesperson: salesperson,
+			SoldAt:      time.Now().UTC(),
+		}
+		if _, err := s.saleCollection.InsertOne(ctx, record); err != nil {
+			return err
+		}
+		return nil
+	}
+}
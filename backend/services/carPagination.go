@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// pageCursor is the decoded form of the opaque cursor handed to clients.
+// It records the sort order it was issued for and the sort values of the last car on the page.
+type pageCursor struct {
+	Sort   string `bson:"s"`
+	Values bson.A `bson:"v"`
+}
+
+// listCars retrieves a single page of cars matching the filter, ordered by the given sort fields.
+// The "_id" field is always used as the final sort field so that every car has a unique position.
+// Returns the page of cars and any error encountered, including ErrInvalidCursor.
+func (s *carService) listCars(filter bson.M, sortFields []models.CarSortField, page models.PageRequest) (*models.CarPage, error) {
+	sortFields = withIDTiebreaker(sortFields)
+	spec := sortSpec(sortFields)
+
+	query := filter
+	if page.Cursor != "" {
+		cursor, err := decodePageCursor(page.Cursor)
+		if err != nil || cursor.Sort != spec || len(cursor.Values) != len(sortFields) {
+			return nil, ErrInvalidCursor
+		}
+		query = bson.M{"$and": bson.A{filter, buildAfterFilter(sortFields, cursor.Values)}}
+	}
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = models.DefaultPageLimit
+	}
+
+	// Fetch one extra car to find out whether another page follows
+	opts := options.Find().SetSort(buildCarSort(sortFields)).SetLimit(int64(limit + 1))
+	cursor, err := s.carCollection.Find(context.Background(), query, opts)
+	if err != nil {
+		log.Printf("Error listing cars: %v", err)
+		return nil, err
+	}
+	cars := []models.Car{}
+	if err = cursor.All(context.Background(), &cars); err != nil {
+		log.Printf("Error decoding listed cars: %v", err)
+		return nil, err
+	}
+
+	result := &models.CarPage{Items: cars}
+	if len(cars) > limit {
+		result.Items = cars[:limit]
+		result.NextCursor, err = encodePageCursor(spec, sortFields, result.Items[limit-1])
+		if err != nil {
+			log.Printf("Error encoding page cursor: %v", err)
+			return nil, err
+		}
+	}
+
+	if page.IncludeTotal {
+		total, err := s.carCollection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			log.Printf("Error counting listed cars: %v", err)
+			return nil, err
+		}
+		result.Total = &total
+	}
+	return result, nil
+}
+
+// withIDTiebreaker returns the sort fields with "_id" appended when it is not already present.
+// Cars are ordered from newest to oldest when no sort fields are given.
+func withIDTiebreaker(fields []models.CarSortField) []models.CarSortField {
+	if len(fields) == 0 {
+		return []models.CarSortField{{Field: "_id", Direction: models.SortDescending}}
+	}
+	for _, field := range fields {
+		if field.Field == "_id" {
+			return fields
+		}
+	}
+	result := append([]models.CarSortField{}, fields...)
+	return append(result, models.CarSortField{Field: "_id", Direction: models.SortAscending})
+}
+
+// sortSpec returns a compact description of the sort fields, used to tie a cursor to its sort order.
+func sortSpec(fields []models.CarSortField) string {
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field.Field + ":" + strconv.Itoa(field.Direction)
+	}
+	return strings.Join(parts, ",")
+}
+
+// buildAfterFilter builds a filter matching the cars that are ordered after the given sort values.
+// For sort fields f1..fn it matches (f1 after v1) or (f1 = v1 and f2 after v2) and so on.
+func buildAfterFilter(fields []models.CarSortField, values bson.A) bson.M {
+	or := bson.A{}
+	for i, field := range fields {
+		clause := bson.M{}
+		for j := 0; j < i; j++ {
+			clause[fields[j].Field] = values[j]
+		}
+		operator := "$gt"
+		if field.Direction == models.SortDescending {
+			operator = "$lt"
+		}
+		clause[field.Field] = bson.M{operator: values[i]}
+		or = append(or, clause)
+	}
+	return bson.M{"$or": or}
+}
+
+// encodePageCursor builds the opaque cursor pointing after the given car.
+func encodePageCursor(spec string, fields []models.CarSortField, car models.Car) (string, error) {
+	values := bson.A{}
+	for _, field := range fields {
+		values = append(values, carSortValue(car, field.Field))
+	}
+	return encodeCursorValues(spec, values)
+}
+
+// encodeCursorValues builds the opaque cursor for the given sort order and sort values of the last item on a page.
+func encodeCursorValues(spec string, values bson.A) (string, error) {
+	data, err := bson.Marshal(pageCursor{Sort: spec, Values: values})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodePageCursor parses an opaque cursor produced by encodePageCursor.
+func decodePageCursor(token string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, err
+	}
+	err = bson.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// carSortValue returns the value of a sortable car document field.
+func carSortValue(car models.Car, field string) interface{} {
+	switch field {
+	case "price":
+		return car.Price
+	case "year":
+		return car.Year
+	default:
+		return car.ID
+	}
+}
+
+// newestFirst orders documents from newest to oldest, used by the listings that cannot be sorted by clients.
+var newestFirst = []models.CarSortField{{Field: "_id", Direction: models.SortDescending}}
+
+// listNewestFirst retrieves a single page of documents matching the filter, ordered from newest to oldest.
+// The id function returns the "_id" of a decoded document, which is used to build the cursor of the next page.
+// Returns the documents, the cursor of the next page, the total when requested and any error encountered,
+// including ErrInvalidCursor.
+func listNewestFirst[T any](collection *mongo.Collection, filter bson.M, page models.PageRequest, id func(T) primitive.ObjectID) ([]T, string, *int64, error) {
+	spec := sortSpec(newestFirst)
+	query := filter
+	if page.Cursor != "" {
+		cursor, err := decodePageCursor(page.Cursor)
+		if err != nil || cursor.Sort != spec || len(cursor.Values) != len(newestFirst) {
+			return nil, "", nil, ErrInvalidCursor
+		}
+		query = bson.M{"$and": bson.A{filter, buildAfterFilter(newestFirst, cursor.Values)}}
+	}
+
+	limit := page.Limit
+	if limit <= 0 {
+		limit = models.DefaultPageLimit
+	}
+
+	// Fetch one extra document to find out whether another page follows
+	opts := options.Find().SetSort(buildCarSort(newestFirst)).SetLimit(int64(limit + 1))
+	cursor, err := collection.Find(context.Background(), query, opts)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	items := []T{}
+	if err = cursor.All(context.Background(), &items); err != nil {
+		return nil, "", nil, err
+	}
+
+	var next string
+	if len(items) > limit {
+		items = items[:limit]
+		if next, err = encodeCursorValues(spec, bson.A{id(items[limit-1])}); err != nil {
+			return nil, "", nil, err
+		}
+	}
+
+	var total *int64
+	if page.IncludeTotal {
+		count, err := collection.CountDocuments(context.Background(), filter)
+		if err != nil {
+			return nil, "", nil, err
+		}
+		total = &count
+	}
+	return items, next, total, nil
+}
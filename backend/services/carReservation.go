@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ExtendReservation moves the expiry of the reservation of a reserved car.
+// The new expiry has to be later than the current one and at most one reservation hold period from now.
+// When an expected version is given, the reservation is only extended if the car is still at that version.
+// Returns the reserved car and any error encountered.
+func (s *carService) ExtendReservation(id primitive.ObjectID, expiresAt time.Time, version *int64) (*models.Car, error) {
+	car, err := s.GetCarByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCarVersion(*car, version); err != nil {
+		return nil, err
+	}
+	if car.Status != models.CarStatusReserved || car.Reservation == nil {
+		return nil, errInvalidTransition(models.CarActionExtendReservation, car.Status)
+	}
+
+	expiresAt = expiresAt.UTC()
+	if !expiresAt.After(car.Reservation.ExpiresAt) {
+		return nil, fmt.Errorf("%w: new expiry must be after the current expiry %s", ErrValidation, car.Reservation.ExpiresAt.Format(time.RFC3339))
+	}
+	if latest := time.Now().UTC().Add(s.reservationHoldPeriod); expiresAt.After(latest) {
+		return nil, fmt.Errorf("%w: new expiry must not be after %s", ErrValidation, latest.Format(time.RFC3339))
+	}
+
+	updatedCar, err := s.updateCarAudited(
+		car,
+		models.CarActionExtendReservation,
+		bson.M{"_id": id, "status": models.CarStatusReserved, "version": carVersionFilter(car.Version)},
+		bson.M{"$set": bson.M{"reservation.expiresAt": expiresAt}, "$inc": bson.M{"version": 1}},
+	)
+	if err != nil {
+		log.Printf("Error extending reservation of car with ID '%s': %v", id.Hex(), err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: car %s was changed by another request", ErrConflict, id.Hex())
+		}
+		return nil, err
+	}
+	return updatedCar, nil
+}
+
+// ExpireReservations makes every reserved car whose reservation expired at or before the given time available again,
+// recording models.StatusReasonReservationExpired as the reason and refunding the deposits paid with the reservations.
+// Cars that are changed by another request in the meantime are skipped.
+// Returns the released cars and any error encountered.
+func (s *carService) ExpireReservations(now time.Time) ([]models.Car, error) {
+	cursor, err := s.carCollection.Find(
+		context.Background(),
+		bson.M{"status": models.CarStatusReserved, "reservation.expiresAt": bson.M{"$lte": now}},
+		options.Find().SetProjection(bson.M{"_id": 1}),
+	)
+	if err != nil {
+		log.Printf("Error finding expired reservations: %v", err)
+		return nil, err
+	}
+	var expired []models.Car
+	if err := cursor.All(context.Background(), &expired); err != nil {
+		log.Printf("Error decoding expired reservations: %v", err)
+		return nil, err
+	}
+
+	released := []models.Car{}
+	for _, car := range expired {
+		change := carUpdate{
+			match:    bson.M{"reservation.expiresAt": bson.M{"$lte": now}},
+			set:      bson.M{"statusReason": models.StatusReasonReservationExpired},
+			unset:    []string{"customer"},
+			payments: s.refundStep,
+		}
+		releasedCar, err := s.transitionCar(car.ID, models.CarActionExpireReservation, change, reservationExpiredGuard(now))
+		if err != nil {
+			if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidTransition) || errors.Is(err, ErrConflict) {
+				continue
+			}
+			return released, err
+		}
+		released = append(released, *releasedCar)
+	}
+	return released, nil
+}
@@ -3,238 +3,537 @@ package services
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"log"
+	"net/http"
+	"regexp"
+	"time"
 
 	"github.com/lazarpetrovicc/Car-Dealership/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// returnUpdatedCar makes FindOneAndUpdate return the car document as it is after the update.
+var returnUpdatedCar = options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+// carVersionFilter returns the filter condition matching a car at the given version.
+// Cars stored before cars were versioned have no version field and are at version 0.
+func carVersionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
 // carService provides methods to manage cars and their associated images.
 type carService struct {
-	carCollection *mongo.Collection // MongoDB collection for storing cars
-	gridFSBucket  *gridfs.Bucket    // GridFS bucket for storing car images
+	client                *mongo.Client     // MongoDB client, used to run transactions
+	carCollection         *mongo.Collection // MongoDB collection for storing cars
+	saleCollection        *mongo.Collection // MongoDB collection for storing sales
+	images                ImageStore        // Store holding car images
+	reservationHoldPeriod time.Duration     // How long a new reservation holds a car
+	maxImageSize          int64             // Largest accepted image upload, in bytes
+	payments              *paymentService   // Records the payments belonging to status changes
+	customers             *customerService  // Resolves the customers cars are reserved and sold to
+	audit                 *auditLog         // Records the changes made to cars
 }
 
 // NewCarService initializes a new instance of carService.
 func NewCarService(client *mongo.Client, dbName string) *carService {
 	db := client.Database(dbName)
 	carCollection := db.Collection("cars")
-	bucket, _ := gridfs.NewBucket(db)
+	images, _ := NewGridFSImageStore(db)
 	return &carService{
-		carCollection: carCollection,
-		gridFSBucket:  bucket,
+		client:                client,
+		carCollection:         carCollection,
+		saleCollection:        db.Collection("sales"),
+		images:                images,
+		reservationHoldPeriod: models.DefaultReservationHoldPeriod,
+		maxImageSize:          models.DefaultMaxImageSize,
+		payments:              newPaymentService(db),
+		customers:             newCustomerService(db),
+		audit:                 newAuditLog(db),
 	}
 }
 
-// SetGridFSBucket sets the GridFS bucket used for storing car images.
-func (s *carService) SetGridFSBucket(bucket *gridfs.Bucket) {
-	s.gridFSBucket = bucket
+// WithActor returns a copy of the service that records the changes it makes, including those to customers,
+// in the audit log as made by the given actor.
+func (s *carService) WithActor(actor models.Actor) IcarService {
+	copied := *s
+	copied.customers = s.customers.withActor(actor)
+	copied.payments = s.payments.withActor(actor)
+	copied.audit = s.audit.withActor(actor)
+	return &copied
+}
+
+// SetImageStore sets the store car images are kept in, which is GridFS in the car database unless another store is set.
+func (s *carService) SetImageStore(store ImageStore) {
+	s.images = store
+}
+
+// SetReservationHoldPeriod sets how long new reservations hold a car.
+func (s *carService) SetReservationHoldPeriod(period time.Duration) {
+	s.reservationHoldPeriod = period
+}
+
+// SetMaxImageSize sets the largest accepted image upload, in bytes.
+func (s *carService) SetMaxImageSize(size int64) {
+	s.maxImageSize = size
 }
 
-// GetCarsByStatus retrieves cars from the database based on their status.
-// Returns a slice of cars and any error encountered.
-func (s *carService) GetCarsByStatus(status string) ([]models.Car, error) {
-	var cars []models.Car
-	cursor, err := s.carCollection.Find(context.Background(), bson.M{"status": status})
+// GetCarsByStatus retrieves a page of cars from the database based on their status, ordered from newest to oldest.
+// Deleted cars are left out.
+// Returns the page of cars and any error encountered.
+func (s *carService) GetCarsByStatus(status string, page models.PageRequest) (*models.CarPage, error) {
+	result, err := s.listCars(bson.M{"status": status, "deletedAt": bson.M{"$exists": false}}, nil, page)
 	if err != nil {
 		log.Printf("Error finding cars by status '%s': %v", status, err)
 		return nil, err
 	}
-	if err = cursor.All(context.Background(), &cars); err != nil {
-		log.Printf("Error decoding cars by status '%s': %v", status, err)
-		return nil, err
-	}
-	return cars, nil
+	return result, nil
 }
 
-// GetCarImage retrieves the image data for a specific car based on its picture ID.
-// Returns a byte slice containing the image data and any error encountered.
-func (s *carService) GetCarImage(pictureID string) ([]byte, error) {
-	oid, err := primitive.ObjectIDFromHex(pictureID)
+// SearchCars retrieves a page of cars matching the filters of the given query, ordered by its sort fields.
+// Returns the page of cars and any error encountered.
+func (s *carService) SearchCars(query models.CarQuery, page models.PageRequest) (*models.CarPage, error) {
+	result, err := s.listCars(buildCarFilter(query), query.Sort, page)
 	if err != nil {
-		log.Printf("Error converting pictureID '%s' to ObjectID: %v", pictureID, err)
+		log.Printf("Error searching cars: %v", err)
 		return nil, err
 	}
+	return result, nil
+}
 
-	dStream, err := s.gridFSBucket.OpenDownloadStream(oid)
-	if err != nil {
-		log.Printf("Error opening download stream for pictureID '%s': %v", pictureID, err)
-		return nil, err
+// buildCarFilter converts a validated car query into a MongoDB filter.
+func buildCarFilter(query models.CarQuery) bson.M {
+	filter := bson.M{}
+	switch query.Deleted {
+	case models.DeletedCarsInclude:
+	case models.DeletedCarsOnly:
+		filter["deletedAt"] = bson.M{"$exists": true}
+	default:
+		filter["deletedAt"] = bson.M{"$exists": false}
 	}
-	defer dStream.Close()
-
-	var buf bytes.Buffer
-	_, err = io.Copy(&buf, dStream)
-	if err != nil {
-		log.Printf("Error copying data from download stream for pictureID '%s': %v", pictureID, err)
-		return nil, err
+	if query.Status != "" {
+		filter["status"] = query.Status
+	}
+	if query.CustomerID != nil {
+		filter["customer._id"] = *query.CustomerID
+	}
+	if query.Make != "" {
+		filter["make"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query.Make) + "$", Options: "i"}
+	}
+	if query.Model != "" {
+		filter["model"] = primitive.Regex{Pattern: "^" + regexp.QuoteMeta(query.Model) + "$", Options: "i"}
 	}
 
-	return buf.Bytes(), nil
-}
+	year := bson.M{}
+	if query.MinYear != 0 {
+		year["$gte"] = query.MinYear
+	}
+	if query.MaxYear != 0 {
+		year["$lte"] = query.MaxYear
+	}
+	if len(year) > 0 {
+		filter["year"] = year
+	}
 
-// CreateCar inserts a new available car document into the database and uploads its image to GridFS.
-// Returns the MongoDB InsertOneResult and any error encountered.
-func (s *carService) CreateCar(car *models.Car, fileData []byte, fileName string) (interface{}, error) {
-	// Ensure that the car status is available
-	car.Status = models.CarStatusAvailable
+	price := bson.M{}
+	if query.MinPrice != 0 {
+		price["$gte"] = query.MinPrice
+	}
+	if query.MaxPrice != 0 {
+		price["$lte"] = query.MaxPrice
+	}
+	if len(price) > 0 {
+		filter["price"] = price
+	}
 
-	// Upload the image to GridFS
-	uploadStream, err := s.gridFSBucket.OpenUploadStream(fileName)
-	if err != nil {
-		log.Printf("Error opening upload stream for file '%s': %v", fileName, err)
-		return nil, err
+	if query.Text != "" {
+		text := primitive.Regex{Pattern: regexp.QuoteMeta(query.Text), Options: "i"}
+		filter["$or"] = bson.A{bson.M{"make": text}, bson.M{"model": text}}
 	}
-	defer uploadStream.Close()
+	return filter
+}
 
-	_, err = uploadStream.Write(fileData)
-	if err != nil {
-		log.Printf("Error writing file '%s' to upload stream: %v", fileName, err)
-		return nil, err
+// buildCarSort converts car sort fields into a MongoDB sort document.
+func buildCarSort(fields []models.CarSortField) bson.D {
+	sort := bson.D{}
+	for _, field := range fields {
+		sort = append(sort, bson.E{Key: field.Field, Value: field.Direction})
 	}
+	return sort
+}
 
-	car.Picture = uploadStream.FileID.(primitive.ObjectID).Hex()
-	// Insert the car document into the collection
-	result, err := s.carCollection.InsertOne(context.Background(), car)
+// GetCarByID retrieves a single car document by its ID.
+// Returns the car and any error encountered, including ErrNotFound if the car does not exist.
+func (s *carService) GetCarByID(id primitive.ObjectID) (*models.Car, error) {
+	var car models.Car
+	err := s.carCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&car)
 	if err != nil {
-		log.Printf("Error inserting car into collection: %v", err)
+		log.Printf("Error finding car with ID '%s': %v", id.Hex(), err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errCarNotFound(id)
+		}
 		return nil, err
 	}
-	return result, nil
+	return &car, nil
 }
 
-// UpdateCar updates an existing available car document in the database and updates its image in GridFS. Only available cars can be updated, and their status cannot be changed through updating.
-// Returns the MongoDB UpdateOneResult and any error encountered.
-func (s *carService) UpdateCar(id primitive.ObjectID, car *models.Car, fileData []byte, fileName string) (interface{}, error) {
-	if fileData != nil {
-		// Find the existing available car to get the current picture ID
-		var existingCar models.Car
-		err := s.carCollection.FindOne(context.Background(), bson.M{"_id": id, "status": models.CarStatusAvailable}).Decode(&existingCar)
+// GetCarImage retrieves the image data for a specific car based on its picture ID, in one of the sizes of models.ImageVariantSizes
+// or in its original size when the size is empty or models.ImageSizeOriginal. Images without a variant in the requested size,
+// because they are smaller or were uploaded before variants were generated, are returned in their original size.
+// The content type is the one stored with the image, or sniffed from the image data for images stored without one.
+// The image data is streamed from the image store as it is read, and the caller has to close it.
+// Returns the image file and any error encountered.
+func (s *carService) GetCarImage(pictureID string, size string) (*models.ImageFile, error) {
+	if _, err := primitive.ObjectIDFromHex(pictureID); err != nil {
+		log.Printf("Error converting pictureID '%s' to ObjectID: %v", pictureID, err)
+		return nil, fmt.Errorf("%w: picture ID '%s' is not a valid ID", ErrValidation, pictureID)
+	}
+
+	fileID := pictureID
+	if size != "" && size != models.ImageSizeOriginal {
+		variants, err := s.images.Variants(pictureID)
 		if err != nil {
-			log.Printf("Error finding existing car with ID '%s': %v", id.Hex(), err)
 			return nil, err
 		}
+		if variantID, ok := variants[size]; ok {
+			fileID = variantID
+		}
+	}
 
-		// Delete the old photo from GridFS if it exists
-		if existingCar.Picture != "" {
-			oldPictureID, err := primitive.ObjectIDFromHex(existingCar.Picture)
-			if err != nil {
-				log.Printf("Error converting old picture ID '%s' to ObjectID: %v", existingCar.Picture, err)
-				return nil, err
-			}
-			err = s.gridFSBucket.Delete(oldPictureID)
-			if err != nil {
-				log.Printf("Error deleting old picture with ID '%s': %v", oldPictureID.Hex(), err)
-				return nil, err
-			}
+	image, err := s.images.Open(fileID)
+	if err != nil {
+		log.Printf("Error opening picture with ID '%s': %v", pictureID, err)
+		if errors.Is(err, ErrNotFound) {
+			return nil, fmt.Errorf("%w: picture %s does not exist", ErrNotFound, pictureID)
 		}
+		return nil, err
+	}
 
-		// Upload the new photo to GridFS
-		uploadStream, err := s.gridFSBucket.OpenUploadStream(fileName)
-		if err != nil {
-			log.Printf("Error opening upload stream for file '%s': %v", fileName, err)
+	if image.ContentType == "" {
+		// Sniff the content type of images stored without one from the start of their data
+		head := make([]byte, sniffLength)
+		n, err := io.ReadFull(image.Content, head)
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			image.Content.Close()
+			log.Printf("Error reading data of picture with ID '%s': %v", pictureID, err)
 			return nil, err
 		}
-		defer uploadStream.Close()
-
-		_, err = uploadStream.Write(fileData)
-		if err != nil {
-			log.Printf("Error writing file '%s' to upload stream: %v", fileName, err)
+		image.ContentType = http.DetectContentType(head[:n])
+		if _, err := image.Content.Seek(0, io.SeekStart); err != nil {
+			image.Content.Close()
 			return nil, err
 		}
-		car.Picture = uploadStream.FileID.(primitive.ObjectID).Hex()
 	}
+	return image, nil
+}
 
-	// Ensure that the updated car status remains "available"
+// CreateCar inserts a new available car document into the database and uploads its image to the image store.
+// Returns the created car and any error encountered.
+func (s *carService) CreateCar(car *models.Car, content io.Reader, fileName string) (*models.Car, error) {
+	// Ensure that the car status is available
 	car.Status = models.CarStatusAvailable
+	car.Version = 1
 
-	update := bson.D{{Key: "$set", Value: car}}
-	result, err := s.carCollection.UpdateOne(context.Background(), bson.M{"_id": id}, update)
+	// Upload the image to the image store, it starts the gallery of the car as its primary image
+	pictureID, err := s.uploadPicture(content, fileName)
 	if err != nil {
-		log.Printf("Error updating car with ID '%s': %v", id.Hex(), err)
 		return nil, err
 	}
-	return result, nil
+	car.Picture = pictureID
+	car.Images = []models.CarImage{{ID: pictureID, Primary: true}}
+
+	// Insert the car document into the collection together with its audit entry
+	car.ID = primitive.NewObjectID()
+	err = withTransaction(s.client, func(ctx mongo.SessionContext) error {
+		if _, err := s.carCollection.InsertOne(ctx, car); err != nil {
+			return err
+		}
+		return s.audit.record(ctx, models.AuditEntityCar, car.ID, models.AuditActionCreate, nil, car)
+	})
+	if err != nil {
+		log.Printf("Error inserting car into collection: %v", err)
+		s.deletePicture(pictureID)
+		return nil, classifyWriteError(err)
+	}
+	return car, nil
 }
 
-// DeleteCar removes a car document from the database and deletes its associated image from GridFS. Only available cars can be deleted.
-// Returns the MongoDB DeleteOneResult and any error encountered.
-func (s *carService) DeleteCar(id primitive.ObjectID) (interface{}, error) {
-	var car models.Car
-	err := s.carCollection.FindOne(context.Background(), bson.M{"_id": id, "status": models.CarStatusAvailable}).Decode(&car)
+// uploadPicture streams an uploaded image to the image store and stores its resized variants, which the store links to
+// the image. The sniffed content type of every file is stored with it. The upload is never held in memory as a whole:
+// it is checked while it is streamed, and the stored file is read back to check its dimensions and generate the variants.
+// A file that turns out not to be acceptable is deleted again.
+// Returns the ID of the image and any error encountered, including ErrValidation if the upload is not an
+// acceptable image and ErrTooLarge if it is larger than the configured maximum image size.
+func (s *carService) uploadPicture(content io.Reader, fileName string) (string, error) {
+	image, contentType, err := sniffImage(&sizeLimitedReader{reader: content, limit: s.maxImageSize})
+	if err != nil {
+		log.Printf("Error checking file '%s': %v", fileName, err)
+		return "", err
+	}
+	pictureID, err := s.images.Save(fileName, image, ImageMetadata{ContentType: contentType})
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.storeImageVariants(pictureID, fileName, contentType); err != nil {
+		s.deletePicture(pictureID)
+		return "", err
+	}
+	return pictureID, nil
+}
+
+// storeImageVariants reads a stored image back from the image store, checks its header against the sniffed content type
+// and models.MaxImageDimension, and saves a resized variant for every size of models.ImageVariantSizes smaller than the image.
+// Returns any error encountered, including ErrValidation if the stored file is not an acceptable image.
+func (s *carService) storeImageVariants(pictureID, fileName, contentType string) error {
+	stored, err := s.images.Open(pictureID)
+	if err != nil {
+		return err
+	}
+	defer stored.Content.Close()
+	if err := checkImageConfig(stored.Content, contentType); err != nil {
+		log.Printf("Error checking file '%s': %v", fileName, err)
+		return err
+	}
+
+	// The header is known to be acceptable, so the image is only decoded in full now
+	if _, err := stored.Content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	variants, err := generateImageVariants(stored.Content, models.ImageVariantSizes)
+	if err != nil {
+		log.Printf("Error generating variants of file '%s': %v", fileName, err)
+		return fmt.Errorf("%w: image is not a valid %s image", ErrValidation, contentType)
+	}
+	for size, data := range variants {
+		metadata := ImageMetadata{ContentType: "image/jpeg", OriginalID: pictureID, Size: size}
+		if _, err := s.images.Save(size+"-"+fileName, bytes.NewReader(data), metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// editableCar retrieves a car that is about to be edited and checks that it is at the expected version and in one of
+// models.CarEditableStatuses. Returns the car and any error encountered, including ErrNotFound, ErrPrecondition and ErrCarNotEditable.
+func (s *carService) editableCar(id primitive.ObjectID, version *int64) (*models.Car, error) {
+	car, err := s.GetCarByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCarVersion(*car, version); err != nil {
+		return nil, err
+	}
+	if !models.IsEditableCarStatus(car.Status) {
+		return nil, errCarNotEditable(id, car.Status)
+	}
+	return car, nil
+}
+
+// UpdateCar updates the make, model, year, price and, when a new image is given, the primary image of an existing car.
+// Only cars in one of models.CarEditableStatuses can be updated, and their status cannot be changed through updating.
+// The status and the version are checked in the same operation that updates the car, so a car that is reserved or sold
+// concurrently is never modified. When an expected version is given, the car is only updated if it is still at that version.
+// Returns the updated car and any error encountered.
+func (s *carService) UpdateCar(id primitive.ObjectID, car *models.Car, content io.Reader, fileName string, version *int64) (*models.Car, error) {
+	existingCar, err := s.editableCar(id, version)
 	if err != nil {
-		log.Printf("Error finding car with ID '%s' for deletion: %v", id.Hex(), err)
 		return nil, err
 	}
 
-	// Delete the associated image from GridFS if it exists
-	if car.Picture != "" {
-		pictureID, err := primitive.ObjectIDFromHex(car.Picture)
+	set := bson.M{
+		"make":  car.Make,
+		"model": car.Model,
+		"year":  car.Year,
+		"price": car.Price,
+	}
+	if content != nil {
+		// Upload the new photo to the image store and put it in place of the primary image of the gallery
+		pictureID, err := s.uploadPicture(content, fileName)
 		if err != nil {
-			log.Printf("Error converting picture ID '%s' to ObjectID: %v", car.Picture, err)
 			return nil, err
 		}
-		err = s.gridFSBucket.Delete(pictureID)
-		if err != nil {
-			log.Printf("Error deleting picture with ID '%s': %v", pictureID.Hex(), err)
-			return nil, err
+		set["picture"] = pictureID
+		set["images"] = replacePrimaryImage(existingCar.Gallery(), pictureID)
+	}
+
+	filter := bson.M{
+		"_id":     id,
+		"status":  bson.M{"$in": models.CarEditableStatuses},
+		"version": carVersionFilter(existingCar.Version),
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	updatedCar, err := s.updateCarAudited(existingCar, models.AuditActionUpdate, filter, update)
+	if err != nil {
+		log.Printf("Error updating car with ID '%s': %v", id.Hex(), err)
+		if picture, ok := set["picture"].(string); ok {
+			s.deletePicture(picture)
+		}
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, s.updateFailure(id, version)
 		}
+		return nil, classifyWriteError(err)
 	}
 
-	// Delete the car document from the collection
-	result, err := s.carCollection.DeleteOne(context.Background(), bson.M{"_id": id})
+	// Delete the old photo from the image store once the car refers to the new one
+	if content != nil && existingCar.Picture != "" {
+		s.deletePicture(existingCar.Picture)
+	}
+	return updatedCar, nil
+}
+
+// PatchCar changes the fields of a car that are set in the patch and differ from the current values.
+// Like UpdateCar, it only changes cars in one of models.CarEditableStatuses and checks their status and version in the same
+// operation. A patch that does not change anything returns the car as it is, without incrementing its version.
+// Returns the patched car and any error encountered.
+func (s *carService) PatchCar(id primitive.ObjectID, patch models.CarPatch, version *int64) (*models.Car, error) {
+	existingCar, err := s.editableCar(id, version)
 	if err != nil {
-		log.Printf("Error deleting car with ID '%s': %v", id.Hex(), err)
 		return nil, err
 	}
-	return result, nil
+
+	set := bson.M{}
+	if patch.Make != nil && *patch.Make != existingCar.Make {
+		set["make"] = *patch.Make
+	}
+	if patch.Model != nil && *patch.Model != existingCar.Model {
+		set["model"] = *patch.Model
+	}
+	if patch.Year != nil && *patch.Year != existingCar.Year {
+		set["year"] = *patch.Year
+	}
+	if patch.Price != nil && *patch.Price != existingCar.Price {
+		set["price"] = *patch.Price
+	}
+	if len(set) == 0 {
+		return existingCar, nil
+	}
+
+	filter := bson.M{
+		"_id":     id,
+		"status":  bson.M{"$in": models.CarEditableStatuses},
+		"version": carVersionFilter(existingCar.Version),
+	}
+	update := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	patchedCar, err := s.updateCarAudited(existingCar, models.AuditActionUpdate, filter, update)
+	if err != nil {
+		log.Printf("Error patching car with ID '%s': %v", id.Hex(), err)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, s.updateFailure(id, version)
+		}
+		return nil, classifyWriteError(err)
+	}
+	return patchedCar, nil
 }
 
-// ReserveCar updates the status of a car to "reserved" and assigns a customer to it. Only available cars can be reserved.
-// Returns the MongoDB UpdateOneResult and any error encountered.
-func (s *carService) ReserveCar(id primitive.ObjectID, customer models.Customer) (interface{}, error) {
-	result, err := s.carCollection.UpdateOne(
-		context.Background(),
-		bson.M{"_id": id, "status": models.CarStatusAvailable},
-		bson.D{{Key: "$set", Value: bson.M{"status": models.CarStatusReserved, "customer": customer}}},
-	)
-	if err != nil {
-		log.Printf("Error reserving car with ID '%s': %v", id.Hex(), err)
+// updateCarAudited applies an update to the car matching the filter and records it in the audit log as a change from
+// the given car, in one transaction so that the car is never changed without its audit entry.
+// Returns the updated car and any error encountered, mongo.ErrNoDocuments when no car matches the filter.
+func (s *carService) updateCarAudited(car *models.Car, action string, filter, update bson.M) (*models.Car, error) {
+	var updatedCar models.Car
+	err := withTransaction(s.client, func(ctx mongo.SessionContext) error {
+		if err := s.carCollection.FindOneAndUpdate(ctx, filter, update, returnUpdatedCar).Decode(&updatedCar); err != nil {
+			return err
+		}
+		return s.audit.record(ctx, models.AuditEntityCar, car.ID, action, car, &updatedCar)
+	})
+	if err != nil {
 		return nil, err
 	}
-	return result, nil
+	return &updatedCar, nil
 }
 
-// CancelReservation updates the status of a reserved car back to "available" and clears the customer information.
-// Returns the MongoDB UpdateOneResult and any error encountered.
-func (s *carService) CancelReservation(id primitive.ObjectID) (interface{}, error) {
-	result, err := s.carCollection.UpdateOne(
-		context.Background(),
-		bson.M{"_id": id, "status": models.CarStatusReserved},
-		bson.D{{Key: "$set", Value: bson.M{"status": models.CarStatusAvailable, "customer": nil}}},
-	)
+// updateFailure explains why a car that was checked before an update no longer matched the update filter.
+// Returns ErrNotFound, ErrPrecondition or ErrCarNotEditable if one of them applies to the current car, and ErrConflict otherwise.
+func (s *carService) updateFailure(id primitive.ObjectID, version *int64) error {
+	car, err := s.GetCarByID(id)
 	if err != nil {
-		log.Printf("Error canceling reservation for car with ID '%s': %v", id.Hex(), err)
-		return nil, err
+		return err
 	}
-	return result, nil
+	if err := checkCarVersion(*car, version); err != nil {
+		return err
+	}
+	if !models.IsEditableCarStatus(car.Status) {
+		return errCarNotEditable(id, car.Status)
+	}
+	return fmt.Errorf("%w: car %s was changed by another request", ErrConflict, id.Hex())
 }
 
-// SellCar updates the status of a car to "sold" and assigns a customer to it. Only available cars can be sold.
-// Returns the MongoDB UpdateOneResult and any error encountered.
-func (s *carService) SellCar(id primitive.ObjectID, customer models.Customer) (interface{}, error) {
-	result, err := s.carCollection.UpdateOne(
-		context.Background(),
-		bson.M{"_id": id, "status": models.CarStatusAvailable},
-		bson.D{{Key: "$set", Value: bson.M{"status": models.CarStatusSold, "customer": customer}}},
-	)
+// deletePicture deletes a car image and its variants from the image store. Failures are logged, as the car no longer refers to the image.
+func (s *carService) deletePicture(pictureID string) {
+	variants, err := s.images.Variants(pictureID)
 	if err != nil {
-		log.Printf("Error selling car with ID '%s': %v", id.Hex(), err)
-		return nil, err
+		return
 	}
-	return result, nil
+	fileIDs := []string{pictureID}
+	for _, variantID := range variants {
+		fileIDs = append(fileIDs, variantID)
+	}
+	for _, fileID := range fileIDs {
+		if err := s.images.Delete(fileID); err != nil {
+			log.Printf("Error deleting picture with ID '%s': %v", fileID, err)
+		}
+	}
+}
+
+// ReserveCar updates the status of a car to "reserved" and assigns a customer to it. Only available cars can be reserved.
+// The customer is either an existing customer or inline details, which are stored in the customers collection in the
+// same transaction as the reservation, so a reservation that fails leaves the customers unchanged.
+// The reservation expires after the reservation hold period. A deposit paid with the reservation is recorded as a payment.
+// Returns the reserved car and any error encountered.
+func (s *carService) ReserveCar(id primitive.ObjectID, reservation models.ReservationRequest, version *int64) (*models.Car, error) {
+	now := time.Now().UTC()
+	change := carUpdate{
+		version:  version,
+		set:      bson.M{"reservation": models.Reservation{ReservedAt: now, ExpiresAt: now.Add(s.reservationHoldPeriod)}},
+		customer: s.customerStep(reservation.CustomerID, reservation.Customer, nil),
+		payments: s.depositStep(reservation.Deposit),
+	}
+	return s.transitionCar(id, models.CarActionReserve, change, nil)
+}
+
+// CancelReservation updates the status of a reserved car back to "available", clears the customer information
+// and refunds the deposits paid with the reservation.
+// Returns the car that is available again and any error encountered.
+func (s *carService) CancelReservation(id primitive.ObjectID, version *int64) (*models.Car, error) {
+	return s.transitionCar(id, models.CarActionCancelReservation, carUpdate{version: version, unset: []string{"customer"}, payments: s.refundStep}, nil)
+}
+
+// SellCar updates the status of a car to "sold", assigns a customer to it and records the sale in the sales ledger.
+// The customer is resolved like for ReserveCar. Payments received with the sale are recorded.
+// The car is sold for its list price at the version the sale is applied to, unless the sale sets a price. Available cars can be sold to anyone, reserved cars only to the customer who reserved them.
+// The user the service records changes for, as set by WithActor, is recorded as the salesperson.
+// Returns the sold car and any error encountered.
+func (s *carService) SellCar(id primitive.ObjectID, sale models.SaleRequest, version *int64) (*models.Car, error) {
+	change := carUpdate{
+		version:  version,
+		customer: s.customerStep(sale.CustomerID, sale.Customer, sameCustomerGuard),
+		payments: s.salePaymentStep(sale.Price, sale.Payments),
+		record:   s.saleRecordStep(sale.Price),
+	}
+	return s.transitionCar(id, models.CarActionSell, change, nil)
+}
+
+// ReturnCar takes back a sold car, clears the customer information, refunds its payments and moves it to "in-preparation".
+// Returns the returned car and any error encountered.
+func (s *carService) ReturnCar(id primitive.ObjectID, version *int64) (*models.Car, error) {
+	return s.transitionCar(id, models.CarActionReturn, carUpdate{version: version, unset: []string{"customer"}, payments: s.refundStep}, nil)
+}
+
+// ChangeCarStatus moves a car to one of the statuses listed in models.CarStatusActions, which do not involve a customer.
+// Returns the updated car and any error encountered.
+func (s *carService) ChangeCarStatus(id primitive.ObjectID, status string, version *int64) (*models.Car, error) {
+	action, ok := models.CarStatusActions[status]
+	if !ok {
+		return nil, fmt.Errorf("%w: status '%s' cannot be set directly", ErrValidation, status)
+	}
+	return s.transitionCar(id, action, carUpdate{version: version}, nil)
 }
@@ -0,0 +1,292 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// customerDocument is a customer as it is stored in the customers collection.
+// The normalized keys carry unique indexes, which prevent duplicate customers.
+type customerDocument struct {
+	models.Customer `bson:",inline"`
+	EmailKey        string `bson:"emailKey"` // Email address in lower case, without surrounding spaces
+	PhoneKey        string `bson:"phoneKey"` // Digits of the phone number
+}
+
+// customerService provides methods to manage customers.
+type customerService struct {
+	client             *mongo.Client     // MongoDB client, used to run transactions
+	customerCollection *mongo.Collection // MongoDB collection for storing customers
+	carCollection      *mongo.Collection // MongoDB collection for storing cars
+	audit              *auditLog         // Records the changes made to customers
+}
+
+// NewCustomerService initializes a new instance of customerService.
+func NewCustomerService(client *mongo.Client, dbName string) *customerService {
+	return newCustomerService(client.Database(dbName))
+}
+
+// newCustomerService initializes a customerService using the collections of the given database
+// and makes sure the indexes preventing duplicate customers exist.
+func newCustomerService(db *mongo.Database) *customerService {
+	s := &customerService{
+		client:             db.Client(),
+		customerCollection: db.Collection("customers"),
+		carCollection:      db.Collection("cars"),
+		audit:              newAuditLog(db),
+	}
+	_, err := s.customerCollection.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "emailKey", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "phoneKey", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		log.Printf("Error creating customer indexes: %v", err)
+	}
+	return s
+}
+
+// WithActor returns a copy of the service that records the changes it makes in the audit log as made by the given actor.
+func (s *customerService) WithActor(actor models.Actor) IcustomerService {
+	return s.withActor(actor)
+}
+
+// withActor returns a copy of the service that records its changes as made by the given actor.
+func (s *customerService) withActor(actor models.Actor) *customerService {
+	copied := *s
+	copied.audit = s.audit.withActor(actor)
+	return &copied
+}
+
+// GetCustomers retrieves a page of customers matching the query, ordered from newest to oldest.
+// Returns the page of customers and any error encountered.
+func (s *customerService) GetCustomers(query models.CustomerQuery, page models.PageRequest) (*models.CustomerPage, error) {
+	filter := bson.M{}
+	if query.Text != "" {
+		text := primitive.Regex{Pattern: regexp.QuoteMeta(query.Text), Options: "i"}
+		filter["$or"] = bson.A{bson.M{"fullName": text}, bson.M{"email": text}, bson.M{"phoneNumber": text}}
+	}
+
+	customers, next, total, err := listNewestFirst(s.customerCollection, filter, page, func(customer models.Customer) primitive.ObjectID { return customer.ID })
+	if err != nil {
+		if !errors.Is(err, ErrInvalidCursor) {
+			log.Printf("Error listing customers: %v", err)
+		}
+		return nil, err
+	}
+	return &models.CustomerPage{Items: customers, NextCursor: next, Total: total}, nil
+}
+
+// GetCustomerByID retrieves a single customer by its ID.
+// Returns the customer and any error encountered.
+func (s *customerService) GetCustomerByID(id primitive.ObjectID) (*models.Customer, error) {
+	return s.findByID(context.Background(), id)
+}
+
+// findByID retrieves a single customer by its ID.
+func (s *customerService) findByID(ctx context.Context, id primitive.ObjectID) (*models.Customer, error) {
+	var customer models.Customer
+	err := s.customerCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&customer)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errCustomerNotFound(id)
+		}
+		log.Printf("Error finding customer with ID '%s': %v", id.Hex(), err)
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// CreateCustomer inserts a new customer into the database, in a transaction with its audit entry.
+// Returns the created customer and any error encountered.
+func (s *customerService) CreateCustomer(customer models.Customer) (*models.Customer, error) {
+	var created *models.Customer
+	err := withTransaction(s.client, func(ctx mongo.SessionContext) error {
+		existing, err := s.findMatching(ctx, customer)
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			return fmt.Errorf("%w: customer %s already has this email address or phone number", ErrConflict, existing[0].ID.Hex())
+		}
+		created, err = s.insert(ctx, customer)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// UpdateCustomer updates the details of an existing customer, in a transaction with its audit entry.
+// Returns the updated customer and any error encountered.
+func (s *customerService) UpdateCustomer(id primitive.ObjectID, customer models.Customer) (*models.Customer, error) {
+	var updated *models.Customer
+	err := withTransaction(s.client, func(ctx mongo.SessionContext) error {
+		var err error
+		updated, err = s.update(ctx, id, customer)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// DeleteCustomer removes a customer that has no reserved cars, in a transaction with its audit entry.
+// Returns any error encountered.
+func (s *customerService) DeleteCustomer(id primitive.ObjectID) error {
+	return withTransaction(s.client, func(ctx mongo.SessionContext) error {
+		reserved, err := s.carCollection.CountDocuments(ctx, bson.M{"customer._id": id, "status": models.CarStatusReserved})
+		if err != nil {
+			log.Printf("Error counting reserved cars of customer with ID '%s': %v", id.Hex(), err)
+			return err
+		}
+		if reserved > 0 {
+			return fmt.Errorf("%w: customer %s has reserved cars", ErrConflict, id.Hex())
+		}
+
+		var deleted models.Customer
+		err = s.customerCollection.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&deleted)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return errCustomerNotFound(id)
+			}
+			log.Printf("Error deleting customer with ID '%s': %v", id.Hex(), err)
+			return err
+		}
+		return s.audit.record(ctx, models.AuditEntityCustomer, id, models.AuditActionDelete, &deleted, nil)
+	})
+}
+
+// resolveCustomer returns the customer a car is reserved or sold to.
+// An existing customer is looked up by ID; inline details are matched against existing customers by email address
+// and phone number, updating the matching customer or creating a new one.
+// Returns the stored customer and any error encountered, including ErrValidation for an unknown customer ID.
+func (s *customerService) resolveCustomer(ctx context.Context, id *primitive.ObjectID, details models.Customer) (models.Customer, error) {
+	if id != nil {
+		customer, err := s.findByID(ctx, *id)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return models.Customer{}, fmt.Errorf("%w: customer %s does not exist", ErrValidation, id.Hex())
+			}
+			return models.Customer{}, err
+		}
+		return *customer, nil
+	}
+
+	existing, err := s.findMatching(ctx, details)
+	if err != nil {
+		return models.Customer{}, err
+	}
+	switch len(existing) {
+	case 0:
+		customer, err := s.insert(ctx, details)
+		if err != nil {
+			return models.Customer{}, err
+		}
+		return *customer, nil
+	case 1:
+		customer, err := s.update(ctx, existing[0].ID, details)
+		if err != nil {
+			return models.Customer{}, err
+		}
+		return *customer, nil
+	default:
+		return models.Customer{}, fmt.Errorf("%w: the email address and the phone number belong to different customers", ErrConflict)
+	}
+}
+
+// findMatching retrieves the customers sharing the normalized email address or phone number of the given customer.
+func (s *customerService) findMatching(ctx context.Context, customer models.Customer) ([]models.Customer, error) {
+	cursor, err := s.customerCollection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"emailKey": normalizeEmail(customer.Email)},
+		bson.M{"phoneKey": normalizePhone(customer.PhoneNumber)},
+	}})
+	if err != nil {
+		log.Printf("Error finding matching customers: %v", err)
+		return nil, err
+	}
+	customers := []models.Customer{}
+	if err := cursor.All(ctx, &customers); err != nil {
+		log.Printf("Error decoding matching customers: %v", err)
+		return nil, err
+	}
+	return customers, nil
+}
+
+// insert stores a new customer together with its normalized keys and records it in the audit log.
+// Called in a transaction, so that the customer is only stored together with its audit entry.
+func (s *customerService) insert(ctx context.Context, customer models.Customer) (*models.Customer, error) {
+	customer.ID = primitive.NewObjectID()
+	document := customerDocument{
+		Customer: customer,
+		EmailKey: normalizeEmail(customer.Email),
+		PhoneKey: normalizePhone(customer.PhoneNumber),
+	}
+	if _, err := s.customerCollection.InsertOne(ctx, document); err != nil {
+		log.Printf("Error inserting customer: %v", err)
+		return nil, classifyWriteError(err)
+	}
+	if err := s.audit.record(ctx, models.AuditEntityCustomer, customer.ID, models.AuditActionCreate, nil, &customer); err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// update replaces the details and normalized keys of a stored customer and records the change in the audit log.
+// Called in a transaction, so that the customer is only changed together with its audit entry.
+func (s *customerService) update(ctx context.Context, id primitive.ObjectID, customer models.Customer) (*models.Customer, error) {
+	var existing models.Customer
+	err := s.customerCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"fullName":    customer.FullName,
+			"email":       customer.Email,
+			"phoneNumber": customer.PhoneNumber,
+			"emailKey":    normalizeEmail(customer.Email),
+			"phoneKey":    normalizePhone(customer.PhoneNumber),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.Before),
+	).Decode(&existing)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errCustomerNotFound(id)
+		}
+		log.Printf("Error updating customer with ID '%s': %v", id.Hex(), err)
+		return nil, classifyWriteError(err)
+	}
+
+	updated := existing
+	updated.FullName, updated.Email, updated.PhoneNumber = customer.FullName, customer.Email, customer.PhoneNumber
+	if err := s.audit.record(ctx, models.AuditEntityCustomer, id, models.AuditActionUpdate, &existing, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// normalizeEmail returns the form of an email address used to detect duplicate customers.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizePhone returns the form of a phone number used to detect duplicate customers, which keeps only its digits.
+func normalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, phone)
+}
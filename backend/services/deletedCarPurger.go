@@ -0,0 +1,38 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+)
+
+// DeletedCarPurger periodically removes cars that were deleted longer than the retention period ago, together with their images.
+type DeletedCarPurger struct {
+	*PeriodicJob
+	service   IcarService   // Service used to purge deleted cars
+	retention time.Duration // How long a deleted car can be restored before it is purged
+}
+
+// NewDeletedCarPurger initializes a purger that removes the cars deleted longer than the retention period ago through
+// the given service every interval. The first purge happens as soon as the purger is started. The purged cars are
+// recorded in the audit log as changes made by the deleted-car-purger system actor.
+func NewDeletedCarPurger(service IcarService, retention, interval time.Duration) *DeletedCarPurger {
+	p := &DeletedCarPurger{
+		service:   service.WithActor(models.Actor{Name: "deleted-car-purger", Kind: models.ActorKindSystem}),
+		retention: retention,
+	}
+	p.PeriodicJob = NewPeriodicJob(interval, true, p.purge)
+	return p
+}
+
+// purge removes the cars whose retention period has passed by now.
+func (p *DeletedCarPurger) purge() {
+	purged, err := p.service.PurgeDeletedCars(time.Now().UTC().Add(-p.retention))
+	if err != nil {
+		log.Printf("Error purging deleted cars: %v", err)
+	}
+	for _, car := range purged {
+		log.Printf("Car with ID '%s' was deleted at %s and has been purged", car.ID.Hex(), car.DeletedAt.Format(time.RFC3339))
+	}
+}
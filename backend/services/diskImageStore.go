@@ -0,0 +1,188 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+)
+
+// diskImageStore stores images as files in a directory of the local filesystem. Every image file is accompanied by a
+// JSON file holding its metadata.
+type diskImageStore struct {
+	dir string // Directory holding the images
+}
+
+// diskImageInfo is the metadata kept next to an image file of the disk image store.
+type diskImageInfo struct {
+	Name        string    `json:"name"`                 // Name of the uploaded file
+	ContentType string    `json:"contentType"`          // MIME type of the image data
+	OriginalID  string    `json:"originalId,omitempty"` // ID of the original image of a variant
+	Size        string    `json:"size,omitempty"`       // Size of a variant
+	UploadedAt  time.Time `json:"uploadedAt"`           // Time the image was stored
+}
+
+// NewDiskImageStore initializes an ImageStore keeping images in the given directory, which is created if it does not exist.
+// Returns the store and any error encountered.
+func NewDiskImageStore(dir string) (ImageStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &diskImageStore{dir: dir}, nil
+}
+
+// Save streams an image file to a temporary file, which is only renamed to its ID once it was written completely,
+// so a failed upload never leaves a partial image behind.
+// Returns the ID of the stored image and any error encountered.
+func (s *diskImageStore) Save(name string, content io.Reader, metadata ImageMetadata) (string, error) {
+	id := newImageID(metadata)
+	if !imageIDPattern.MatchString(id) {
+		return "", fmt.Errorf("%w: image ID '%s' is not valid", ErrValidation, id)
+	}
+
+	file, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		log.Printf("Error creating file for image '%s': %v", name, err)
+		return "", err
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Printf("Error writing image '%s' to disk: %v", name, err)
+		return "", err
+	}
+
+	info, err := json.Marshal(diskImageInfo{
+		Name:        name,
+		ContentType: metadata.ContentType,
+		OriginalID:  metadata.OriginalID,
+		Size:        metadata.Size,
+		UploadedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(s.infoPath(id), info, 0o644); err != nil {
+		log.Printf("Error writing metadata of image '%s' to disk: %v", name, err)
+		return "", err
+	}
+	if err := os.Rename(file.Name(), s.path(id)); err != nil {
+		log.Printf("Error moving image '%s' into place: %v", name, err)
+		os.Remove(s.infoPath(id))
+		return "", err
+	}
+	return id, nil
+}
+
+// Open opens an image file for streaming, with the content type and upload time from its metadata file.
+// Returns the image and any error encountered, including ErrNotFound if the image does not exist.
+func (s *diskImageStore) Open(id string) (*models.ImageFile, error) {
+	if !imageIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%w: image %s does not exist", ErrNotFound, id)
+	}
+	file, err := os.Open(s.path(id))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: image %s does not exist", ErrNotFound, id)
+		}
+		log.Printf("Error opening image '%s': %v", id, err)
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	info := diskImageInfo{UploadedAt: stat.ModTime().UTC()}
+	if data, err := os.ReadFile(s.infoPath(id)); err == nil {
+		if err := json.Unmarshal(data, &info); err != nil {
+			log.Printf("Error decoding metadata of image '%s': %v", id, err)
+		}
+	}
+	return &models.ImageFile{
+		ID:          id,
+		Content:     file,
+		ContentType: info.ContentType,
+		Size:        stat.Size(),
+		UploadedAt:  info.UploadedAt,
+	}, nil
+}
+
+// Variants checks which of the sizes of models.ImageVariantSizes have been stored for the original image.
+// Returns the IDs of the variants keyed by their size and any error encountered.
+func (s *diskImageStore) Variants(id string) (map[string]string, error) {
+	variants := make(map[string]string)
+	for size := range models.ImageVariantSizes {
+		variantID := variantImageID(id, size)
+		if !imageIDPattern.MatchString(variantID) {
+			continue
+		}
+		if _, err := os.Stat(s.path(variantID)); err == nil {
+			variants[size] = variantID
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return variants, nil
+}
+
+// Delete removes an image file and its metadata file.
+// Returns any error encountered.
+func (s *diskImageStore) Delete(id string) error {
+	if !imageIDPattern.MatchString(id) {
+		return nil
+	}
+	for _, path := range []string{s.path(id), s.infoPath(id)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// List lists the image files of the directory, leaving out metadata files and uploads in progress.
+// Returns the files and any error encountered.
+func (s *diskImageStore) List() ([]StoredImage, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		log.Printf("Error listing image directory '%s': %v", s.dir, err)
+		return nil, err
+	}
+	var images []StoredImage
+	for _, entry := range entries {
+		id := entry.Name()
+		if entry.IsDir() || !imageIDPattern.MatchString(id) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // Deleted since the directory was read
+			}
+			return nil, err
+		}
+		images = append(images, StoredImage{ID: id, OriginalID: originalImageID(id), UploadedAt: info.ModTime().UTC()})
+	}
+	return images, nil
+}
+
+// path returns the path of the file holding the image with the given ID.
+func (s *diskImageStore) path(id string) string {
+	return filepath.Join(s.dir, id)
+}
+
+// infoPath returns the path of the metadata file of the image with the given ID.
+func (s *diskImageStore) infoPath(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
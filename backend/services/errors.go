@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Domain errors returned by the services.
+// Errors returned by service methods wrap one of these so that callers can classify them with errors.Is.
+var (
+	ErrNotFound          = errors.New("not found")                // The requested resource does not exist
+	ErrInvalidTransition = errors.New("invalid state transition") // The resource is not in a state that allows the operation
+	ErrConflict          = errors.New("conflict")                 // The operation conflicts with existing data or a concurrent change
+	ErrValidation        = errors.New("validation failed")        // The input of the operation is invalid
+	ErrPrecondition      = errors.New("precondition failed")      // The resource changed since the version the caller expected
+	ErrTooLarge          = errors.New("too large")                // The input of the operation exceeds a size limit
+	ErrUnauthorized      = errors.New("unauthorized")             // The credentials or token of the caller are missing, invalid or expired
+	ErrForbidden         = errors.New("forbidden")                // The role of the caller does not allow the operation
+)
+
+// ErrInvalidCursor is returned when a page cursor is malformed or was issued for a different sort order.
+var ErrInvalidCursor = fmt.Errorf("%w: cursor is invalid", ErrValidation)
+
+// ErrCarNotEditable is returned when the details of a car cannot be edited in its status, see models.CarEditableStatuses.
+var ErrCarNotEditable = fmt.Errorf("%w: car is not editable", ErrInvalidTransition)
+
+// errCarNotEditable returns the error reported when the details of a car in the given status cannot be edited.
+func errCarNotEditable(id primitive.ObjectID, status string) error {
+	return fmt.Errorf("%w: car %s is %s", ErrCarNotEditable, id.Hex(), status)
+}
+
+// errCarNotFound returns the error reported when no car with the given ID exists.
+func errCarNotFound(id primitive.ObjectID) error {
+	return fmt.Errorf("%w: car %s does not exist", ErrNotFound, id.Hex())
+}
+
+// errCarImageNotFound returns the error reported when a car has no image with the given ID.
+func errCarImageNotFound(id primitive.ObjectID, imageID string) error {
+	return fmt.Errorf("%w: car %s has no image %s", ErrNotFound, id.Hex(), imageID)
+}
+
+// errCustomerNotFound returns the error reported when no customer with the given ID exists.
+func errCustomerNotFound(id primitive.ObjectID) error {
+	return fmt.Errorf("%w: customer %s does not exist", ErrNotFound, id.Hex())
+}
+
+// errInvalidTransition returns the error reported when an action is not allowed for a car in the given status.
+func errInvalidTransition(action, status string) error {
+	return fmt.Errorf("%w: action '%s' is not allowed for a car that is %s", ErrInvalidTransition, action, status)
+}
+
+// checkCarVersion returns ErrPrecondition when an expected version is given and the car is at a different version.
+func checkCarVersion(car models.Car, expected *int64) error {
+	if expected != nil && *expected != car.Version {
+		return fmt.Errorf("%w: car %s is at version %d, not %d", ErrPrecondition, car.ID.Hex(), car.Version, *expected)
+	}
+	return nil
+}
+
+// classifyWriteError wraps write errors that are caused by the data rather than the database in a domain error.
+func classifyWriteError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: a document with the same key already exists", ErrConflict)
+	}
+	return err
+}
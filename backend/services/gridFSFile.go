@@ -0,0 +1,92 @@
+package services
+
+import (
+	"errors"
+	"io"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+)
+
+// gridFSFile streams a GridFS file and supports seeking, which GridFS download streams do not.
+// Seeking only records the new position; the next read reopens the download stream and skips to it.
+// Skipping still reads the chunks before the position from MongoDB and discards them, so only the range
+// is sent to the client but the start of the file is downloaded from the database on every seek.
+type gridFSFile struct {
+	bucket       *gridfs.Bucket         // Bucket the file is stored in
+	fileID       primitive.ObjectID     // GridFS file ID
+	size         int64                  // Length of the file in bytes
+	stream       *gridfs.DownloadStream // Open download stream, nil until the file is read
+	offset       int64                  // Position the next read starts at
+	streamOffset int64                  // Position of the open download stream
+}
+
+// newGridFSFile wraps an open download stream of a GridFS file, which is positioned at the start of the file.
+func newGridFSFile(bucket *gridfs.Bucket, stream *gridfs.DownloadStream) *gridFSFile {
+	return &gridFSFile{
+		bucket: bucket,
+		fileID: stream.GetFile().ID.(primitive.ObjectID),
+		size:   stream.GetFile().Length,
+		stream: stream,
+	}
+}
+
+// Read reads from the current position, reopening the download stream when the file was seeked.
+func (f *gridFSFile) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if f.stream == nil || f.streamOffset != f.offset {
+		if err := f.reopen(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.stream.Read(p)
+	f.offset += int64(n)
+	f.streamOffset = f.offset
+	return n, err
+}
+
+// Seek sets the position of the next read.
+func (f *gridFSFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, errors.New("gridfs: seek to a negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close closes the download stream, if one is open.
+func (f *gridFSFile) Close() error {
+	if f.stream == nil {
+		return nil
+	}
+	err := f.stream.Close()
+	f.stream = nil
+	return err
+}
+
+// reopen opens a new download stream and reads up to the current offset, discarding what it read.
+func (f *gridFSFile) reopen() error {
+	f.Close()
+	stream, err := f.bucket.OpenDownloadStream(f.fileID)
+	if err != nil {
+		log.Printf("Error reopening download stream for file '%s': %v", f.fileID.Hex(), err)
+		return err
+	}
+	if _, err := stream.Skip(f.offset); err != nil {
+		stream.Close()
+		log.Printf("Error skipping to offset %d of file '%s': %v", f.offset, f.fileID.Hex(), err)
+		return err
+	}
+	f.stream = stream
+	f.streamOffset = f.offset
+	return nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// gridFSImageStore stores images in the default GridFS bucket of a MongoDB database. The content type, and for resized
+// variants the originalId and size, are kept in the metadata of each file.
+type gridFSImageStore struct {
+	bucket *gridfs.Bucket // GridFS bucket holding the images
+}
+
+// NewGridFSImageStore initializes an ImageStore keeping images in the default GridFS bucket of the database.
+// Returns the store and any error encountered.
+func NewGridFSImageStore(db *mongo.Database) (ImageStore, error) {
+	bucket, err := gridfs.NewBucket(db)
+	if err != nil {
+		return nil, err
+	}
+	return &gridFSImageStore{bucket: bucket}, nil
+}
+
+// Save streams an image file to GridFS. When reading the content fails, the partially written file is removed again.
+// Returns the GridFS file ID of the image and any error encountered.
+func (s *gridFSImageStore) Save(name string, content io.Reader, metadata ImageMetadata) (string, error) {
+	fileMetadata := bson.M{"contentType": metadata.ContentType}
+	if metadata.OriginalID != "" {
+		originalID, err := primitive.ObjectIDFromHex(metadata.OriginalID)
+		if err != nil {
+			return "", err
+		}
+		fileMetadata["originalId"] = originalID
+		fileMetadata["size"] = metadata.Size
+	}
+
+	uploadStream, err := s.bucket.OpenUploadStream(name, options.GridFSUpload().SetMetadata(fileMetadata))
+	if err != nil {
+		log.Printf("Error opening upload stream for file '%s': %v", name, err)
+		return "", err
+	}
+	if _, err := io.Copy(uploadStream, content); err != nil {
+		log.Printf("Error writing file '%s' to upload stream: %v", name, err)
+		if abortErr := uploadStream.Abort(); abortErr != nil {
+			log.Printf("Error aborting upload of file '%s': %v", name, abortErr)
+		}
+		return "", err
+	}
+	if err := uploadStream.Close(); err != nil {
+		log.Printf("Error closing upload stream for file '%s': %v", name, err)
+		return "", err
+	}
+	return uploadStream.FileID.(primitive.ObjectID).Hex(), nil
+}
+
+// Open opens a GridFS file for streaming, with the content type stored in its metadata.
+// Returns the file and any error encountered, including ErrNotFound if the file does not exist.
+func (s *gridFSImageStore) Open(id string) (*models.ImageFile, error) {
+	fileID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("%w: image %s does not exist", ErrNotFound, id)
+	}
+	stream, err := s.bucket.OpenDownloadStream(fileID)
+	if err != nil {
+		log.Printf("Error opening download stream for file '%s': %v", id, err)
+		if errors.Is(err, gridfs.ErrFileNotFound) {
+			return nil, fmt.Errorf("%w: image %s does not exist", ErrNotFound, id)
+		}
+		return nil, err
+	}
+
+	file := stream.GetFile()
+	contentType, _ := file.Metadata.Lookup("contentType").StringValueOK()
+	return &models.ImageFile{
+		ID:          id,
+		Content:     newGridFSFile(s.bucket, stream),
+		ContentType: contentType,
+		Size:        file.Length,
+		UploadedAt:  file.UploadDate,
+	}, nil
+}
+
+// Variants finds the GridFS files whose metadata links them to the original image.
+// Returns the file IDs of the variants keyed by their size and any error encountered.
+func (s *gridFSImageStore) Variants(id string) (map[string]string, error) {
+	originalID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return map[string]string{}, nil
+	}
+	cursor, err := s.bucket.Find(bson.M{"metadata.originalId": originalID})
+	if err != nil {
+		log.Printf("Error finding variants of image with ID '%s': %v", id, err)
+		return nil, err
+	}
+	var files []struct {
+		ID       primitive.ObjectID `bson:"_id"`
+		Metadata struct {
+			Size string `bson:"size"`
+		} `bson:"metadata"`
+	}
+	if err := cursor.All(context.Background(), &files); err != nil {
+		log.Printf("Error decoding variants of image with ID '%s': %v", id, err)
+		return nil, err
+	}
+
+	variants := make(map[string]string, len(files))
+	for _, file := range files {
+		variants[file.Metadata.Size] = file.ID.Hex()
+	}
+	return variants, nil
+}
+
+// List lists the files of the GridFS bucket, linking variants to their original image through their metadata.
+// Returns the files and any error encountered.
+func (s *gridFSImageStore) List() ([]StoredImage, error) {
+	cursor, err := s.bucket.Find(bson.M{})
+	if err != nil {
+		log.Printf("Error listing GridFS files: %v", err)
+		return nil, err
+	}
+	var files []struct {
+		ID         primitive.ObjectID `bson:"_id"`
+		UploadDate time.Time          `bson:"uploadDate"`
+		Metadata   struct {
+			OriginalID primitive.ObjectID `bson:"originalId"`
+		} `bson:"metadata"`
+	}
+	if err := cursor.All(context.Background(), &files); err != nil {
+		log.Printf("Error decoding GridFS files: %v", err)
+		return nil, err
+	}
+
+	images := make([]StoredImage, len(files))
+	for i, file := range files {
+		images[i] = StoredImage{ID: file.ID.Hex(), UploadedAt: file.UploadDate}
+		if !file.Metadata.OriginalID.IsZero() {
+			images[i].OriginalID = file.Metadata.OriginalID.Hex()
+		}
+	}
+	return images, nil
+}
+
+// Delete removes a GridFS file and its chunks.
+// Returns any error encountered.
+func (s *gridFSImageStore) Delete(id string) error {
+	fileID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil
+	}
+	if err := s.bucket.Delete(fileID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CheckImages compares the images the galleries of cars refer to with the files in the image store. Stored files older
+// than models.OrphanedImageGracePeriod that no car refers to are reported as orphaned, together with the variants of
+// such images; images cars refer to that are not stored are reported as missing.
+// When repair is true, orphaned files are deleted and missing images are removed from the galleries of their cars.
+// A car whose every image is missing keeps its gallery, as a car always has a primary image.
+// Returns the report of the check and any error encountered.
+func (s *carService) CheckImages(repair bool) (*models.ImageCheckReport, error) {
+	now := time.Now().UTC()
+	report := &models.ImageCheckReport{
+		CheckedAt:      now,
+		Repaired:       repair,
+		OrphanedImages: []models.OrphanedImage{},
+		MissingImages:  []models.MissingCarImage{},
+	}
+
+	// List the stored files before the cars, so that every car referring to a listed file is listed as well
+	stored, err := s.images.List()
+	if err != nil {
+		return nil, err
+	}
+	cars, err := s.listCarGalleries()
+	if err != nil {
+		return nil, err
+	}
+	report.StoredImages = len(stored)
+	report.CheckedCars = len(cars)
+
+	referenced := make(map[string]bool)
+	for _, car := range cars {
+		for _, image := range car.Gallery() {
+			referenced[image.ID] = true
+		}
+	}
+
+	storedIDs := make(map[string]bool, len(stored))
+	for _, file := range stored {
+		storedIDs[file.ID] = true
+		originalID := file.ID
+		if file.OriginalID != "" {
+			originalID = file.OriginalID
+		}
+		if referenced[originalID] || now.Sub(file.UploadedAt) < models.OrphanedImageGracePeriod {
+			continue
+		}
+
+		orphan := models.OrphanedImage{ID: file.ID, OriginalID: file.OriginalID, UploadedAt: file.UploadedAt}
+		if repair {
+			if err := s.images.Delete(file.ID); err != nil {
+				log.Printf("Error deleting orphaned image with ID '%s': %v", file.ID, err)
+			} else {
+				orphan.Deleted = true
+			}
+		}
+		report.OrphanedImages = append(report.OrphanedImages, orphan)
+	}
+
+	for _, car := range cars {
+		var missing []models.CarImage
+		for _, image := range car.Gallery() {
+			// Images stored after the files were listed are not in the listing, so they are looked up once more
+			if !storedIDs[image.ID] && !s.imageExists(image.ID) {
+				missing = append(missing, image)
+			}
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		removed := repair && s.removeMissingImages(car, missing)
+		for _, image := range missing {
+			report.MissingImages = append(report.MissingImages, models.MissingCarImage{
+				CarID:   car.ID.Hex(),
+				ImageID: image.ID,
+				Primary: image.Primary,
+				Removed: removed,
+			})
+		}
+	}
+	return report, nil
+}
+
+// listCarGalleries retrieves the ID, version and gallery of every car, whatever its status.
+// Returns the cars and any error encountered.
+func (s *carService) listCarGalleries() ([]models.Car, error) {
+	projection := options.Find().SetProjection(bson.M{"picture": 1, "images": 1, "version": 1})
+	cursor, err := s.carCollection.Find(context.Background(), bson.M{}, projection)
+	if err != nil {
+		log.Printf("Error finding the images of cars: %v", err)
+		return nil, err
+	}
+	var cars []models.Car
+	if err := cursor.All(context.Background(), &cars); err != nil {
+		log.Printf("Error decoding the images of cars: %v", err)
+		return nil, err
+	}
+	return cars, nil
+}
+
+// imageExists reports whether the image store holds the image with the given ID. Images that cannot be checked
+// are assumed to exist, so that they are never removed from a gallery because of a passing failure.
+func (s *carService) imageExists(imageID string) bool {
+	image, err := s.images.Open(imageID)
+	if err != nil {
+		return !errors.Is(err, ErrNotFound)
+	}
+	image.Content.Close()
+	return true
+}
+
+// removeMissingImages removes the missing images from the gallery of a car, making the first remaining image primary
+// when the primary image is missing. The car is only changed if it is still at the version it was checked at.
+// Reports whether the images were removed.
+func (s *carService) removeMissingImages(car models.Car, missing []models.CarImage) bool {
+	var images []models.CarImage
+	for _, image := range car.Gallery() {
+		if findCarImage(missing, image.ID) < 0 {
+			images = append(images, image)
+		}
+	}
+	if len(images) == 0 {
+		log.Printf("Every image of car with ID '%s' is missing, leaving its gallery as it is", car.ID.Hex())
+		return false
+	}
+
+	primary := images[0].ID
+	for _, image := range images {
+		if image.Primary {
+			primary = image.ID
+		}
+	}
+	images = setPrimaryImage(images, primary)
+
+	var updatedCar models.Car
+	filter := bson.M{"_id": car.ID, "version": carVersionFilter(car.Version)}
+	update := bson.M{"$set": bson.M{"images": images, "picture": primary}, "$inc": bson.M{"version": 1}}
+	err := withTransaction(s.client, func(ctx mongo.SessionContext) error {
+		if err := s.carCollection.FindOneAndUpdate(ctx, filter, update, returnUpdatedCar).Decode(&updatedCar); err != nil {
+			return err
+		}
+		// The checked car only holds its gallery, which is all the repair changed
+		before := updatedCar
+		before.Picture, before.Images = car.Picture, car.Images
+		return s.audit.record(ctx, models.AuditEntityCar, car.ID, models.AuditActionRepairImages, &before, &updatedCar)
+	})
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("Car with ID '%s' was changed while its images were checked, leaving its gallery as it is", car.ID.Hex())
+			return false
+		}
+		log.Printf("Error removing missing images from car with ID '%s': %v", car.ID.Hex(), err)
+		return false
+	}
+	return true
+}
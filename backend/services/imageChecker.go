@@ -0,0 +1,45 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+)
+
+// ImageChecker periodically checks that the images cars refer to and the stored images match, and optionally repairs
+// the problems it finds.
+type ImageChecker struct {
+	*PeriodicJob
+	service IcarService // Service used to check the images
+	repair  bool        // Whether problems found are repaired or only reported
+}
+
+// NewImageChecker initializes a checker that checks the images of cars through the given service every interval.
+// The first check happens after one interval, so that restarting the server does not start a check every time.
+// Repairs are recorded in the audit log as changes made by the image-checker system actor.
+func NewImageChecker(service IcarService, interval time.Duration, repair bool) *ImageChecker {
+	c := &ImageChecker{
+		service: service.WithActor(models.Actor{Name: "image-checker", Kind: models.ActorKindSystem}),
+		repair:  repair,
+	}
+	c.PeriodicJob = NewPeriodicJob(interval, false, c.check)
+	return c
+}
+
+// check checks the images once and logs the problems found.
+func (c *ImageChecker) check() {
+	report, err := c.service.CheckImages(c.repair)
+	if err != nil {
+		log.Printf("Error checking car images: %v", err)
+		return
+	}
+	for _, image := range report.OrphanedImages {
+		log.Printf("Image with ID '%s' is not referred to by any car (deleted: %t)", image.ID, image.Deleted)
+	}
+	for _, image := range report.MissingImages {
+		log.Printf("Image with ID '%s' of car with ID '%s' is missing (removed: %t)", image.ImageID, image.CarID, image.Removed)
+	}
+	log.Printf("Checked the images of %d cars against %d stored images: %d orphaned, %d missing",
+		report.CheckedCars, report.StoredImages, len(report.OrphanedImages), len(report.MissingImages))
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ImageMetadata describes an image file that is saved to an ImageStore.
+type ImageMetadata struct {
+	ContentType string // MIME type of the image data
+	OriginalID  string // ID of the original image when the file is one of its resized variants
+	Size        string // Size of the variant, one of models.ImageVariantSizes, empty for original images
+}
+
+// StoredImage describes a file held by an ImageStore.
+type StoredImage struct {
+	ID         string    // ID of the file
+	OriginalID string    // ID of the original image when the file is one of its resized variants
+	UploadedAt time.Time // Time the file was stored
+}
+
+// ImageStore stores the image files of cars. Stored files are never changed, so an ID always refers to the same content.
+// Car logic only refers to images by the IDs the store assigns, so images can be kept in GridFS, on a local disk or in
+// an S3-compatible object store without changing it.
+type ImageStore interface {
+	// Save streams an image file to the store under a new ID. When reading the content fails, nothing is kept.
+	// Returns the ID of the stored file and any error encountered, including the error reading the content.
+	Save(name string, content io.Reader, metadata ImageMetadata) (string, error)
+
+	// Open opens a stored file for streaming; the caller has to close its content. The content type is empty for
+	// files stored without one.
+	// Returns the file and any error encountered, including ErrNotFound if no file with the given ID exists.
+	Open(id string) (*models.ImageFile, error)
+
+	// Variants finds the resized variants of an original image.
+	// Returns the IDs of the variants keyed by their size and any error encountered.
+	Variants(id string) (map[string]string, error)
+
+	// Delete removes a stored file. Deleting a file that does not exist is not an error.
+	// Returns any error encountered.
+	Delete(id string) error
+
+	// List lists every stored file, original images and variants alike.
+	// Returns the files and any error encountered.
+	List() ([]StoredImage, error)
+}
+
+// imageIDPattern matches the IDs the disk and S3 image stores assign: an ObjectID for original images, followed by the
+// size for their variants. Only such IDs are used in file paths and object keys.
+var imageIDPattern = regexp.MustCompile(`^[0-9a-f]{24}(-[a-z]+)?$`)
+
+// newImageID returns the ID for an image saved with the given metadata. Variants are identified by their original
+// image and size, so they can be found without an index.
+func newImageID(metadata ImageMetadata) string {
+	if metadata.OriginalID != "" {
+		return variantImageID(metadata.OriginalID, metadata.Size)
+	}
+	return primitive.NewObjectID().Hex()
+}
+
+// variantImageID returns the ID of the variant of an original image in the given size.
+func variantImageID(originalID, size string) string {
+	return originalID + "-" + size
+}
+
+// originalImageID returns the ID of the original image of a variant ID assigned by newImageID, or an empty string for
+// the ID of an original image.
+func originalImageID(id string) string {
+	if original, _, isVariant := strings.Cut(id, "-"); isVariant {
+		return original
+	}
+	return ""
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+)
+
+// sniffLength is the number of leading bytes http.DetectContentType considers.
+const sniffLength = 512
+
+// sniffImage sniffs the content type of an uploaded image from its first bytes and checks it against models.ImageContentTypes.
+// Returns a reader yielding the whole image, including the sniffed bytes, the content type and any error encountered,
+// wrapping ErrValidation when the upload is empty or not of an accepted type.
+func sniffImage(content io.Reader) (io.Reader, string, error) {
+	buffered := bufio.NewReaderSize(content, sniffLength)
+	head, err := buffered.Peek(sniffLength)
+	if err != nil && err != io.EOF {
+		return nil, "", err
+	}
+	if len(head) == 0 {
+		return nil, "", fmt.Errorf("%w: image is empty", ErrValidation)
+	}
+
+	contentType := http.DetectContentType(head)
+	if !isImageContentType(contentType) {
+		return nil, "", fmt.Errorf("%w: image must be JPEG, PNG or WebP, not %s", ErrValidation, contentType)
+	}
+	return buffered, contentType, nil
+}
+
+// checkImageConfig reads the header of a stored image and checks that it decodes as the sniffed content type, so a file
+// with a forged signature is rejected, and that it is within models.MaxImageDimension.
+// Returns any error encountered, wrapping ErrValidation when the image is not acceptable.
+func checkImageConfig(content io.Reader, contentType string) error {
+	config, format, err := image.DecodeConfig(content)
+	if err != nil || "image/"+format != contentType {
+		return fmt.Errorf("%w: image is not a valid %s image", ErrValidation, contentType)
+	}
+	if config.Width > models.MaxImageDimension || config.Height > models.MaxImageDimension {
+		return fmt.Errorf("%w: image must not be larger than %dx%d pixels, not %dx%d",
+			ErrValidation, models.MaxImageDimension, models.MaxImageDimension, config.Width, config.Height)
+	}
+	return nil
+}
+
+// isImageContentType reports whether the content type is one of models.ImageContentTypes.
+func isImageContentType(contentType string) bool {
+	for _, allowed := range models.ImageContentTypes {
+		if allowed == contentType {
+			return true
+		}
+	}
+	return false
+}
+
+// sizeLimitedReader reads from an upload and fails with ErrTooLarge once it yields more than limit bytes.
+// Unlike io.LimitReader it does not end the upload silently, so a truncated file is never stored.
+type sizeLimitedReader struct {
+	reader io.Reader // Upload being read
+	limit  int64     // Largest number of bytes the upload may have
+	read   int64     // Number of bytes read so far
+}
+
+// Read reads from the upload, returning ErrTooLarge as soon as it exceeds the limit.
+func (r *sizeLimitedReader) Read(p []byte) (int, error) {
+	// Read one byte past the limit at most, which is enough to tell that the upload is too large
+	if remaining := r.limit - r.read + 1; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		return 0, fmt.Errorf("%w: image must not be larger than %d bytes", ErrTooLarge, r.limit)
+	}
+	return n, err
+}
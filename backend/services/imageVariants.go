@@ -0,0 +1,60 @@
+package services
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	_ "image/png" // Registers the PNG decoder with image.Decode
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Registers the WebP decoder with image.Decode
+)
+
+// imageVariantQuality is the JPEG quality the resized variants of car images are encoded with.
+const imageVariantQuality = 80
+
+// generateImageVariants decodes a stored image and encodes a resized JPEG for every size, such as those of
+// models.ImageVariantSizes, that is smaller than the image.
+// Returns the encoded variants keyed by size and any error encountered decoding the image.
+func generateImageVariants(content io.Reader, sizes map[string]int) (map[string][]byte, error) {
+	src, _, err := image.Decode(content)
+	if err != nil {
+		return nil, err
+	}
+
+	variants := make(map[string][]byte)
+	for size, maxSide := range sizes {
+		resized := resizeImage(src, maxSide)
+		if resized == nil {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: imageVariantQuality}); err != nil {
+			return nil, err
+		}
+		variants[size] = buf.Bytes()
+	}
+	return variants, nil
+}
+
+// resizeImage scales an image down so that its longer side is maxSide pixels long, keeping its aspect ratio.
+// Transparent areas are filled with white, as JPEG has no transparency. Returns nil if the image is not larger than maxSide.
+func resizeImage(src image.Image, maxSide int) image.Image {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSide && height <= maxSide {
+		return nil
+	}
+	if width >= height {
+		width, height = maxSide, max(1, height*maxSide/width)
+	} else {
+		width, height = max(1, width*maxSide/height), maxSide
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Over, nil)
+	return dst
+}
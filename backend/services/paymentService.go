@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// paymentTypesByStatus maps the statuses in which payments can be recorded to the type of those payments.
+var paymentTypesByStatus = map[string]string{
+	models.CarStatusReserved: models.PaymentTypeDeposit,
+	models.CarStatusSold:     models.PaymentTypeSale,
+}
+
+// paymentService provides methods to record and query the payments of cars.
+type paymentService struct {
+	client            *mongo.Client     // MongoDB client used to record payments in transactions
+	paymentCollection *mongo.Collection // MongoDB collection for storing payments
+	carCollection     *mongo.Collection // MongoDB collection for storing cars
+	saleCollection    *mongo.Collection // MongoDB collection for storing sales, which fix the price of sold cars
+	audit             *auditLog         // Records the payments in the audit log
+}
+
+// NewPaymentService initializes a new instance of paymentService.
+func NewPaymentService(client *mongo.Client, dbName string) *paymentService {
+	return newPaymentService(client.Database(dbName))
+}
+
+// newPaymentService initializes a paymentService using the collections of the given database.
+func newPaymentService(db *mongo.Database) *paymentService {
+	return &paymentService{
+		client:            db.Client(),
+		paymentCollection: db.Collection("payments"),
+		carCollection:     db.Collection("cars"),
+		saleCollection:    db.Collection("sales"),
+		audit:             newAuditLog(db),
+	}
+}
+
+// WithActor returns a copy of the service that records the payments it takes in the audit log as made by the given actor.
+func (s *paymentService) WithActor(actor models.Actor) IpaymentService {
+	return s.withActor(actor)
+}
+
+// withActor returns a copy of the service that records its payments as made by the given actor.
+func (s *paymentService) withActor(actor models.Actor) *paymentService {
+	copied := *s
+	copied.audit = s.audit.withActor(actor)
+	return &copied
+}
+
+// GetPaymentsByCar retrieves the payments and refunds of a car, from oldest to newest.
+// Returns the payments and any error encountered.
+func (s *paymentService) GetPaymentsByCar(carID primitive.ObjectID) ([]models.Payment, error) {
+	if _, err := s.findCar(context.Background(), carID); err != nil {
+		return nil, err
+	}
+	return s.paymentsOf(context.Background(), carID)
+}
+
+// RecordPayment records a payment for a reserved or sold car.
+// The payment is checked against the balance due and stored in a transaction that increments the version of the car,
+// so concurrent payments are applied one after the other and cannot together exceed the balance due.
+// The payment is recorded in the audit log of the car in the same transaction.
+// Returns the recorded payment and any error encountered.
+func (s *paymentService) RecordPayment(carID primitive.ObjectID, payment models.PaymentRequest) (*models.Payment, error) {
+	var payments []models.Payment
+	err := withTransaction(s.client, func(ctx mongo.SessionContext) error {
+		car, err := s.findCar(ctx, carID)
+		if err != nil {
+			return err
+		}
+		paymentType, ok := paymentTypesByStatus[car.Status]
+		if !ok {
+			return fmt.Errorf("%w: payments cannot be recorded for a car that is %s", ErrInvalidTransition, car.Status)
+		}
+
+		if payments, err = s.recordPayments(ctx, *car, paymentType, []models.PaymentRequest{payment}); err != nil {
+			return err
+		}
+
+		// Change the car, so that a concurrent payment for it conflicts with this one
+		filter := bson.M{"_id": carID, "status": car.Status, "version": carVersionFilter(car.Version)}
+		result, err := s.carCollection.UpdateOne(ctx, filter, bson.M{"$inc": bson.M{"version": 1}})
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return fmt.Errorf("%w: car %s was changed by another request", ErrConflict, carID.Hex())
+		}
+		return s.audit.record(ctx, models.AuditEntityCar, carID, models.AuditActionPayment, nil, &payments[0])
+	})
+	if err != nil {
+		log.Printf("Error recording payment for car with ID '%s': %v", carID.Hex(), err)
+		return nil, err
+	}
+	return &payments[0], nil
+}
+
+// GetBalance calculates how much of the price of a car has been paid and how much is still due.
+// Returns the balance and any error encountered.
+func (s *paymentService) GetBalance(carID primitive.ObjectID) (*models.CarBalance, error) {
+	car, err := s.findCar(context.Background(), carID)
+	if err != nil {
+		return nil, err
+	}
+	return s.balanceOf(context.Background(), *car)
+}
+
+// findCar retrieves the car payments are recorded for.
+func (s *paymentService) findCar(ctx context.Context, carID primitive.ObjectID) (*models.Car, error) {
+	var car models.Car
+	err := s.carCollection.FindOne(ctx, bson.M{"_id": carID}).Decode(&car)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errCarNotFound(carID)
+		}
+		log.Printf("Error finding car with ID '%s': %v", carID.Hex(), err)
+		return nil, err
+	}
+	return &car, nil
+}
+
+// paymentsOf retrieves the payments and refunds of a car, from oldest to newest.
+func (s *paymentService) paymentsOf(ctx context.Context, carID primitive.ObjectID) ([]models.Payment, error) {
+	cursor, err := s.paymentCollection.Find(
+		ctx,
+		bson.M{"carId": carID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		log.Printf("Error finding payments of car with ID '%s': %v", carID.Hex(), err)
+		return nil, err
+	}
+	payments := []models.Payment{}
+	if err := cursor.All(ctx, &payments); err != nil {
+		log.Printf("Error decoding payments of car with ID '%s': %v", carID.Hex(), err)
+		return nil, err
+	}
+	return payments, nil
+}
+
+// recordPayments stores payments of the given type for a car, provided that together they do not exceed the balance due.
+// Returns the stored payments and any error encountered.
+func (s *paymentService) recordPayments(ctx context.Context, car models.Car, paymentType string, requests []models.PaymentRequest) ([]models.Payment, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	balance, err := s.balanceOf(ctx, car)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	total := 0.0
+	payments := make([]models.Payment, len(requests))
+	documents := make([]interface{}, len(requests))
+	for i, request := range requests {
+		total += request.Amount
+		payments[i] = models.Payment{
+			ID:        primitive.NewObjectID(),
+			CarID:     car.ID,
+			Type:      paymentType,
+			Method:    request.Method,
+			Amount:    roundAmount(request.Amount),
+			CreatedAt: now,
+		}
+		documents[i] = payments[i]
+	}
+	if roundAmount(total) > balance.BalanceDue {
+		return nil, fmt.Errorf("%w: payments of %.2f exceed the balance due of %.2f", ErrValidation, roundAmount(total), balance.BalanceDue)
+	}
+
+	if _, err := s.paymentCollection.InsertMany(ctx, documents); err != nil {
+		log.Printf("Error recording payments of car with ID '%s': %v", car.ID.Hex(), err)
+		return nil, err
+	}
+	return payments, nil
+}
+
+// refundOutstanding records a refund for every payment of a car that has not been refunded yet.
+// Returns the recorded refunds and any error encountered.
+func (s *paymentService) refundOutstanding(ctx context.Context, carID primitive.ObjectID) ([]models.Payment, error) {
+	payments, err := s.paymentsOf(ctx, carID)
+	if err != nil {
+		return nil, err
+	}
+
+	refunded := make(map[primitive.ObjectID]bool)
+	for _, payment := range payments {
+		if payment.RefundOf != nil {
+			refunded[*payment.RefundOf] = true
+		}
+	}
+
+	now := time.Now().UTC()
+	var refunds []models.Payment
+	var documents []interface{}
+	for _, payment := range payments {
+		if payment.Type == models.PaymentTypeRefund || refunded[payment.ID] {
+			continue
+		}
+		refundOf := payment.ID
+		refund := models.Payment{
+			ID:        primitive.NewObjectID(),
+			CarID:     carID,
+			Type:      models.PaymentTypeRefund,
+			Method:    payment.Method,
+			Amount:    payment.Amount,
+			RefundOf:  &refundOf,
+			CreatedAt: now,
+		}
+		refunds = append(refunds, refund)
+		documents = append(documents, refund)
+	}
+	if len(documents) == 0 {
+		return nil, nil
+	}
+
+	if _, err := s.paymentCollection.InsertMany(ctx, documents); err != nil {
+		log.Printf("Error refunding payments of car with ID '%s': %v", carID.Hex(), err)
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// balanceOf calculates the balance of a car against the price it was sold for, or its list price while it is not sold.
+func (s *paymentService) balanceOf(ctx context.Context, car models.Car) (*models.CarBalance, error) {
+	if car.Status == models.CarStatusSold {
+		var sale models.Sale
+		err := s.saleCollection.FindOne(ctx, bson.M{"carId": car.ID}, options.FindOne().SetSort(bson.M{"_id": -1})).Decode(&sale)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("Error finding sale of car with ID '%s': %v", car.ID.Hex(), err)
+			return nil, err
+		}
+		if err == nil {
+			car.Price = sale.Price
+		}
+	}
+
+	payments, err := s.paymentsOf(ctx, car.ID)
+	if err != nil {
+		return nil, err
+	}
+	balance := calculateBalance(car, payments)
+	return &balance, nil
+}
+
+// calculateBalance sums the payments of a car, less refunds, and compares them with the price of the car.
+func calculateBalance(car models.Car, payments []models.Payment) models.CarBalance {
+	paid := 0.0
+	for _, payment := range payments {
+		if payment.Type == models.PaymentTypeRefund {
+			paid -= payment.Amount
+		} else {
+			paid += payment.Amount
+		}
+	}
+	paid = roundAmount(paid)
+	return models.CarBalance{
+		CarID:      car.ID,
+		Price:      car.Price,
+		Paid:       paid,
+		BalanceDue: roundAmount(math.Max(car.Price-paid, 0)),
+	}
+}
+
+// roundAmount rounds an amount of money to cents.
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// PeriodicJob runs a function every interval in a separate goroutine until it is stopped.
+// The background jobs of the server, such as the ReservationSweeper, are built on it.
+type PeriodicJob struct {
+	interval  time.Duration // Time between two runs
+	immediate bool          // Whether the first run happens on Start or after one interval
+	run       func()        // Function run on every tick
+	stop      chan struct{} // Closed to stop the job
+	done      chan struct{} // Closed when the job has stopped
+	stopOnce  sync.Once
+}
+
+// NewPeriodicJob initializes a job that runs the given function every interval. When immediate is set the first run
+// happens as soon as the job is started, otherwise after one interval.
+func NewPeriodicJob(interval time.Duration, immediate bool, run func()) *PeriodicJob {
+	return &PeriodicJob{
+		interval:  interval,
+		immediate: immediate,
+		run:       run,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start runs the job in a separate goroutine.
+func (j *PeriodicJob) Start() {
+	go j.loop()
+}
+
+// Stop stops the job and waits for a run in progress to finish. Stopping a stopped job does nothing.
+func (j *PeriodicJob) Stop() {
+	j.stopOnce.Do(func() { close(j.stop) })
+	<-j.done
+}
+
+// loop runs the function on every tick until the job is stopped.
+func (j *PeriodicJob) loop() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	if j.immediate {
+		j.run()
+	}
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.run()
+		}
+	}
+}
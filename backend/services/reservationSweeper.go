@@ -0,0 +1,36 @@
+package services
+
+import (
+	"log"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+)
+
+// ReservationSweeper periodically makes cars with expired reservations available again.
+type ReservationSweeper struct {
+	*PeriodicJob
+	service IcarService // Service used to release expired reservations
+}
+
+// NewReservationSweeper initializes a sweeper that releases expired reservations through the given service every interval.
+// The first sweep happens as soon as the sweeper is started. The released reservations are recorded in the audit log
+// as changes made by the reservation-sweeper system actor.
+func NewReservationSweeper(service IcarService, interval time.Duration) *ReservationSweeper {
+	s := &ReservationSweeper{
+		service: service.WithActor(models.Actor{Name: "reservation-sweeper", Kind: models.ActorKindSystem}),
+	}
+	s.PeriodicJob = NewPeriodicJob(interval, true, s.sweep)
+	return s
+}
+
+// sweep releases the reservations that have expired by now.
+func (s *ReservationSweeper) sweep() {
+	released, err := s.service.ExpireReservations(time.Now().UTC())
+	if err != nil {
+		log.Printf("Error releasing expired reservations: %v", err)
+	}
+	for _, car := range released {
+		log.Printf("Reservation of car with ID '%s' expired, the car is available again", car.ID.Hex())
+	}
+}
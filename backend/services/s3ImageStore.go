@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Options holds the settings of the S3-compatible object store images are kept in.
+type S3Options struct {
+	Endpoint        string // Host and port of the object store, such as s3.amazonaws.com or localhost:9000
+	Bucket          string // Bucket holding the images, created if it does not exist
+	Region          string // Region of the bucket, empty to use the default region of the store
+	AccessKeyID     string // Access key used to sign requests
+	SecretAccessKey string // Secret key used to sign requests
+	UseSSL          bool   // Whether the object store is reached through HTTPS
+}
+
+// s3ImageStore stores images as objects in a bucket of an S3-compatible object store such as Amazon S3 or MinIO.
+// Objects are named by the IDs of their images; the name of the uploaded file and the original image and size of
+// variants are kept in the user metadata of each object.
+type s3ImageStore struct {
+	client *minio.Client // Client of the object store
+	bucket string        // Bucket holding the images
+}
+
+// NewS3ImageStore initializes an ImageStore keeping images in a bucket of an S3-compatible object store,
+// creating the bucket if it does not exist.
+// Returns the store and any error encountered.
+func NewS3ImageStore(opts S3Options) (ImageStore, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKeyID, opts.SecretAccessKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("checking bucket '%s': %w", opts.Bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, opts.Bucket, minio.MakeBucketOptions{Region: opts.Region}); err != nil {
+			return nil, fmt.Errorf("creating bucket '%s': %w", opts.Bucket, err)
+		}
+	}
+	return &s3ImageStore{client: client, bucket: opts.Bucket}, nil
+}
+
+// Save streams an image file to a temporary file first, so that it is uploaded with a known length in a single request
+// instead of being buffered in memory in parts. A failed upload never leaves an object behind.
+// Returns the ID of the stored image and any error encountered.
+func (s *s3ImageStore) Save(name string, content io.Reader, metadata ImageMetadata) (string, error) {
+	id := newImageID(metadata)
+	if !imageIDPattern.MatchString(id) {
+		return "", fmt.Errorf("%w: image ID '%s' is not valid", ErrValidation, id)
+	}
+
+	file, err := os.CreateTemp("", "car-image-*")
+	if err != nil {
+		log.Printf("Error creating temporary file for image '%s': %v", name, err)
+		return "", err
+	}
+	defer func() {
+		file.Close()
+		os.Remove(file.Name())
+	}()
+	size, err := io.Copy(file, content)
+	if err != nil {
+		log.Printf("Error writing image '%s' to temporary file: %v", name, err)
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	userMetadata := map[string]string{"name": name}
+	if metadata.OriginalID != "" {
+		userMetadata["original-id"] = metadata.OriginalID
+		userMetadata["size"] = metadata.Size
+	}
+	_, err = s.client.PutObject(context.Background(), s.bucket, id, file, size, minio.PutObjectOptions{
+		ContentType:  metadata.ContentType,
+		UserMetadata: userMetadata,
+	})
+	if err != nil {
+		log.Printf("Error uploading image '%s' to bucket '%s': %v", name, s.bucket, err)
+		return "", err
+	}
+	return id, nil
+}
+
+// Open opens an object for streaming. Reading and seeking request the object in ranges as it is consumed.
+// Returns the image and any error encountered, including ErrNotFound if the image does not exist.
+func (s *s3ImageStore) Open(id string) (*models.ImageFile, error) {
+	if !imageIDPattern.MatchString(id) {
+		return nil, fmt.Errorf("%w: image %s does not exist", ErrNotFound, id)
+	}
+	object, err := s.client.GetObject(context.Background(), s.bucket, id, minio.GetObjectOptions{})
+	if err != nil {
+		log.Printf("Error opening image '%s': %v", id, err)
+		return nil, err
+	}
+	info, err := object.Stat()
+	if err != nil {
+		object.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%w: image %s does not exist", ErrNotFound, id)
+		}
+		log.Printf("Error reading information of image '%s': %v", id, err)
+		return nil, err
+	}
+	return &models.ImageFile{
+		ID:          id,
+		Content:     object,
+		ContentType: info.ContentType,
+		Size:        info.Size,
+		UploadedAt:  info.LastModified,
+	}, nil
+}
+
+// Variants lists the objects named after the original image.
+// Returns the IDs of the variants keyed by their size and any error encountered.
+func (s *s3ImageStore) Variants(id string) (map[string]string, error) {
+	variants := make(map[string]string)
+	if !imageIDPattern.MatchString(id) {
+		return variants, nil
+	}
+	prefix := variantImageID(id, "")
+	for object := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{Prefix: prefix}) {
+		if object.Err != nil {
+			log.Printf("Error listing variants of image '%s': %v", id, object.Err)
+			return nil, object.Err
+		}
+		variants[strings.TrimPrefix(object.Key, prefix)] = object.Key
+	}
+	return variants, nil
+}
+
+// List lists the objects of the bucket that are named like images.
+// Returns the files and any error encountered.
+func (s *s3ImageStore) List() ([]StoredImage, error) {
+	var images []StoredImage
+	for object := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{}) {
+		if object.Err != nil {
+			log.Printf("Error listing bucket '%s': %v", s.bucket, object.Err)
+			return nil, object.Err
+		}
+		if imageIDPattern.MatchString(object.Key) {
+			images = append(images, StoredImage{ID: object.Key, OriginalID: originalImageID(object.Key), UploadedAt: object.LastModified})
+		}
+	}
+	return images, nil
+}
+
+// Delete removes an object. Removing an object that does not exist succeeds in S3.
+// Returns any error encountered.
+func (s *s3ImageStore) Delete(id string) error {
+	if !imageIDPattern.MatchString(id) {
+		return nil
+	}
+	return s.client.RemoveObject(context.Background(), s.bucket, id, minio.RemoveObjectOptions{})
+}
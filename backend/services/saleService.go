@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// saleService provides methods to query the sales ledger.
+type saleService struct {
+	saleCollection *mongo.Collection // MongoDB collection for storing sales
+}
+
+// NewSaleService initializes a new instance of saleService.
+func NewSaleService(client *mongo.Client, dbName string) *saleService {
+	return &saleService{
+		saleCollection: client.Database(dbName).Collection("sales"),
+	}
+}
+
+// GetSales retrieves a page of sales matching the query, ordered from newest to oldest.
+// Returns the page of sales and any error encountered.
+func (s *saleService) GetSales(query models.SaleQuery, page models.PageRequest) (*models.SalePage, error) {
+	filter := bson.M{}
+	if query.CarID != nil {
+		filter["carId"] = *query.CarID
+	}
+	if query.CustomerID != nil {
+		filter["customer._id"] = *query.CustomerID
+	}
+	if query.Salesperson != "" {
+		filter["salesperson"] = query.Salesperson
+	}
+
+	sales, next, total, err := listNewestFirst(s.saleCollection, filter, page, func(sale models.Sale) primitive.ObjectID { return sale.ID })
+	if err != nil {
+		if !errors.Is(err, ErrInvalidCursor) {
+			log.Printf("Error listing sales: %v", err)
+		}
+		return nil, err
+	}
+	return &models.SalePage{Items: sales, NextCursor: next, Total: total}, nil
+}
+
+// GetSaleByID retrieves a single sale by its ID.
+// Returns the sale and any error encountered.
+func (s *saleService) GetSaleByID(id primitive.ObjectID) (*models.Sale, error) {
+	var sale models.Sale
+	err := s.saleCollection.FindOne(context.Background(), bson.M{"_id": id}).Decode(&sale)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, fmt.Errorf("%w: sale %s does not exist", ErrNotFound, id.Hex())
+		}
+		log.Printf("Error finding sale with ID '%s': %v", id.Hex(), err)
+		return nil, err
+	}
+	return &sale, nil
+}
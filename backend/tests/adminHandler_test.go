@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckImages(t *testing.T) {
+	checkedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	var receivedRepair *bool
+	mockCarService := &MockCarService{
+		CheckImagesFunc: func(repair bool) (*models.ImageCheckReport, error) {
+			receivedRepair = &repair
+			return &models.ImageCheckReport{
+				CheckedAt:      checkedAt,
+				Repaired:       repair,
+				StoredImages:   3,
+				CheckedCars:    2,
+				OrphanedImages: []models.OrphanedImage{{ID: "60c72b2f9b1e8b3e0c6fc2a9", UploadedAt: checkedAt.Add(-48 * time.Hour), Deleted: repair}},
+				MissingImages:  []models.MissingCarImage{{CarID: "60c72b2f9b1e8b3e0c6fc1c1", ImageID: "60c72b2f9b1e8b3e0c6fc2a1", Removed: repair}},
+			}, nil
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	t.Run("check without repairing", func(t *testing.T) {
+		// Creating a request for a report of the images
+		req, err := http.NewRequest("GET", "/admin/images/check", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.CheckImages(rr, req)
+
+		// Checking the response status, that nothing was repaired and the report in the body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		if assert.NotNil(t, receivedRepair) {
+			assert.False(t, *receivedRepair)
+		}
+		var result models.ImageCheckReport
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, checkedAt, result.CheckedAt)
+		assert.Equal(t, 3, result.StoredImages)
+		assert.Equal(t, 2, result.CheckedCars)
+		assert.Equal(t, []models.OrphanedImage{{ID: "60c72b2f9b1e8b3e0c6fc2a9", UploadedAt: checkedAt.Add(-48 * time.Hour)}}, result.OrphanedImages)
+		assert.Equal(t, []models.MissingCarImage{{CarID: "60c72b2f9b1e8b3e0c6fc1c1", ImageID: "60c72b2f9b1e8b3e0c6fc2a1"}}, result.MissingImages)
+	})
+
+	t.Run("repair", func(t *testing.T) {
+		// Creating a request repairing the images
+		req, err := http.NewRequest("POST", "/admin/images/repair", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.RepairImages(rr, req)
+
+		// Checking the response status and that the problems were repaired
+		assert.Equal(t, http.StatusOK, rr.Code)
+		if assert.NotNil(t, receivedRepair) {
+			assert.True(t, *receivedRepair)
+		}
+		var result models.ImageCheckReport
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.True(t, result.Repaired)
+		assert.True(t, result.OrphanedImages[0].Deleted)
+		assert.True(t, result.MissingImages[0].Removed)
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		// Simulating a service error
+		handlers.SetCarService(&MockCarService{
+			CheckImagesFunc: func(repair bool) (*models.ImageCheckReport, error) {
+				return nil, assert.AnError
+			},
+		})
+		req, err := http.NewRequest("GET", "/admin/images/check", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.CheckImages(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+	})
+}
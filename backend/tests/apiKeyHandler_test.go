@@ -0,0 +1,137 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGetAPIKeys(t *testing.T) {
+	lastUsedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	handlers.SetAuthService(&MockAuthService{
+		GetAPIKeysFunc: func() ([]models.APIKey, error) {
+			return []models.APIKey{
+				{ID: primitive.NewObjectID(), Name: "DMS sync", Prefix: "cdk_Ab3dE6gH", KeyHash: "5e884898da28047151d0e56f8dc62927", Scopes: []string{models.ScopeSalesWrite}, LastUsedAt: &lastUsedAt},
+				{ID: primitive.NewObjectID(), Name: "Listing syndication", Prefix: "cdk_Zy9xW8vU", KeyHash: "6b86b273ff34fce19d6b804eff5a3f57", Scopes: []string{models.ScopeInventoryRead}},
+			}, nil
+		},
+	})
+
+	req := httptest.NewRequest("GET", "/api-keys", nil)
+	rr := httptest.NewRecorder()
+	handlers.GetAPIKeys(rr, req)
+
+	// Checking the response status and that the body leaves out the key hashes
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "5e884898da28047151d0e56f8dc62927")
+	var result []models.APIKey
+	json.NewDecoder(rr.Body).Decode(&result)
+	if assert.Len(t, result, 2) {
+		assert.Equal(t, "cdk_Ab3dE6gH", result[0].Prefix)
+		assert.Equal(t, lastUsedAt, *result[0].LastUsedAt)
+		assert.Nil(t, result[1].LastUsedAt)
+	}
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedCreatedBy string
+	handlers.SetAuthService(&MockAuthService{
+		CreateAPIKeyFunc: func(request models.APIKeyRequest, createdBy string) (*models.CreatedAPIKey, error) {
+			receivedCreatedBy = createdBy
+			key := "cdk_Ab3dE6gHiJ9kLmN0pQrStUvWxYz1234567890abcd"
+			return &models.CreatedAPIKey{
+				APIKey: models.APIKey{ID: primitive.NewObjectID(), Name: request.Name, Prefix: key[:12], KeyHash: "5e884898da28047151d0e56f8dc62927", Scopes: request.Scopes, CreatedBy: createdBy},
+				Key:    key,
+			}, nil
+		},
+	})
+
+	t.Run("valid API key", func(t *testing.T) {
+		// Creating a request for a reserve-only key
+		body := `{"name":"Website reservations","scopes":["reservations:write"]}`
+		req := httptest.NewRequest("POST", "/api-keys", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handlers.CreateAPIKey(rr, asRole(req, models.RoleAdmin))
+
+		// Checking the response status and that the body has the key but not its hash
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "5e884898da28047151d0e56f8dc62927")
+		var result models.CreatedAPIKey
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "cdk_Ab3dE6gHiJ9kLmN0pQrStUvWxYz1234567890abcd", result.Key)
+		assert.Equal(t, "Website reservations", result.Name)
+		assert.Equal(t, []string{models.ScopeReservationsWrite}, result.Scopes)
+		assert.Equal(t, "jdoe", receivedCreatedBy)
+	})
+
+	t.Run("unknown scope", func(t *testing.T) {
+		// Creating a request with a scope that does not exist
+		body := `{"name":"Website reservations","scopes":["users:write"]}`
+		req := httptest.NewRequest("POST", "/api-keys", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handlers.CreateAPIKey(rr, asRole(req, models.RoleAdmin))
+
+		// Checking the response status
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("no scopes", func(t *testing.T) {
+		// Creating a request for a key that would be granted nothing
+		body := `{"name":"Website reservations","scopes":[]}`
+		req := httptest.NewRequest("POST", "/api-keys", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handlers.CreateAPIKey(rr, asRole(req, models.RoleAdmin))
+
+		// Checking the response status
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	handlers.SetAuthService(&MockAuthService{
+		RevokeAPIKeyFunc: func(id primitive.ObjectID) error {
+			if id.Hex() == "60d5f60e4f1c000088aa8401" {
+				return nil
+			}
+			return fmt.Errorf("%w: API key %s does not exist", services.ErrNotFound, id.Hex())
+		},
+	})
+
+	tests := []struct {
+		name   string
+		id     string
+		status int
+	}{
+		{"existing key", "60d5f60e4f1c000088aa8401", http.StatusNoContent},
+		{"unknown key", "60d5f60e4f1c000088aa8402", http.StatusNotFound},
+		{"invalid ID", "invalid-id", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("DELETE", "/api-keys/"+tt.id, nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			rr := httptest.NewRecorder()
+			handlers.RevokeAPIKey(rr, req)
+
+			// Checking the response status
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/routers"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockAuditService is a mock implementation of the IauditService interface
+type MockAuditService struct {
+	GetAuditEntriesFunc func(query models.AuditQuery, page models.PageRequest) (*models.AuditPage, error)
+}
+
+// Implementing the IauditService interface methods using function fields in MockAuditService
+func (m *MockAuditService) GetAuditEntries(query models.AuditQuery, page models.PageRequest) (*models.AuditPage, error) {
+	return m.GetAuditEntriesFunc(query, page)
+}
+
+func TestGetAuditEntries(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	carID, _ := primitive.ObjectIDFromHex("60d5f60e4f1c000088aa8501")
+	var receivedQuery models.AuditQuery
+	handlers.SetAuditService(&MockAuditService{
+		GetAuditEntriesFunc: func(query models.AuditQuery, page models.PageRequest) (*models.AuditPage, error) {
+			receivedQuery = query
+			if page.Cursor == "bad" {
+				return nil, services.ErrInvalidCursor
+			}
+			return &models.AuditPage{Items: []models.AuditEntry{{
+				ID:        primitive.NewObjectID(),
+				Entity:    models.AuditEntityCar,
+				EntityID:  carID,
+				Action:    models.AuditActionUpdate,
+				Actor:     "jdoe",
+				ActorKind: models.ActorKindUser,
+				RequestID: "4bf92f3577b34da6a3ce929d0e0e4736",
+				Timestamp: time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+				Before:    primitive.M{"price": 20000.0},
+				After:     primitive.M{"price": 19500.0},
+			}}}, nil
+		},
+	})
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"all entries", "", http.StatusOK},
+		{"entries of a car by an actor in a time range", "?carId=60d5f60e4f1c000088aa8501&actor=jdoe&from=2024-06-01T00:00:00Z&to=2024-06-02T00:00:00%2B02:00", http.StatusOK},
+		{"invalid car ID", "?carId=invalid-id", http.StatusBadRequest},
+		{"car and customer", "?carId=60d5f60e4f1c000088aa8501&customerId=60d5f60e4f1c000088aa8291", http.StatusBadRequest},
+		{"invalid time", "?from=yesterday", http.StatusBadRequest},
+		{"empty time range", "?from=2024-06-02T00:00:00Z&to=2024-06-01T00:00:00Z", http.StatusBadRequest},
+		{"unsupported parameter", "?entity=car", http.StatusBadRequest},
+		{"invalid cursor", "?cursor=bad", http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receivedQuery = models.AuditQuery{}
+			req := httptest.NewRequest("GET", "/audit"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			handlers.GetAuditEntries(rr, req)
+
+			// Checking the response status
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+
+	t.Run("filters and diff", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/audit?carId=60d5f60e4f1c000088aa8501&actor=jdoe&from=2024-06-01T00:00:00Z&to=2024-06-02T00:00:00%2B02:00", nil)
+		rr := httptest.NewRecorder()
+		handlers.GetAuditEntries(rr, req)
+
+		// Checking the parsed filters, with the times in UTC
+		assert.Equal(t, carID, *receivedQuery.CarID)
+		assert.Nil(t, receivedQuery.CustomerID)
+		assert.Equal(t, "jdoe", receivedQuery.Actor)
+		assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), *receivedQuery.From)
+		assert.Equal(t, time.Date(2024, 6, 1, 22, 0, 0, 0, time.UTC), *receivedQuery.To)
+
+		// Checking that the entry carries the changed fields before and after the change
+		var result struct {
+			Items []struct {
+				EntityID  string                 `json:"entityId"`
+				Actor     string                 `json:"actor"`
+				RequestID string                 `json:"requestId"`
+				Before    map[string]interface{} `json:"before"`
+				After     map[string]interface{} `json:"after"`
+			} `json:"items"`
+		}
+		json.NewDecoder(rr.Body).Decode(&result)
+		if assert.Len(t, result.Items, 1) {
+			assert.Equal(t, "60d5f60e4f1c000088aa8501", result.Items[0].EntityID)
+			assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", result.Items[0].RequestID)
+			assert.Equal(t, map[string]interface{}{"price": 20000.0}, result.Items[0].Before)
+			assert.Equal(t, map[string]interface{}{"price": 19500.0}, result.Items[0].After)
+		}
+	})
+}
+
+func TestAuditActor(t *testing.T) {
+	// Setting up the validator and mock services
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	handlers.SetAuthService(&MockAuthService{
+		AuthenticateFunc: func(accessToken string) (*models.Principal, error) {
+			return &models.Principal{UserID: primitive.NewObjectID(), Username: "jdoe", Role: models.RoleSalesperson}, nil
+		},
+		AuthenticateAPIKeyFunc: func(key string) (*models.Principal, error) {
+			return &models.Principal{APIKeyID: primitive.NewObjectID(), Username: "DMS sync", Scopes: []string{models.ScopeCustomersWrite}}, nil
+		},
+	})
+
+	// The customer is created by the service the handler asked for with the actor of the request
+	var receivedActor models.Actor
+	created := &MockCustomerService{
+		CreateCustomerFunc: func(customer models.Customer) (*models.Customer, error) {
+			customer.ID = primitive.NewObjectID()
+			return &customer, nil
+		},
+	}
+	handlers.SetCustomerService(&MockCustomerService{
+		WithActorFunc: func(actor models.Actor) services.IcustomerService {
+			receivedActor = actor
+			return created
+		},
+	})
+
+	router := routers.InitRoutes()
+	body := `{"fullName":"John Doe","email":"john.doe@example.com","phoneNumber":"1234567890"}`
+
+	tests := []struct {
+		name          string
+		authorization string
+		requestID     string
+		actor         models.Actor
+	}{
+		{"user", "Bearer salesperson-token", "4bf92f3577b34da6a3ce929d0e0e4736", models.Actor{Name: "jdoe", Kind: models.ActorKindUser, RequestID: "4bf92f3577b34da6a3ce929d0e0e4736"}},
+		{"API key", "Bearer cdk_customers:write", "dms-sync-42", models.Actor{Name: "DMS sync", Kind: models.ActorKindAPIKey, RequestID: "dms-sync-42"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receivedActor = models.Actor{}
+			req := httptest.NewRequest("POST", "/customers", bytes.NewBufferString(body))
+			req.Header.Set("Authorization", tt.authorization)
+			req.Header.Set("X-Request-ID", tt.requestID)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			// Checking that the change is made as the caller of the request, with its request ID
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			assert.Equal(t, tt.requestID, rr.Header().Get("X-Request-ID"))
+			assert.Equal(t, tt.actor, receivedActor)
+		})
+	}
+}
+
+func TestAssignRequestID(t *testing.T) {
+	router := routers.InitRoutes()
+
+	tests := []struct {
+		name      string
+		requestID string
+		kept      bool
+	}{
+		{"no request ID", "", false},
+		{"client request ID", "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"request ID with control characters", "abc\x07def", false},
+		{"request ID that is too long", string(bytes.Repeat([]byte("a"), 101)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/health", nil)
+			if tt.requestID != "" {
+				req.Header.Set("X-Request-ID", tt.requestID)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			// Checking that the response carries the kept or a generated request ID
+			requestID := rr.Header().Get("X-Request-ID")
+			if tt.kept {
+				assert.Equal(t, tt.requestID, requestID)
+			} else {
+				assert.Len(t, requestID, 32)
+				assert.NotEqual(t, tt.requestID, requestID)
+			}
+		})
+	}
+}
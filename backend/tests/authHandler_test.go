@@ -0,0 +1,534 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/routers"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockAuthService is a mock implementation of the IauthService interface
+type MockAuthService struct {
+	SetTokenLifetimesFunc  func(access, refresh time.Duration)
+	GetUsersFunc           func() ([]models.User, error)
+	CreateUserFunc         func(request models.UserRequest) (*models.User, error)
+	CreateInitialUserFunc  func(request models.UserRequest) (*models.User, error)
+	SetUserRoleFunc        func(id primitive.ObjectID, role string) (*models.User, error)
+	LoginFunc              func(username, password string) (*models.TokenPair, error)
+	RefreshFunc            func(refreshToken string) (*models.TokenPair, error)
+	LogoutFunc             func(refreshToken string) error
+	AuthenticateFunc       func(accessToken string) (*models.Principal, error)
+	GetAPIKeysFunc         func() ([]models.APIKey, error)
+	CreateAPIKeyFunc       func(request models.APIKeyRequest, createdBy string) (*models.CreatedAPIKey, error)
+	RevokeAPIKeyFunc       func(id primitive.ObjectID) error
+	AuthenticateAPIKeyFunc func(key string) (*models.Principal, error)
+}
+
+// Implementing the IauthService interface methods using function fields in MockAuthService
+func (m *MockAuthService) SetTokenLifetimes(access, refresh time.Duration) {
+	m.SetTokenLifetimesFunc(access, refresh)
+}
+
+func (m *MockAuthService) GetUsers() ([]models.User, error) {
+	return m.GetUsersFunc()
+}
+
+func (m *MockAuthService) CreateUser(request models.UserRequest) (*models.User, error) {
+	return m.CreateUserFunc(request)
+}
+
+func (m *MockAuthService) CreateInitialUser(request models.UserRequest) (*models.User, error) {
+	return m.CreateInitialUserFunc(request)
+}
+
+func (m *MockAuthService) SetUserRole(id primitive.ObjectID, role string) (*models.User, error) {
+	return m.SetUserRoleFunc(id, role)
+}
+
+func (m *MockAuthService) Login(username, password string) (*models.TokenPair, error) {
+	return m.LoginFunc(username, password)
+}
+
+func (m *MockAuthService) Refresh(refreshToken string) (*models.TokenPair, error) {
+	return m.RefreshFunc(refreshToken)
+}
+
+func (m *MockAuthService) Logout(refreshToken string) error {
+	return m.LogoutFunc(refreshToken)
+}
+
+func (m *MockAuthService) Authenticate(accessToken string) (*models.Principal, error) {
+	return m.AuthenticateFunc(accessToken)
+}
+
+func (m *MockAuthService) GetAPIKeys() ([]models.APIKey, error) {
+	return m.GetAPIKeysFunc()
+}
+
+func (m *MockAuthService) CreateAPIKey(request models.APIKeyRequest, createdBy string) (*models.CreatedAPIKey, error) {
+	return m.CreateAPIKeyFunc(request, createdBy)
+}
+
+func (m *MockAuthService) RevokeAPIKey(id primitive.ObjectID) error {
+	return m.RevokeAPIKeyFunc(id)
+}
+
+func (m *MockAuthService) AuthenticateAPIKey(key string) (*models.Principal, error) {
+	return m.AuthenticateAPIKeyFunc(key)
+}
+
+// testTokens are the tokens the mock auth service issues
+var testTokens = models.TokenPair{AccessToken: "access-token", TokenType: models.TokenTypeBearer, ExpiresIn: 900, RefreshToken: "refresh-token"}
+
+func TestLogin(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	handlers.SetAuthService(&MockAuthService{
+		LoginFunc: func(username, password string) (*models.TokenPair, error) {
+			if username != "jdoe" || password != "correct horse" {
+				return nil, fmt.Errorf("%w: wrong username or password", services.ErrUnauthorized)
+			}
+			return &testTokens, nil
+		},
+	})
+
+	t.Run("valid credentials", func(t *testing.T) {
+		// Creating a request with the credentials of a user
+		body := `{"username":"jdoe","password":"correct horse","role":"salesperson"}`
+		req, err := http.NewRequest("POST", "/auth/login", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.Login(rr, req)
+
+		// Checking the response status and the tokens in the body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.TokenPair
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, testTokens, result)
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		// Creating a request with a wrong password
+		body := `{"username":"jdoe","password":"wrong"}`
+		req, err := http.NewRequest("POST", "/auth/login", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.Login(rr, req)
+
+		// Checking the response status, the challenge and the body
+		assertProblem(t, rr, http.StatusUnauthorized, "wrong username or password")
+		assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("missing password", func(t *testing.T) {
+		// Creating a request without a password
+		body := `{"username":"jdoe"}`
+		req, err := http.NewRequest("POST", "/auth/login", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.Login(rr, req)
+
+		// Checking the response status
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		// Creating a request with a body that is not JSON
+		req, err := http.NewRequest("POST", "/auth/login", bytes.NewBufferString("username=jdoe"))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.Login(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid login data\n", rr.Body.String())
+	})
+}
+
+func TestRefreshTokens(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	handlers.SetAuthService(&MockAuthService{
+		RefreshFunc: func(refreshToken string) (*models.TokenPair, error) {
+			if refreshToken != "refresh-token" {
+				return nil, fmt.Errorf("%w: refresh token was revoked or already used", services.ErrUnauthorized)
+			}
+			return &testTokens, nil
+		},
+	})
+
+	t.Run("valid refresh token", func(t *testing.T) {
+		// Creating a request with a refresh token
+		req, err := http.NewRequest("POST", "/auth/refresh", bytes.NewBufferString(`{"refreshToken":"refresh-token"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.RefreshTokens(rr, req)
+
+		// Checking the response status and the new tokens in the body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.TokenPair
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, testTokens, result)
+	})
+
+	t.Run("used refresh token", func(t *testing.T) {
+		// Creating a request with a refresh token that was used before
+		req, err := http.NewRequest("POST", "/auth/refresh", bytes.NewBufferString(`{"refreshToken":"used-token"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.RefreshTokens(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusUnauthorized, "already used")
+	})
+
+	t.Run("missing refresh token", func(t *testing.T) {
+		// Creating a request without a refresh token
+		req, err := http.NewRequest("POST", "/auth/refresh", bytes.NewBufferString(`{}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.RefreshTokens(rr, req)
+
+		// Checking the response status
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestLogout(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var revokedToken string
+	handlers.SetAuthService(&MockAuthService{
+		LogoutFunc: func(refreshToken string) error {
+			if refreshToken == "forged-token" {
+				return fmt.Errorf("%w: refresh token is invalid", services.ErrUnauthorized)
+			}
+			revokedToken = refreshToken
+			return nil
+		},
+	})
+
+	t.Run("valid refresh token", func(t *testing.T) {
+		// Creating a request revoking a refresh token
+		req, err := http.NewRequest("POST", "/auth/logout", bytes.NewBufferString(`{"refreshToken":"refresh-token"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.Logout(rr, req)
+
+		// Checking the response status and that the token was revoked
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Equal(t, "refresh-token", revokedToken)
+	})
+
+	t.Run("forged refresh token", func(t *testing.T) {
+		// Creating a request with a refresh token the service did not issue
+		req, err := http.NewRequest("POST", "/auth/logout", bytes.NewBufferString(`{"refreshToken":"forged-token"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.Logout(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusUnauthorized, "refresh token is invalid")
+	})
+}
+
+func TestCreateUser(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	createdAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	handlers.SetAuthService(&MockAuthService{
+		CreateUserFunc: func(request models.UserRequest) (*models.User, error) {
+			if request.Username == "taken" {
+				return nil, fmt.Errorf("%w: username 'taken' is taken", services.ErrConflict)
+			}
+			id, _ := primitive.ObjectIDFromHex("60d5f60e4f1c000088aa8301")
+			return &models.User{ID: id, Username: request.Username, PasswordHash: "$2a$10$hash", Role: request.Role, CreatedAt: createdAt}, nil
+		},
+	})
+
+	t.Run("valid user", func(t *testing.T) {
+		// Creating a request with the details of a new user
+		body := `{"username":"jdoe","password":"correct horse","role":"salesperson"}`
+		req, err := http.NewRequest("POST", "/users", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.CreateUser(rr, req)
+
+		// Checking the response status and that the body leaves out the password hash
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.NotContains(t, rr.Body.String(), "hash")
+		var result models.User
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "60d5f60e4f1c000088aa8301", result.ID.Hex())
+		assert.Equal(t, "jdoe", result.Username)
+		assert.Equal(t, models.RoleSalesperson, result.Role)
+		assert.Equal(t, createdAt, result.CreatedAt)
+	})
+
+	t.Run("unknown role", func(t *testing.T) {
+		// Creating a request with a role that does not exist
+		body := `{"username":"jdoe","password":"correct horse","role":"owner"}`
+		req, err := http.NewRequest("POST", "/users", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.CreateUser(rr, req)
+
+		// Checking the response status
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("short password", func(t *testing.T) {
+		// Creating a request with a password that is too short
+		body := `{"username":"jdoe","password":"short","role":"salesperson"}`
+		req, err := http.NewRequest("POST", "/users", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.CreateUser(rr, req)
+
+		// Checking the response status
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("username taken", func(t *testing.T) {
+		// Creating a request with a username that belongs to another user
+		body := `{"username":"taken","password":"correct horse","role":"salesperson"}`
+		req, err := http.NewRequest("POST", "/users", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.CreateUser(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusConflict, "username 'taken' is taken")
+	})
+}
+
+func TestGetUsers(t *testing.T) {
+	handlers.SetAuthService(&MockAuthService{
+		GetUsersFunc: func() ([]models.User, error) {
+			return []models.User{
+				{ID: primitive.NewObjectID(), Username: "admin", PasswordHash: "$2a$10$hash", Role: models.RoleAdmin},
+				{ID: primitive.NewObjectID(), Username: "jdoe", PasswordHash: "$2a$10$hash", Role: models.RoleViewer},
+			}, nil
+		},
+	})
+
+	req := httptest.NewRequest("GET", "/users", nil)
+	rr := httptest.NewRecorder()
+	handlers.GetUsers(rr, req)
+
+	// Checking the response status and that the body leaves out the password hashes
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "hash")
+	var result []models.User
+	json.NewDecoder(rr.Body).Decode(&result)
+	if assert.Len(t, result, 2) {
+		assert.Equal(t, "admin", result[0].Username)
+		assert.Equal(t, models.RoleViewer, result[1].Role)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	handlers.SetAuthService(&MockAuthService{
+		SetUserRoleFunc: func(id primitive.ObjectID, role string) (*models.User, error) {
+			switch id.Hex() {
+			case "60d5f60e4f1c000088aa8301":
+				return &models.User{ID: id, Username: "jdoe", Role: role}, nil
+			case "60d5f60e4f1c000088aa8302":
+				return nil, fmt.Errorf("%w: admin is the last admin", services.ErrConflict)
+			}
+			return nil, fmt.Errorf("%w: user %s", services.ErrNotFound, id.Hex())
+		},
+	})
+
+	newRoleRequest := func(id, body string) *http.Request {
+		req := httptest.NewRequest("PUT", "/users/"+id+"/role", bytes.NewBufferString(body))
+		return mux.SetURLVars(req, map[string]string{"id": id})
+	}
+
+	tests := []struct {
+		name   string
+		id     string
+		body   string
+		status int
+		detail string
+	}{
+		{"valid role", "60d5f60e4f1c000088aa8301", `{"role":"manager"}`, http.StatusOK, ""},
+		{"unknown role", "60d5f60e4f1c000088aa8301", `{"role":"owner"}`, http.StatusBadRequest, ""},
+		{"invalid ID", "invalid-id", `{"role":"manager"}`, http.StatusBadRequest, ""},
+		{"last admin", "60d5f60e4f1c000088aa8302", `{"role":"viewer"}`, http.StatusConflict, "admin is the last admin"},
+		{"unknown user", "60d5f60e4f1c000088aa8303", `{"role":"viewer"}`, http.StatusNotFound, "user 60d5f60e4f1c000088aa8303"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			handlers.SetUserRole(rr, newRoleRequest(tt.id, tt.body))
+
+			// Checking the response status and body
+			if tt.detail != "" {
+				assertProblem(t, rr, tt.status, tt.detail)
+				return
+			}
+			assert.Equal(t, tt.status, rr.Code)
+			if tt.status == http.StatusOK {
+				var result models.User
+				json.NewDecoder(rr.Body).Decode(&result)
+				assert.Equal(t, models.RoleManager, result.Role)
+			}
+		})
+	}
+}
+
+func TestAuthenticationMiddleware(t *testing.T) {
+	// Setting up the validator and mock services
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	handlers.SetAuthService(&MockAuthService{
+		AuthenticateFunc: func(accessToken string) (*models.Principal, error) {
+			if accessToken == "expired-token" {
+				return nil, fmt.Errorf("%w: access token has expired", services.ErrUnauthorized)
+			}
+			// The tests name the role of the caller in the token, e.g. "viewer-token"
+			id, _ := primitive.ObjectIDFromHex("60d5f60e4f1c000088aa8301")
+			return &models.Principal{UserID: id, Username: "jdoe", Role: strings.TrimSuffix(accessToken, "-token")}, nil
+		},
+		AuthenticateAPIKeyFunc: func(key string) (*models.Principal, error) {
+			// The tests name the scope of the key in the key, e.g. "cdk_customers:write"
+			if key == "cdk_revoked" {
+				return nil, fmt.Errorf("%w: API key is invalid or revoked", services.ErrUnauthorized)
+			}
+			id, _ := primitive.ObjectIDFromHex("60d5f60e4f1c000088aa8401")
+			return &models.Principal{APIKeyID: id, Username: "DMS sync", Scopes: []string{strings.TrimPrefix(key, models.APIKeyPrefix)}}, nil
+		},
+	})
+	handlers.SetCustomerService(&MockCustomerService{
+		CreateCustomerFunc: func(customer models.Customer) (*models.Customer, error) {
+			customer.ID, _ = primitive.ObjectIDFromHex("60d5f60e4f1c000088aa8291")
+			return &customer, nil
+		},
+	})
+	handlers.SetCarService(&MockCarService{
+		GetCarByIDFunc: func(id primitive.ObjectID) (*models.Car, error) {
+			return &models.Car{ID: id, Make: "Toyota", Model: "Corolla", Status: models.CarStatusAvailable}, nil
+		},
+	})
+
+	router := routers.InitRoutes()
+	body := `{"fullName":"John Doe","email":"john.doe@example.com","phoneNumber":"1234567890"}`
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		status        int
+		detail        string
+	}{
+		{"anonymous read", "GET", "/health", "", http.StatusOK, ""},
+		{"anonymous change", "POST", "/customers", "", http.StatusUnauthorized, "an access token is required"},
+		{"anonymous car read", "GET", "/cars/60d5f60e4f1c000088aa828e", "", http.StatusUnauthorized, "an access token is required"},
+		{"car read by a viewer", "GET", "/cars/60d5f60e4f1c000088aa828e", "Bearer viewer-token", http.StatusOK, ""},
+		{"car read with an API key", "GET", "/cars/60d5f60e4f1c000088aa828e", "Bearer cdk_inventory:read", http.StatusOK, ""},
+		{"car read with an API key without the scope", "GET", "/cars/60d5f60e4f1c000088aa828e", "Bearer cdk_sales:read", http.StatusForbidden, "the inventory:read scope is required"},
+		{"authenticated change", "POST", "/customers", "Bearer salesperson-token", http.StatusCreated, ""},
+		{"change by a lower role", "POST", "/customers", "Bearer viewer-token", http.StatusForbidden, "the salesperson role is required"},
+		{"change by a higher role", "POST", "/customers", "Bearer admin-token", http.StatusCreated, ""},
+		{"admin route by a manager", "GET", "/users", "Bearer manager-token", http.StatusForbidden, "the admin role is required"},
+		{"change with an API key", "POST", "/customers", "Bearer cdk_customers:write", http.StatusCreated, ""},
+		{"API key without the scope", "POST", "/customers", "Bearer cdk_customers:read", http.StatusForbidden, "the customers:write scope is required"},
+		{"admin route with an API key", "GET", "/users", "Bearer cdk_customers:write", http.StatusForbidden, "API keys cannot be used"},
+		{"revoked API key", "GET", "/health", "Bearer cdk_revoked", http.StatusUnauthorized, "API key is invalid or revoked"},
+		{"expired token", "GET", "/health", "Bearer expired-token", http.StatusUnauthorized, "access token has expired"},
+		{"other scheme", "POST", "/customers", "Basic amRvZTpwYXNzd29yZA==", http.StatusUnauthorized, "Bearer <token>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Creating a request through the router, with the given Authorization header
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(body))
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			// Checking the response status, and the challenge of rejected requests
+			switch tt.status {
+			case http.StatusUnauthorized:
+				assertProblem(t, rr, tt.status, tt.detail)
+				assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"))
+			case http.StatusForbidden:
+				assertProblem(t, rr, tt.status, tt.detail)
+				assert.Empty(t, rr.Header().Get("WWW-Authenticate"))
+			default:
+				assert.Equal(t, tt.status, rr.Code)
+			}
+		})
+	}
+}
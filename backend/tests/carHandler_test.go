@@ -3,71 +3,166 @@ package tests
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/go-playground/validator"
 	"github.com/gorilla/mux"
 	"github.com/lazarpetrovicc/Car-Dealership/handlers"
 	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
 	"github.com/stretchr/testify/assert"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/gridfs"
 )
 
 // MockCarService is a mock implementation of the IcarService interface
 type MockCarService struct {
-	GetCarsByStatusFunc   func(status string) ([]models.Car, error)
-	GetCarImageFunc       func(pictureID string) ([]byte, error)
-	CreateCarFunc         func(car *models.Car, fileData []byte, fileName string) (interface{}, error)
-	UpdateCarFunc         func(id primitive.ObjectID, car *models.Car, fileData []byte, fileName string) (interface{}, error)
-	DeleteCarFunc         func(id primitive.ObjectID) (interface{}, error)
-	ReserveCarFunc        func(id primitive.ObjectID, customer models.Customer) (interface{}, error)
-	CancelReservationFunc func(id primitive.ObjectID) (interface{}, error)
-	SellCarFunc           func(id primitive.ObjectID, customer models.Customer) (interface{}, error)
-	SetGridFSBucketFunc   func(bucket *gridfs.Bucket)
+	GetCarsByStatusFunc          func(status string, page models.PageRequest) (*models.CarPage, error)
+	SearchCarsFunc               func(query models.CarQuery, page models.PageRequest) (*models.CarPage, error)
+	GetCarByIDFunc               func(id primitive.ObjectID) (*models.Car, error)
+	GetCarImageFunc              func(pictureID string, size string) (*models.ImageFile, error)
+	CreateCarFunc                func(car *models.Car, content io.Reader, fileName string) (*models.Car, error)
+	UpdateCarFunc                func(id primitive.ObjectID, car *models.Car, content io.Reader, fileName string, version *int64) (*models.Car, error)
+	PatchCarFunc                 func(id primitive.ObjectID, patch models.CarPatch, version *int64) (*models.Car, error)
+	AddCarImageFunc              func(id primitive.ObjectID, image models.CarImageRequest, content io.Reader, fileName string, version *int64) (*models.Car, error)
+	UpdateCarImageFunc           func(id primitive.ObjectID, imageID string, update models.CarImageUpdate, version *int64) (*models.Car, error)
+	RemoveCarImageFunc           func(id primitive.ObjectID, imageID string, version *int64) (*models.Car, error)
+	ReorderCarImagesFunc         func(id primitive.ObjectID, imageIDs []string, version *int64) (*models.Car, error)
+	DeleteCarFunc                func(id primitive.ObjectID, version *int64) error
+	RestoreCarFunc               func(id primitive.ObjectID, version *int64) (*models.Car, error)
+	PurgeDeletedCarsFunc         func(deletedBefore time.Time) ([]models.Car, error)
+	ReserveCarFunc               func(id primitive.ObjectID, reservation models.ReservationRequest, version *int64) (*models.Car, error)
+	CancelReservationFunc        func(id primitive.ObjectID, version *int64) (*models.Car, error)
+	ExtendReservationFunc        func(id primitive.ObjectID, expiresAt time.Time, version *int64) (*models.Car, error)
+	ExpireReservationsFunc       func(now time.Time) ([]models.Car, error)
+	SellCarFunc                  func(id primitive.ObjectID, sale models.SaleRequest, version *int64) (*models.Car, error)
+	ReturnCarFunc                func(id primitive.ObjectID, version *int64) (*models.Car, error)
+	ChangeCarStatusFunc          func(id primitive.ObjectID, status string, version *int64) (*models.Car, error)
+	CheckImagesFunc              func(repair bool) (*models.ImageCheckReport, error)
+	SetImageStoreFunc            func(store services.ImageStore)
+	SetReservationHoldPeriodFunc func(period time.Duration)
+	SetMaxImageSizeFunc          func(size int64)
+	WithActorFunc                func(actor models.Actor) services.IcarService
 }
 
 // Implementing the IcarService interface methods using function fields in MockCarService
-func (m *MockCarService) GetCarsByStatus(status string) ([]models.Car, error) {
-	return m.GetCarsByStatusFunc(status)
+func (m *MockCarService) GetCarsByStatus(status string, page models.PageRequest) (*models.CarPage, error) {
+	return m.GetCarsByStatusFunc(status, page)
 }
 
-func (m *MockCarService) GetCarImage(pictureID string) ([]byte, error) {
-	return m.GetCarImageFunc(pictureID)
+func (m *MockCarService) SearchCars(query models.CarQuery, page models.PageRequest) (*models.CarPage, error) {
+	return m.SearchCarsFunc(query, page)
 }
 
-func (m *MockCarService) CreateCar(car *models.Car, fileData []byte, fileName string) (interface{}, error) {
-	return m.CreateCarFunc(car, fileData, fileName)
+func (m *MockCarService) GetCarByID(id primitive.ObjectID) (*models.Car, error) {
+	return m.GetCarByIDFunc(id)
 }
 
-func (m *MockCarService) UpdateCar(id primitive.ObjectID, car *models.Car, fileData []byte, fileName string) (interface{}, error) {
-	return m.UpdateCarFunc(id, car, fileData, fileName)
+func (m *MockCarService) GetCarImage(pictureID string, size string) (*models.ImageFile, error) {
+	return m.GetCarImageFunc(pictureID, size)
 }
 
-func (m *MockCarService) DeleteCar(id primitive.ObjectID) (interface{}, error) {
-	return m.DeleteCarFunc(id)
+func (m *MockCarService) CreateCar(car *models.Car, content io.Reader, fileName string) (*models.Car, error) {
+	return m.CreateCarFunc(car, content, fileName)
 }
 
-func (m *MockCarService) ReserveCar(id primitive.ObjectID, customer models.Customer) (interface{}, error) {
-	return m.ReserveCarFunc(id, customer)
+func (m *MockCarService) UpdateCar(id primitive.ObjectID, car *models.Car, content io.Reader, fileName string, version *int64) (*models.Car, error) {
+	return m.UpdateCarFunc(id, car, content, fileName, version)
 }
 
-func (m *MockCarService) CancelReservation(id primitive.ObjectID) (interface{}, error) {
-	return m.CancelReservationFunc(id)
+func (m *MockCarService) PatchCar(id primitive.ObjectID, patch models.CarPatch, version *int64) (*models.Car, error) {
+	return m.PatchCarFunc(id, patch, version)
 }
 
-func (m *MockCarService) SellCar(id primitive.ObjectID, customer models.Customer) (interface{}, error) {
-	return m.SellCarFunc(id, customer)
+func (m *MockCarService) AddCarImage(id primitive.ObjectID, image models.CarImageRequest, content io.Reader, fileName string, version *int64) (*models.Car, error) {
+	return m.AddCarImageFunc(id, image, content, fileName, version)
 }
 
-func (m *MockCarService) SetGridFSBucket(bucket *gridfs.Bucket) {
-	if m.SetGridFSBucketFunc != nil {
-		m.SetGridFSBucketFunc(bucket)
+func (m *MockCarService) UpdateCarImage(id primitive.ObjectID, imageID string, update models.CarImageUpdate, version *int64) (*models.Car, error) {
+	return m.UpdateCarImageFunc(id, imageID, update, version)
+}
+
+func (m *MockCarService) RemoveCarImage(id primitive.ObjectID, imageID string, version *int64) (*models.Car, error) {
+	return m.RemoveCarImageFunc(id, imageID, version)
+}
+
+func (m *MockCarService) ReorderCarImages(id primitive.ObjectID, imageIDs []string, version *int64) (*models.Car, error) {
+	return m.ReorderCarImagesFunc(id, imageIDs, version)
+}
+
+func (m *MockCarService) DeleteCar(id primitive.ObjectID, version *int64) error {
+	return m.DeleteCarFunc(id, version)
+}
+
+func (m *MockCarService) RestoreCar(id primitive.ObjectID, version *int64) (*models.Car, error) {
+	return m.RestoreCarFunc(id, version)
+}
+
+func (m *MockCarService) PurgeDeletedCars(deletedBefore time.Time) ([]models.Car, error) {
+	return m.PurgeDeletedCarsFunc(deletedBefore)
+}
+
+func (m *MockCarService) ReserveCar(id primitive.ObjectID, reservation models.ReservationRequest, version *int64) (*models.Car, error) {
+	return m.ReserveCarFunc(id, reservation, version)
+}
+
+func (m *MockCarService) CancelReservation(id primitive.ObjectID, version *int64) (*models.Car, error) {
+	return m.CancelReservationFunc(id, version)
+}
+
+func (m *MockCarService) SellCar(id primitive.ObjectID, sale models.SaleRequest, version *int64) (*models.Car, error) {
+	return m.SellCarFunc(id, sale, version)
+}
+
+func (m *MockCarService) ExtendReservation(id primitive.ObjectID, expiresAt time.Time, version *int64) (*models.Car, error) {
+	return m.ExtendReservationFunc(id, expiresAt, version)
+}
+
+func (m *MockCarService) ExpireReservations(now time.Time) ([]models.Car, error) {
+	return m.ExpireReservationsFunc(now)
+}
+
+func (m *MockCarService) ReturnCar(id primitive.ObjectID, version *int64) (*models.Car, error) {
+	return m.ReturnCarFunc(id, version)
+}
+
+func (m *MockCarService) ChangeCarStatus(id primitive.ObjectID, status string, version *int64) (*models.Car, error) {
+	return m.ChangeCarStatusFunc(id, status, version)
+}
+
+func (m *MockCarService) CheckImages(repair bool) (*models.ImageCheckReport, error) {
+	return m.CheckImagesFunc(repair)
+}
+
+func (m *MockCarService) SetImageStore(store services.ImageStore) {
+	if m.SetImageStoreFunc != nil {
+		m.SetImageStoreFunc(store)
+	}
+}
+
+func (m *MockCarService) SetReservationHoldPeriod(period time.Duration) {
+	if m.SetReservationHoldPeriodFunc != nil {
+		m.SetReservationHoldPeriodFunc(period)
+	}
+}
+
+func (m *MockCarService) SetMaxImageSize(size int64) {
+	if m.SetMaxImageSizeFunc != nil {
+		m.SetMaxImageSizeFunc(size)
+	}
+}
+
+func (m *MockCarService) WithActor(actor models.Actor) services.IcarService {
+	if m.WithActorFunc != nil {
+		return m.WithActorFunc(actor)
 	}
+	return m
 }
 
 // Helper function to create a new multipart form request
@@ -113,6 +208,30 @@ func newMultipartRequest(method, url string, fields map[string]string, fileField
 	return req, nil
 }
 
+// Helper function to check that a response is an RFC 7807 problem with the given status and detail
+func assertProblem(t *testing.T, rr *httptest.ResponseRecorder, status int, detail string) {
+	t.Helper()
+	assert.Equal(t, status, rr.Code)
+	assert.Equal(t, "application/problem+json", rr.Header().Get("Content-Type"))
+
+	var problem handlers.Problem
+	json.Unmarshal(rr.Body.Bytes(), &problem)
+	assert.Equal(t, status, problem.Status)
+	assert.Contains(t, problem.Detail, detail)
+}
+
+// asRole returns a copy of the request made by a user with the given role, as the Authenticate middleware leaves it.
+func asRole(req *http.Request, role string) *http.Request {
+	principal := &models.Principal{UserID: primitive.NewObjectID(), Username: "jdoe", Role: role}
+	return req.WithContext(handlers.ContextWithPrincipal(req.Context(), principal))
+}
+
+// asAPIKey returns a copy of the request made with an API key with the given scopes, as the Authenticate middleware leaves it.
+func asAPIKey(req *http.Request, scopes ...string) *http.Request {
+	principal := &models.Principal{APIKeyID: primitive.NewObjectID(), Username: "DMS sync", Scopes: scopes}
+	return req.WithContext(handlers.ContextWithPrincipal(req.Context(), principal))
+}
+
 func TestHealthCheck(t *testing.T) {
 	req := httptest.NewRequest("GET", "/health", nil)
 	rr := httptest.NewRecorder()
@@ -125,15 +244,26 @@ func TestHealthCheck(t *testing.T) {
 }
 
 func TestGetCarsByStatus(t *testing.T) {
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedPage models.PageRequest
 	mockCarService := &MockCarService{
-		GetCarsByStatusFunc: func(status string) ([]models.Car, error) {
+		GetCarsByStatusFunc: func(status string, page models.PageRequest) (*models.CarPage, error) {
+			receivedPage = page
+			if page.Cursor == "bad-cursor" {
+				return nil, services.ErrInvalidCursor
+			}
 			if status == models.CarStatusAvailable {
-				return []models.Car{
-					{Make: "Toyota", Model: "Corolla", Year: 2020},
-					{Make: "Honda", Model: "Civic", Year: 2021},
+				return &models.CarPage{
+					Items: []models.Car{
+						{Make: "Toyota", Model: "Corolla", Year: 2020},
+						{Make: "Honda", Model: "Civic", Year: 2021},
+					},
+					NextCursor: "next-cursor",
 				}, nil
 			}
-			return nil, nil
+			return &models.CarPage{Items: []models.Car{}}, nil
 		},
 	}
 
@@ -152,13 +282,58 @@ func TestGetCarsByStatus(t *testing.T) {
 		// Checking the response status and body
 		assert.Equal(t, http.StatusOK, rr.Code)
 
-		var result []models.Car
+		var result models.CarListResponse
 		json.NewDecoder(rr.Body).Decode(&result)
-		expected := []models.Car{
-			{Make: "Toyota", Model: "Corolla", Year: 2020},
-			{Make: "Honda", Model: "Civic", Year: 2021},
-		}
+		expected := models.NewCarListResponse(models.CarPage{
+			Items: []models.Car{
+				{Make: "Toyota", Model: "Corolla", Year: 2020},
+				{Make: "Honda", Model: "Civic", Year: 2021},
+			},
+			NextCursor: "next-cursor",
+		})
 		assert.Equal(t, expected, result)
+		assert.Equal(t, models.PageRequest{Limit: models.DefaultPageLimit}, receivedPage)
+	})
+
+	t.Run("page parameters", func(t *testing.T) {
+		// Creating a request for a later page with a total count
+		req := httptest.NewRequest("GET", "/cars/status/available?limit=2&cursor=next-cursor&includeTotal=true", nil)
+		req = mux.SetURLVars(req, map[string]string{"status": "available"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.GetCarsByStatus(rr, req)
+
+		// Checking the response status and the page passed to the service
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, models.PageRequest{Limit: 2, Cursor: "next-cursor", IncludeTotal: true}, receivedPage)
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+		// Creating a request with a limit above the maximum
+		req := httptest.NewRequest("GET", "/cars/status/available?limit=500", nil)
+		req = mux.SetURLVars(req, map[string]string{"status": "available"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.GetCarsByStatus(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Limit must be at most 100")
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		// Creating a request with a cursor rejected by the service
+		req := httptest.NewRequest("GET", "/cars/status/available?cursor=bad-cursor", nil)
+		req = mux.SetURLVars(req, map[string]string{"status": "available"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.GetCarsByStatus(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusUnprocessableEntity, "cursor is invalid")
 	})
 
 	t.Run("invalid status", func(t *testing.T) {
@@ -177,7 +352,7 @@ func TestGetCarsByStatus(t *testing.T) {
 
 	t.Run("service error", func(t *testing.T) {
 		// Simulating a service error
-		mockCarService.GetCarsByStatusFunc = func(status string) ([]models.Car, error) {
+		mockCarService.GetCarsByStatusFunc = func(status string, page models.PageRequest) (*models.CarPage, error) {
 			if status == models.CarStatusReserved {
 				return nil, assert.AnError
 			}
@@ -193,152 +368,231 @@ func TestGetCarsByStatus(t *testing.T) {
 		handlers.GetCarsByStatus(rr, req)
 
 		// Checking the response status and body
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Equal(t, assert.AnError.Error()+"\n", rr.Body.String())
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
 	})
 }
 
-func TestGetCarImage(t *testing.T) {
+func TestSearchCars(t *testing.T) {
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedQuery models.CarQuery
+	var receivedPage models.PageRequest
 	mockCarService := &MockCarService{
-		GetCarImageFunc: func(pictureID string) ([]byte, error) {
-			if pictureID == "valid-id" {
-				return []byte("fake image data"), nil
+		SearchCarsFunc: func(query models.CarQuery, page models.PageRequest) (*models.CarPage, error) {
+			receivedQuery = query
+			receivedPage = page
+			if query.Make == "Honda" {
+				return nil, assert.AnError
 			}
-			return nil, assert.AnError
+			return &models.CarPage{
+				Items: []models.Car{{Make: "Toyota", Model: "Corolla", Year: 2020, Price: 18000}},
+			}, nil
 		},
 	}
 
 	handlers.SetCarService(mockCarService)
 
-	t.Run("valid image ID", func(t *testing.T) {
-		// Creating a request with a valid image ID
-		req, err := http.NewRequest("GET", "/cars/images/valid-id", nil)
-		if err != nil {
-			t.Fatalf("Error creating request: %v", err)
+	t.Run("valid query", func(t *testing.T) {
+		// Creating a request with every supported parameter
+		req := httptest.NewRequest("GET", "/cars?make=Toyota&model=Corolla&minYear=2015&maxYear=2022&minPrice=10000&maxPrice=25000&q=cor&status=available&sort=-price,year&limit=10", nil)
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.SearchCars(rr, req)
+
+		// Checking the response status, body and the query passed to the service
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var result models.CarListResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, []models.CarResponse{models.NewCarResponse(models.Car{Make: "Toyota", Model: "Corolla", Year: 2020, Price: 18000})}, result.Items)
+		assert.Empty(t, result.NextCursor)
+		assert.Equal(t, models.PageRequest{Limit: 10}, receivedPage)
+
+		expected := models.CarQuery{
+			Make:     "Toyota",
+			Model:    "Corolla",
+			MinYear:  2015,
+			MaxYear:  2022,
+			MinPrice: 10000,
+			MaxPrice: 25000,
+			Text:     "cor",
+			Status:   models.CarStatusAvailable,
+			Sort: []models.CarSortField{
+				{Field: "price", Direction: models.SortDescending},
+				{Field: "year", Direction: models.SortAscending},
+			},
 		}
-		req = mux.SetURLVars(req, map[string]string{"id": "valid-id"})
+		assert.Equal(t, expected, receivedQuery)
+	})
 
+	t.Run("invalid number", func(t *testing.T) {
+		// Creating a request with a non-numeric year
+		req := httptest.NewRequest("GET", "/cars?minYear=old", nil)
 		rr := httptest.NewRecorder()
-		handlers.GetCarImage(rr, req)
 
-		// Checking the response status and headers
-		assert.Equal(t, http.StatusOK, rr.Code)
-		assert.Equal(t, "image/jpeg", rr.Header().Get("Content-Type"))
-		assert.Equal(t, strconv.Itoa(len("fake image data")), rr.Header().Get("Content-Length"))
-		assert.Equal(t, "fake image data", rr.Body.String())
+		// Calling the handler
+		handlers.SearchCars(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "minYear must be a number")
 	})
 
-	t.Run("invalid image ID", func(t *testing.T) {
-		// Creating a request with an invalid image ID
-		req, err := http.NewRequest("GET", "/cars/images/invalid-id", nil)
-		if err != nil {
-			t.Fatalf("Error creating request: %v", err)
-		}
-		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+	t.Run("unsupported parameter", func(t *testing.T) {
+		// Creating a request with an unknown parameter
+		req := httptest.NewRequest("GET", "/cars?color=red", nil)
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.SearchCars(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "color is not a supported parameter")
+	})
 
+	t.Run("invalid sort field", func(t *testing.T) {
+		// Creating a request sorting by an unknown field
+		req := httptest.NewRequest("GET", "/cars?sort=mileage", nil)
 		rr := httptest.NewRecorder()
-		handlers.GetCarImage(rr, req)
+
+		// Calling the handler
+		handlers.SearchCars(rr, req)
 
 		// Checking the response status and body
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Equal(t, assert.AnError.Error()+"\n", rr.Body.String())
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "sort must be a comma separated list of price, year and created")
 	})
-}
 
-func TestCreateCar(t *testing.T) {
-	validate := validator.New()
-	handlers.SetValidator(validate)
+	t.Run("invalid includeTotal", func(t *testing.T) {
+		// Creating a request with a non-boolean includeTotal
+		req := httptest.NewRequest("GET", "/cars?includeTotal=maybe", nil)
+		rr := httptest.NewRecorder()
 
-	mockCarService := &MockCarService{
-		CreateCarFunc: func(car *models.Car, fileData []byte, fileName string) (interface{}, error) {
-			if car.Make == "Toyota" {
-				return map[string]string{"message": "Car created successfully"}, nil
-			}
-			return nil, assert.AnError
-		},
-	}
+		// Calling the handler
+		handlers.SearchCars(rr, req)
 
-	handlers.SetCarService(mockCarService)
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "includeTotal must be true or false")
+	})
 
-	t.Run("valid car data", func(t *testing.T) {
-		// Creating a multipart request with valid car data
-		fileContent := []byte("fake image data")
-		req, err := newMultipartRequest("POST", "/cars", map[string]string{
-			"make":  "Toyota",
-			"model": "Corolla",
-			"year":  "2020",
-			"price": "20000",
-		}, "picture", fileContent)
-		if err != nil {
-			t.Fatalf("Error creating request: %v", err)
-		}
+	t.Run("invalid year range", func(t *testing.T) {
+		// Creating a request where the maximum year is lower than the minimum year
+		req := httptest.NewRequest("GET", "/cars?minYear=2020&maxYear=2010", nil)
 		rr := httptest.NewRecorder()
 
 		// Calling the handler
-		handlers.CreateCar(rr, req)
+		handlers.SearchCars(rr, req)
 
 		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "MaxYear must be greater than or equal to MinYear")
+	})
+
+	t.Run("deleted cars", func(t *testing.T) {
+		// Creating a request listing only deleted cars
+		req := httptest.NewRequest("GET", "/cars?deleted=only", nil)
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.SearchCars(rr, req)
+
+		// Checking the response status and the query passed to the service
 		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, models.DeletedCarsOnly, receivedQuery.Deleted)
+	})
 
-		var result map[string]string
-		json.NewDecoder(rr.Body).Decode(&result)
-		expected := map[string]string{"message": "Car created successfully"}
-		assert.Equal(t, expected, result)
+	t.Run("invalid deleted", func(t *testing.T) {
+		// Creating a request with an unknown way of treating deleted cars
+		req := httptest.NewRequest("GET", "/cars?deleted=yes", nil)
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.SearchCars(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Deleted must be one of")
 	})
 
-	t.Run("invalid car data", func(t *testing.T) {
-		// Creating a multipart request with invalid car data (empty make)
-		fileContent := []byte("fake image data")
-		req, err := newMultipartRequest("POST", "/cars", map[string]string{
-			"make":  "",
-			"model": "Corolla",
-			"year":  "2020",
-			"price": "20000",
-		}, "picture", fileContent)
-		if err != nil {
-			t.Fatalf("Error creating request: %v", err)
-		}
+	t.Run("invalid status", func(t *testing.T) {
+		// Creating a request with an unknown status
+		req := httptest.NewRequest("GET", "/cars?status=stolen", nil)
 		rr := httptest.NewRecorder()
 
 		// Calling the handler
-		handlers.CreateCar(rr, req)
+		handlers.SearchCars(rr, req)
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.Contains(t, rr.Body.String(), "Make is required")
+		assert.Contains(t, rr.Body.String(), "Status must be one of")
 	})
 
-	t.Run("service error", func(t *testing.T) {
-		// Simulating a service error
-		fileContent := []byte("fake image data")
-		req, err := newMultipartRequest("POST", "/cars", map[string]string{
-			"make":  "Honda",
-			"model": "Civic",
-			"year":  "2020",
-			"price": "20000",
-		}, "picture", fileContent)
-		if err != nil {
-			t.Fatalf("Error creating request: %v", err)
+	t.Run("customer", func(t *testing.T) {
+		// Creating a request listing the cars of a customer
+		req := httptest.NewRequest("GET", "/cars?customerId=60d5f60e4f1c000088aa8290", nil)
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.SearchCars(rr, asRole(req, models.RoleViewer))
+
+		// Checking the response status and the query passed to the service
+		assert.Equal(t, http.StatusOK, rr.Code)
+		if assert.NotNil(t, receivedQuery.CustomerID) {
+			assert.Equal(t, "60d5f60e4f1c000088aa8290", receivedQuery.CustomerID.Hex())
 		}
+	})
+
+	t.Run("customer with an API key without customers:read", func(t *testing.T) {
+		// Creating a request listing the cars of a customer with a key that may only read cars
+		req := httptest.NewRequest("GET", "/cars?customerId=60d5f60e4f1c000088aa8290", nil)
 		rr := httptest.NewRecorder()
 
 		// Calling the handler
-		handlers.CreateCar(rr, req)
+		handlers.SearchCars(rr, asAPIKey(req, models.ScopeInventoryRead))
 
 		// Checking the response status and body
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Equal(t, assert.AnError.Error()+"\n", rr.Body.String())
+		assertProblem(t, rr, http.StatusForbidden, "the customers:read scope is required")
 	})
-}
 
-func TestUpdateCar(t *testing.T) {
-	validate := validator.New()
-	handlers.SetValidator(validate)
+	t.Run("service error", func(t *testing.T) {
+		// Creating a request that triggers a service error
+		req := httptest.NewRequest("GET", "/cars?make=Honda", nil)
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.SearchCars(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
+	})
+}
 
+func TestGetCarByID(t *testing.T) {
 	mockCarService := &MockCarService{
-		UpdateCarFunc: func(id primitive.ObjectID, car *models.Car, fileData []byte, fileName string) (interface{}, error) {
-			if id.Hex() == "60c72b2f9b1e8b3e0c6fc1c1" {
-				return map[string]string{"message": "Car updated successfully"}, nil
+		GetCarByIDFunc: func(id primitive.ObjectID) (*models.Car, error) {
+			switch id.Hex() {
+			case "60c72b2f9b1e8b3e0c6fc1c1":
+				return &models.Car{
+					ID:      id,
+					Make:    "Toyota",
+					Model:   "Corolla",
+					Year:    2020,
+					Status:  models.CarStatusReserved,
+					Version: 3,
+					Customer: &models.Customer{
+						FullName:    "John Doe",
+						Email:       "john.doe@example.com",
+						PhoneNumber: "1234567890",
+					},
+				}, nil
+			case "60c72b2f9b1e8b3e0c6fc1c2":
+				return nil, fmt.Errorf("%w: car %s does not exist", services.ErrNotFound, id.Hex())
 			}
 			return nil, assert.AnError
 		},
@@ -346,60 +600,392 @@ func TestUpdateCar(t *testing.T) {
 
 	handlers.SetCarService(mockCarService)
 
-	t.Run("valid car data", func(t *testing.T) {
-		// Creating a multipart request with valid car data
-		fileContent := []byte("fake image data")
-		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1", map[string]string{
-			"make":  "Toyota",
-			"model": "Corolla",
-			"year":  "2020",
-			"price": "20000",
-		}, "picture", fileContent)
-		if err != nil {
-			t.Fatalf("Error creating request: %v", err)
-		}
+	t.Run("existing car", func(t *testing.T) {
+		// Creating a request for an existing car
+		req := httptest.NewRequest("GET", "/cars/60c72b2f9b1e8b3e0c6fc1c1", nil)
 		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
 		rr := httptest.NewRecorder()
 
 		// Calling the handler
-		handlers.UpdateCar(rr, req)
+		handlers.GetCarByID(rr, asRole(req, models.RoleViewer))
 
-		// Checking the response status and body
+		// Checking the response status, headers and body
 		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
 
-		var result map[string]string
+		var result models.CarResponse
 		json.NewDecoder(rr.Body).Decode(&result)
-		expected := map[string]string{"message": "Car updated successfully"}
-		assert.Equal(t, expected, result)
+		assert.Equal(t, "60c72b2f9b1e8b3e0c6fc1c1", result.ID)
+		assert.Equal(t, int64(3), result.Version)
+		assert.Equal(t, "Toyota", result.Make)
+		assert.Equal(t, models.CarStatusReserved, result.Status)
+		if assert.NotNil(t, result.Customer) {
+			assert.Equal(t, "John Doe", result.Customer.FullName)
+		}
 	})
 
-	t.Run("invalid car ID", func(t *testing.T) {
-		// Creating a multipart request with an invalid car ID
-		fileContent := []byte("fake image data")
-		req, err := newMultipartRequest("PUT", "/cars/invalid", map[string]string{
-			"make":  "Toyota",
-			"model": "Corolla",
-			"year":  "2020",
-			"price": "20000",
-		}, "picture", fileContent)
-		if err != nil {
-			t.Fatalf("Error creating request: %v", err)
-		}
-		req = mux.SetURLVars(req, map[string]string{"id": "invalid"})
+	t.Run("API key without customers:read", func(t *testing.T) {
+		// Creating a request for a reserved car with a key that may only read cars
+		req := httptest.NewRequest("GET", "/cars/60c72b2f9b1e8b3e0c6fc1c1", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
 		rr := httptest.NewRecorder()
 
 		// Calling the handler
-		handlers.UpdateCar(rr, req)
+		handlers.GetCarByID(rr, asAPIKey(req, models.ScopeInventoryRead))
 
-		// Checking the response status and body
-		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
+		// Checking that the car is returned without its customer
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "Toyota", result.Make)
+		assert.Nil(t, result.Customer)
 	})
 
-	t.Run("invalid car data", func(t *testing.T) {
+	t.Run("API key with customers:read", func(t *testing.T) {
+		// Creating a request for a reserved car with a key that may read cars and customers
+		req := httptest.NewRequest("GET", "/cars/60c72b2f9b1e8b3e0c6fc1c1", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.GetCarByID(rr, asAPIKey(req, models.ScopeInventoryRead, models.ScopeCustomersRead))
+
+		// Checking that the car is returned with its customer
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.NotNil(t, result.Customer)
+	})
+
+	t.Run("car not found", func(t *testing.T) {
+		// Creating a request for a car that does not exist
+		req := httptest.NewRequest("GET", "/cars/60c72b2f9b1e8b3e0c6fc1c2", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c2"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.GetCarByID(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusNotFound, "car 60c72b2f9b1e8b3e0c6fc1c2 does not exist")
+	})
+
+	t.Run("invalid car ID", func(t *testing.T) {
+		// Creating a request with an invalid car ID
+		req := httptest.NewRequest("GET", "/cars/invalid", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "invalid"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.GetCarByID(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		// Creating a request with a car ID that triggers a service error
+		req := httptest.NewRequest("GET", "/cars/60c72b2f9b1e8b3e0c6fc1c3", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c3"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.GetCarByID(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
+	})
+}
+
+// nopReadSeekCloser adds a Close method that does nothing to an io.ReadSeeker
+type nopReadSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopReadSeekCloser) Close() error {
+	return nil
+}
+
+func TestGetCarImage(t *testing.T) {
+	var receivedSize string
+	uploadedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mockCarService := &MockCarService{
+		GetCarImageFunc: func(pictureID string, size string) (*models.ImageFile, error) {
+			receivedSize = size
+			if pictureID == "valid-id" {
+				return &models.ImageFile{
+					ID:          "60c72b2f9b1e8b3e0c6fc1d1",
+					Content:     nopReadSeekCloser{bytes.NewReader([]byte("fake image data"))},
+					ContentType: "image/png",
+					Size:        int64(len("fake image data")),
+					UploadedAt:  uploadedAt,
+				}, nil
+			}
+			return nil, assert.AnError
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	t.Run("valid image ID", func(t *testing.T) {
+		// Creating a request with a valid image ID
+		req, err := http.NewRequest("GET", "/cars/images/valid-id", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "valid-id"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetCarImage(rr, req)
+
+		// Checking the response status and headers
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+		assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+		assert.Equal(t, strconv.Itoa(len("fake image data")), rr.Header().Get("Content-Length"))
+		assert.Equal(t, "fake image data", rr.Body.String())
+		assert.Equal(t, `"60c72b2f9b1e8b3e0c6fc1d1"`, rr.Header().Get("ETag"))
+		assert.Equal(t, uploadedAt.Format(http.TimeFormat), rr.Header().Get("Last-Modified"))
+		assert.Equal(t, "public, max-age=31536000, immutable", rr.Header().Get("Cache-Control"))
+		assert.Equal(t, "bytes", rr.Header().Get("Accept-Ranges"))
+		assert.Equal(t, "", receivedSize)
+	})
+
+	t.Run("range request", func(t *testing.T) {
+		// Creating a request for the first four bytes of an image
+		req, err := http.NewRequest("GET", "/cars/images/valid-id", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req.Header.Set("Range", "bytes=0-3")
+		req = mux.SetURLVars(req, map[string]string{"id": "valid-id"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetCarImage(rr, req)
+
+		// Checking the response status, range and body
+		assert.Equal(t, http.StatusPartialContent, rr.Code)
+		assert.Equal(t, "bytes 0-3/15", rr.Header().Get("Content-Range"))
+		assert.Equal(t, "fake", rr.Body.String())
+	})
+
+	t.Run("unchanged image", func(t *testing.T) {
+		// Creating a conditional request with the ETag of the image
+		req, err := http.NewRequest("GET", "/cars/images/valid-id", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req.Header.Set("If-None-Match", `"60c72b2f9b1e8b3e0c6fc1d1"`)
+		req = mux.SetURLVars(req, map[string]string{"id": "valid-id"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetCarImage(rr, req)
+
+		// Checking that the image is not sent again
+		assert.Equal(t, http.StatusNotModified, rr.Code)
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("resized variant", func(t *testing.T) {
+		// Creating a request for the thumbnail of an image
+		req, err := http.NewRequest("GET", "/cars/images/valid-id?size=thumb", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "valid-id"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetCarImage(rr, req)
+
+		// Checking the response status and the requested size
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, models.ImageSizeThumb, receivedSize)
+	})
+
+	t.Run("invalid size", func(t *testing.T) {
+		// Creating a request for a size that does not exist
+		req, err := http.NewRequest("GET", "/cars/images/valid-id?size=huge", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "valid-id"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetCarImage(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid image size\n", rr.Body.String())
+	})
+
+	t.Run("invalid image ID", func(t *testing.T) {
+		// Creating a request with an invalid image ID
+		req, err := http.NewRequest("GET", "/cars/images/invalid-id", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetCarImage(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
+	})
+}
+
+func TestCreateCar(t *testing.T) {
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedCar models.Car
+	mockCarService := &MockCarService{
+		CreateCarFunc: func(car *models.Car, content io.Reader, fileName string) (*models.Car, error) {
+			receivedCar = *car
+			fileData, _ := io.ReadAll(content)
+			switch string(fileData) {
+			case "plain text":
+				return nil, fmt.Errorf("%w: image must be JPEG, PNG or WebP, not text/plain; charset=utf-8", services.ErrValidation)
+			case "oversized image":
+				return nil, fmt.Errorf("%w: image must not be larger than 10 bytes", services.ErrTooLarge)
+			}
+			if car.Make == "Toyota" {
+				created := *car
+				created.ID, _ = primitive.ObjectIDFromHex("60c72b2f9b1e8b3e0c6fc1c1")
+				created.Picture = "60c72b2f9b1e8b3e0c6fc1d1"
+				return &created, nil
+			}
+			return nil, assert.AnError
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	t.Run("valid car data", func(t *testing.T) {
+		// Creating a multipart request with valid car data
+		fileContent := []byte("fake image data")
+		req, err := newMultipartRequest("POST", "/cars", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "20000",
+		}, "picture", fileContent)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.CreateCar(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "/cars/60c72b2f9b1e8b3e0c6fc1c1", rr.Header().Get("Location"))
+		assert.Equal(t, models.APIVersion, rr.Header().Get("API-Version"))
+
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		expected := models.CarResponse{
+			ID:      "60c72b2f9b1e8b3e0c6fc1c1",
+			Make:    "Toyota",
+			Model:   "Corolla",
+			Year:    2020,
+			Price:   20000,
+			Status:  models.CarStatusAvailable,
+			Picture: "60c72b2f9b1e8b3e0c6fc1d1",
+			Images: []models.CarImageResponse{
+				{ID: "60c72b2f9b1e8b3e0c6fc1d1", Primary: true, URL: "/cars/image/60c72b2f9b1e8b3e0c6fc1d1"},
+			},
+		}
+		assert.Equal(t, expected, result)
+		assert.Equal(t, "", receivedCar.Picture, "The picture data should not be copied into the car")
+	})
+
+	t.Run("unsupported picture", func(t *testing.T) {
+		// Creating a multipart request with a picture that is not an image
+		req, err := newMultipartRequest("POST", "/cars", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "20000",
+		}, "picture", []byte("plain text"))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.CreateCar(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusUnprocessableEntity, "image must be JPEG, PNG or WebP")
+	})
+
+	t.Run("picture too large", func(t *testing.T) {
+		// Creating a multipart request with a picture larger than the maximum image size
+		req, err := newMultipartRequest("POST", "/cars", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "20000",
+		}, "picture", []byte("oversized image"))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.CreateCar(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusRequestEntityTooLarge, "image must not be larger than 10 bytes")
+	})
+
+	t.Run("missing picture", func(t *testing.T) {
+		// Creating a multipart request without a picture
+		req, err := newMultipartRequest("POST", "/cars", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "20000",
+		}, "", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.CreateCar(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "picture is required\n", rr.Body.String())
+	})
+
+	t.Run("not a multipart request", func(t *testing.T) {
+		// Creating a request with a JSON body instead of multipart form data
+		req, err := http.NewRequest("POST", "/cars", bytes.NewBufferString(`{"make":"Toyota"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.CreateCar(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Error parsing form data\n", rr.Body.String())
+	})
+
+	t.Run("invalid car data", func(t *testing.T) {
 		// Creating a multipart request with invalid car data (empty make)
 		fileContent := []byte("fake image data")
-		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1", map[string]string{
+		req, err := newMultipartRequest("POST", "/cars", map[string]string{
 			"make":  "",
 			"model": "Corolla",
 			"year":  "2020",
@@ -408,11 +994,10 @@ func TestUpdateCar(t *testing.T) {
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
-		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
 		rr := httptest.NewRecorder()
 
 		// Calling the handler
-		handlers.UpdateCar(rr, req)
+		handlers.CreateCar(rr, req)
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
@@ -422,96 +1007,974 @@ func TestUpdateCar(t *testing.T) {
 	t.Run("service error", func(t *testing.T) {
 		// Simulating a service error
 		fileContent := []byte("fake image data")
-		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c2", map[string]string{
-			"make":  "Toyota",
-			"model": "Corolla",
+		req, err := newMultipartRequest("POST", "/cars", map[string]string{
+			"make":  "Honda",
+			"model": "Civic",
 			"year":  "2020",
 			"price": "20000",
 		}, "picture", fileContent)
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
-		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c2"})
-		rr := httptest.NewRecorder()
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.CreateCar(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
+	})
+}
+
+func TestUpdateCar(t *testing.T) {
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	mockCarService := &MockCarService{
+		GetCarByIDFunc: func(id primitive.ObjectID) (*models.Car, error) {
+			return &models.Car{ID: id, Make: "Toyota", Model: "Corolla", Year: 2020, Price: 20000, Status: models.CarStatusAvailable}, nil
+		},
+		UpdateCarFunc: func(id primitive.ObjectID, car *models.Car, content io.Reader, fileName string, version *int64) (*models.Car, error) {
+			switch id.Hex() {
+			case "60c72b2f9b1e8b3e0c6fc1c1":
+				updated := *car
+				updated.ID = id
+				updated.Status = models.CarStatusAvailable
+				if content == nil {
+					updated.Picture = "existing-picture"
+				}
+				return &updated, nil
+			case "60c72b2f9b1e8b3e0c6fc1c3":
+				return nil, fmt.Errorf("%w: car %s is sold", services.ErrCarNotEditable, id.Hex())
+			}
+			return nil, assert.AnError
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	t.Run("valid car data", func(t *testing.T) {
+		// Creating a multipart request with valid car data
+		fileContent := []byte("fake image data")
+		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "20000",
+		}, "picture", fileContent)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "60c72b2f9b1e8b3e0c6fc1c1", result.ID)
+		assert.Equal(t, "Corolla", result.Model)
+		assert.Equal(t, 20000.0, result.Price)
+		assert.Equal(t, models.CarStatusAvailable, result.Status)
+	})
+
+	t.Run("without picture", func(t *testing.T) {
+		// Creating a multipart request that keeps the current picture
+		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "19000",
+		}, "", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, 19000.0, result.Price)
+		assert.Equal(t, "existing-picture", result.Picture)
+	})
+
+	t.Run("car not editable", func(t *testing.T) {
+		// Creating a multipart request for a sold car
+		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c3", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "19000",
+		}, "", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c3"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusConflict, "car is not editable: car 60c72b2f9b1e8b3e0c6fc1c3 is sold")
+	})
+
+	t.Run("invalid car ID", func(t *testing.T) {
+		// Creating a multipart request with an invalid car ID
+		fileContent := []byte("fake image data")
+		req, err := newMultipartRequest("PUT", "/cars/invalid", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "20000",
+		}, "picture", fileContent)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "invalid"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
+	})
+
+	t.Run("invalid car data", func(t *testing.T) {
+		// Creating a multipart request with invalid car data (empty make)
+		fileContent := []byte("fake image data")
+		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1", map[string]string{
+			"make":  "",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "20000",
+		}, "picture", fileContent)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Make is required")
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		// Simulating a service error
+		fileContent := []byte("fake image data")
+		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c2", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "20000",
+		}, "picture", fileContent)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c2"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
+	})
+
+	t.Run("price change by a salesperson", func(t *testing.T) {
+		// Creating a multipart request that lowers the price
+		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "19000",
+		}, "", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusForbidden, "the manager role is required to change the price of a car")
+	})
+
+	t.Run("unchanged price by a salesperson", func(t *testing.T) {
+		// Creating a multipart request that keeps the price
+		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla Hybrid",
+			"year":  "2020",
+			"price": "20000",
+		}, "", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "Corolla Hybrid", result.Model)
+	})
+
+	t.Run("missing If-Match", func(t *testing.T) {
+		// Creating a multipart request that does not say which version of the car it changes
+		req, err := newMultipartRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1", map[string]string{
+			"make":  "Toyota",
+			"model": "Corolla",
+			"year":  "2020",
+			"price": "20000",
+		}, "", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCar(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusPreconditionRequired, "If-Match header")
+	})
+}
+
+func TestPatchCar(t *testing.T) {
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedPatch models.CarPatch
+	var receivedVersion *int64
+	mockCarService := &MockCarService{
+		GetCarByIDFunc: func(id primitive.ObjectID) (*models.Car, error) {
+			return &models.Car{ID: id, Make: "Toyota", Model: "Corolla", Year: 2020, Price: 20000, Status: models.CarStatusAvailable, Version: 2}, nil
+		},
+		PatchCarFunc: func(id primitive.ObjectID, patch models.CarPatch, version *int64) (*models.Car, error) {
+			receivedPatch = patch
+			receivedVersion = version
+			if id.Hex() == "60c72b2f9b1e8b3e0c6fc1c3" {
+				return nil, fmt.Errorf("%w: car %s is reserved", services.ErrCarNotEditable, id.Hex())
+			}
+			car := &models.Car{ID: id, Make: "Toyota", Model: "Corolla", Year: 2020, Price: 20000, Status: models.CarStatusAvailable, Version: 2}
+			if patch.Price != nil {
+				car.Price = *patch.Price
+			}
+			return car, nil
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	newPatchRequest := func(id, body string) *http.Request {
+		req := httptest.NewRequest("PATCH", "/cars/"+id, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/merge-patch+json")
+		return mux.SetURLVars(req, map[string]string{"id": id})
+	}
+
+	t.Run("valid patch", func(t *testing.T) {
+		// Creating a patch that only changes the price
+		req := newPatchRequest("60c72b2f9b1e8b3e0c6fc1c1", `{"price": 18500}`)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.PatchCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status, the received patch and the body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+		if assert.NotNil(t, receivedPatch.Price) {
+			assert.Equal(t, 18500.0, *receivedPatch.Price)
+		}
+		assert.Nil(t, receivedPatch.Make)
+		assert.Nil(t, receivedPatch.Year)
+
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, 18500.0, result.Price)
+		assert.Equal(t, "Corolla", result.Model)
+	})
+
+	t.Run("invalid field values", func(t *testing.T) {
+		// Creating a patch with a year that is too early and an empty make
+		req := newPatchRequest("60c72b2f9b1e8b3e0c6fc1c1", `{"year": 1800, "make": ""}`)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.PatchCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Year must be at least 1900")
+		assert.Contains(t, rr.Body.String(), "Make must be at least 1")
+	})
+
+	t.Run("fields that cannot be patched", func(t *testing.T) {
+		// Creating a patch removing the model and changing the status
+		req := newPatchRequest("60c72b2f9b1e8b3e0c6fc1c1", `{"model": null, "status": "sold", "price": "cheap"}`)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.PatchCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "model cannot be removed")
+		assert.Contains(t, rr.Body.String(), "status cannot be patched")
+		assert.Contains(t, rr.Body.String(), "price has an invalid value")
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		// Creating a patch sent as plain JSON
+		req := newPatchRequest("60c72b2f9b1e8b3e0c6fc1c1", `{"price": 18500}`)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.PatchCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	})
+
+	t.Run("patch that is not an object", func(t *testing.T) {
+		// Creating a patch that is a JSON array
+		req := newPatchRequest("60c72b2f9b1e8b3e0c6fc1c1", `[{"op": "replace"}]`)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.PatchCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid car patch\n", rr.Body.String())
+	})
+
+	t.Run("car not editable", func(t *testing.T) {
+		// Creating a patch for a reserved car
+		req := newPatchRequest("60c72b2f9b1e8b3e0c6fc1c3", `{"price": 18500}`)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.PatchCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusConflict, "car 60c72b2f9b1e8b3e0c6fc1c3 is reserved")
+	})
+
+	t.Run("price change by a salesperson", func(t *testing.T) {
+		// Creating a patch that changes the price
+		receivedPatch = models.CarPatch{}
+		req := newPatchRequest("60c72b2f9b1e8b3e0c6fc1c1", `{"price": 18500}`)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.PatchCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking that the change was refused without patching the car
+		assertProblem(t, rr, http.StatusForbidden, "the manager role is required to change the price of a car")
+		assert.Nil(t, receivedPatch.Price)
+	})
+
+	t.Run("price change with an API key", func(t *testing.T) {
+		// Creating a patch that changes the price, sent with a key that may edit cars but not their prices
+		receivedPatch = models.CarPatch{}
+		req := newPatchRequest("60c72b2f9b1e8b3e0c6fc1c1", `{"price": 18500}`)
+		principal := &models.Principal{APIKeyID: primitive.NewObjectID(), Username: "DMS sync", Scopes: []string{models.ScopeInventoryWrite}}
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.PatchCar(rr, req.WithContext(handlers.ContextWithPrincipal(req.Context(), principal)))
+
+		// Checking that the change was refused without patching the car
+		assertProblem(t, rr, http.StatusForbidden, "the prices:write scope is required to change the price of a car")
+		assert.Nil(t, receivedPatch.Price)
+	})
+
+	t.Run("unchanged price by a salesperson", func(t *testing.T) {
+		// Creating a patch that repeats the current price
+		req := newPatchRequest("60c72b2f9b1e8b3e0c6fc1c1", `{"price": 20000, "year": 2021}`)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.PatchCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking that the car was patched at the version the price was checked against
+		assert.Equal(t, http.StatusOK, rr.Code)
+		if assert.NotNil(t, receivedVersion) {
+			assert.Equal(t, int64(2), *receivedVersion)
+		}
+	})
+}
+
+func TestDeleteCar(t *testing.T) {
+	// Mocking the car service with a DeleteCar function
+	mockCarService := &MockCarService{
+		DeleteCarFunc: func(id primitive.ObjectID, version *int64) error {
+			if id.Hex() == "60c72b2f9b1e8b3e0c6fc1c1" {
+				return nil
+			}
+			return assert.AnError
+		},
+	}
+
+	// Setting the mock service in the handler
+	handlers.SetCarService(mockCarService)
+
+	t.Run("valid car ID", func(t *testing.T) {
+		// Creating a request with a valid car ID
+		req := httptest.NewRequest("DELETE", "/cars/60c72b2f9b1e8b3e0c6fc1c1", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.DeleteCar(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+		assert.Empty(t, rr.Body.String())
+	})
+
+	t.Run("invalid car ID", func(t *testing.T) {
+		// Creating a request with an invalid car ID
+		req := httptest.NewRequest("DELETE", "/cars/invalid", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "invalid"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.DeleteCar(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		// Creating a request with a car ID that triggers a service error
+		req := httptest.NewRequest("DELETE", "/cars/60c72b2f9b1e8b3e0c6fc1c2", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c2"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.DeleteCar(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
+	})
+}
+
+func TestRestoreCar(t *testing.T) {
+	// Mocking the car service with a RestoreCar function
+	var receivedVersion *int64
+	mockCarService := &MockCarService{
+		RestoreCarFunc: func(id primitive.ObjectID, version *int64) (*models.Car, error) {
+			receivedVersion = version
+			switch id.Hex() {
+			case "60c72b2f9b1e8b3e0c6fc1c1":
+				return &models.Car{ID: id, Make: "Toyota", Model: "Corolla", Status: models.CarStatusAvailable, Version: 5}, nil
+			case "60c72b2f9b1e8b3e0c6fc1c2":
+				return nil, fmt.Errorf("%w: car %s is archived but not deleted", services.ErrInvalidTransition, id.Hex())
+			}
+			return nil, fmt.Errorf("%w: car %s does not exist", services.ErrNotFound, id.Hex())
+		},
+	}
+
+	// Setting the mock service in the handler
+	handlers.SetCarService(mockCarService)
+
+	tests := []struct {
+		name    string
+		id      string
+		ifMatch string
+		status  int
+	}{
+		{"deleted car", "60c72b2f9b1e8b3e0c6fc1c1", `"4"`, http.StatusOK},
+		{"car that is not deleted", "60c72b2f9b1e8b3e0c6fc1c2", "*", http.StatusConflict},
+		{"unknown car", "60c72b2f9b1e8b3e0c6fc1c3", "*", http.StatusNotFound},
+		{"invalid car ID", "invalid", "*", http.StatusBadRequest},
+		{"invalid If-Match", "60c72b2f9b1e8b3e0c6fc1c1", "four", http.StatusBadRequest},
+		{"missing If-Match", "60c72b2f9b1e8b3e0c6fc1c1", "", http.StatusPreconditionRequired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receivedVersion = nil
+			req := httptest.NewRequest("POST", "/cars/"+tt.id+"/restore", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": tt.id})
+			if tt.ifMatch != "" {
+				req.Header.Set("If-Match", tt.ifMatch)
+			}
+			rr := httptest.NewRecorder()
+
+			// Calling the handler
+			handlers.RestoreCar(rr, req)
+
+			// Checking the response status
+			assert.Equal(t, tt.status, rr.Code)
+		})
+	}
+
+	t.Run("restored car", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/cars/60c72b2f9b1e8b3e0c6fc1c1/restore", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", `"4"`)
+		rr := httptest.NewRecorder()
+		handlers.RestoreCar(rr, req)
+
+		// Checking the expected version, the new ETag and that the car is no longer deleted
+		if assert.NotNil(t, receivedVersion) {
+			assert.Equal(t, int64(4), *receivedVersion)
+		}
+		assert.Equal(t, `"5"`, rr.Header().Get("ETag"))
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, models.CarStatusAvailable, result.Status)
+		assert.Nil(t, result.DeletedAt)
+	})
+}
+
+func TestReserveCar(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	mockCarService := &MockCarService{
+		ReserveCarFunc: func(id primitive.ObjectID, reservation models.ReservationRequest, version *int64) (*models.Car, error) {
+			if reservation.FullName == "John Doe" {
+				return &models.Car{ID: id, Make: "Toyota", Status: models.CarStatusReserved, Customer: &reservation.Customer}, nil
+			}
+			if reservation.Deposit != nil && reservation.Deposit.Amount == 500 {
+				return &models.Car{ID: id, Make: "Toyota", Status: models.CarStatusReserved, Customer: &reservation.Customer}, nil
+			}
+			if reservation.CustomerID != nil {
+				customer := models.Customer{ID: *reservation.CustomerID, FullName: "Existing Customer", Email: "existing@example.com", PhoneNumber: "1112223333"}
+				return &models.Car{ID: id, Make: "Toyota", Status: models.CarStatusReserved, Customer: &customer}, nil
+			}
+			return nil, assert.AnError
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	t.Run("valid reservation data", func(t *testing.T) {
+		// Creating a valid customer object and request
+		customer := models.Customer{
+			FullName:    "John Doe",
+			Email:       "john.doe@example.com",
+			PhoneNumber: "1234567890",
+		}
+		body, _ := json.Marshal(customer)
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ReserveCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "60d5f60e4f1c000088aa828e", result.ID)
+		assert.Equal(t, models.CarStatusReserved, result.Status)
+		assert.Equal(t, &models.CustomerResponse{FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}, result.Customer)
+	})
+
+	t.Run("reservation with deposit", func(t *testing.T) {
+		// Creating a reservation request with a deposit
+		body := `{"fullName":"Jane Doe","email":"jane.doe@example.com","phoneNumber":"1234567890","deposit":{"amount":500,"method":"card"}}`
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ReserveCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "Jane Doe", result.Customer.FullName)
+	})
+
+	t.Run("existing customer", func(t *testing.T) {
+		// Creating a reservation request for an existing customer
+		body := `{"customerId":"60d5f60e4f1c000088aa8290"}`
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ReserveCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "60d5f60e4f1c000088aa8290", result.Customer.ID)
+		assert.Equal(t, "Existing Customer", result.Customer.FullName)
+	})
+
+	t.Run("customer ID and customer details", func(t *testing.T) {
+		// Creating a reservation request naming the customer twice
+		body := `{"customerId":"60d5f60e4f1c000088aa8290","fullName":"Jane Doe"}`
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ReserveCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Provide either customerId or customer details\n", rr.Body.String())
+	})
+
+	t.Run("invalid deposit", func(t *testing.T) {
+		// Creating a reservation request with a deposit paid by an unknown method
+		body := `{"fullName":"Jane Doe","email":"jane.doe@example.com","phoneNumber":"1234567890","deposit":{"amount":500,"method":"cheque"}}`
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ReserveCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Method must be one of cash card bank-transfer financing")
+	})
+
+	t.Run("invalid reservation data", func(t *testing.T) {
+		// Creating a customer object with invalid data
+		customer := models.Customer{
+			FullName:    "Name",
+			Email:       "invalid-email",
+			PhoneNumber: "12345",
+		}
+		body, _ := json.Marshal(customer)
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ReserveCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Email is not a valid email address")
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		// Creating a valid customer object with an ID that triggers a service error
+		customer := models.Customer{
+			FullName:    "Jane Doe",
+			Email:       "jane.doe@example.com",
+			PhoneNumber: "0987654321",
+		}
+		body, _ := json.Marshal(customer)
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ReserveCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
+	})
+
+	t.Run("invalid car ID", func(t *testing.T) {
+		// Creating a valid customer object with an invalid car ID
+		customer := models.Customer{
+			FullName:    "John Doe",
+			Email:       "john.doe@example.com",
+			PhoneNumber: "1234567890",
+		}
+		body, _ := json.Marshal(customer)
+		req, err := http.NewRequest("POST", "/cars/invalid-id/reserve", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ReserveCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
+	})
+}
+
+func TestCancelReservation(t *testing.T) {
+	// Mocking the car service with a CancelReservation function
+	mockCarService := &MockCarService{
+		CancelReservationFunc: func(id primitive.ObjectID, version *int64) (*models.Car, error) {
+			if id.Hex() == "60d5f60e4f1c000088aa828e" {
+				return &models.Car{ID: id, Make: "Toyota", Status: models.CarStatusAvailable}, nil
+			}
+			return nil, assert.AnError
+		},
+	}
+
+	// Setting the mock service in the handler
+	handlers.SetCarService(mockCarService)
+
+	t.Run("valid cancel reservation", func(t *testing.T) {
+		// Creating a request with a valid reservation ID
+		req, err := http.NewRequest("DELETE", "/cars/60d5f60e4f1c000088aa828e/cancel", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.CancelReservation(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "60d5f60e4f1c000088aa828e", result.ID)
+		assert.Equal(t, models.CarStatusAvailable, result.Status)
+		assert.Nil(t, result.Customer)
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		// Creating a request with a reservation ID that triggers a service error
+		req, err := http.NewRequest("DELETE", "/cars/60d5f60e4f1c000088aa828f/cancel", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.CancelReservation(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
+	})
+
+	t.Run("invalid car ID", func(t *testing.T) {
+		// Creating a request with an invalid car ID
+		req, err := http.NewRequest("DELETE", "/cars/invalid-id/cancel", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+		req.Header.Set("If-Match", "*")
 
-		// Calling the handler
-		handlers.UpdateCar(rr, req)
+		rr := httptest.NewRecorder()
+		handlers.CancelReservation(rr, req)
 
 		// Checking the response status and body
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Equal(t, assert.AnError.Error()+"\n", rr.Body.String())
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
 	})
 }
 
-func TestDeleteCar(t *testing.T) {
-	// Mocking the car service with a DeleteCar function
+func TestExtendReservation(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
 	mockCarService := &MockCarService{
-		DeleteCarFunc: func(id primitive.ObjectID) (interface{}, error) {
-			if id.Hex() == "60c72b2f9b1e8b3e0c6fc1c1" {
-				return map[string]string{"message": "Car deleted successfully"}, nil
+		ExtendReservationFunc: func(id primitive.ObjectID, expiresAt time.Time, version *int64) (*models.Car, error) {
+			if id.Hex() == "60d5f60e4f1c000088aa828e" {
+				reservation := &models.Reservation{ReservedAt: expiresAt.Add(-96 * time.Hour), ExpiresAt: expiresAt}
+				customer := &models.Customer{FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}
+				return &models.Car{ID: id, Make: "Toyota", Status: models.CarStatusReserved, Reservation: reservation, Customer: customer}, nil
 			}
-			return nil, assert.AnError
+			return nil, fmt.Errorf("%w: new expiry must be after the current expiry", services.ErrValidation)
 		},
 	}
 
-	// Setting the mock service in the handler
 	handlers.SetCarService(mockCarService)
 
-	t.Run("valid car ID", func(t *testing.T) {
-		// Creating a request with a valid car ID
-		req := httptest.NewRequest("DELETE", "/cars/60c72b2f9b1e8b3e0c6fc1c1", nil)
-		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
-		rr := httptest.NewRecorder()
+	t.Run("valid extension", func(t *testing.T) {
+		// Creating a request with a new expiry
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/extend-reservation", bytes.NewBufferString(`{"expiresAt":"2030-01-02T15:04:05Z"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
 
-		// Calling the handler
-		handlers.DeleteCar(rr, req)
+		rr := httptest.NewRecorder()
+		handlers.ExtendReservation(rr, asRole(req, models.RoleSalesperson))
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusOK, rr.Code)
-		var result map[string]string
+		var result models.CarResponse
 		json.NewDecoder(rr.Body).Decode(&result)
-		expected := map[string]string{"message": "Car deleted successfully"}
-		assert.Equal(t, expected, result)
+		assert.Equal(t, models.CarStatusReserved, result.Status)
+		if assert.NotNil(t, result.Reservation) {
+			assert.Equal(t, time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC), result.Reservation.ExpiresAt)
+		}
+		assert.NotNil(t, result.Customer)
 	})
 
-	t.Run("invalid car ID", func(t *testing.T) {
-		// Creating a request with an invalid car ID
-		req := httptest.NewRequest("DELETE", "/cars/invalid", nil)
-		req = mux.SetURLVars(req, map[string]string{"id": "invalid"})
+	t.Run("API key without customers:read", func(t *testing.T) {
+		// Creating a request with a new expiry made with a key that may only change reservations
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/extend-reservation", bytes.NewBufferString(`{"expiresAt":"2030-01-02T15:04:05Z"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
 		rr := httptest.NewRecorder()
+		handlers.ExtendReservation(rr, asAPIKey(req, models.ScopeReservationsWrite))
 
-		// Calling the handler
-		handlers.DeleteCar(rr, req)
+		// Checking that the changed car is returned without its customer
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, models.CarStatusReserved, result.Status)
+		assert.Nil(t, result.Customer)
+		assert.NotContains(t, rr.Body.String(), "john.doe@example.com")
+	})
+
+	t.Run("expiry rejected by the service", func(t *testing.T) {
+		// Creating a request with an expiry the service rejects
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828f/extend-reservation", bytes.NewBufferString(`{"expiresAt":"2020-01-02T15:04:05Z"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ExtendReservation(rr, req)
 
 		// Checking the response status and body
-		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
+		assertProblem(t, rr, http.StatusUnprocessableEntity, "validation failed: new expiry must be after the current expiry")
 	})
 
-	t.Run("service error", func(t *testing.T) {
-		// Creating a request with a car ID that triggers a service error
-		req := httptest.NewRequest("DELETE", "/cars/60c72b2f9b1e8b3e0c6fc1c2", nil)
-		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c2"})
+	t.Run("missing expiry", func(t *testing.T) {
+		// Creating a request without an expiry
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/extend-reservation", bytes.NewBufferString(`{}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
 		rr := httptest.NewRecorder()
+		handlers.ExtendReservation(rr, req)
 
-		// Calling the handler
-		handlers.DeleteCar(rr, req)
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "ExpiresAt is required")
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		// Creating a request with an expiry that is not a timestamp
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/extend-reservation", bytes.NewBufferString(`{"expiresAt":"tomorrow"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ExtendReservation(rr, req)
 
 		// Checking the response status and body
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Equal(t, assert.AnError.Error()+"\n", rr.Body.String())
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid reservation data\n", rr.Body.String())
 	})
 }
 
-func TestReserveCar(t *testing.T) {
+func TestSellCar(t *testing.T) {
 	// Setting up the validator and mock service
 	validate := validator.New()
 	handlers.SetValidator(validate)
 
 	mockCarService := &MockCarService{
-		ReserveCarFunc: func(id primitive.ObjectID, customer models.Customer) (interface{}, error) {
-			if customer.FullName == "John Doe" {
-				return map[string]string{"message": "Car reserved successfully"}, nil
+		GetCarByIDFunc: func(id primitive.ObjectID) (*models.Car, error) {
+			return &models.Car{ID: id, Make: "Toyota", Price: 20000, Status: models.CarStatusReserved, Version: 3}, nil
+		},
+		SellCarFunc: func(id primitive.ObjectID, sale models.SaleRequest, version *int64) (*models.Car, error) {
+			if id.Hex() == "60d5f60e4f1c000088aa828e" {
+				return &models.Car{ID: id, Make: "Toyota", Status: models.CarStatusSold, Customer: &sale.Customer}, nil
+			}
+			if len(sale.Payments) > 0 {
+				return nil, fmt.Errorf("%w: payments of %.2f exceed the balance due of 0.00", services.ErrValidation, sale.Payments[0].Amount)
 			}
 			return nil, assert.AnError
 		},
@@ -519,47 +1982,50 @@ func TestReserveCar(t *testing.T) {
 
 	handlers.SetCarService(mockCarService)
 
-	t.Run("valid reservation data", func(t *testing.T) {
+	t.Run("valid sell car request", func(t *testing.T) {
 		// Creating a valid customer object and request
 		customer := models.Customer{
 			FullName:    "John Doe",
 			Email:       "john.doe@example.com",
 			PhoneNumber: "1234567890",
 		}
-		body, _ := json.Marshal(customer)
-		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBuffer(body))
+		customerJSON, _ := json.Marshal(customer)
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/sell", bytes.NewBuffer(customerJSON))
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
 		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.ReserveCar(rr, req)
+		handlers.SellCar(rr, asRole(req, models.RoleManager))
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusOK, rr.Code)
-		var result map[string]string
+		var result models.CarResponse
 		json.NewDecoder(rr.Body).Decode(&result)
-		expected := map[string]string{"message": "Car reserved successfully"}
-		assert.Equal(t, expected, result)
+		assert.Equal(t, "60d5f60e4f1c000088aa828e", result.ID)
+		assert.Equal(t, models.CarStatusSold, result.Status)
+		assert.Equal(t, "John Doe", result.Customer.FullName)
 	})
 
-	t.Run("invalid reservation data", func(t *testing.T) {
+	t.Run("invalid customer data", func(t *testing.T) {
 		// Creating a customer object with invalid data
 		customer := models.Customer{
 			FullName:    "Name",
 			Email:       "invalid-email",
-			PhoneNumber: "12345",
+			PhoneNumber: "123",
 		}
-		body, _ := json.Marshal(customer)
-		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBuffer(body))
+		customerJSON, _ := json.Marshal(customer)
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/sell", bytes.NewBuffer(customerJSON))
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
 		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.ReserveCar(rr, req)
+		handlers.SellCar(rr, asRole(req, models.RoleManager))
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
@@ -569,23 +2035,41 @@ func TestReserveCar(t *testing.T) {
 	t.Run("service error", func(t *testing.T) {
 		// Creating a valid customer object with an ID that triggers a service error
 		customer := models.Customer{
-			FullName:    "Jane Doe",
-			Email:       "jane.doe@example.com",
-			PhoneNumber: "0987654321",
+			FullName:    "John Doe",
+			Email:       "john.doe@example.com",
+			PhoneNumber: "1234567890",
 		}
-		body, _ := json.Marshal(customer)
-		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBuffer(body))
+		customerJSON, _ := json.Marshal(customer)
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828f/sell", bytes.NewBuffer(customerJSON))
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
-		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.SellCar(rr, asRole(req, models.RoleManager))
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+		assert.NotContains(t, rr.Body.String(), assert.AnError.Error())
+	})
+
+	t.Run("payments exceeding the balance", func(t *testing.T) {
+		// Creating a sale request with a payment the service rejects
+		body := `{"fullName":"John Doe","email":"john.doe@example.com","phoneNumber":"1234567890","payments":[{"amount":99999,"method":"bank-transfer"}]}`
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828f/sell", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.ReserveCar(rr, req)
+		handlers.SellCar(rr, asRole(req, models.RoleManager))
 
 		// Checking the response status and body
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Equal(t, assert.AnError.Error()+"\n", rr.Body.String())
+		assertProblem(t, rr, http.StatusUnprocessableEntity, "validation failed: payments of 99999.00 exceed the balance due of 0.00")
 	})
 
 	t.Run("invalid car ID", func(t *testing.T) {
@@ -595,81 +2079,113 @@ func TestReserveCar(t *testing.T) {
 			Email:       "john.doe@example.com",
 			PhoneNumber: "1234567890",
 		}
-		body, _ := json.Marshal(customer)
-		req, err := http.NewRequest("POST", "/cars/invalid-id/reserve", bytes.NewBuffer(body))
+		customerJSON, _ := json.Marshal(customer)
+		req, err := http.NewRequest("POST", "/cars/invalid-id/sell", bytes.NewBuffer(customerJSON))
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
 		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.ReserveCar(rr, req)
+		handlers.SellCar(rr, asRole(req, models.RoleManager))
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
 		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
 	})
+
+	t.Run("discount by a salesperson", func(t *testing.T) {
+		// Creating a sale below the list price of the car
+		body := `{"fullName": "John Doe", "email": "john.doe@example.com", "phoneNumber": "1234567890", "price": 18000}`
+		req := httptest.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/sell", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.SellCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusForbidden, "the manager role is required to sell a car at a price other than its list price")
+	})
+
+	t.Run("list price by a salesperson", func(t *testing.T) {
+		// Creating a sale at the list price of the car
+		body := `{"fullName": "John Doe", "email": "john.doe@example.com", "phoneNumber": "1234567890", "price": 20000}`
+		req := httptest.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/sell", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.SellCar(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
 }
 
-func TestCancelReservation(t *testing.T) {
-	// Mocking the car service with a CancelReservation function
+func TestReturnCar(t *testing.T) {
+	// Mocking the car service with a ReturnCar function
 	mockCarService := &MockCarService{
-		CancelReservationFunc: func(id primitive.ObjectID) (interface{}, error) {
+		ReturnCarFunc: func(id primitive.ObjectID, version *int64) (*models.Car, error) {
 			if id.Hex() == "60d5f60e4f1c000088aa828e" {
-				return map[string]string{"message": "Reservation cancelled successfully"}, nil
+				return &models.Car{ID: id, Make: "Toyota", Status: models.CarStatusInPreparation}, nil
 			}
-			return nil, assert.AnError
+			return nil, fmt.Errorf("%w: action 'return' is not allowed for a car that is available", services.ErrInvalidTransition)
 		},
 	}
 
-	// Setting the mock service in the handler
 	handlers.SetCarService(mockCarService)
 
-	t.Run("valid cancel reservation", func(t *testing.T) {
-		// Creating a request with a valid reservation ID
-		req, err := http.NewRequest("DELETE", "/cars/60d5f60e4f1c000088aa828e/cancel", nil)
+	t.Run("valid return", func(t *testing.T) {
+		// Creating a request for a sold car
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/return", nil)
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
 		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.CancelReservation(rr, req)
+		handlers.ReturnCar(rr, req)
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusOK, rr.Code)
-		var result map[string]string
+		var result models.CarResponse
 		json.NewDecoder(rr.Body).Decode(&result)
-		expected := map[string]string{"message": "Reservation cancelled successfully"}
-		assert.Equal(t, expected, result)
+		assert.Equal(t, models.CarStatusInPreparation, result.Status)
+		assert.Nil(t, result.Customer)
 	})
 
-	t.Run("service error", func(t *testing.T) {
-		// Creating a request with a reservation ID that triggers a service error
-		req, err := http.NewRequest("DELETE", "/cars/60d5f60e4f1c000088aa828f/cancel", nil)
+	t.Run("car not sold", func(t *testing.T) {
+		// Creating a request for a car that was never sold
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828f/return", nil)
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
 		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.CancelReservation(rr, req)
+		handlers.ReturnCar(rr, req)
 
 		// Checking the response status and body
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Equal(t, assert.AnError.Error()+"\n", rr.Body.String())
+		assertProblem(t, rr, http.StatusConflict, "invalid state transition: action 'return' is not allowed for a car that is available")
 	})
 
 	t.Run("invalid car ID", func(t *testing.T) {
 		// Creating a request with an invalid car ID
-		req, err := http.NewRequest("DELETE", "/cars/invalid-id/cancel", nil)
+		req, err := http.NewRequest("POST", "/cars/invalid-id/return", nil)
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
 		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.CancelReservation(rr, req)
+		handlers.ReturnCar(rr, req)
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
@@ -677,110 +2193,213 @@ func TestCancelReservation(t *testing.T) {
 	})
 }
 
-func TestSellCar(t *testing.T) {
+func TestChangeCarStatus(t *testing.T) {
 	// Setting up the validator and mock service
 	validate := validator.New()
 	handlers.SetValidator(validate)
 
 	mockCarService := &MockCarService{
-		SellCarFunc: func(id primitive.ObjectID, customer models.Customer) (interface{}, error) {
+		ChangeCarStatusFunc: func(id primitive.ObjectID, status string, version *int64) (*models.Car, error) {
+			if version != nil && *version != 4 {
+				return nil, fmt.Errorf("%w: car %s is at version 4, not %d", services.ErrPrecondition, id.Hex(), *version)
+			}
 			if id.Hex() == "60d5f60e4f1c000088aa828e" {
-				return map[string]string{"message": "Car sold successfully"}, nil
+				return &models.Car{ID: id, Make: "Toyota", Status: status, Version: 5}, nil
 			}
-			return nil, assert.AnError
+			return nil, fmt.Errorf("%w: action 'archive' is not allowed for a car that is sold", services.ErrInvalidTransition)
 		},
 	}
 
 	handlers.SetCarService(mockCarService)
 
-	t.Run("valid sell car request", func(t *testing.T) {
-		// Creating a valid customer object and request
-		customer := models.Customer{
-			FullName:    "John Doe",
-			Email:       "john.doe@example.com",
-			PhoneNumber: "1234567890",
-		}
-		customerJSON, _ := json.Marshal(customer)
-		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/sell", bytes.NewBuffer(customerJSON))
+	t.Run("valid status change", func(t *testing.T) {
+		// Creating a request moving the car to in-preparation
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/status", bytes.NewBufferString(`{"status":"in-preparation"}`))
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
 		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.SellCar(rr, req)
+		handlers.ChangeCarStatus(rr, req)
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusOK, rr.Code)
-		var result map[string]string
+		var result models.CarResponse
 		json.NewDecoder(rr.Body).Decode(&result)
-		expected := map[string]string{"message": "Car sold successfully"}
-		assert.Equal(t, expected, result)
+		assert.Equal(t, models.CarStatusInPreparation, result.Status)
 	})
 
-	t.Run("invalid customer data", func(t *testing.T) {
-		// Creating a customer object with invalid data
-		customer := models.Customer{
-			FullName:    "Name",
-			Email:       "invalid-email",
-			PhoneNumber: "123",
+	t.Run("matching If-Match", func(t *testing.T) {
+		// Creating a request for the current version of the car
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/status", bytes.NewBufferString(`{"status":"archived"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
 		}
-		customerJSON, _ := json.Marshal(customer)
-		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/sell", bytes.NewBuffer(customerJSON))
+		req.Header.Set("If-Match", `"4"`)
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.ChangeCarStatus(rr, req)
+
+		// Checking the response status and the ETag of the new version
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, `"5"`, rr.Header().Get("ETag"))
+	})
+
+	t.Run("stale If-Match", func(t *testing.T) {
+		// Creating a request for an outdated version of the car
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/status", bytes.NewBufferString(`{"status":"archived"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req.Header.Set("If-Match", `"3"`)
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.ChangeCarStatus(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusPreconditionFailed, "is at version 4, not 3")
+	})
+
+	t.Run("invalid If-Match", func(t *testing.T) {
+		// Creating a request with an entity tag that is not a car version
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/status", bytes.NewBufferString(`{"status":"archived"}`))
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
+		req.Header.Set("If-Match", `W/"4"`)
 		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
 
 		rr := httptest.NewRecorder()
-		handlers.SellCar(rr, req)
+		handlers.ChangeCarStatus(rr, req)
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.Contains(t, rr.Body.String(), "Email is not a valid email address")
+		assert.Equal(t, "Invalid If-Match header\n", rr.Body.String())
 	})
 
-	t.Run("service error", func(t *testing.T) {
-		// Creating a valid customer object with an ID that triggers a service error
-		customer := models.Customer{
-			FullName:    "John Doe",
-			Email:       "john.doe@example.com",
-			PhoneNumber: "1234567890",
+	t.Run("missing If-Match", func(t *testing.T) {
+		// Creating a request that does not say which version of the car it changes
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/status", bytes.NewBufferString(`{"status":"archived"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
 		}
-		customerJSON, _ := json.Marshal(customer)
-		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828f/sell", bytes.NewBuffer(customerJSON))
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.ChangeCarStatus(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusPreconditionRequired, "If-Match header")
+	})
+
+	t.Run("status requiring a customer", func(t *testing.T) {
+		// Creating a request moving the car to a status that has its own action
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/status", bytes.NewBufferString(`{"status":"sold"}`))
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
-		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.SellCar(rr, req)
+		handlers.ChangeCarStatus(rr, req)
 
 		// Checking the response status and body
-		assert.Equal(t, http.StatusInternalServerError, rr.Code)
-		assert.Equal(t, assert.AnError.Error()+"\n", rr.Body.String())
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Status must be one of")
 	})
 
-	t.Run("invalid car ID", func(t *testing.T) {
-		// Creating a valid customer object with an invalid car ID
-		customer := models.Customer{
-			FullName:    "John Doe",
-			Email:       "john.doe@example.com",
-			PhoneNumber: "1234567890",
+	t.Run("transition not allowed", func(t *testing.T) {
+		// Creating a request archiving a sold car
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828f/status", bytes.NewBufferString(`{"status":"archived"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
 		}
-		customerJSON, _ := json.Marshal(customer)
-		req, err := http.NewRequest("POST", "/cars/invalid-id/sell", bytes.NewBuffer(customerJSON))
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+		req.Header.Set("If-Match", "*")
+
+		rr := httptest.NewRecorder()
+		handlers.ChangeCarStatus(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusConflict, "invalid state transition: action 'archive' is not allowed for a car that is sold")
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		// Creating a request with a malformed body
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/status", bytes.NewBufferString(`{`))
 		if err != nil {
 			t.Fatalf("Error creating request: %v", err)
 		}
-		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+		req.Header.Set("If-Match", "*")
 
 		rr := httptest.NewRecorder()
-		handlers.SellCar(rr, req)
+		handlers.ChangeCarStatus(rr, req)
 
 		// Checking the response status and body
 		assert.Equal(t, http.StatusBadRequest, rr.Code)
-		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
+		assert.Equal(t, "Invalid status change data\n", rr.Body.String())
 	})
 }
+
+func TestServiceErrorMapping(t *testing.T) {
+	// Setting up the validator and a mock service returning the error under test
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var serviceErr error
+	mockCarService := &MockCarService{
+		ReserveCarFunc: func(id primitive.ObjectID, reservation models.ReservationRequest, version *int64) (*models.Car, error) {
+			return nil, serviceErr
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		uri    string
+	}{
+		{"not found", fmt.Errorf("%w: car does not exist", services.ErrNotFound), http.StatusNotFound, "/problems/not-found"},
+		{"invalid transition", fmt.Errorf("%w: cannot reserve a car that is sold", services.ErrInvalidTransition), http.StatusConflict, "/problems/invalid-state-transition"},
+		{"conflict", fmt.Errorf("%w: duplicate", services.ErrConflict), http.StatusConflict, "/problems/conflict"},
+		{"validation", fmt.Errorf("%w: bad input", services.ErrValidation), http.StatusUnprocessableEntity, "/problems/validation"},
+		{"precondition", fmt.Errorf("%w: car is at version 2, not 1", services.ErrPrecondition), http.StatusPreconditionFailed, "/problems/precondition-failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serviceErr = tt.err
+
+			// Creating a valid reservation request
+			customer := models.Customer{
+				FullName:    "John Doe",
+				Email:       "john.doe@example.com",
+				PhoneNumber: "1234567890",
+			}
+			body, _ := json.Marshal(customer)
+			req := httptest.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/reserve", bytes.NewBuffer(body))
+			req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+			req.Header.Set("If-Match", "*")
+			rr := httptest.NewRecorder()
+
+			// Calling the handler
+			handlers.ReserveCar(rr, req)
+
+			// Checking the problem details of the response
+			assertProblem(t, rr, tt.status, tt.err.Error())
+
+			var problem handlers.Problem
+			json.Unmarshal(rr.Body.Bytes(), &problem)
+			assert.Equal(t, tt.uri, problem.Type)
+			assert.Equal(t, "/cars/60d5f60e4f1c000088aa828e/reserve", problem.Instance)
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Helper function to create a car with a gallery of the given image IDs, the first of which is its primary image
+func newGalleryCar(id primitive.ObjectID, imageIDs ...string) *models.Car {
+	car := &models.Car{ID: id, Make: "Toyota", Model: "Corolla", Year: 2020, Price: 20000, Status: models.CarStatusAvailable, Version: 3}
+	for i, imageID := range imageIDs {
+		car.Images = append(car.Images, models.CarImage{ID: imageID, Primary: i == 0})
+	}
+	if len(imageIDs) > 0 {
+		car.Picture = imageIDs[0]
+	}
+	return car
+}
+
+func TestAddCarImage(t *testing.T) {
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedImage models.CarImageRequest
+	var receivedData []byte
+	var receivedVersion *int64
+	mockCarService := &MockCarService{
+		AddCarImageFunc: func(id primitive.ObjectID, image models.CarImageRequest, content io.Reader, fileName string, version *int64) (*models.Car, error) {
+			receivedImage, receivedVersion = image, version
+			receivedData, _ = io.ReadAll(content)
+			if id.Hex() == "60c72b2f9b1e8b3e0c6fc1c3" {
+				return nil, fmt.Errorf("%w: car %s already has the maximum of %d images", services.ErrValidation, id.Hex(), models.MaxCarImages)
+			}
+			car := newGalleryCar(id, "60c72b2f9b1e8b3e0c6fc2a1", "60c72b2f9b1e8b3e0c6fc2a2")
+			car.Images[1].Caption = image.Caption
+			return car, nil
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	t.Run("valid image", func(t *testing.T) {
+		// Creating a request uploading an image with a caption
+		req, err := newMultipartRequest("POST", "/cars/60c72b2f9b1e8b3e0c6fc1c1/images", map[string]string{"caption": "Interior", "primary": "false"}, "image", []byte("image data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("If-Match", `"3"`)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.AddCarImage(rr, req)
+
+		// Checking the response status, the received image and the gallery in the body
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "Interior", receivedImage.Caption)
+		assert.False(t, receivedImage.Primary)
+		assert.Equal(t, []byte("image data"), receivedData)
+		if assert.NotNil(t, receivedVersion) {
+			assert.Equal(t, int64(3), *receivedVersion)
+		}
+
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		if assert.Len(t, result.Images, 2) {
+			assert.Equal(t, "Interior", result.Images[1].Caption)
+			assert.Equal(t, "/cars/image/60c72b2f9b1e8b3e0c6fc2a2", result.Images[1].URL)
+			assert.True(t, result.Images[0].Primary)
+		}
+	})
+
+	t.Run("missing image", func(t *testing.T) {
+		// Creating a request without an image file
+		req, err := newMultipartRequest("POST", "/cars/60c72b2f9b1e8b3e0c6fc1c1/images", map[string]string{"caption": "Interior"}, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.AddCarImage(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "image is required\n", rr.Body.String())
+	})
+
+	t.Run("invalid primary flag", func(t *testing.T) {
+		// Creating a request with a primary flag that is not a boolean
+		req, err := newMultipartRequest("POST", "/cars/60c72b2f9b1e8b3e0c6fc1c1/images", map[string]string{"primary": "maybe"}, "image", []byte("image data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.AddCarImage(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "primary must be true or false")
+	})
+
+	t.Run("gallery full", func(t *testing.T) {
+		// Creating a request for a car that already has the maximum number of images
+		req, err := newMultipartRequest("POST", "/cars/60c72b2f9b1e8b3e0c6fc1c3/images", nil, "image", []byte("image data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c3"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.AddCarImage(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusUnprocessableEntity, "maximum of 30 images")
+	})
+}
+
+func TestUpdateCarImage(t *testing.T) {
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedImageID string
+	var receivedUpdate models.CarImageUpdate
+	mockCarService := &MockCarService{
+		UpdateCarImageFunc: func(id primitive.ObjectID, imageID string, update models.CarImageUpdate, version *int64) (*models.Car, error) {
+			receivedImageID, receivedUpdate = imageID, update
+			if imageID != "60c72b2f9b1e8b3e0c6fc2a2" {
+				return nil, fmt.Errorf("%w: car %s has no image %s", services.ErrNotFound, id.Hex(), imageID)
+			}
+			return newGalleryCar(id, "60c72b2f9b1e8b3e0c6fc2a2", "60c72b2f9b1e8b3e0c6fc2a1"), nil
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	newImageRequest := func(imageID, body string) *http.Request {
+		req := httptest.NewRequest("PATCH", "/cars/60c72b2f9b1e8b3e0c6fc1c1/images/"+imageID, bytes.NewBufferString(body))
+		return mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1", "imageId": imageID})
+	}
+
+	t.Run("make image primary", func(t *testing.T) {
+		// Creating a request making the second image primary
+		req := newImageRequest("60c72b2f9b1e8b3e0c6fc2a2", `{"primary": true}`)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCarImage(rr, req)
+
+		// Checking the response status, the received update and the body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "60c72b2f9b1e8b3e0c6fc2a2", receivedImageID)
+		if assert.NotNil(t, receivedUpdate.Primary) {
+			assert.True(t, *receivedUpdate.Primary)
+		}
+		assert.Nil(t, receivedUpdate.Caption)
+
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "60c72b2f9b1e8b3e0c6fc2a2", result.Picture)
+	})
+
+	t.Run("caption too long", func(t *testing.T) {
+		// Creating a request with a caption longer than 200 characters
+		req := newImageRequest("60c72b2f9b1e8b3e0c6fc2a2", fmt.Sprintf(`{"caption": "%0201d"}`, 0))
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCarImage(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Caption")
+	})
+
+	t.Run("unknown image", func(t *testing.T) {
+		// Creating a request for an image the car does not have
+		req := newImageRequest("60c72b2f9b1e8b3e0c6fc2ff", `{"caption": "Front"}`)
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.UpdateCarImage(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusNotFound, "has no image 60c72b2f9b1e8b3e0c6fc2ff")
+	})
+}
+
+func TestRemoveCarImage(t *testing.T) {
+	mockCarService := &MockCarService{
+		RemoveCarImageFunc: func(id primitive.ObjectID, imageID string, version *int64) (*models.Car, error) {
+			if imageID == "60c72b2f9b1e8b3e0c6fc2a1" {
+				return nil, fmt.Errorf("%w: the last image of a car cannot be removed", services.ErrValidation)
+			}
+			return newGalleryCar(id, "60c72b2f9b1e8b3e0c6fc2a1"), nil
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	t.Run("valid removal", func(t *testing.T) {
+		// Creating a request removing an image
+		req := httptest.NewRequest("DELETE", "/cars/60c72b2f9b1e8b3e0c6fc1c1/images/60c72b2f9b1e8b3e0c6fc2a2", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1", "imageId": "60c72b2f9b1e8b3e0c6fc2a2"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.RemoveCarImage(rr, req)
+
+		// Checking the response status and the remaining gallery
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Len(t, result.Images, 1)
+	})
+
+	t.Run("last image", func(t *testing.T) {
+		// Creating a request removing the only image of a car
+		req := httptest.NewRequest("DELETE", "/cars/60c72b2f9b1e8b3e0c6fc1c1/images/60c72b2f9b1e8b3e0c6fc2a1", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1", "imageId": "60c72b2f9b1e8b3e0c6fc2a1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.RemoveCarImage(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusUnprocessableEntity, "last image")
+	})
+
+	t.Run("missing If-Match", func(t *testing.T) {
+		// Creating a request that does not say which version of the car it changes
+		req := httptest.NewRequest("DELETE", "/cars/60c72b2f9b1e8b3e0c6fc1c1/images/60c72b2f9b1e8b3e0c6fc2a2", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1", "imageId": "60c72b2f9b1e8b3e0c6fc2a2"})
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.RemoveCarImage(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusPreconditionRequired, "If-Match header")
+	})
+}
+
+func TestReorderCarImages(t *testing.T) {
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedImageIDs []string
+	mockCarService := &MockCarService{
+		ReorderCarImagesFunc: func(id primitive.ObjectID, imageIDs []string, version *int64) (*models.Car, error) {
+			receivedImageIDs = imageIDs
+			return newGalleryCar(id, imageIDs...), nil
+		},
+	}
+
+	handlers.SetCarService(mockCarService)
+
+	t.Run("valid order", func(t *testing.T) {
+		// Creating a request swapping two images
+		body := `{"imageIds": ["60c72b2f9b1e8b3e0c6fc2a2", "60c72b2f9b1e8b3e0c6fc2a1"]}`
+		req := httptest.NewRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1/images/order", bytes.NewBufferString(body))
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.ReorderCarImages(rr, req)
+
+		// Checking the response status and the received order
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, []string{"60c72b2f9b1e8b3e0c6fc2a2", "60c72b2f9b1e8b3e0c6fc2a1"}, receivedImageIDs)
+	})
+
+	t.Run("empty order", func(t *testing.T) {
+		// Creating a request without any image IDs
+		req := httptest.NewRequest("PUT", "/cars/60c72b2f9b1e8b3e0c6fc1c1/images/order", bytes.NewBufferString(`{"imageIds": []}`))
+		req = mux.SetURLVars(req, map[string]string{"id": "60c72b2f9b1e8b3e0c6fc1c1"})
+		req.Header.Set("If-Match", "*")
+		rr := httptest.NewRecorder()
+
+		// Calling the handler
+		handlers.ReorderCarImages(rr, req)
+
+		// Checking the response status
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
@@ -1,8 +1,15 @@
 package tests
 
 import (
+	"bytes"
 	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -66,6 +73,48 @@ func clearCollection(t *testing.T, db *mongo.Database) {
 		t.Fatalf("Failed to clear cars collection: %v", err)
 	}
 
+	// Clear the "payments" collection
+	err = db.Collection("payments").Drop(context.Background())
+	if err != nil && err != mongo.ErrNoDocuments {
+		t.Fatalf("Failed to clear payments collection: %v", err)
+	}
+
+	// Clear the "sales" collection
+	err = db.Collection("sales").Drop(context.Background())
+	if err != nil && err != mongo.ErrNoDocuments {
+		t.Fatalf("Failed to clear sales collection: %v", err)
+	}
+
+	// Clear the "customers" collection
+	err = db.Collection("customers").Drop(context.Background())
+	if err != nil && err != mongo.ErrNoDocuments {
+		t.Fatalf("Failed to clear customers collection: %v", err)
+	}
+
+	// Clear the "users" collection
+	err = db.Collection("users").Drop(context.Background())
+	if err != nil && err != mongo.ErrNoDocuments {
+		t.Fatalf("Failed to clear users collection: %v", err)
+	}
+
+	// Clear the "sessions" collection
+	err = db.Collection("sessions").Drop(context.Background())
+	if err != nil && err != mongo.ErrNoDocuments {
+		t.Fatalf("Failed to clear sessions collection: %v", err)
+	}
+
+	// Clear the "apiKeys" collection
+	err = db.Collection("apiKeys").Drop(context.Background())
+	if err != nil && err != mongo.ErrNoDocuments {
+		t.Fatalf("Failed to clear apiKeys collection: %v", err)
+	}
+
+	// Clear the "audit" collection
+	err = db.Collection("audit").Drop(context.Background())
+	if err != nil && err != mongo.ErrNoDocuments {
+		t.Fatalf("Failed to clear audit collection: %v", err)
+	}
+
 	// Clear the "fs.files" collection
 	err = db.Collection("fs.files").Drop(context.Background())
 	if err != nil && err != mongo.ErrNoDocuments {
@@ -103,18 +152,169 @@ func TestGetCarsByStatusService(t *testing.T) {
 
 	// Test GetCarsByStatus
 	status := "available"
-	result, err := serviceInterface.GetCarsByStatus(status)
+	result, err := serviceInterface.GetCarsByStatus(status, models.PageRequest{Limit: models.DefaultPageLimit})
 	if err != nil {
 		t.Fatalf("GetCarsByStatus failed: %v", err)
 	}
 
 	// Verify the result
-	assert.Equal(t, 2, len(result), "Expected 2 cars with status 'available'")
-	for _, car := range result {
+	assert.Equal(t, 2, len(result.Items), "Expected 2 cars with status 'available'")
+	assert.Empty(t, result.NextCursor, "Expected no further pages")
+	for _, car := range result.Items {
 		assert.Equal(t, status, car.Status, "Car status does not match")
 	}
 }
 
+// TestSearchCarsService tests searching cars by filters and sorting the results.
+func TestSearchCarsService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+
+	// Insert test data
+	cars := []interface{}{
+		models.Car{ID: primitive.NewObjectID(), Make: "Toyota", Model: "Corolla", Year: 2018, Price: 15000, Status: models.CarStatusAvailable},
+		models.Car{ID: primitive.NewObjectID(), Make: "Toyota", Model: "Camry", Year: 2021, Price: 24000, Status: models.CarStatusAvailable},
+		models.Car{ID: primitive.NewObjectID(), Make: "Honda", Model: "Civic", Year: 2020, Price: 19000, Status: models.CarStatusAvailable},
+		models.Car{ID: primitive.NewObjectID(), Make: "Toyota", Model: "Yaris", Year: 2022, Price: 17000, Status: models.CarStatusSold},
+	}
+	_, err := db.Collection("cars").InsertMany(context.Background(), cars)
+	if err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	// Test SearchCars with make, year range and status filters, sorted by descending price
+	page := models.PageRequest{Limit: models.DefaultPageLimit}
+	result, err := serviceInterface.SearchCars(models.CarQuery{
+		Make:    "toyota",
+		MinYear: 2018,
+		MaxYear: 2022,
+		Status:  models.CarStatusAvailable,
+		Sort:    []models.CarSortField{{Field: "price", Direction: models.SortDescending}},
+	}, page)
+	if err != nil {
+		t.Fatalf("SearchCars failed: %v", err)
+	}
+
+	// Verify the result
+	if assert.Equal(t, 2, len(result.Items), "Expected 2 available Toyotas") {
+		assert.Equal(t, "Camry", result.Items[0].Model, "Cars are not sorted by descending price")
+		assert.Equal(t, "Corolla", result.Items[1].Model, "Cars are not sorted by descending price")
+	}
+
+	// Test SearchCars with free text and price range filters
+	result, err = serviceInterface.SearchCars(models.CarQuery{Text: "CIV", MaxPrice: 20000}, page)
+	if err != nil {
+		t.Fatalf("SearchCars failed: %v", err)
+	}
+	if assert.Equal(t, 1, len(result.Items), "Expected 1 car matching the free text") {
+		assert.Equal(t, "Civic", result.Items[0].Model, "Car Model does not match")
+	}
+}
+
+// TestPaginateCarsService tests walking through search results page by page using cursors.
+func TestPaginateCarsService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+
+	// Insert test data, with two cars sharing a price to exercise the ID tiebreaker
+	cars := []interface{}{
+		models.Car{ID: primitive.NewObjectID(), Make: "Toyota", Model: "Corolla", Price: 15000, Status: models.CarStatusAvailable},
+		models.Car{ID: primitive.NewObjectID(), Make: "Toyota", Model: "Camry", Price: 24000, Status: models.CarStatusAvailable},
+		models.Car{ID: primitive.NewObjectID(), Make: "Honda", Model: "Civic", Price: 19000, Status: models.CarStatusAvailable},
+		models.Car{ID: primitive.NewObjectID(), Make: "Honda", Model: "Accord", Price: 19000, Status: models.CarStatusAvailable},
+		models.Car{ID: primitive.NewObjectID(), Make: "Mazda", Model: "3", Price: 21000, Status: models.CarStatusAvailable},
+	}
+	_, err := db.Collection("cars").InsertMany(context.Background(), cars)
+	if err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	// Walk through the cars sorted by ascending price, two at a time
+	query := models.CarQuery{Sort: []models.CarSortField{{Field: "price", Direction: models.SortAscending}}}
+	page := models.PageRequest{Limit: 2, IncludeTotal: true}
+	var seenModels []string
+	for i := 0; i < 5; i++ {
+		result, err := serviceInterface.SearchCars(query, page)
+		if err != nil {
+			t.Fatalf("SearchCars failed: %v", err)
+		}
+		if assert.NotNil(t, result.Total, "Expected the total to be counted") {
+			assert.Equal(t, int64(5), *result.Total, "Total does not match")
+		}
+		for _, car := range result.Items {
+			seenModels = append(seenModels, car.Model)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		page.Cursor = result.NextCursor
+	}
+
+	// Verify every car was returned exactly once and in order
+	assert.Equal(t, []string{"Corolla", "Civic", "Accord", "3", "Camry"}, seenModels, "Pages do not cover the cars in order")
+
+	// Test that a cursor cannot be reused with a different sort order
+	_, err = serviceInterface.SearchCars(models.CarQuery{}, models.PageRequest{Limit: 2, Cursor: page.Cursor})
+	assert.ErrorIs(t, err, services.ErrInvalidCursor, "Expected ErrInvalidCursor for a mismatched sort order")
+}
+
+// TestGetCarByIDService tests the retrieval of a single car by its ID.
+func TestGetCarByIDService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+
+	// Insert test data
+	carID := primitive.NewObjectID()
+	car := models.Car{
+		ID:     carID,
+		Make:   "Toyota",
+		Model:  "Corolla",
+		Status: models.CarStatusReserved,
+		Customer: &models.Customer{
+			FullName:    "John Doe",
+			Email:       "john.doe@example.com",
+			PhoneNumber: "1234567890",
+		},
+	}
+	_, err := db.Collection("cars").InsertOne(context.Background(), car)
+	if err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	// Test GetCarByID
+	result, err := serviceInterface.GetCarByID(carID)
+	if err != nil {
+		t.Fatalf("GetCarByID failed: %v", err)
+	}
+
+	// Verify the result
+	assert.Equal(t, carID, result.ID, "Car ID does not match")
+	assert.Equal(t, car.Make, result.Make, "Car Make does not match")
+	assert.Equal(t, car.Customer.FullName, result.Customer.FullName, "Customer FullName does not match")
+
+	// Test GetCarByID with an unknown ID
+	_, err = serviceInterface.GetCarByID(primitive.NewObjectID())
+	assert.ErrorIs(t, err, services.ErrNotFound, "Expected ErrNotFound for an unknown car")
+}
+
 // TestGetCarImageService tests retrieving a car image from GridFS.
 func TestGetCarImageService(t *testing.T) {
 	client, db := setupTestDB(t)
@@ -123,14 +323,13 @@ func TestGetCarImageService(t *testing.T) {
 		client.Disconnect(context.Background())
 	}()
 
-	// Create a GridFS bucket
+	// Create a GridFS bucket; the car service keeps images in GridFS unless another image store is set
 	bucket, err := gridfs.NewBucket(db)
 	if err != nil {
 		t.Fatalf("Failed to create GridFS bucket: %v", err)
 	}
 
 	service := services.NewCarServiceInterface(client, testDbName)
-	service.SetGridFSBucket(bucket)
 
 	// Prepare test image data
 	fileData := []byte("test image data for car image")
@@ -154,13 +353,31 @@ func TestGetCarImageService(t *testing.T) {
 	}
 
 	// Test GetCarImage
-	result, err := service.GetCarImage(fileID.Hex())
+	result, err := service.GetCarImage(fileID.Hex(), "")
 	if err != nil {
 		t.Fatalf("GetCarImage failed: %v", err)
 	}
 
-	// Verify the result
-	assert.Equal(t, fileData, result, "Image data does not match")
+	// Verify the result; the content type of files stored without one is sniffed from their data
+	defer result.Content.Close()
+	data, err := io.ReadAll(result.Content)
+	if err != nil {
+		t.Fatalf("Failed to read image data: %v", err)
+	}
+	assert.Equal(t, fileData, data, "Image data does not match")
+	assert.Equal(t, int64(len(fileData)), result.Size, "Image size does not match")
+	assert.Equal(t, fileID.Hex(), result.ID, "Image ID does not match")
+
+	// Test reading a range of the image after seeking back into it
+	if _, err := result.Content.Seek(5, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	part := make([]byte, 5)
+	if _, err := io.ReadFull(result.Content, part); err != nil {
+		t.Fatalf("Failed to read image range: %v", err)
+	}
+	assert.Equal(t, fileData[5:10], part, "Image range does not match")
+	assert.Equal(t, "text/plain; charset=utf-8", result.ContentType, "Content type does not match")
 }
 
 // TestCreateCarService tests creating a new car entry.
@@ -175,7 +392,7 @@ func TestCreateCarService(t *testing.T) {
 	var serviceInterface services.IcarService = service
 
 	// Prepare test data
-	fileData := []byte("test image data")
+	fileData := newTestImage(t, 64, 48)
 	fileName := "testImage.jpg"
 	car := &models.Car{
 		Make:    "Toyota",
@@ -187,19 +404,13 @@ func TestCreateCarService(t *testing.T) {
 	}
 
 	// Test CreateCar
-	result, err := serviceInterface.CreateCar(car, fileData, fileName)
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(fileData), fileName)
 	if err != nil {
 		t.Fatalf("CreateCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.InsertOneResult
-	insertResult, ok := result.(*mongo.InsertOneResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.InsertOneResult, got %T", result)
-	}
-
 	// Verify insertion
-	insertedID := insertResult.InsertedID.(primitive.ObjectID)
+	insertedID := result.ID
 	var insertedCar models.Car
 	err = db.Collection("cars").FindOne(context.Background(), bson.M{"_id": insertedID}).Decode(&insertedCar)
 	if err != nil {
@@ -211,6 +422,24 @@ func TestCreateCarService(t *testing.T) {
 	assert.Equal(t, car.Year, insertedCar.Year, "Car Year does not match")
 	assert.Equal(t, car.Price, insertedCar.Price, "Car Price does not match")
 	assert.Equal(t, car.Status, insertedCar.Status, "Car Status does not match")
+
+	// Test that data that is not an acceptable image is rejected
+	for _, data := range [][]byte{[]byte("not an image"), []byte("\x89PNG\r\n\x1a\nforged"), newTestImage(t, models.MaxImageDimension+1, 10)} {
+		_, err = serviceInterface.CreateCar(&models.Car{Make: "Toyota", Model: "Corolla", Year: 2022, Price: 20000}, bytes.NewReader(data), fileName)
+		assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation for an unacceptable image")
+	}
+
+	// Test that an image larger than the maximum image size is rejected while it is streamed
+	service.SetMaxImageSize(int64(len(fileData)) - 1)
+	_, err = serviceInterface.CreateCar(&models.Car{Make: "Toyota", Model: "Corolla", Year: 2022, Price: 20000}, bytes.NewReader(fileData), fileName)
+	assert.ErrorIs(t, err, services.ErrTooLarge, "Expected ErrTooLarge for an image larger than the maximum image size")
+
+	// Verify that none of the rejected uploads was left in GridFS
+	count, err := db.Collection("fs.files").CountDocuments(context.Background(), bson.M{})
+	if err != nil {
+		t.Fatalf("Failed to count GridFS files: %v", err)
+	}
+	assert.Equal(t, int64(1), count, "Only the image of the created car should be stored")
 }
 
 // TestUpdateCarService tests updating an existing car entry.
@@ -225,7 +454,7 @@ func TestUpdateCarService(t *testing.T) {
 	var serviceInterface services.IcarService = service
 
 	// Create a car to update
-	fileData := []byte("test updated image data")
+	fileData := newTestImage(t, 64, 48)
 	fileName := "updatedImage.jpg"
 	car := &models.Car{
 		Make:    "Toyota",
@@ -236,18 +465,12 @@ func TestUpdateCarService(t *testing.T) {
 		Picture: fileName,
 	}
 
-	result, err := serviceInterface.CreateCar(car, fileData, fileName)
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(fileData), fileName)
 	if err != nil {
 		t.Fatalf("CreateCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.InsertOneResult
-	insertResult, ok := result.(*mongo.InsertOneResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.InsertOneResult, got %T", result)
-	}
-
-	carID := insertResult.InsertedID.(primitive.ObjectID)
+	carID := result.ID
 
 	// Prepare updated car data
 	updatedCar := &models.Car{
@@ -260,20 +483,14 @@ func TestUpdateCarService(t *testing.T) {
 	}
 
 	// Test UpdateCar
-	updateResult, err := serviceInterface.UpdateCar(carID, updatedCar, fileData, fileName)
+	updateResult, err := serviceInterface.UpdateCar(carID, updatedCar, bytes.NewReader(fileData), fileName, nil)
 	if err != nil {
 		t.Fatalf("UpdateCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.UpdateResult
-	updateResultCast, ok := updateResult.(*mongo.UpdateResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.UpdateResult, got %T", updateResult)
-	}
-
-	if updateResultCast.ModifiedCount == 0 {
-		t.Fatalf("Expected 1 car to be updated, got 0")
-	}
+	// Verify the returned car
+	assert.Equal(t, carID, updateResult.ID, "Returned car ID does not match")
+	assert.Equal(t, updatedCar.Model, updateResult.Model, "Returned car Model does not match")
 
 	// Verify update
 	var updatedCarResult models.Car
@@ -287,9 +504,32 @@ func TestUpdateCarService(t *testing.T) {
 	assert.Equal(t, updatedCar.Year, updatedCarResult.Year, "Car Year does not match")
 	assert.Equal(t, updatedCar.Price, updatedCarResult.Price, "Car Price does not match")
 	assert.Equal(t, updatedCar.Status, updatedCarResult.Status, "Car Status does not match")
+
+	// Test that updating without image data keeps the current image
+	picture := updatedCarResult.Picture
+	updateResult, err = serviceInterface.UpdateCar(carID, &models.Car{Make: "Toyota", Model: "Corolla", Year: 2023, Price: 20500}, nil, "", nil)
+	if err != nil {
+		t.Fatalf("UpdateCar failed: %v", err)
+	}
+	assert.Equal(t, picture, updateResult.Picture, "Car Picture should be kept")
+	assert.Equal(t, 20500.0, updateResult.Price, "Car Price does not match")
+
+	// Test that a sold car cannot be updated and keeps its status and details
+	customer := models.Customer{FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}
+	if _, err := serviceInterface.SellCar(carID, models.SaleRequest{Customer: customer}, nil); err != nil {
+		t.Fatalf("SellCar failed: %v", err)
+	}
+	_, err = serviceInterface.UpdateCar(carID, &models.Car{Make: "Toyota", Model: "Corolla", Year: 2023, Price: 1}, nil, "", nil)
+	assert.ErrorIs(t, err, services.ErrCarNotEditable, "Expected ErrCarNotEditable for a sold car")
+	soldCar, err := serviceInterface.GetCarByID(carID)
+	if err != nil {
+		t.Fatalf("GetCarByID failed: %v", err)
+	}
+	assert.Equal(t, models.CarStatusSold, soldCar.Status, "Car Status should not be changed")
+	assert.Equal(t, 20500.0, soldCar.Price, "Car Price should not be changed")
 }
 
-// TestDeleteCarService tests deleting a car entry.
+// TestDeleteCarService tests deleting, restoring and purging a car.
 func TestDeleteCarService(t *testing.T) {
 	client, db := setupTestDB(t)
 	defer func() {
@@ -301,7 +541,7 @@ func TestDeleteCarService(t *testing.T) {
 	var serviceInterface services.IcarService = service
 
 	// Create a car to delete
-	fileData := []byte("test image data")
+	fileData := newTestImage(t, 64, 48)
 	fileName := "testImage.jpg"
 	car := &models.Car{
 		Make:    "Toyota",
@@ -312,40 +552,80 @@ func TestDeleteCarService(t *testing.T) {
 		Picture: fileName,
 	}
 
-	result, err := serviceInterface.CreateCar(car, fileData, fileName)
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(fileData), fileName)
 	if err != nil {
 		t.Fatalf("CreateCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.InsertOneResult
-	insertResult, ok := result.(*mongo.InsertOneResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.InsertOneResult, got %T", result)
-	}
-
-	carID := insertResult.InsertedID.(primitive.ObjectID)
+	carID := result.ID
 
 	// Test DeleteCar
-	deleteResult, err := serviceInterface.DeleteCar(carID)
+	err = serviceInterface.DeleteCar(carID, nil)
 	if err != nil {
 		t.Fatalf("DeleteCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.DeleteResult
-	deleteResultCast, ok := deleteResult.(*mongo.DeleteResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.DeleteResult, got %T", deleteResult)
+	// Verify that the car is archived as deleted and left out of listings unless asked for
+	deletedCar, err := serviceInterface.GetCarByID(carID)
+	if err != nil {
+		t.Fatalf("GetCarByID failed: %v", err)
+	}
+	assert.Equal(t, models.CarStatusArchived, deletedCar.Status, "A deleted car should be archived")
+	assert.NotNil(t, deletedCar.DeletedAt, "A deleted car should record when it was deleted")
+	page, err := serviceInterface.SearchCars(models.CarQuery{}, models.PageRequest{})
+	if err != nil {
+		t.Fatalf("SearchCars failed: %v", err)
+	}
+	assert.Empty(t, page.Items, "Deleted cars should be left out of searches")
+	page, err = serviceInterface.GetCarsByStatus(models.CarStatusArchived, models.PageRequest{})
+	if err != nil {
+		t.Fatalf("GetCarsByStatus failed: %v", err)
+	}
+	assert.Empty(t, page.Items, "Deleted cars should be left out of listings by status")
+	page, err = serviceInterface.SearchCars(models.CarQuery{Deleted: models.DeletedCarsOnly}, models.PageRequest{})
+	if err != nil {
+		t.Fatalf("SearchCars failed: %v", err)
+	}
+	if assert.Len(t, page.Items, 1, "Deleted cars should be found when asked for") {
+		assert.Equal(t, carID, page.Items[0].ID)
+	}
+
+	// Test that a deleted car has to be restored before it can be changed
+	_, err = serviceInterface.ChangeCarStatus(carID, models.CarStatusAvailable, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidTransition, "Expected ErrInvalidTransition when changing the status of a deleted car")
+
+	// Test RestoreCar
+	restoredCar, err := serviceInterface.RestoreCar(carID, &deletedCar.Version)
+	if err != nil {
+		t.Fatalf("RestoreCar failed: %v", err)
 	}
+	assert.Equal(t, models.CarStatusAvailable, restoredCar.Status, "A restored car should be available")
+	assert.Nil(t, restoredCar.DeletedAt, "A restored car should no longer be deleted")
+	_, err = serviceInterface.RestoreCar(carID, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidTransition, "Expected ErrInvalidTransition when restoring a car that is not deleted")
 
-	if deleteResultCast.DeletedCount == 0 {
-		t.Fatalf("Expected 1 car to be deleted, got 0")
+	// Test that only cars deleted before the retention period are purged
+	if err := serviceInterface.DeleteCar(carID, nil); err != nil {
+		t.Fatalf("DeleteCar failed: %v", err)
+	}
+	purged, err := serviceInterface.PurgeDeletedCars(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("PurgeDeletedCars failed: %v", err)
+	}
+	assert.Empty(t, purged, "A recently deleted car should not be purged")
+	purged, err = serviceInterface.PurgeDeletedCars(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("PurgeDeletedCars failed: %v", err)
 	}
+	assert.Len(t, purged, 1, "The deleted car should be purged")
 
-	// Verify deletion
+	// Verify that the car and its image are gone
 	err = db.Collection("cars").FindOne(context.Background(), bson.M{"_id": carID}).Decode(&models.Car{})
 	if err != mongo.ErrNoDocuments {
 		t.Fatalf("Expected no documents, but found one: %v", err)
 	}
+	_, err = serviceInterface.GetCarImage(result.Picture, "")
+	assert.ErrorIs(t, err, services.ErrNotFound, "The image of a purged car should be deleted from GridFS")
 }
 
 // TestReserveCarService tests reserving a car.
@@ -360,7 +640,7 @@ func TestReserveCarService(t *testing.T) {
 	var serviceInterface services.IcarService = service
 
 	// Create a car to reserve
-	fileData := []byte("test image data")
+	fileData := newTestImage(t, 64, 48)
 	fileName := "testImage.jpg"
 	car := &models.Car{
 		Make:    "Toyota",
@@ -371,18 +651,12 @@ func TestReserveCarService(t *testing.T) {
 		Picture: fileName,
 	}
 
-	result, err := serviceInterface.CreateCar(car, fileData, fileName)
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(fileData), fileName)
 	if err != nil {
 		t.Fatalf("CreateCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.InsertOneResult
-	insertResult, ok := result.(*mongo.InsertOneResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.InsertOneResult, got %T", result)
-	}
-
-	carID := insertResult.InsertedID.(primitive.ObjectID)
+	carID := result.ID
 
 	// Prepare customer data
 	customer := models.Customer{
@@ -392,20 +666,14 @@ func TestReserveCarService(t *testing.T) {
 	}
 
 	// Test ReserveCar
-	reserveResult, err := serviceInterface.ReserveCar(carID, customer)
+	reserveResult, err := serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: customer}, nil)
 	if err != nil {
 		t.Fatalf("ReserveCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.UpdateResult
-	reserveResultCast, ok := reserveResult.(*mongo.UpdateResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.UpdateResult, got %T", reserveResult)
-	}
-
-	if reserveResultCast.ModifiedCount == 0 {
-		t.Fatalf("Expected 1 car to be reserved, got 0")
-	}
+	// Verify the returned car
+	assert.Equal(t, carID, reserveResult.ID, "Returned car ID does not match")
+	assert.Equal(t, models.CarStatusReserved, reserveResult.Status, "Returned car Status does not match")
 
 	// Verify reservation
 	var reservedCar models.Car
@@ -432,7 +700,7 @@ func TestReserveAndCancelCarService(t *testing.T) {
 	var serviceInterface services.IcarService = service
 
 	// Create a car to reserve
-	fileData := []byte("test image data")
+	fileData := newTestImage(t, 64, 48)
 	fileName := "testImage.jpg"
 	car := &models.Car{
 		Make:    "Toyota",
@@ -443,18 +711,12 @@ func TestReserveAndCancelCarService(t *testing.T) {
 		Picture: fileName,
 	}
 
-	result, err := serviceInterface.CreateCar(car, fileData, fileName)
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(fileData), fileName)
 	if err != nil {
 		t.Fatalf("CreateCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.InsertOneResult
-	insertResult, ok := result.(*mongo.InsertOneResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.InsertOneResult, got %T", result)
-	}
-
-	carID := insertResult.InsertedID.(primitive.ObjectID)
+	carID := result.ID
 
 	// Prepare customer data
 	customer := models.Customer{
@@ -464,20 +726,14 @@ func TestReserveAndCancelCarService(t *testing.T) {
 	}
 
 	// Test ReserveCar
-	reserveResult, err := serviceInterface.ReserveCar(carID, customer)
+	reserveResult, err := serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: customer}, nil)
 	if err != nil {
 		t.Fatalf("ReserveCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.UpdateResult
-	reserveResultCast, ok := reserveResult.(*mongo.UpdateResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.UpdateResult, got %T", reserveResult)
-	}
-
-	if reserveResultCast.ModifiedCount == 0 {
-		t.Fatalf("Expected 1 car to be reserved, got 0")
-	}
+	// Verify the returned car
+	assert.Equal(t, carID, reserveResult.ID, "Returned car ID does not match")
+	assert.Equal(t, models.CarStatusReserved, reserveResult.Status, "Returned car Status does not match")
 
 	// Verify reservation
 	var reservedCar models.Car
@@ -492,20 +748,14 @@ func TestReserveAndCancelCarService(t *testing.T) {
 	assert.Equal(t, customer.PhoneNumber, reservedCar.Customer.PhoneNumber, "Customer PhoneNumber does not match")
 
 	// Test CancelReservation
-	cancelResult, err := serviceInterface.CancelReservation(carID)
+	cancelResult, err := serviceInterface.CancelReservation(carID, nil)
 	if err != nil {
 		t.Fatalf("CancelReservation failed: %v", err)
 	}
 
-	// Cast result to *mongo.UpdateResult
-	cancelResultCast, ok := cancelResult.(*mongo.UpdateResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.UpdateResult, got %T", cancelResult)
-	}
-
-	if cancelResultCast.ModifiedCount == 0 {
-		t.Fatalf("Expected 1 reservation to be canceled, got 0")
-	}
+	// Verify the returned car
+	assert.Equal(t, carID, cancelResult.ID, "Returned car ID does not match")
+	assert.Equal(t, models.CarStatusAvailable, cancelResult.Status, "Returned car Status does not match")
 
 	// Verify cancellation
 	var canceledCar models.Car
@@ -530,7 +780,7 @@ func TestSellCarService(t *testing.T) {
 	var serviceInterface services.IcarService = service
 
 	// Create a car to sell
-	fileData := []byte("test image data")
+	fileData := newTestImage(t, 64, 48)
 	fileName := "testImage.jpg"
 	car := &models.Car{
 		Make:    "Honda",
@@ -541,18 +791,12 @@ func TestSellCarService(t *testing.T) {
 		Picture: fileName,
 	}
 
-	result, err := serviceInterface.CreateCar(car, fileData, fileName)
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(fileData), fileName)
 	if err != nil {
 		t.Fatalf("CreateCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.InsertOneResult
-	insertResult, ok := result.(*mongo.InsertOneResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.InsertOneResult, got %T", result)
-	}
-
-	carID := insertResult.InsertedID.(primitive.ObjectID)
+	carID := result.ID
 
 	// Prepare customer data
 	customer := &models.Customer{
@@ -562,20 +806,14 @@ func TestSellCarService(t *testing.T) {
 	}
 
 	// Test SellCar
-	sellResult, err := serviceInterface.SellCar(carID, *customer)
+	sellResult, err := serviceInterface.SellCar(carID, models.SaleRequest{Customer: *customer}, nil)
 	if err != nil {
 		t.Fatalf("SellCar failed: %v", err)
 	}
 
-	// Cast result to *mongo.UpdateResult
-	sellResultCast, ok := sellResult.(*mongo.UpdateResult)
-	if !ok {
-		t.Fatalf("Expected *mongo.UpdateResult, got %T", sellResult)
-	}
-
-	if sellResultCast.ModifiedCount == 0 {
-		t.Fatalf("Expected 1 car to be sold, got 0")
-	}
+	// Verify the returned car
+	assert.Equal(t, carID, sellResult.ID, "Returned car ID does not match")
+	assert.Equal(t, models.CarStatusSold, sellResult.Status, "Returned car Status does not match")
 
 	// Verify sale
 	var soldCar models.Car
@@ -588,4 +826,1072 @@ func TestSellCarService(t *testing.T) {
 	assert.Equal(t, customer.FullName, soldCar.Customer.FullName, "Customer FullName does not match")
 	assert.Equal(t, customer.Email, soldCar.Customer.Email, "Customer Email does not match")
 	assert.Equal(t, customer.PhoneNumber, soldCar.Customer.PhoneNumber, "Customer PhoneNumber does not match")
+
+	// Test that a sold car can no longer be reserved or deleted
+	_, err = serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: *customer}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidTransition, "Expected ErrInvalidTransition when reserving a sold car")
+	err = serviceInterface.DeleteCar(carID, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidTransition, "Expected ErrInvalidTransition when deleting a sold car")
+
+	// Test that selling an unknown car reports that it does not exist
+	_, err = serviceInterface.SellCar(primitive.NewObjectID(), models.SaleRequest{Customer: *customer}, nil)
+	assert.ErrorIs(t, err, services.ErrNotFound, "Expected ErrNotFound when selling an unknown car")
+}
+
+// TestCarLifecycleService tests selling a reserved car, returning it and moving it through the remaining statuses.
+func TestCarLifecycleService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+
+	// Create a car and reserve it
+	car := &models.Car{
+		Make:    "Mazda",
+		Model:   "3",
+		Year:    2022,
+		Price:   21000,
+		Status:  models.CarStatusAvailable,
+		Picture: "testImage.jpg",
+	}
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(newTestImage(t, 64, 48)), "testImage.jpg")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	carID := result.ID
+
+	customer := models.Customer{
+		FullName:    "John Doe",
+		Email:       "john.doe@example.com",
+		PhoneNumber: "1234567890",
+	}
+	if _, err := serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: customer}, nil); err != nil {
+		t.Fatalf("ReserveCar failed: %v", err)
+	}
+
+	// Test that a reserved car cannot be sold to another customer
+	otherCustomer := models.Customer{
+		FullName:    "Jane Doe",
+		Email:       "jane.doe@example.com",
+		PhoneNumber: "0987654321",
+	}
+	_, err = serviceInterface.SellCar(carID, models.SaleRequest{Customer: otherCustomer}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidTransition, "Expected ErrInvalidTransition when selling a reserved car to another customer")
+
+	// Test selling the reserved car to the customer who reserved it
+	customer.Email = "John.Doe@Example.com"
+	soldCar, err := serviceInterface.SellCar(carID, models.SaleRequest{Customer: customer}, nil)
+	if err != nil {
+		t.Fatalf("SellCar failed: %v", err)
+	}
+	assert.Equal(t, models.CarStatusSold, soldCar.Status, "Car Status does not match")
+
+	// Test returning the sold car
+	returnedCar, err := serviceInterface.ReturnCar(carID, nil)
+	if err != nil {
+		t.Fatalf("ReturnCar failed: %v", err)
+	}
+	assert.Equal(t, models.CarStatusInPreparation, returnedCar.Status, "Car Status does not match")
+	assert.Nil(t, returnedCar.Customer, "Customer information should be cleared")
+
+	// Test that a car in preparation cannot be reserved
+	_, err = serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: customer}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidTransition, "Expected ErrInvalidTransition when reserving a car in preparation")
+
+	// Test moving the car through the statuses that do not involve a customer
+	for _, status := range []string{models.CarStatusAvailable, models.CarStatusArchived, models.CarStatusInPreparation} {
+		changedCar, err := serviceInterface.ChangeCarStatus(carID, status, nil)
+		if err != nil {
+			t.Fatalf("ChangeCarStatus to %s failed: %v", status, err)
+		}
+		assert.Equal(t, status, changedCar.Status, "Car Status does not match")
+	}
+
+	// Test that statuses with their own action cannot be set directly
+	_, err = serviceInterface.ChangeCarStatus(carID, models.CarStatusSold, nil)
+	assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation when setting the sold status directly")
+}
+
+// TestReservationExpiryService tests extending a reservation and releasing it once it has expired.
+func TestReservationExpiryService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+	serviceInterface.SetReservationHoldPeriod(time.Hour)
+
+	// Create a car and reserve it
+	car := &models.Car{
+		Make:    "Kia",
+		Model:   "Ceed",
+		Year:    2021,
+		Price:   17000,
+		Status:  models.CarStatusAvailable,
+		Picture: "testImage.jpg",
+	}
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(newTestImage(t, 64, 48)), "testImage.jpg")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	carID := result.ID
+
+	customer := models.Customer{
+		FullName:    "John Doe",
+		Email:       "john.doe@example.com",
+		PhoneNumber: "1234567890",
+	}
+	reservedCar, err := serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: customer}, nil)
+	if err != nil {
+		t.Fatalf("ReserveCar failed: %v", err)
+	}
+	if assert.NotNil(t, reservedCar.Reservation, "Reservation should be set") {
+		assert.Equal(t, time.Hour, reservedCar.Reservation.ExpiresAt.Sub(reservedCar.Reservation.ReservedAt), "Reservation hold period does not match")
+	}
+	expiresAt := reservedCar.Reservation.ExpiresAt
+
+	// Test that a reservation can only be extended up to one hold period from now
+	_, err = serviceInterface.ExtendReservation(carID, expiresAt.Add(-time.Minute), nil)
+	assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation when moving the expiry backwards")
+	_, err = serviceInterface.ExtendReservation(carID, time.Now().Add(2*time.Hour), nil)
+	assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation when extending beyond the hold period")
+
+	extendedCar, err := serviceInterface.ExtendReservation(carID, expiresAt.Add(time.Second), nil)
+	if err != nil {
+		t.Fatalf("ExtendReservation failed: %v", err)
+	}
+	assert.True(t, extendedCar.Reservation.ExpiresAt.After(expiresAt), "Reservation should be extended")
+	expiresAt = extendedCar.Reservation.ExpiresAt
+
+	// Test that reservations that have not expired are kept
+	released, err := serviceInterface.ExpireReservations(expiresAt.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("ExpireReservations failed: %v", err)
+	}
+	assert.Empty(t, released, "No reservation should be released before it expires")
+
+	// Test releasing the expired reservation
+	released, err = serviceInterface.ExpireReservations(expiresAt)
+	if err != nil {
+		t.Fatalf("ExpireReservations failed: %v", err)
+	}
+	if assert.Len(t, released, 1, "The expired reservation should be released") {
+		assert.Equal(t, carID, released[0].ID, "Released car ID does not match")
+	}
+
+	var releasedCar models.Car
+	err = db.Collection("cars").FindOne(context.Background(), bson.M{"_id": carID}).Decode(&releasedCar)
+	if err != nil {
+		t.Fatalf("Failed to find released car: %v", err)
+	}
+	assert.Equal(t, models.CarStatusAvailable, releasedCar.Status, "Car Status does not match")
+	assert.Equal(t, models.StatusReasonReservationExpired, releasedCar.StatusReason, "Car StatusReason does not match")
+	assert.Nil(t, releasedCar.Customer, "Customer information should be cleared")
+	assert.Nil(t, releasedCar.Reservation, "Reservation should be cleared")
+
+	// Test that an available car has no reservation to extend
+	_, err = serviceInterface.ExtendReservation(carID, time.Now().Add(time.Minute), nil)
+	assert.ErrorIs(t, err, services.ErrInvalidTransition, "Expected ErrInvalidTransition when extending a reservation of an available car")
+}
+
+// TestPaymentsService tests recording deposits and sale payments, refunds and the balance due.
+func TestPaymentsService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+	var paymentService services.IpaymentService = services.NewPaymentServiceInterface(client, testDbName)
+	auditService := services.NewAuditServiceInterface(client, testDbName)
+
+	// Create a car
+	car := &models.Car{
+		Make:    "Skoda",
+		Model:   "Octavia",
+		Year:    2023,
+		Price:   25000,
+		Status:  models.CarStatusAvailable,
+		Picture: "testImage.jpg",
+	}
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(newTestImage(t, 64, 48)), "testImage.jpg")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	carID := result.ID
+
+	customer := models.Customer{
+		FullName:    "John Doe",
+		Email:       "john.doe@example.com",
+		PhoneNumber: "1234567890",
+	}
+
+	// Test that payments cannot be recorded for an available car
+	_, err = paymentService.RecordPayment(carID, models.PaymentRequest{Amount: 100, Method: models.PaymentMethodCash})
+	assert.ErrorIs(t, err, services.ErrInvalidTransition, "Expected ErrInvalidTransition when paying for an available car")
+
+	// Test that a deposit larger than the price is rejected and the car stays available
+	_, err = serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: customer, Deposit: &models.PaymentRequest{Amount: 30000, Method: models.PaymentMethodCard}}, nil)
+	assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation for a deposit larger than the price")
+
+	// Reserve the car with a deposit and cancel the reservation
+	_, err = serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: customer, Deposit: &models.PaymentRequest{Amount: 1000, Method: models.PaymentMethodCard}}, nil)
+	if err != nil {
+		t.Fatalf("ReserveCar failed: %v", err)
+	}
+	balance, err := paymentService.GetBalance(carID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	assert.Equal(t, 1000.0, balance.Paid, "Paid amount does not match")
+	assert.Equal(t, 24000.0, balance.BalanceDue, "Balance due does not match")
+
+	if _, err := serviceInterface.CancelReservation(carID, nil); err != nil {
+		t.Fatalf("CancelReservation failed: %v", err)
+	}
+	payments, err := paymentService.GetPaymentsByCar(carID)
+	if err != nil {
+		t.Fatalf("GetPaymentsByCar failed: %v", err)
+	}
+	if assert.Len(t, payments, 2, "Deposit and refund should be recorded") {
+		assert.Equal(t, models.PaymentTypeDeposit, payments[0].Type, "First payment should be the deposit")
+		assert.Equal(t, models.PaymentTypeRefund, payments[1].Type, "Second payment should be the refund")
+		assert.Equal(t, payments[0].ID, *payments[1].RefundOf, "Refund should reference the deposit")
+	}
+
+	// Reserve the car again, sell it with a partial payment and pay the rest
+	_, err = serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: customer, Deposit: &models.PaymentRequest{Amount: 2000, Method: models.PaymentMethodCash}}, nil)
+	if err != nil {
+		t.Fatalf("ReserveCar failed: %v", err)
+	}
+	_, err = serviceInterface.SellCar(carID, models.SaleRequest{Customer: customer, Payments: []models.PaymentRequest{{Amount: 20000, Method: models.PaymentMethodFinancing}}}, nil)
+	if err != nil {
+		t.Fatalf("SellCar failed: %v", err)
+	}
+
+	// Test that concurrent payments cannot together exceed the balance due of 3000
+	var wg sync.WaitGroup
+	paymentErrs := make([]error, 2)
+	for i := range paymentErrs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, paymentErrs[i] = paymentService.RecordPayment(carID, models.PaymentRequest{Amount: 2000, Method: models.PaymentMethodCash})
+		}(i)
+	}
+	wg.Wait()
+	recorded := 0
+	for _, err := range paymentErrs {
+		if err == nil {
+			recorded++
+		}
+	}
+	assert.Equal(t, 1, recorded, "Only one of the concurrent payments should be recorded")
+
+	_, err = paymentService.RecordPayment(carID, models.PaymentRequest{Amount: 1000.01, Method: models.PaymentMethodBankTransfer})
+	assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation when paying more than the balance due")
+	payment, err := paymentService.RecordPayment(carID, models.PaymentRequest{Amount: 1000, Method: models.PaymentMethodBankTransfer})
+	if err != nil {
+		t.Fatalf("RecordPayment failed: %v", err)
+	}
+	assert.Equal(t, models.PaymentTypeSale, payment.Type, "Payment type does not match")
+
+	// Test that the payment is recorded in the audit log of the car
+	page, err := auditService.GetAuditEntries(models.AuditQuery{CarID: &carID}, models.PageRequest{Limit: 1})
+	if err != nil {
+		t.Fatalf("GetAuditEntries failed: %v", err)
+	}
+	if assert.Len(t, page.Items, 1) {
+		assert.Equal(t, models.AuditActionPayment, page.Items[0].Action)
+		assert.Nil(t, page.Items[0].Before)
+		assert.Equal(t, 1000.0, page.Items[0].After["amount"])
+	}
+
+	balance, err = paymentService.GetBalance(carID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	assert.Equal(t, 25000.0, balance.Paid, "Paid amount does not match")
+	assert.Equal(t, 0.0, balance.BalanceDue, "Balance due does not match")
+
+	// Test that returning the car refunds its payments
+	if _, err := serviceInterface.ReturnCar(carID, nil); err != nil {
+		t.Fatalf("ReturnCar failed: %v", err)
+	}
+	balance, err = paymentService.GetBalance(carID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	assert.Equal(t, 0.0, balance.Paid, "Payments should be refunded")
+
+	// Test that the payments of an unknown car cannot be fetched
+	_, err = paymentService.GetPaymentsByCar(primitive.NewObjectID())
+	assert.ErrorIs(t, err, services.ErrNotFound, "Expected ErrNotFound for an unknown car")
+}
+
+// TestSalesLedgerService tests that selling a car records a sale that is kept when the car changes afterwards.
+func TestSalesLedgerService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+	var saleService services.IsaleService = services.NewSaleServiceInterface(client, testDbName)
+	var paymentService services.IpaymentService = services.NewPaymentServiceInterface(client, testDbName)
+
+	// Create a car
+	car := &models.Car{
+		Make:    "Volvo",
+		Model:   "XC40",
+		Year:    2023,
+		Price:   40000,
+		Status:  models.CarStatusAvailable,
+		Picture: "testImage.jpg",
+	}
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(newTestImage(t, 64, 48)), "testImage.jpg")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	carID := result.ID
+
+	customer := models.Customer{
+		FullName:    "John Doe",
+		Email:       "john.doe@example.com",
+		PhoneNumber: "1234567890",
+	}
+
+	// Test that a failed sale records neither the sale nor its payments
+	price := 38000.0
+	_, err = serviceInterface.SellCar(carID, models.SaleRequest{Customer: customer, Price: &price, Payments: []models.PaymentRequest{{Amount: 39000, Method: models.PaymentMethodCard}}}, nil)
+	assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation for payments above the agreed price")
+	sales, err := saleService.GetSales(models.SaleQuery{CarID: &carID}, models.PageRequest{})
+	if err != nil {
+		t.Fatalf("GetSales failed: %v", err)
+	}
+	assert.Empty(t, sales.Items, "No sale should be recorded for a failed sale")
+
+	// Sell the car for an agreed price as the salesperson Ana
+	salesperson := models.Actor{Name: "Ana", Kind: models.ActorKindUser}
+	_, err = serviceInterface.WithActor(salesperson).SellCar(carID, models.SaleRequest{
+		Customer: customer,
+		Price:    &price,
+		Payments: []models.PaymentRequest{{Amount: 8000, Method: models.PaymentMethodCard}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("SellCar failed: %v", err)
+	}
+
+	sales, err = saleService.GetSales(models.SaleQuery{CarID: &carID}, models.PageRequest{IncludeTotal: true})
+	if err != nil {
+		t.Fatalf("GetSales failed: %v", err)
+	}
+	if !assert.Len(t, sales.Items, 1, "The sale should be recorded") {
+		return
+	}
+	sale := sales.Items[0]
+	assert.Equal(t, int64(1), *sales.Total, "Total does not match")
+	assert.Equal(t, "Volvo", sale.Car.Make, "Sale car Make does not match")
+	assert.Equal(t, 40000.0, sale.Car.ListPrice, "Sale car ListPrice does not match")
+	assert.Equal(t, 38000.0, sale.Price, "Sale Price does not match")
+	assert.Equal(t, 8000.0, sale.Paid, "Sale Paid does not match")
+	assert.Equal(t, "Ana", sale.Salesperson, "Sale Salesperson does not match")
+	assert.Equal(t, customer.Email, sale.Customer.Email, "Sale Customer does not match")
+	assert.False(t, sale.Customer.ID.IsZero(), "Sale Customer should reference the stored customer")
+
+	// Test that the balance of the sold car is calculated against the agreed price
+	balance, err := paymentService.GetBalance(carID)
+	if err != nil {
+		t.Fatalf("GetBalance failed: %v", err)
+	}
+	assert.Equal(t, 30000.0, balance.BalanceDue, "Balance due does not match")
+
+	// Test that the sale is kept unchanged after the car is returned and edited
+	if _, err := serviceInterface.ReturnCar(carID, nil); err != nil {
+		t.Fatalf("ReturnCar failed: %v", err)
+	}
+	_, err = db.Collection("cars").UpdateOne(context.Background(), bson.M{"_id": carID}, bson.M{"$set": bson.M{"make": "Polestar", "price": 35000}})
+	if err != nil {
+		t.Fatalf("Failed to edit car: %v", err)
+	}
+	storedSale, err := saleService.GetSaleByID(sale.ID)
+	if err != nil {
+		t.Fatalf("GetSaleByID failed: %v", err)
+	}
+	assert.Equal(t, "Volvo", storedSale.Car.Make, "Sale should keep the car as it was sold")
+	assert.Equal(t, 38000.0, storedSale.Price, "Sale should keep the agreed price")
+
+	// Test that an unknown sale reports that it does not exist
+	_, err = saleService.GetSaleByID(primitive.NewObjectID())
+	assert.ErrorIs(t, err, services.ErrNotFound, "Expected ErrNotFound for an unknown sale")
+}
+
+// TestCustomersService tests managing customers and reserving and selling cars to stored customers.
+func TestCustomersService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+	var customerService services.IcustomerService = services.NewCustomerServiceInterface(client, testDbName)
+
+	// Create a customer
+	customer, err := customerService.CreateCustomer(models.Customer{
+		FullName:    "John Doe",
+		Email:       "john.doe@example.com",
+		PhoneNumber: "1234567890",
+	})
+	if err != nil {
+		t.Fatalf("CreateCustomer failed: %v", err)
+	}
+	assert.False(t, customer.ID.IsZero(), "Customer ID should be set")
+
+	// Test that customers are deduplicated by normalized email address and phone number
+	_, err = customerService.CreateCustomer(models.Customer{FullName: "Johnny Doe", Email: " John.Doe@Example.com ", PhoneNumber: "5550000000"})
+	assert.ErrorIs(t, err, services.ErrConflict, "Expected ErrConflict for a duplicate email address")
+	_, err = customerService.CreateCustomer(models.Customer{FullName: "Johnny Doe", Email: "johnny@example.com", PhoneNumber: "1234567890"})
+	assert.ErrorIs(t, err, services.ErrConflict, "Expected ErrConflict for a duplicate phone number")
+
+	// Create two cars
+	var carIDs []primitive.ObjectID
+	for _, carMake := range []string{"Skoda", "Seat"} {
+		car := &models.Car{Make: carMake, Model: "Test", Year: 2022, Price: 20000, Status: models.CarStatusAvailable, Picture: "testImage.jpg"}
+		result, err := serviceInterface.CreateCar(car, bytes.NewReader(newTestImage(t, 64, 48)), "testImage.jpg")
+		if err != nil {
+			t.Fatalf("CreateCar failed: %v", err)
+		}
+		carIDs = append(carIDs, result.ID)
+	}
+
+	// Test reserving a car for an existing customer
+	reservedCar, err := serviceInterface.ReserveCar(carIDs[0], models.ReservationRequest{CustomerID: &customer.ID}, nil)
+	if err != nil {
+		t.Fatalf("ReserveCar failed: %v", err)
+	}
+	assert.Equal(t, *customer, *reservedCar.Customer, "Reserved car Customer does not match")
+
+	// Test that reserving for an unknown customer is rejected
+	unknownID := primitive.NewObjectID()
+	_, err = serviceInterface.ReserveCar(carIDs[1], models.ReservationRequest{CustomerID: &unknownID}, nil)
+	assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation for an unknown customer")
+
+	// Test that reservations and sales that fail leave the customers unchanged
+	jane := models.Customer{FullName: "Jane Roe", Email: "jane.roe@example.com", PhoneNumber: "5551234567"}
+	_, err = serviceInterface.SellCar(carIDs[0], models.SaleRequest{Customer: jane}, nil)
+	assert.ErrorIs(t, err, services.ErrInvalidTransition, "Expected ErrInvalidTransition when selling a car reserved for another customer")
+	_, err = serviceInterface.ReserveCar(carIDs[1], models.ReservationRequest{Customer: jane, Deposit: &models.PaymentRequest{Amount: 30000, Method: models.PaymentMethodCash}}, nil)
+	assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation for a deposit larger than the price")
+	janes, err := customerService.GetCustomers(models.CustomerQuery{Text: "jane"}, models.PageRequest{})
+	if err != nil {
+		t.Fatalf("GetCustomers failed: %v", err)
+	}
+	assert.Empty(t, janes.Items, "The customer of a failed reservation or sale should not be stored")
+
+	// Test that inline customer details update the matching customer instead of creating a new one
+	soldCar, err := serviceInterface.SellCar(carIDs[1], models.SaleRequest{Customer: models.Customer{FullName: "John A. Doe", Email: "JOHN.DOE@example.com", PhoneNumber: "1234567890"}}, nil)
+	if err != nil {
+		t.Fatalf("SellCar failed: %v", err)
+	}
+	assert.Equal(t, customer.ID, soldCar.Customer.ID, "Sold car should reference the existing customer")
+	storedCustomer, err := customerService.GetCustomerByID(customer.ID)
+	if err != nil {
+		t.Fatalf("GetCustomerByID failed: %v", err)
+	}
+	assert.Equal(t, "John A. Doe", storedCustomer.FullName, "Customer FullName should be updated")
+
+	customers, err := customerService.GetCustomers(models.CustomerQuery{Text: "doe"}, models.PageRequest{IncludeTotal: true})
+	if err != nil {
+		t.Fatalf("GetCustomers failed: %v", err)
+	}
+	assert.Equal(t, int64(1), *customers.Total, "Only one customer should be stored")
+
+	// Test that the cars of a customer can be listed
+	page, err := serviceInterface.SearchCars(models.CarQuery{CustomerID: &customer.ID}, models.PageRequest{})
+	if err != nil {
+		t.Fatalf("SearchCars failed: %v", err)
+	}
+	assert.Len(t, page.Items, 2, "Both cars should belong to the customer")
+
+	// Test that a customer with a reserved car cannot be deleted
+	err = customerService.DeleteCustomer(customer.ID)
+	assert.ErrorIs(t, err, services.ErrConflict, "Expected ErrConflict for a customer with a reserved car")
+
+	if _, err := serviceInterface.CancelReservation(carIDs[0], nil); err != nil {
+		t.Fatalf("CancelReservation failed: %v", err)
+	}
+	if err := customerService.DeleteCustomer(customer.ID); err != nil {
+		t.Fatalf("DeleteCustomer failed: %v", err)
+	}
+	_, err = customerService.GetCustomerByID(customer.ID)
+	assert.ErrorIs(t, err, services.ErrNotFound, "Expected ErrNotFound for a deleted customer")
+}
+
+// TestCarVersionService tests that every change increments the version of a car and that stale versions are rejected.
+func TestCarVersionService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+
+	// Create a car
+	car := &models.Car{
+		Make:    "Honda",
+		Model:   "Civic",
+		Year:    2021,
+		Price:   19000,
+		Status:  models.CarStatusAvailable,
+		Picture: "testImage.jpg",
+	}
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(newTestImage(t, 64, 48)), "testImage.jpg")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	carID := result.ID
+	assert.Equal(t, int64(1), result.Version, "A new car should be at version 1")
+
+	// Test updating the car at its current version
+	version := result.Version
+	updatedCar := &models.Car{Make: "Honda", Model: "Civic", Year: 2021, Price: 18500, Picture: result.Picture}
+	updateResult, err := serviceInterface.UpdateCar(carID, updatedCar, nil, "", &version)
+	if err != nil {
+		t.Fatalf("UpdateCar failed: %v", err)
+	}
+	assert.Equal(t, int64(2), updateResult.Version, "Updating should increment the version")
+
+	// Test that changes based on the previous version are rejected
+	updatedCar = &models.Car{Make: "Honda", Model: "Civic", Year: 2021, Price: 15000, Picture: result.Picture}
+	_, err = serviceInterface.UpdateCar(carID, updatedCar, nil, "", &version)
+	assert.ErrorIs(t, err, services.ErrPrecondition, "Expected ErrPrecondition for a stale update")
+	_, err = serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: models.Customer{FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}}, &version)
+	assert.ErrorIs(t, err, services.ErrPrecondition, "Expected ErrPrecondition for a stale reservation")
+	err = serviceInterface.DeleteCar(carID, &version)
+	assert.ErrorIs(t, err, services.ErrPrecondition, "Expected ErrPrecondition for a stale deletion")
+
+	// Test that status changes increment the version
+	version = updateResult.Version
+	preparedCar, err := serviceInterface.ChangeCarStatus(carID, models.CarStatusInPreparation, &version)
+	if err != nil {
+		t.Fatalf("ChangeCarStatus failed: %v", err)
+	}
+	assert.Equal(t, int64(3), preparedCar.Version, "Changing the status should increment the version")
+	assert.Equal(t, 18500.0, preparedCar.Price, "The stale update should not have been applied")
+
+	// Test that cars stored before cars were versioned can be changed at version 0
+	if _, err := db.Collection("cars").UpdateOne(context.Background(), bson.M{"_id": carID}, bson.M{"$unset": bson.M{"version": ""}}); err != nil {
+		t.Fatalf("Failed to remove car version: %v", err)
+	}
+	version = 0
+	availableCar, err := serviceInterface.ChangeCarStatus(carID, models.CarStatusAvailable, &version)
+	if err != nil {
+		t.Fatalf("ChangeCarStatus failed: %v", err)
+	}
+	assert.Equal(t, int64(1), availableCar.Version, "Changing an unversioned car should start its version at 1")
+}
+
+// TestPatchCarService tests changing some details of a car with a patch.
+func TestPatchCarService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+
+	// Create a car
+	car := &models.Car{
+		Make:    "Kia",
+		Model:   "Ceed",
+		Year:    2021,
+		Price:   17000,
+		Status:  models.CarStatusAvailable,
+		Picture: "testImage.jpg",
+	}
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(newTestImage(t, 64, 48)), "testImage.jpg")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	carID := result.ID
+
+	// Test patching only the price
+	price := 16500.0
+	patchedCar, err := serviceInterface.PatchCar(carID, models.CarPatch{Price: &price}, nil)
+	if err != nil {
+		t.Fatalf("PatchCar failed: %v", err)
+	}
+	assert.Equal(t, 16500.0, patchedCar.Price, "Car Price does not match")
+	assert.Equal(t, "Ceed", patchedCar.Model, "Car Model should be kept")
+	assert.Equal(t, result.Picture, patchedCar.Picture, "Car Picture should be kept")
+	assert.Equal(t, int64(2), patchedCar.Version, "Patching should increment the version")
+
+	// Test that a patch without changes leaves the version as it is
+	model := "Ceed"
+	unchangedCar, err := serviceInterface.PatchCar(carID, models.CarPatch{Model: &model, Price: &price}, nil)
+	if err != nil {
+		t.Fatalf("PatchCar failed: %v", err)
+	}
+	assert.Equal(t, int64(2), unchangedCar.Version, "A patch without changes should not increment the version")
+
+	// Test that a reserved car cannot be patched
+	customer := models.Customer{FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}
+	if _, err := serviceInterface.ReserveCar(carID, models.ReservationRequest{Customer: customer}, nil); err != nil {
+		t.Fatalf("ReserveCar failed: %v", err)
+	}
+	price = 1
+	_, err = serviceInterface.PatchCar(carID, models.CarPatch{Price: &price}, nil)
+	assert.ErrorIs(t, err, services.ErrCarNotEditable, "Expected ErrCarNotEditable for a reserved car")
+}
+
+func TestCarImagesService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+
+	// Create a car, whose picture starts its gallery
+	car := &models.Car{
+		Make:    "Skoda",
+		Model:   "Octavia",
+		Year:    2022,
+		Price:   24000,
+		Status:  models.CarStatusAvailable,
+		Picture: "testImage.jpg",
+	}
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(newTestImage(t, 64, 48)), "front.jpg")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	carID := result.ID
+	front := result.Picture
+	assert.Equal(t, []models.CarImage{{ID: front, Primary: true}}, result.Images, "The picture should be the primary image of the gallery")
+
+	// Test adding images, one of them as the new primary image
+	withRear, err := serviceInterface.AddCarImage(carID, models.CarImageRequest{Caption: "Rear"}, bytes.NewReader(newTestImage(t, 64, 48)), "rear.jpg", nil)
+	if err != nil {
+		t.Fatalf("AddCarImage failed: %v", err)
+	}
+	rear := withRear.Images[1].ID
+	withInterior, err := serviceInterface.AddCarImage(carID, models.CarImageRequest{Caption: "Interior", Primary: true}, bytes.NewReader(newTestImage(t, 64, 48)), "interior.jpg", nil)
+	if err != nil {
+		t.Fatalf("AddCarImage failed: %v", err)
+	}
+	interior := withInterior.Images[2].ID
+	assert.Len(t, withInterior.Images, 3, "The gallery should hold three images")
+	assert.Equal(t, interior, withInterior.Picture, "The picture should follow the primary image")
+	assert.False(t, withInterior.Images[0].Primary, "The previous primary image should no longer be primary")
+
+	// Test reordering the images and rejecting an order that does not list every image
+	reordered, err := serviceInterface.ReorderCarImages(carID, []string{interior, front, rear}, nil)
+	if err != nil {
+		t.Fatalf("ReorderCarImages failed: %v", err)
+	}
+	assert.Equal(t, interior, reordered.Images[0].ID, "The images should be in the new order")
+	assert.Equal(t, rear, reordered.Images[2].ID, "The images should be in the new order")
+	_, err = serviceInterface.ReorderCarImages(carID, []string{interior, front, front}, nil)
+	assert.ErrorIs(t, err, services.ErrValidation, "Expected ErrValidation for an incomplete order")
+
+	// Test changing a caption
+	caption := "Dashboard"
+	captioned, err := serviceInterface.UpdateCarImage(carID, interior, models.CarImageUpdate{Caption: &caption}, nil)
+	if err != nil {
+		t.Fatalf("UpdateCarImage failed: %v", err)
+	}
+	assert.Equal(t, "Dashboard", captioned.Images[0].Caption, "Caption does not match")
+
+	// Test removing the primary image, which deletes it from GridFS and makes the first remaining image primary
+	removed, err := serviceInterface.RemoveCarImage(carID, interior, nil)
+	if err != nil {
+		t.Fatalf("RemoveCarImage failed: %v", err)
+	}
+	assert.Equal(t, front, removed.Picture, "The first remaining image should become primary")
+	_, err = serviceInterface.GetCarImage(interior, "")
+	assert.ErrorIs(t, err, services.ErrNotFound, "The removed image should be deleted from GridFS")
+
+	// Test that purging the deleted car deletes every image of its gallery
+	if err := serviceInterface.DeleteCar(carID, nil); err != nil {
+		t.Fatalf("DeleteCar failed: %v", err)
+	}
+	if _, err := serviceInterface.PurgeDeletedCars(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeDeletedCars failed: %v", err)
+	}
+	for _, imageID := range []string{front, rear} {
+		_, err = serviceInterface.GetCarImage(imageID, "")
+		assert.ErrorIs(t, err, services.ErrNotFound, "The images of a purged car should be deleted from GridFS")
+	}
+}
+
+// readImage reads and closes the content of an image file.
+func readImage(t *testing.T, file *models.ImageFile) []byte {
+	defer file.Content.Close()
+	data, err := io.ReadAll(file.Content)
+	if err != nil {
+		t.Fatalf("Failed to read image data: %v", err)
+	}
+	return data
+}
+
+// newTestImage encodes a PNG image of the given dimensions.
+func newTestImage(t *testing.T, width, height int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		img.Set(x, height/2, color.RGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageVariantsService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewCarServiceInterface(client, testDbName)
+	var serviceInterface services.IcarService = service
+
+	// Create a car with a large landscape picture
+	original := newTestImage(t, 2000, 1000)
+	car := &models.Car{
+		Make:    "Volvo",
+		Model:   "V60",
+		Year:    2023,
+		Price:   41000,
+		Status:  models.CarStatusAvailable,
+		Picture: "testImage.png",
+	}
+	result, err := serviceInterface.CreateCar(car, bytes.NewReader(original), "testImage.png")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+
+	// Test that every variant is scaled down to its size and the original is kept as it was uploaded
+	for size, maxSide := range models.ImageVariantSizes {
+		file, err := serviceInterface.GetCarImage(result.Picture, size)
+		if err != nil {
+			t.Fatalf("GetCarImage failed for size %s: %v", size, err)
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(readImage(t, file)))
+		if err != nil {
+			t.Fatalf("Failed to decode %s variant: %v", size, err)
+		}
+		assert.Equal(t, "jpeg", format, "Variants should be encoded as JPEG")
+		assert.Equal(t, "image/jpeg", file.ContentType, "Variants should be served as JPEG")
+		assert.Equal(t, maxSide, config.Width, "Variant width does not match its size")
+		assert.Equal(t, maxSide/2, config.Height, "Variant should keep the aspect ratio")
+	}
+	file, err := serviceInterface.GetCarImage(result.Picture, models.ImageSizeOriginal)
+	if err != nil {
+		t.Fatalf("GetCarImage failed: %v", err)
+	}
+	assert.Equal(t, original, readImage(t, file), "The original image should be returned as uploaded")
+	assert.Equal(t, "image/png", file.ContentType, "The original image should be served with its content type")
+
+	// Test that images smaller than a size are returned in their original size
+	small := newTestImage(t, 200, 100)
+	withSmall, err := serviceInterface.AddCarImage(result.ID, models.CarImageRequest{}, bytes.NewReader(small), "small.png", nil)
+	if err != nil {
+		t.Fatalf("AddCarImage failed: %v", err)
+	}
+	file, err = serviceInterface.GetCarImage(withSmall.Images[1].ID, models.ImageSizeThumb)
+	if err != nil {
+		t.Fatalf("GetCarImage failed: %v", err)
+	}
+	assert.Equal(t, small, readImage(t, file), "A small image should be returned in its original size")
+
+	// Test that purging the deleted car deletes its images together with their variants
+	if err := serviceInterface.DeleteCar(result.ID, nil); err != nil {
+		t.Fatalf("DeleteCar failed: %v", err)
+	}
+	if _, err := serviceInterface.PurgeDeletedCars(time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeDeletedCars failed: %v", err)
+	}
+	count, err := db.Collection("fs.files").CountDocuments(context.Background(), bson.M{})
+	if err != nil {
+		t.Fatalf("Failed to count GridFS files: %v", err)
+	}
+	assert.Equal(t, int64(0), count, "Every image and variant should be deleted")
+}
+
+// TestAuthService tests user accounts, logging in and the lifecycle of tokens.
+func TestAuthService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewAuthServiceInterface(client, testDbName, []byte("0123456789abcdef0123456789abcdef"))
+
+	// Test creating the initial user, which only happens once
+	user, err := service.CreateInitialUser(models.UserRequest{Username: "Admin", Password: "correct horse"})
+	if err != nil {
+		t.Fatalf("CreateInitialUser failed: %v", err)
+	}
+	assert.Equal(t, "admin", user.Username, "Usernames should be stored in lower case")
+	assert.Equal(t, models.RoleAdmin, user.Role, "The initial user should be an admin")
+	assert.NotEqual(t, "correct horse", user.PasswordHash, "Passwords should be hashed")
+	again, err := service.CreateInitialUser(models.UserRequest{Username: "other", Password: "correct horse"})
+	assert.NoError(t, err)
+	assert.Nil(t, again, "No user should be created when users exist")
+
+	// Test that usernames are unique regardless of case
+	_, err = service.CreateUser(models.UserRequest{Username: "ADMIN", Password: "battery staple"})
+	assert.ErrorIs(t, err, services.ErrConflict)
+
+	// Test logging in with wrong credentials
+	_, err = service.Login("admin", "wrong password")
+	assert.ErrorIs(t, err, services.ErrUnauthorized)
+	_, err = service.Login("nobody", "correct horse")
+	assert.ErrorIs(t, err, services.ErrUnauthorized)
+
+	// Test logging in and authenticating with the access token
+	tokens, err := service.Login("Admin", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	assert.Equal(t, models.TokenTypeBearer, tokens.TokenType)
+	assert.Equal(t, int64(models.DefaultAccessTokenLifetime/time.Second), tokens.ExpiresIn)
+	principal, err := service.Authenticate(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	assert.Equal(t, models.Principal{UserID: user.ID, Username: "admin", Role: models.RoleAdmin}, *principal)
+
+	// Test that tokens cannot be used as each other or be signed with another key
+	_, err = service.Authenticate(tokens.RefreshToken)
+	assert.ErrorIs(t, err, services.ErrUnauthorized, "A refresh token should not authenticate requests")
+	_, err = service.Refresh(tokens.AccessToken)
+	assert.ErrorIs(t, err, services.ErrUnauthorized, "An access token should not be exchanged for new tokens")
+	forger := services.NewAuthServiceInterface(client, testDbName, []byte("fedcba9876543210fedcba9876543210"))
+	_, err = forger.Authenticate(tokens.AccessToken)
+	assert.ErrorIs(t, err, services.ErrUnauthorized, "Tokens signed with another key should be rejected")
+
+	// Test refreshing the tokens, which can only be done once per refresh token
+	refreshed, err := service.Refresh(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+	_, err = service.Refresh(tokens.RefreshToken)
+	assert.ErrorIs(t, err, services.ErrUnauthorized, "A used refresh token should be rejected")
+
+	// Test that logging out revokes the refresh token
+	if err := service.Logout(refreshed.RefreshToken); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	_, err = service.Refresh(refreshed.RefreshToken)
+	assert.ErrorIs(t, err, services.ErrUnauthorized, "A revoked refresh token should be rejected")
+	assert.NoError(t, service.Logout(refreshed.RefreshToken), "Logging out twice should succeed")
+
+	// Test changing the role of a user, which applies to the tokens issued afterwards
+	jdoe, err := service.CreateUser(models.UserRequest{Username: "jdoe", Password: "battery staple", Role: models.RoleViewer})
+	if err != nil {
+		t.Fatalf("CreateUser failed: %v", err)
+	}
+	promoted, err := service.SetUserRole(jdoe.ID, models.RoleManager)
+	if err != nil {
+		t.Fatalf("SetUserRole failed: %v", err)
+	}
+	assert.Equal(t, models.RoleManager, promoted.Role)
+	tokens, err = service.Login("jdoe", "battery staple")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	principal, err = service.Authenticate(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	assert.Equal(t, models.RoleManager, principal.Role)
+	_, err = service.SetUserRole(user.ID, models.RoleViewer)
+	assert.ErrorIs(t, err, services.ErrConflict, "The last admin should keep their role")
+	_, err = service.SetUserRole(primitive.NewObjectID(), models.RoleViewer)
+	assert.ErrorIs(t, err, services.ErrNotFound)
+
+	// Test listing the users by username
+	users, err := service.GetUsers()
+	if err != nil {
+		t.Fatalf("GetUsers failed: %v", err)
+	}
+	if assert.Len(t, users, 2) {
+		assert.Equal(t, "admin", users[0].Username)
+		assert.Equal(t, "jdoe", users[1].Username)
+	}
+
+	// Test that expired access tokens are rejected
+	service.SetTokenLifetimes(time.Second, time.Hour)
+	tokens, err = service.Login("admin", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	time.Sleep(2 * time.Second)
+	_, err = service.Authenticate(tokens.AccessToken)
+	assert.ErrorIs(t, err, services.ErrUnauthorized, "An expired access token should be rejected")
+}
+
+func TestAPIKeyService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	service := services.NewAuthServiceInterface(client, testDbName, []byte("0123456789abcdef0123456789abcdef"))
+
+	// Test creating a key, which is only stored as a hash
+	created, err := service.CreateAPIKey(models.APIKeyRequest{Name: "Listing syndication", Scopes: []string{models.ScopeInventoryRead}}, "admin")
+	if err != nil {
+		t.Fatalf("CreateAPIKey failed: %v", err)
+	}
+	assert.True(t, strings.HasPrefix(created.Key, models.APIKeyPrefix))
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	assert.NotContains(t, created.KeyHash, created.Key[len(models.APIKeyPrefix):])
+	assert.Equal(t, "admin", created.CreatedBy)
+	assert.Nil(t, created.LastUsedAt)
+
+	// Test authenticating with the key, which records when it was used
+	principal, err := service.AuthenticateAPIKey(created.Key)
+	if err != nil {
+		t.Fatalf("AuthenticateAPIKey failed: %v", err)
+	}
+	assert.Equal(t, models.Principal{APIKeyID: created.ID, Username: "Listing syndication", Scopes: []string{models.ScopeInventoryRead}}, *principal)
+	_, err = service.AuthenticateAPIKey(created.Key + "x")
+	assert.ErrorIs(t, err, services.ErrUnauthorized, "An unknown key should be rejected")
+
+	keys, err := service.GetAPIKeys()
+	if err != nil {
+		t.Fatalf("GetAPIKeys failed: %v", err)
+	}
+	if assert.Len(t, keys, 1) && assert.NotNil(t, keys[0].LastUsedAt, "The use of the key should be recorded") {
+		assert.WithinDuration(t, time.Now(), *keys[0].LastUsedAt, time.Minute)
+	}
+
+	// Test revoking the key, which can be repeated
+	assert.NoError(t, service.RevokeAPIKey(created.ID))
+	assert.NoError(t, service.RevokeAPIKey(created.ID), "Revoking a key twice should succeed")
+	_, err = service.AuthenticateAPIKey(created.Key)
+	assert.ErrorIs(t, err, services.ErrUnauthorized, "A revoked key should be rejected")
+	assert.ErrorIs(t, service.RevokeAPIKey(primitive.NewObjectID()), services.ErrNotFound)
+
+	keys, err = service.GetAPIKeys()
+	if err != nil {
+		t.Fatalf("GetAPIKeys failed: %v", err)
+	}
+	if assert.Len(t, keys, 1) {
+		assert.NotNil(t, keys[0].RevokedAt, "Revoked keys should still be listed")
+	}
+}
+
+// TestAuditService tests that changes to cars and customers are recorded in the audit log with their actor and diff.
+func TestAuditService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	auditService := services.NewAuditServiceInterface(client, testDbName)
+	carService := services.NewCarServiceInterface(client, testDbName)
+	manager := carService.WithActor(models.Actor{Name: "jdoe", Kind: models.ActorKindUser, RequestID: "request-1"})
+	integration := carService.WithActor(models.Actor{Name: "DMS sync", Kind: models.ActorKindAPIKey, RequestID: "request-2"})
+
+	// Create a car, change its price and reserve it
+	car := &models.Car{Make: "Toyota", Model: "Corolla", Year: 2022, Price: 20000, Picture: "testImage.jpg"}
+	created, err := manager.CreateCar(car, bytes.NewReader(newTestImage(t, 64, 48)), "testImage.jpg")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	price := 19500.0
+	if _, err := manager.PatchCar(created.ID, models.CarPatch{Price: &price}, nil); err != nil {
+		t.Fatalf("PatchCar failed: %v", err)
+	}
+	customer := models.Customer{FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}
+	reserved, err := integration.ReserveCar(created.ID, models.ReservationRequest{Customer: customer}, nil)
+	if err != nil {
+		t.Fatalf("ReserveCar failed: %v", err)
+	}
+
+	// Test listing the entries of the car, newest first
+	page, err := auditService.GetAuditEntries(models.AuditQuery{CarID: &created.ID}, models.PageRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAuditEntries failed: %v", err)
+	}
+	if assert.Len(t, page.Items, 3) {
+		reserve, update, create := page.Items[0], page.Items[1], page.Items[2]
+
+		assert.Equal(t, models.CarActionReserve, reserve.Action)
+		assert.Equal(t, "DMS sync", reserve.Actor)
+		assert.Equal(t, models.ActorKindAPIKey, reserve.ActorKind)
+		assert.Equal(t, "request-2", reserve.RequestID)
+		assert.Equal(t, primitive.M{"status": models.CarStatusAvailable}, reserve.Before)
+		assert.Equal(t, models.CarStatusReserved, reserve.After["status"])
+		assert.Contains(t, reserve.After, "customer")
+		assert.Contains(t, reserve.After, "reservation")
+
+		assert.Equal(t, models.AuditActionUpdate, update.Action)
+		assert.Equal(t, primitive.M{"price": 20000.0}, update.Before, "Only the changed fields should be recorded")
+		assert.Equal(t, primitive.M{"price": 19500.0}, update.After)
+
+		assert.Equal(t, models.AuditActionCreate, create.Action)
+		assert.Equal(t, "jdoe", create.Actor)
+		assert.Nil(t, create.Before)
+		assert.Equal(t, "Toyota", create.After["make"])
+	}
+
+	// Test that the customer created with the reservation is recorded as well
+	page, err = auditService.GetAuditEntries(models.AuditQuery{CustomerID: &reserved.Customer.ID}, models.PageRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAuditEntries failed: %v", err)
+	}
+	if assert.Len(t, page.Items, 1) {
+		assert.Equal(t, models.AuditActionCreate, page.Items[0].Action)
+		assert.Equal(t, "DMS sync", page.Items[0].Actor)
+	}
+
+	// Test filtering by actor and time range
+	page, err = auditService.GetAuditEntries(models.AuditQuery{Actor: "jdoe"}, models.PageRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAuditEntries failed: %v", err)
+	}
+	assert.Len(t, page.Items, 2)
+	future := time.Now().Add(time.Hour)
+	page, err = auditService.GetAuditEntries(models.AuditQuery{From: &future}, models.PageRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAuditEntries failed: %v", err)
+	}
+	assert.Empty(t, page.Items)
+
+	// Test that a failed change is not recorded
+	assert.ErrorIs(t, manager.DeleteCar(created.ID, nil), services.ErrInvalidTransition)
+	page, err = auditService.GetAuditEntries(models.AuditQuery{CarID: &created.ID}, models.PageRequest{Limit: 10})
+	if err != nil {
+		t.Fatalf("GetAuditEntries failed: %v", err)
+	}
+	assert.Len(t, page.Items, 3, "Deleting a reserved car fails and should not be recorded")
 }
@@ -0,0 +1,357 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockCustomerService is a mock implementation of the IcustomerService interface
+type MockCustomerService struct {
+	GetCustomersFunc    func(query models.CustomerQuery, page models.PageRequest) (*models.CustomerPage, error)
+	GetCustomerByIDFunc func(id primitive.ObjectID) (*models.Customer, error)
+	CreateCustomerFunc  func(customer models.Customer) (*models.Customer, error)
+	UpdateCustomerFunc  func(id primitive.ObjectID, customer models.Customer) (*models.Customer, error)
+	DeleteCustomerFunc  func(id primitive.ObjectID) error
+	WithActorFunc       func(actor models.Actor) services.IcustomerService
+}
+
+// Implementing the IcustomerService interface methods using function fields in MockCustomerService
+func (m *MockCustomerService) GetCustomers(query models.CustomerQuery, page models.PageRequest) (*models.CustomerPage, error) {
+	return m.GetCustomersFunc(query, page)
+}
+
+func (m *MockCustomerService) GetCustomerByID(id primitive.ObjectID) (*models.Customer, error) {
+	return m.GetCustomerByIDFunc(id)
+}
+
+func (m *MockCustomerService) CreateCustomer(customer models.Customer) (*models.Customer, error) {
+	return m.CreateCustomerFunc(customer)
+}
+
+func (m *MockCustomerService) UpdateCustomer(id primitive.ObjectID, customer models.Customer) (*models.Customer, error) {
+	return m.UpdateCustomerFunc(id, customer)
+}
+
+func (m *MockCustomerService) DeleteCustomer(id primitive.ObjectID) error {
+	return m.DeleteCustomerFunc(id)
+}
+
+func (m *MockCustomerService) WithActor(actor models.Actor) services.IcustomerService {
+	if m.WithActorFunc != nil {
+		return m.WithActorFunc(actor)
+	}
+	return m
+}
+
+func TestGetCustomers(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedQuery models.CustomerQuery
+	mockCustomerService := &MockCustomerService{
+		GetCustomersFunc: func(query models.CustomerQuery, page models.PageRequest) (*models.CustomerPage, error) {
+			receivedQuery = query
+			customer := models.Customer{ID: primitive.NewObjectID(), FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}
+			return &models.CustomerPage{Items: []models.Customer{customer}, NextCursor: "next"}, nil
+		},
+	}
+
+	handlers.SetCustomerService(mockCustomerService)
+
+	t.Run("search customers", func(t *testing.T) {
+		// Creating a request searching by name
+		req, err := http.NewRequest("GET", "/customers?q=john&limit=5", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.GetCustomers(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "john", receivedQuery.Text)
+		var result models.CustomerListResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		if assert.Len(t, result.Items, 1) {
+			assert.NotEmpty(t, result.Items[0].ID)
+			assert.Equal(t, "John Doe", result.Items[0].FullName)
+		}
+		assert.Equal(t, "next", result.NextCursor)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		// Creating a request with an unknown parameter
+		req, err := http.NewRequest("GET", "/customers?email=john.doe@example.com", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.GetCustomers(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "email is not a supported parameter")
+	})
+}
+
+func TestGetCustomerByID(t *testing.T) {
+	// Mocking the customer service with a GetCustomerByID function
+	mockCustomerService := &MockCustomerService{
+		GetCustomerByIDFunc: func(id primitive.ObjectID) (*models.Customer, error) {
+			if id.Hex() == "60d5f60e4f1c000088aa8290" {
+				return &models.Customer{ID: id, FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}, nil
+			}
+			return nil, fmt.Errorf("%w: customer %s does not exist", services.ErrNotFound, id.Hex())
+		},
+	}
+
+	handlers.SetCustomerService(mockCustomerService)
+
+	t.Run("existing customer", func(t *testing.T) {
+		// Creating a request for an existing customer
+		req, err := http.NewRequest("GET", "/customers/60d5f60e4f1c000088aa8290", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa8290"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetCustomerByID(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CustomerResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, models.CustomerResponse{ID: "60d5f60e4f1c000088aa8290", FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}, result)
+	})
+
+	t.Run("unknown customer", func(t *testing.T) {
+		// Creating a request for a customer that does not exist
+		req, err := http.NewRequest("GET", "/customers/60d5f60e4f1c000088aa8291", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa8291"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetCustomerByID(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusNotFound, "customer 60d5f60e4f1c000088aa8291 does not exist")
+	})
+
+	t.Run("invalid customer ID", func(t *testing.T) {
+		// Creating a request with an invalid customer ID
+		req, err := http.NewRequest("GET", "/customers/invalid-id", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetCustomerByID(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid customer ID\n", rr.Body.String())
+	})
+}
+
+func TestCreateCustomer(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	mockCustomerService := &MockCustomerService{
+		CreateCustomerFunc: func(customer models.Customer) (*models.Customer, error) {
+			if customer.Email == "taken@example.com" {
+				return nil, fmt.Errorf("%w: customer 60d5f60e4f1c000088aa8290 already has this email address or phone number", services.ErrConflict)
+			}
+			customer.ID, _ = primitive.ObjectIDFromHex("60d5f60e4f1c000088aa8291")
+			return &customer, nil
+		},
+	}
+
+	handlers.SetCustomerService(mockCustomerService)
+
+	t.Run("valid customer", func(t *testing.T) {
+		// Creating a request with valid customer details
+		body := `{"fullName":"John Doe","email":"john.doe@example.com","phoneNumber":"1234567890"}`
+		req, err := http.NewRequest("POST", "/customers", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.CreateCustomer(rr, req)
+
+		// Checking the response status, headers and body
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		assert.Equal(t, "/customers/60d5f60e4f1c000088aa8291", rr.Header().Get("Location"))
+		var result models.CustomerResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "60d5f60e4f1c000088aa8291", result.ID)
+		assert.Equal(t, "John Doe", result.FullName)
+	})
+
+	t.Run("duplicate customer", func(t *testing.T) {
+		// Creating a request with an email address that belongs to another customer
+		body := `{"fullName":"John Doe","email":"taken@example.com","phoneNumber":"1234567890"}`
+		req, err := http.NewRequest("POST", "/customers", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.CreateCustomer(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusConflict, "conflict: customer 60d5f60e4f1c000088aa8290 already has this email address or phone number")
+	})
+
+	t.Run("invalid customer data", func(t *testing.T) {
+		// Creating a request with an invalid email address
+		body := `{"fullName":"John Doe","email":"invalid-email","phoneNumber":"1234567890"}`
+		req, err := http.NewRequest("POST", "/customers", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.CreateCustomer(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Email is not a valid email address")
+	})
+}
+
+func TestUpdateCustomer(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	mockCustomerService := &MockCustomerService{
+		UpdateCustomerFunc: func(id primitive.ObjectID, customer models.Customer) (*models.Customer, error) {
+			if id.Hex() != "60d5f60e4f1c000088aa8290" {
+				return nil, fmt.Errorf("%w: customer %s does not exist", services.ErrNotFound, id.Hex())
+			}
+			customer.ID = id
+			return &customer, nil
+		},
+	}
+
+	handlers.SetCustomerService(mockCustomerService)
+
+	t.Run("valid customer", func(t *testing.T) {
+		// Creating a request with new customer details
+		body := `{"fullName":"John Smith","email":"john.smith@example.com","phoneNumber":"1234567890"}`
+		req, err := http.NewRequest("PUT", "/customers/60d5f60e4f1c000088aa8290", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa8290"})
+
+		rr := httptest.NewRecorder()
+		handlers.UpdateCustomer(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CustomerResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "John Smith", result.FullName)
+		assert.Equal(t, "john.smith@example.com", result.Email)
+	})
+
+	t.Run("unknown customer", func(t *testing.T) {
+		// Creating a request for a customer that does not exist
+		body := `{"fullName":"John Smith","email":"john.smith@example.com","phoneNumber":"1234567890"}`
+		req, err := http.NewRequest("PUT", "/customers/60d5f60e4f1c000088aa8291", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa8291"})
+
+		rr := httptest.NewRecorder()
+		handlers.UpdateCustomer(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusNotFound, "customer 60d5f60e4f1c000088aa8291 does not exist")
+	})
+
+	t.Run("invalid customer data", func(t *testing.T) {
+		// Creating a request without a name
+		body := `{"email":"john.smith@example.com","phoneNumber":"1234567890"}`
+		req, err := http.NewRequest("PUT", "/customers/60d5f60e4f1c000088aa8290", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa8290"})
+
+		rr := httptest.NewRecorder()
+		handlers.UpdateCustomer(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "FullName is required")
+	})
+}
+
+func TestDeleteCustomer(t *testing.T) {
+	// Mocking the customer service with a DeleteCustomer function
+	mockCustomerService := &MockCustomerService{
+		DeleteCustomerFunc: func(id primitive.ObjectID) error {
+			if id.Hex() == "60d5f60e4f1c000088aa8290" {
+				return nil
+			}
+			return fmt.Errorf("%w: customer %s has reserved cars", services.ErrConflict, id.Hex())
+		},
+	}
+
+	handlers.SetCustomerService(mockCustomerService)
+
+	t.Run("customer without reserved cars", func(t *testing.T) {
+		// Creating a request to delete a customer
+		req, err := http.NewRequest("DELETE", "/customers/60d5f60e4f1c000088aa8290", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa8290"})
+
+		rr := httptest.NewRecorder()
+		handlers.DeleteCustomer(rr, req)
+
+		// Checking the response status
+		assert.Equal(t, http.StatusNoContent, rr.Code)
+	})
+
+	t.Run("customer with reserved cars", func(t *testing.T) {
+		// Creating a request to delete a customer who still has a reserved car
+		req, err := http.NewRequest("DELETE", "/customers/60d5f60e4f1c000088aa8291", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa8291"})
+
+		rr := httptest.NewRecorder()
+		handlers.DeleteCustomer(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusConflict, "conflict: customer 60d5f60e4f1c000088aa8291 has reserved cars")
+	})
+}
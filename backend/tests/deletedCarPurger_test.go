@@ -0,0 +1,41 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeletedCarPurger(t *testing.T) {
+	// Mocking the car service with a PurgeDeletedCars function reporting the cutoff
+	cutoffs := make(chan time.Time, 10)
+	var receivedActor models.Actor
+	mockCarService := &MockCarService{
+		PurgeDeletedCarsFunc: func(deletedBefore time.Time) ([]models.Car, error) {
+			cutoffs <- deletedBefore
+			return nil, nil
+		},
+	}
+	mockCarService.WithActorFunc = func(actor models.Actor) services.IcarService {
+		receivedActor = actor
+		return mockCarService
+	}
+
+	// Starting the purger and waiting for the immediate purge; the schedule itself is covered by TestPeriodicJob
+	retention := 48 * time.Hour
+	purger := services.NewDeletedCarPurger(mockCarService, retention, time.Hour)
+	purger.Start()
+	defer purger.Stop()
+
+	// Checking that the purge is made as the purger and removes cars deleted before the retention period
+	select {
+	case cutoff := <-cutoffs:
+		assert.WithinDuration(t, time.Now().Add(-retention), cutoff, time.Second)
+	case <-time.After(time.Second):
+		t.Fatal("Purger did not purge deleted cars in time")
+	}
+	assert.Equal(t, models.Actor{Name: "deleted-car-purger", Kind: models.ActorKindSystem}, receivedActor)
+}
@@ -0,0 +1,278 @@
+package tests
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// testImageStore runs the checks every ImageStore implementation has to pass.
+func testImageStore(t *testing.T, store services.ImageStore) {
+	data := []byte("stored image data")
+
+	// Test saving an original image and one of its variants
+	id, err := store.Save("car.png", bytes.NewReader(data), services.ImageMetadata{ContentType: "image/png"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	variantID, err := store.Save("thumb-car.png", bytes.NewReader([]byte("thumb")), services.ImageMetadata{
+		ContentType: "image/jpeg",
+		OriginalID:  id,
+		Size:        models.ImageSizeThumb,
+	})
+	if err != nil {
+		t.Fatalf("Save of variant failed: %v", err)
+	}
+	assert.NotEqual(t, id, variantID, "Variants should get their own ID")
+
+	// Test opening the image and reading it from a position within it
+	file, err := store.Open(id)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	assert.Equal(t, id, file.ID)
+	assert.Equal(t, "image/png", file.ContentType)
+	assert.Equal(t, int64(len(data)), file.Size)
+	assert.False(t, file.UploadedAt.IsZero(), "The upload time should be set")
+	if _, err := file.Content.Seek(7, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+	assert.Equal(t, data[7:], readImage(t, file))
+
+	// Test reading the image again from the start
+	file, err = store.Open(id)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	assert.Equal(t, data, readImage(t, file))
+
+	// Test finding the variants of the image
+	variants, err := store.Variants(id)
+	if err != nil {
+		t.Fatalf("Variants failed: %v", err)
+	}
+	assert.Equal(t, map[string]string{models.ImageSizeThumb: variantID}, variants)
+
+	// Test listing the stored files, with variants linked to their original
+	stored, err := store.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	listed := make(map[string]services.StoredImage)
+	for _, image := range stored {
+		listed[image.ID] = image
+	}
+	assert.Contains(t, listed, id)
+	assert.Empty(t, listed[id].OriginalID)
+	assert.False(t, listed[id].UploadedAt.IsZero(), "The upload time should be listed")
+	assert.Equal(t, id, listed[variantID].OriginalID)
+
+	// Test that an upload that fails while it is read leaves nothing behind
+	failing := io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errors.New("connection reset")))
+	_, err = store.Save("broken.png", failing, services.ImageMetadata{ContentType: "image/png"})
+	assert.Error(t, err, "Expected the read error of the upload")
+
+	// Test deleting the images, which can be repeated
+	for _, fileID := range []string{variantID, id, id} {
+		assert.NoError(t, store.Delete(fileID))
+	}
+	_, err = store.Open(id)
+	assert.ErrorIs(t, err, services.ErrNotFound, "Expected ErrNotFound for a deleted image")
+	variants, err = store.Variants(id)
+	assert.NoError(t, err)
+	assert.Empty(t, variants)
+}
+
+// TestDiskImageStore tests keeping images in a local directory.
+func TestDiskImageStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := services.NewDiskImageStore(dir)
+	if err != nil {
+		t.Fatalf("NewDiskImageStore failed: %v", err)
+	}
+	testImageStore(t, store)
+
+	// Verify that no partial uploads were left in the directory
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read image directory: %v", err)
+	}
+	assert.Empty(t, entries, "The image directory should be empty")
+
+	// Test that IDs are never used as paths outside of the directory
+	_, err = store.Open(filepath.Join("..", filepath.Base(dir)))
+	assert.ErrorIs(t, err, services.ErrNotFound)
+}
+
+// TestGridFSImageStoreService tests keeping images in GridFS.
+func TestGridFSImageStoreService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	store, err := services.NewGridFSImageStore(db)
+	if err != nil {
+		t.Fatalf("NewGridFSImageStore failed: %v", err)
+	}
+	testImageStore(t, store)
+}
+
+// TestS3ImageStoreService tests keeping images in an S3-compatible object store. It runs against the MinIO server
+// of the Docker Compose setup, or the one at S3_TEST_ENDPOINT.
+func TestS3ImageStoreService(t *testing.T) {
+	opts := services.S3Options{
+		Endpoint:        "localhost:9000",
+		Bucket:          "car-images-test",
+		AccessKeyID:     "minioadmin",
+		SecretAccessKey: "minioadmin",
+	}
+	if endpoint := os.Getenv("S3_TEST_ENDPOINT"); endpoint != "" {
+		opts.Endpoint = endpoint
+	}
+
+	store, err := services.NewS3ImageStore(opts)
+	if err != nil {
+		t.Fatalf("NewS3ImageStore failed: %v", err)
+	}
+	testImageStore(t, store)
+}
+
+// TestDiskImageStoreCarService tests that cars keep working when their images are kept on disk instead of in GridFS.
+func TestDiskImageStoreCarService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	dir := t.TempDir()
+	store, err := services.NewDiskImageStore(dir)
+	if err != nil {
+		t.Fatalf("NewDiskImageStore failed: %v", err)
+	}
+	service := services.NewCarServiceInterface(client, testDbName)
+	service.SetImageStore(store)
+
+	// Create a car with an image large enough to have variants
+	car := &models.Car{Make: "Toyota", Model: "Corolla", Year: 2022, Price: 20000}
+	result, err := service.CreateCar(car, bytes.NewReader(newTestImage(t, 1000, 500)), "testImage.png")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	assert.FileExists(t, filepath.Join(dir, result.Picture))
+
+	// Verify that the picture and its variants are served from the directory
+	image, err := service.GetCarImage(result.Picture, models.ImageSizeThumb)
+	if err != nil {
+		t.Fatalf("GetCarImage failed: %v", err)
+	}
+	assert.Equal(t, "image/jpeg", image.ContentType)
+	assert.NotEmpty(t, readImage(t, image))
+
+	// Verify that deleting the car deletes its images from the directory
+	if err := service.DeleteCar(result.ID, nil); err != nil {
+		t.Fatalf("DeleteCar failed: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read image directory: %v", err)
+	}
+	assert.Empty(t, entries, "The images of the deleted car should be removed")
+}
+
+// TestImageCheckService tests finding and repairing orphaned and missing car images.
+func TestImageCheckService(t *testing.T) {
+	client, db := setupTestDB(t)
+	defer func() {
+		clearCollection(t, db)
+		client.Disconnect(context.Background())
+	}()
+
+	dir := t.TempDir()
+	store, err := services.NewDiskImageStore(dir)
+	if err != nil {
+		t.Fatalf("NewDiskImageStore failed: %v", err)
+	}
+	service := services.NewCarServiceInterface(client, testDbName)
+	service.SetImageStore(store)
+
+	// Create a car with two images, then lose the second one
+	car, err := service.CreateCar(&models.Car{Make: "Toyota", Model: "Corolla", Year: 2022, Price: 20000}, bytes.NewReader(newTestImage(t, 64, 48)), "front.png")
+	if err != nil {
+		t.Fatalf("CreateCar failed: %v", err)
+	}
+	car, err = service.AddCarImage(car.ID, models.CarImageRequest{Caption: "Rear"}, bytes.NewReader(newTestImage(t, 64, 48)), "rear.png", nil)
+	if err != nil {
+		t.Fatalf("AddCarImage failed: %v", err)
+	}
+	lostID := car.Images[1].ID
+	if err := store.Delete(lostID); err != nil {
+		t.Fatalf("Failed to delete image: %v", err)
+	}
+
+	// Store an image no car refers to from before the grace period, and one that may still be in use by a request in progress
+	orphanID, err := store.Save("orphan.png", bytes.NewReader(newTestImage(t, 64, 48)), services.ImageMetadata{ContentType: "image/png"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	uploadedAt := time.Now().Add(-2 * models.OrphanedImageGracePeriod)
+	if err := os.Chtimes(filepath.Join(dir, orphanID), uploadedAt, uploadedAt); err != nil {
+		t.Fatalf("Failed to age image: %v", err)
+	}
+	recentID, err := store.Save("recent.png", bytes.NewReader(newTestImage(t, 64, 48)), services.ImageMetadata{ContentType: "image/png"})
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Test reporting the problems without repairing them
+	report, err := service.CheckImages(false)
+	if err != nil {
+		t.Fatalf("CheckImages failed: %v", err)
+	}
+	assert.Equal(t, 1, report.CheckedCars)
+	if assert.Len(t, report.OrphanedImages, 1) {
+		assert.Equal(t, orphanID, report.OrphanedImages[0].ID)
+		assert.False(t, report.OrphanedImages[0].Deleted)
+	}
+	assert.Equal(t, []models.MissingCarImage{{CarID: car.ID.Hex(), ImageID: lostID}}, report.MissingImages)
+	assert.FileExists(t, filepath.Join(dir, orphanID))
+
+	// Test repairing the problems
+	report, err = service.CheckImages(true)
+	if err != nil {
+		t.Fatalf("CheckImages failed: %v", err)
+	}
+	if assert.Len(t, report.OrphanedImages, 1) {
+		assert.True(t, report.OrphanedImages[0].Deleted)
+	}
+	assert.Equal(t, []models.MissingCarImage{{CarID: car.ID.Hex(), ImageID: lostID, Removed: true}}, report.MissingImages)
+	assert.NoFileExists(t, filepath.Join(dir, orphanID))
+	assert.FileExists(t, filepath.Join(dir, recentID), "Images within the grace period should be kept")
+
+	repaired, err := service.GetCarByID(car.ID)
+	if err != nil {
+		t.Fatalf("GetCarByID failed: %v", err)
+	}
+	assert.Equal(t, []models.CarImage{car.Images[0]}, repaired.Images)
+	assert.Equal(t, car.Version+1, repaired.Version)
+
+	// Verify that nothing is left to repair
+	report, err = service.CheckImages(false)
+	if err != nil {
+		t.Fatalf("CheckImages failed: %v", err)
+	}
+	assert.Empty(t, report.OrphanedImages)
+	assert.Empty(t, report.MissingImages)
+}
@@ -0,0 +1,258 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockPaymentService is a mock implementation of the IpaymentService interface
+type MockPaymentService struct {
+	GetPaymentsByCarFunc func(carID primitive.ObjectID) ([]models.Payment, error)
+	RecordPaymentFunc    func(carID primitive.ObjectID, payment models.PaymentRequest) (*models.Payment, error)
+	GetBalanceFunc       func(carID primitive.ObjectID) (*models.CarBalance, error)
+	WithActorFunc        func(actor models.Actor) services.IpaymentService
+}
+
+// Implementing the IpaymentService interface methods using function fields in MockPaymentService
+func (m *MockPaymentService) GetPaymentsByCar(carID primitive.ObjectID) ([]models.Payment, error) {
+	return m.GetPaymentsByCarFunc(carID)
+}
+
+func (m *MockPaymentService) RecordPayment(carID primitive.ObjectID, payment models.PaymentRequest) (*models.Payment, error) {
+	return m.RecordPaymentFunc(carID, payment)
+}
+
+func (m *MockPaymentService) GetBalance(carID primitive.ObjectID) (*models.CarBalance, error) {
+	return m.GetBalanceFunc(carID)
+}
+
+func (m *MockPaymentService) WithActor(actor models.Actor) services.IpaymentService {
+	if m.WithActorFunc != nil {
+		return m.WithActorFunc(actor)
+	}
+	return m
+}
+
+func TestGetPayments(t *testing.T) {
+	// Mocking the payment service with a GetPaymentsByCar function
+	depositID := primitive.NewObjectID()
+	mockPaymentService := &MockPaymentService{
+		GetPaymentsByCarFunc: func(carID primitive.ObjectID) ([]models.Payment, error) {
+			if carID.Hex() == "60d5f60e4f1c000088aa828e" {
+				return []models.Payment{
+					{ID: depositID, CarID: carID, Type: models.PaymentTypeDeposit, Method: models.PaymentMethodCard, Amount: 500, CreatedAt: time.Now()},
+					{ID: primitive.NewObjectID(), CarID: carID, Type: models.PaymentTypeRefund, Method: models.PaymentMethodCard, Amount: 500, RefundOf: &depositID, CreatedAt: time.Now()},
+				}, nil
+			}
+			return nil, fmt.Errorf("%w: car %s does not exist", services.ErrNotFound, carID.Hex())
+		},
+	}
+
+	handlers.SetPaymentService(mockPaymentService)
+
+	t.Run("payments of a car", func(t *testing.T) {
+		// Creating a request for a car with payments
+		req, err := http.NewRequest("GET", "/cars/60d5f60e4f1c000088aa828e/payments", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetPayments(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.PaymentListResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		if assert.Len(t, result.Items, 2) {
+			assert.Equal(t, models.PaymentTypeDeposit, result.Items[0].Type)
+			assert.Equal(t, depositID.Hex(), result.Items[1].RefundOf)
+		}
+	})
+
+	t.Run("unknown car", func(t *testing.T) {
+		// Creating a request for a car that does not exist
+		req, err := http.NewRequest("GET", "/cars/60d5f60e4f1c000088aa828f/payments", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetPayments(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusNotFound, "car 60d5f60e4f1c000088aa828f does not exist")
+	})
+
+	t.Run("invalid car ID", func(t *testing.T) {
+		// Creating a request with an invalid car ID
+		req, err := http.NewRequest("GET", "/cars/invalid-id/payments", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetPayments(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid car ID\n", rr.Body.String())
+	})
+}
+
+func TestRecordPayment(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	var receivedActor models.Actor
+	mockPaymentService := &MockPaymentService{
+		RecordPaymentFunc: func(carID primitive.ObjectID, payment models.PaymentRequest) (*models.Payment, error) {
+			if payment.Amount > 1000 {
+				return nil, fmt.Errorf("%w: payments of %.2f exceed the balance due of 1000.00", services.ErrValidation, payment.Amount)
+			}
+			return &models.Payment{ID: primitive.NewObjectID(), CarID: carID, Type: models.PaymentTypeSale, Method: payment.Method, Amount: payment.Amount, CreatedAt: time.Now()}, nil
+		},
+	}
+	mockPaymentService.WithActorFunc = func(actor models.Actor) services.IpaymentService {
+		receivedActor = actor
+		return mockPaymentService
+	}
+
+	handlers.SetPaymentService(mockPaymentService)
+
+	t.Run("valid payment", func(t *testing.T) {
+		// Creating a valid payment request
+		body, _ := json.Marshal(models.PaymentRequest{Amount: 1000, Method: models.PaymentMethodBankTransfer})
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/payments", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.RecordPayment(rr, asRole(req, models.RoleSalesperson))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusCreated, rr.Code)
+		var result models.PaymentResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "60d5f60e4f1c000088aa828e", result.CarID)
+		assert.Equal(t, models.PaymentTypeSale, result.Type)
+		assert.Equal(t, 1000.0, result.Amount)
+
+		// Checking that the payment is recorded in the audit log as taken by the caller
+		assert.Equal(t, models.Actor{Name: "jdoe", Kind: models.ActorKindUser}, receivedActor)
+	})
+
+	t.Run("payment exceeding the balance", func(t *testing.T) {
+		// Creating a payment request the service rejects
+		body, _ := json.Marshal(models.PaymentRequest{Amount: 1500, Method: models.PaymentMethodCash})
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/payments", bytes.NewBuffer(body))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.RecordPayment(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusUnprocessableEntity, "payments of 1500.00 exceed the balance due of 1000.00")
+	})
+
+	t.Run("invalid payment data", func(t *testing.T) {
+		// Creating a payment request without an amount
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/payments", bytes.NewBufferString(`{"method":"cash"}`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.RecordPayment(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "Amount is required")
+	})
+
+	t.Run("invalid body", func(t *testing.T) {
+		// Creating a request with a malformed body
+		req, err := http.NewRequest("POST", "/cars/60d5f60e4f1c000088aa828e/payments", bytes.NewBufferString(`{`))
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.RecordPayment(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid payment data\n", rr.Body.String())
+	})
+}
+
+func TestGetBalance(t *testing.T) {
+	// Mocking the payment service with a GetBalance function
+	mockPaymentService := &MockPaymentService{
+		GetBalanceFunc: func(carID primitive.ObjectID) (*models.CarBalance, error) {
+			if carID.Hex() == "60d5f60e4f1c000088aa828e" {
+				return &models.CarBalance{CarID: carID, Price: 20000, Paid: 2500, BalanceDue: 17500}, nil
+			}
+			return nil, assert.AnError
+		},
+	}
+
+	handlers.SetPaymentService(mockPaymentService)
+
+	t.Run("balance of a car", func(t *testing.T) {
+		// Creating a request for a car with payments
+		req, err := http.NewRequest("GET", "/cars/60d5f60e4f1c000088aa828e/balance", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetBalance(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.CarBalanceResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, models.CarBalanceResponse{CarID: "60d5f60e4f1c000088aa828e", Price: 20000, Paid: 2500, BalanceDue: 17500}, result)
+	})
+
+	t.Run("service error", func(t *testing.T) {
+		// Creating a request for a car that triggers a service error
+		req, err := http.NewRequest("GET", "/cars/60d5f60e4f1c000088aa828f/balance", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetBalance(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusInternalServerError, "An unexpected error occurred")
+	})
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeriodicJob(t *testing.T) {
+	t.Run("immediate job", func(t *testing.T) {
+		// Creating a job counting its runs
+		var mu sync.Mutex
+		runs := 0
+		ran := make(chan struct{}, 10)
+		job := services.NewPeriodicJob(10*time.Millisecond, true, func() {
+			mu.Lock()
+			runs++
+			mu.Unlock()
+			ran <- struct{}{}
+		})
+
+		// Starting the job and waiting for the immediate and one periodic run
+		job.Start()
+		for i := 0; i < 2; i++ {
+			select {
+			case <-ran:
+			case <-time.After(time.Second):
+				t.Fatal("Job did not run in time")
+			}
+		}
+
+		// Checking that no run happens after the job is stopped
+		job.Stop()
+		mu.Lock()
+		stoppedAt := runs
+		mu.Unlock()
+		time.Sleep(30 * time.Millisecond)
+		mu.Lock()
+		assert.Equal(t, stoppedAt, runs)
+		mu.Unlock()
+
+		// Stopping again is a no-op
+		job.Stop()
+	})
+
+	t.Run("delayed job", func(t *testing.T) {
+		// Creating a job recording when it first runs
+		started := time.Now()
+		ran := make(chan time.Time, 10)
+		job := services.NewPeriodicJob(50*time.Millisecond, false, func() {
+			ran <- time.Now()
+		})
+
+		// Starting the job and checking that the first run waits for one interval
+		job.Start()
+		defer job.Stop()
+		select {
+		case first := <-ran:
+			assert.GreaterOrEqual(t, first.Sub(started), 50*time.Millisecond)
+		case <-time.After(time.Second):
+			t.Fatal("Job did not run in time")
+		}
+	})
+}
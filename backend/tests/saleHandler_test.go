@@ -0,0 +1,257 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-playground/validator"
+	"github.com/gorilla/mux"
+	"github.com/lazarpetrovicc/Car-Dealership/handlers"
+	"github.com/lazarpetrovicc/Car-Dealership/models"
+	"github.com/lazarpetrovicc/Car-Dealership/services"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MockSaleService is a mock implementation of the IsaleService interface
+type MockSaleService struct {
+	GetSalesFunc    func(query models.SaleQuery, page models.PageRequest) (*models.SalePage, error)
+	GetSaleByIDFunc func(id primitive.ObjectID) (*models.Sale, error)
+}
+
+// Implementing the IsaleService interface methods using function fields in MockSaleService
+func (m *MockSaleService) GetSales(query models.SaleQuery, page models.PageRequest) (*models.SalePage, error) {
+	return m.GetSalesFunc(query, page)
+}
+
+func (m *MockSaleService) GetSaleByID(id primitive.ObjectID) (*models.Sale, error) {
+	return m.GetSaleByIDFunc(id)
+}
+
+func TestGetSales(t *testing.T) {
+	// Setting up the validator and mock service
+	validate := validator.New()
+	handlers.SetValidator(validate)
+
+	carID, _ := primitive.ObjectIDFromHex("60d5f60e4f1c000088aa828e")
+	var receivedQuery models.SaleQuery
+	var receivedPage models.PageRequest
+	mockSaleService := &MockSaleService{
+		GetSalesFunc: func(query models.SaleQuery, page models.PageRequest) (*models.SalePage, error) {
+			receivedQuery = query
+			receivedPage = page
+			if page.Cursor == "bad" {
+				return nil, services.ErrInvalidCursor
+			}
+			customer := models.Customer{FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}
+			sale := models.Sale{ID: primitive.NewObjectID(), CarID: carID, Car: models.CarSnapshot{Make: "Toyota", ListPrice: 20000}, Customer: customer, Price: 19500, SoldAt: time.Now()}
+			return &models.SalePage{Items: []models.Sale{sale}, NextCursor: "next"}, nil
+		},
+	}
+
+	handlers.SetSaleService(mockSaleService)
+
+	t.Run("sales of a car", func(t *testing.T) {
+		// Creating a request filtering by car and salesperson
+		req, err := http.NewRequest("GET", "/sales?carId=60d5f60e4f1c000088aa828e&salesperson=Ana&limit=5", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.GetSales(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, carID, *receivedQuery.CarID)
+		assert.Equal(t, "Ana", receivedQuery.Salesperson)
+		assert.Equal(t, 5, receivedPage.Limit)
+		var result models.SaleListResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		if assert.Len(t, result.Items, 1) {
+			assert.Equal(t, carID.Hex(), result.Items[0].CarID)
+			assert.Equal(t, 19500.0, result.Items[0].Price)
+			assert.Equal(t, 20000.0, result.Items[0].Car.ListPrice)
+		}
+		assert.Equal(t, "next", result.NextCursor)
+	})
+
+	t.Run("sales of a customer", func(t *testing.T) {
+		// Creating a request filtering by customer
+		req, err := http.NewRequest("GET", "/sales?customerId=60d5f60e4f1c000088aa8290", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.GetSales(rr, asRole(req, models.RoleViewer))
+
+		// Checking the response status, the query and that the customers are returned
+		assert.Equal(t, http.StatusOK, rr.Code)
+		if assert.NotNil(t, receivedQuery.CustomerID) {
+			assert.Equal(t, "60d5f60e4f1c000088aa8290", receivedQuery.CustomerID.Hex())
+		}
+		var result models.SaleListResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		if assert.Len(t, result.Items, 1) && assert.NotNil(t, result.Items[0].Customer) {
+			assert.Equal(t, "John Doe", result.Items[0].Customer.FullName)
+		}
+	})
+
+	t.Run("API key without customers:read", func(t *testing.T) {
+		// Creating a request listing sales with a key that may only read sales
+		req, err := http.NewRequest("GET", "/sales?carId=60d5f60e4f1c000088aa828e", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.GetSales(rr, asAPIKey(req, models.ScopeSalesRead))
+
+		// Checking that the sales are returned without their customers
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.SaleListResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		if assert.Len(t, result.Items, 1) {
+			assert.Nil(t, result.Items[0].Customer)
+		}
+		assert.NotContains(t, rr.Body.String(), "john.doe@example.com")
+	})
+
+	t.Run("customer with an API key without customers:read", func(t *testing.T) {
+		// Creating a request listing the sales of a customer with a key that may only read sales
+		req, err := http.NewRequest("GET", "/sales?customerId=60d5f60e4f1c000088aa8290", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.GetSales(rr, asAPIKey(req, models.ScopeSalesRead))
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusForbidden, "the customers:read scope is required")
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		// Creating a request with an invalid car ID and an unknown parameter
+		req, err := http.NewRequest("GET", "/sales?carId=invalid-id&make=Toyota", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.GetSales(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), "carId must be a valid car ID")
+		assert.Contains(t, rr.Body.String(), "make is not a supported parameter")
+	})
+
+	t.Run("invalid cursor", func(t *testing.T) {
+		// Creating a request with a cursor the service rejects
+		req, err := http.NewRequest("GET", "/sales?cursor=bad", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.GetSales(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusUnprocessableEntity, "cursor is invalid")
+	})
+}
+
+func TestGetSaleByID(t *testing.T) {
+	// Mocking the sale service with a GetSaleByID function
+	mockSaleService := &MockSaleService{
+		GetSaleByIDFunc: func(id primitive.ObjectID) (*models.Sale, error) {
+			if id.Hex() == "60d5f60e4f1c000088aa828e" {
+				customer := models.Customer{FullName: "John Doe", Email: "john.doe@example.com", PhoneNumber: "1234567890"}
+				return &models.Sale{ID: id, Customer: customer, Price: 20000, Paid: 5000, Salesperson: "Ana", SoldAt: time.Now()}, nil
+			}
+			return nil, fmt.Errorf("%w: sale %s does not exist", services.ErrNotFound, id.Hex())
+		},
+	}
+
+	handlers.SetSaleService(mockSaleService)
+
+	t.Run("existing sale", func(t *testing.T) {
+		// Creating a request for an existing sale
+		req, err := http.NewRequest("GET", "/sales/60d5f60e4f1c000088aa828e", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetSaleByID(rr, asRole(req, models.RoleViewer))
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.SaleResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, "60d5f60e4f1c000088aa828e", result.ID)
+		if assert.NotNil(t, result.Customer) {
+			assert.Equal(t, "John Doe", result.Customer.FullName)
+		}
+		assert.Equal(t, 5000.0, result.Paid)
+		assert.Equal(t, "Ana", result.Salesperson)
+	})
+
+	t.Run("API key without customers:read", func(t *testing.T) {
+		// Creating a request for an existing sale with a key that may only read sales
+		req, err := http.NewRequest("GET", "/sales/60d5f60e4f1c000088aa828e", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828e"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetSaleByID(rr, asAPIKey(req, models.ScopeSalesRead))
+
+		// Checking that the sale is returned without its customer
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var result models.SaleResponse
+		json.NewDecoder(rr.Body).Decode(&result)
+		assert.Equal(t, 5000.0, result.Paid)
+		assert.Nil(t, result.Customer)
+		assert.NotContains(t, rr.Body.String(), "john.doe@example.com")
+	})
+
+	t.Run("unknown sale", func(t *testing.T) {
+		// Creating a request for a sale that does not exist
+		req, err := http.NewRequest("GET", "/sales/60d5f60e4f1c000088aa828f", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "60d5f60e4f1c000088aa828f"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetSaleByID(rr, req)
+
+		// Checking the response status and body
+		assertProblem(t, rr, http.StatusNotFound, "sale 60d5f60e4f1c000088aa828f does not exist")
+	})
+
+	t.Run("invalid sale ID", func(t *testing.T) {
+		// Creating a request with an invalid sale ID
+		req, err := http.NewRequest("GET", "/sales/invalid-id", nil)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"id": "invalid-id"})
+
+		rr := httptest.NewRecorder()
+		handlers.GetSaleByID(rr, req)
+
+		// Checking the response status and body
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Equal(t, "Invalid sale ID\n", rr.Body.String())
+	})
+}
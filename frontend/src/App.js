@@ -1,12 +1,19 @@
-import React from 'react';
+import React, { useState, useEffect } from 'react';
 import { BrowserRouter as Router, Route, Routes, Link } from 'react-router-dom';
 import './styles.css';
 import Home from './pages/Home';
 import CarPage from './pages/CarPage';
 import About from './pages/About';
 import NotFound from './pages/NotFound';
+import Login from './pages/Login';
+import { isLoggedIn, onLogout, logout } from './api';
 
 function App() {
+  const [loggedIn, setLoggedIn] = useState(isLoggedIn());
+
+  // Show the login form again when the tokens can no longer be refreshed
+  useEffect(() => onLogout(() => setLoggedIn(false)), []);
+
   return (
     <Router>
       <div className="App">
@@ -22,13 +29,16 @@ function App() {
               <li><Link to="/" aria-label="Home">Home</Link></li>
               <li><Link to="/cars" aria-label="Car Management">Car Management</Link></li>
               <li><Link to="/about" aria-label="About">About</Link></li>
+              {loggedIn && (
+                <li><button className="logout-button" onClick={logout} aria-label="Log out">Log out</button></li>
+              )}
             </ul>
           </nav>
         </header>
         <main className="app-content">
           <Routes>
             <Route path="/" element={<Home />} />
-            <Route path="/cars" element={<CarPage />} />
+            <Route path="/cars" element={loggedIn ? <CarPage /> : <Login onLogin={() => setLoggedIn(true)} />} />
             <Route path="/about" element={<About />} />
             {/* Route for handling 404 Not Found */}
             <Route path="*" element={<NotFound />} />
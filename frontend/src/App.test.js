@@ -1,4 +1,4 @@
-import { render, screen } from '@testing-library/react';
+import { render, screen, fireEvent } from '@testing-library/react';
 import App from './App';
 
 describe('App', () => {
@@ -21,4 +21,14 @@ describe('App', () => {
     expect(carManagementLink).toBeInTheDocument();
     expect(aboutLink).toBeInTheDocument();
   });
+
+  test('asks to log in before managing cars', () => {
+    localStorage.clear();
+    render(<App />);
+
+    // Check if the login form is shown instead of the car management page
+    fireEvent.click(screen.getByLabelText(/Car Management/i));
+    expect(screen.getByRole('button', { name: 'Log in' })).toBeInTheDocument();
+    expect(screen.queryByText(/Add Car/i)).toBeNull();
+  });
 });
\ No newline at end of file
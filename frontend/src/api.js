@@ -0,0 +1,94 @@
+import axios from 'axios';
+
+const apiUrl = process.env.REACT_APP_API_URL;
+
+// Keys the tokens of the logged in user are kept under in localStorage
+const accessTokenKey = 'accessToken';
+const refreshTokenKey = 'refreshToken';
+
+// Listeners notified when the user is logged out, e.g. because the refresh token expired
+const logoutListeners = new Set();
+
+// Refresh in progress, shared by the requests rejected while it runs
+let refreshing = null;
+
+const storeTokens = (tokens) => {
+  localStorage.setItem(accessTokenKey, tokens.accessToken);
+  localStorage.setItem(refreshTokenKey, tokens.refreshToken);
+};
+
+const clearTokens = () => {
+  localStorage.removeItem(accessTokenKey);
+  localStorage.removeItem(refreshTokenKey);
+  logoutListeners.forEach(listener => listener());
+};
+
+export const isLoggedIn = () => localStorage.getItem(refreshTokenKey) !== null;
+
+// onLogout registers a listener called when the user is logged out and returns a function removing it.
+export const onLogout = (listener) => {
+  logoutListeners.add(listener);
+  return () => logoutListeners.delete(listener);
+};
+
+export const login = async (username, password) => {
+  const response = await axios.post(`${apiUrl}/auth/login`, { username, password });
+  storeTokens(response.data);
+};
+
+export const logout = async () => {
+  const refreshToken = localStorage.getItem(refreshTokenKey);
+  clearTokens();
+  if (refreshToken) {
+    try {
+      await axios.post(`${apiUrl}/auth/logout`, { refreshToken });
+    } catch (error) {
+      console.error('Error logging out:', error);
+    }
+  }
+};
+
+// refreshTokens exchanges the refresh token for new tokens, logging the user out when that is no longer possible.
+const refreshTokens = () => {
+  if (!refreshing) {
+    const refreshToken = localStorage.getItem(refreshTokenKey);
+    refreshing = axios.post(`${apiUrl}/auth/refresh`, { refreshToken })
+      .then(response => storeTokens(response.data))
+      .catch(error => {
+        clearTokens();
+        throw error;
+      })
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+// ifMatch returns the If-Match header changes to a car are sent with, so that they are rejected if the car was
+// changed since it was loaded.
+export const ifMatch = (car) => ({ 'If-Match': `"${car.version}"` });
+
+// api is the client every request to the backend is made with. It sends the access token of the logged in user and
+// refreshes the tokens once when a request is rejected because the access token expired.
+const api = axios.create({ baseURL: apiUrl });
+
+api.interceptors.request.use(config => {
+  const accessToken = localStorage.getItem(accessTokenKey);
+  if (accessToken) {
+    config.headers.Authorization = `Bearer ${accessToken}`;
+  }
+  return config;
+});
+
+api.interceptors.response.use(undefined, async error => {
+  const config = error.config;
+  if (error.response?.status !== 401 || !config || config.retried || !isLoggedIn()) {
+    throw error;
+  }
+  config.retried = true;
+  await refreshTokens();
+  return api(config);
+});
+
+export default api;
@@ -1,10 +1,9 @@
 import React, { useState, useEffect } from 'react';
-import axios from 'axios';
+import api, { ifMatch } from '../api';
 import '../styles.css';
 import carStatuses from '../constants/carStatuses';
 
 const CarForm = ({ carToEdit, onSubmit, onClose }) => {
-  const apiUrl = process.env.REACT_APP_API_URL;
   const [make, setMake] = useState('');
   const [model, setModel] = useState('');
   const [year, setYear] = useState('');
@@ -57,15 +56,16 @@ const CarForm = ({ carToEdit, onSubmit, onClose }) => {
       let response;
       if (carToEdit) {
         // Update existing car
-        response = await axios.put(`${apiUrl}/cars/${carToEdit.id}`, formData, {
+        response = await api.put(`/cars/${carToEdit.id}`, formData, {
           headers: {
             'Content-Type': 'multipart/form-data',
+            ...ifMatch(carToEdit),
           },
         });
         console.log('Car updated:', response.data); // Logging the response data
       } else {
         // Add new car
-        response = await axios.post(`${apiUrl}/cars`, formData, {
+        response = await api.post('/cars', formData, {
           headers: {
             'Content-Type': 'multipart/form-data', // Logging the response data
           },
@@ -130,7 +130,7 @@ const CarForm = ({ carToEdit, onSubmit, onClose }) => {
             type="file"
             id="picture"
             onChange={handleFileChange}
-            accept=".jpg,.jpeg,.png"
+            accept="image/jpeg,image/png,image/webp"
             required
           />
           <br />
@@ -1,5 +1,5 @@
 import React, { useState, useEffect, useCallback } from 'react';
-import axios from 'axios';
+import api from '../api';
 import ReservationAndSaleForm from './ReservationAndSaleForm';
 import ConfirmActionModal from './ConfirmActionModal';
 import '../styles.css';
@@ -16,7 +16,7 @@ const CarList = ({ cars, onEdit, onActionComplete }) => {
 
   // Memoize the fetchCarImage function to avoid unnecessary re-renders
   const fetchCarImage = useCallback((carId, pictureId) => {
-    axios.get(`${apiUrl}/cars/image/${pictureId}`, { responseType: 'blob' })
+    api.get(`/cars/image/${pictureId}?size=thumb`, { responseType: 'blob' })
       .then(response => {
         const imageUrl = URL.createObjectURL(response.data);
         setCarImages(prevState => ({ ...prevState, [carId]: imageUrl }));
@@ -24,7 +24,7 @@ const CarList = ({ cars, onEdit, onActionComplete }) => {
       .catch(error => {
         console.error('Error fetching car image:', error);
       });
-  }, [apiUrl]);
+  }, []);
 
   useEffect(() => {
     cars.forEach(car => {
@@ -83,7 +83,7 @@ const CarList = ({ cars, onEdit, onActionComplete }) => {
       <ul>
         {cars.map(car => (
           <li key={car.id} className={`car-status-${car.status}`}>
-            <a href={carImages[car.id]} target="_blank" rel="noopener noreferrer" onClick={() => openFullSizeImage(carImages[car.id])}>
+            <a href={`${apiUrl}/cars/image/${car.picture}?size=large`} target="_blank" rel="noopener noreferrer" onClick={() => openFullSizeImage(`${apiUrl}/cars/image/${car.picture}?size=large`)}>
               <img src={carImages[car.id]} alt={`${car.make} ${car.model}`} />
             </a>
             <div className="car-details">
@@ -104,6 +104,11 @@ const CarList = ({ cars, onEdit, onActionComplete }) => {
                     <strong>Reserved by:</strong> {car.customer.fullName}<br />
                     <strong>Email:</strong> {car.customer.email}<br />
                     <strong>Phone:</strong> {car.customer.phoneNumber}
+                    {car.reservation && (
+                      <>
+                        <br /><strong>Reserved until:</strong> {new Date(car.reservation.expiresAt).toLocaleString()}
+                      </>
+                    )}
                   </span>
                   <button className="action-button" onClick={() => handleAction(car, actions.cancelAction)}>Cancel Reservation</button>
                 </div>
@@ -1,10 +1,9 @@
 import React, { useState } from 'react';
-import axios from 'axios';
+import api, { ifMatch } from '../api';
 import '../styles.css';
 import actions from '../constants/actions';
 
 const ConfirmActionModal = ({ isOpen, onClose, action, car, onActionComplete }) => {
-  const apiUrl = process.env.REACT_APP_API_URL;
   const [error, setError] = useState(null);
 
   const handleSubmit = () => {
@@ -17,7 +16,7 @@ const ConfirmActionModal = ({ isOpen, onClose, action, car, onActionComplete })
   };
 
   const deleteCar = (car) => {
-    axios.delete(`${apiUrl}/cars/${car.id}`)
+    api.delete(`/cars/${car.id}`, { headers: ifMatch(car) })
       .then(response => {
         console.log('Car deleted:', response.data);
         onActionComplete(); // Callback to refresh or update the car list
@@ -30,7 +29,7 @@ const ConfirmActionModal = ({ isOpen, onClose, action, car, onActionComplete })
   };
 
   const cancelReservation = (car) => {
-    axios.post(`${apiUrl}/cars/${car.id}/cancel-reservation`)
+    api.post(`/cars/${car.id}/cancel-reservation`, null, { headers: ifMatch(car) })
       .then(response => {
         console.log('Reservation canceled:', response.data);
         onActionComplete(); // Callback to refresh or update the car list
@@ -1,10 +1,9 @@
 import React, { useState } from 'react';
-import axios from 'axios';
+import api, { ifMatch } from '../api';
 import '../styles.css';
 import actions from '../constants/actions';
 
 const ReservationAndSaleForm = ({ isOpen, onClose, action, car, onActionComplete }) => {
-  const apiUrl = process.env.REACT_APP_API_URL;
   const [customerFullName, setCustomerFullName] = useState('');
   const [customerEmail, setCustomerEmail] = useState('');
   const [phoneNumber, setPhoneNumber] = useState('');
@@ -33,7 +32,7 @@ const ReservationAndSaleForm = ({ isOpen, onClose, action, car, onActionComplete
   };
 
   const reserveCar = (car, customer) => {
-    axios.post(`${apiUrl}/cars/${car.id}/reserve`, customer)
+    api.post(`/cars/${car.id}/reserve`, customer, { headers: ifMatch(car) })
       .then(response => {
         console.log('Car reserved:', response.data);
         onActionComplete();
@@ -46,7 +45,7 @@ const ReservationAndSaleForm = ({ isOpen, onClose, action, car, onActionComplete
   };
 
   const sellCar = (car, customer) => {
-    axios.post(`${apiUrl}/cars/${car.id}/sell`, customer)
+    api.post(`/cars/${car.id}/sell`, customer, { headers: ifMatch(car) })
       .then(response => {
         console.log('Car sold:', response.data);
         onActionComplete();
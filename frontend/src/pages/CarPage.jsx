@@ -1,5 +1,5 @@
 import React, { useState, useEffect, useCallback } from 'react';
-import axios from 'axios';
+import api from '../api';
 import CarList from '../components/CarList';
 import CarForm from '../components/CarForm';
 import Tab from '../components/Tab';
@@ -7,7 +7,6 @@ import '../styles.css';
 import carStatuses from '../constants/carStatuses';
 
 const CarPage = () => {
-  const apiUrl = process.env.REACT_APP_API_URL;
   const [cars, setCars] = useState([]);
   const [currentTab, setCurrentTab] = useState(carStatuses.StatusAvailable); // State to manage tabs (available, reserved, sold)
   const [isModalOpen, setIsModalOpen] = useState(false);
@@ -16,13 +15,22 @@ const CarPage = () => {
 
   const fetchCars = useCallback(async (status) => {
     try {
-      const response = await axios.get(`${apiUrl}/cars/${status}`);
-      setCars(response.data);
+      // Follow the page cursors until every car with the status has been fetched
+      const allCars = [];
+      let cursor = '';
+      do {
+        const response = await api.get(`/cars/status/${status}`, {
+          params: cursor ? { limit: 100, cursor } : { limit: 100 },
+        });
+        allCars.push(...response.data.items);
+        cursor = response.data.nextCursor;
+      } while (cursor);
+      setCars(allCars);
     } catch (error) {
       console.error('Error fetching cars:', error);
       setError('Failed to fetch cars. Please try again later.');
     }
-  }, [apiUrl]);
+  }, []);
 
   useEffect(() => {
     fetchCars(currentTab);
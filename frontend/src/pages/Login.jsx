@@ -0,0 +1,58 @@
+import React, { useState } from 'react';
+import { login } from '../api';
+import '../styles.css';
+
+const Login = ({ onLogin }) => {
+  const [username, setUsername] = useState('');
+  const [password, setPassword] = useState('');
+  const [error, setError] = useState(null);
+
+  const handleSubmit = async (event) => {
+    event.preventDefault();
+    setError(null); // Clear any previous errors
+
+    try {
+      await login(username, password);
+      setPassword('');
+      onLogin();
+    } catch (error) {
+      console.error('Error logging in:', error);
+      if (error.response?.status === 401) {
+        setError('Invalid username or password.');
+      } else {
+        setError('Failed to log in. Please try again later.');
+      }
+    }
+  };
+
+  return (
+    <div className="login-page">
+      <h2>Log in</h2>
+      <p className="login-text">Log in with your staff account to manage the car inventory.</p>
+      {error && <div className="error-message">{error}</div>}
+      <form onSubmit={handleSubmit}>
+        <label htmlFor="username">Username:</label>
+        <input
+          type="text"
+          id="username"
+          value={username}
+          onChange={(e) => setUsername(e.target.value)}
+          autoComplete="username"
+          required
+        />
+        <label htmlFor="password">Password:</label>
+        <input
+          type="password"
+          id="password"
+          value={password}
+          onChange={(e) => setPassword(e.target.value)}
+          autoComplete="current-password"
+          required
+        />
+        <button type="submit">Log in</button>
+      </form>
+    </div>
+  );
+};
+
+export default Login;
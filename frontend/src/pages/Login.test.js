@@ -0,0 +1,48 @@
+import { render, screen, fireEvent, waitFor } from '@testing-library/react';
+import Login from './Login';
+import { login } from '../api';
+
+jest.mock('../api');
+
+describe('Login Page', () => {
+  afterEach(() => {
+    jest.resetAllMocks();
+  });
+
+  test('renders the login form', () => {
+    render(<Login onLogin={() => {}} />);
+
+    // Check if the heading and the credential fields are rendered
+    expect(screen.getByRole('heading', { level: 2 })).toHaveTextContent('Log in');
+    expect(screen.getByLabelText(/Username/i)).toBeInTheDocument();
+    expect(screen.getByLabelText(/Password/i)).toBeInTheDocument();
+  });
+
+  test('logs in with the entered credentials', async () => {
+    login.mockResolvedValue();
+    const onLogin = jest.fn();
+    render(<Login onLogin={onLogin} />);
+
+    fireEvent.change(screen.getByLabelText(/Username/i), { target: { value: 'jdoe' } });
+    fireEvent.change(screen.getByLabelText(/Password/i), { target: { value: 'correct horse' } });
+    fireEvent.click(screen.getByRole('button', { name: 'Log in' }));
+
+    // Check if the credentials are sent and the login is reported
+    await waitFor(() => expect(onLogin).toHaveBeenCalled());
+    expect(login).toHaveBeenCalledWith('jdoe', 'correct horse');
+  });
+
+  test('shows an error for invalid credentials', async () => {
+    login.mockRejectedValue({ response: { status: 401 } });
+    const onLogin = jest.fn();
+    render(<Login onLogin={onLogin} />);
+
+    fireEvent.change(screen.getByLabelText(/Username/i), { target: { value: 'jdoe' } });
+    fireEvent.change(screen.getByLabelText(/Password/i), { target: { value: 'wrong password' } });
+    fireEvent.click(screen.getByRole('button', { name: 'Log in' }));
+
+    // Check if the error is shown and the login is not reported
+    expect(await screen.findByText('Invalid username or password.')).toBeInTheDocument();
+    expect(onLogin).not.toHaveBeenCalled();
+  });
+});